@@ -0,0 +1,111 @@
+// Package auth provides the primitives behind user accounts: password
+// hashing, opaque session tokens and signed cookie values.
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// MinPasswordLength is the shortest password accepted at registration.
+const MinPasswordLength = 8
+
+// ErrPasswordTooShort is returned by HashPassword for passwords shorter than MinPasswordLength.
+var ErrPasswordTooShort = errors.New("password must be at least 8 characters")
+
+// ErrPasswordTooLong is returned by HashPassword for passwords bcrypt cannot hash.
+var ErrPasswordTooLong = errors.New("password must be at most 72 bytes")
+
+// HashPassword returns a bcrypt hash of password suitable for storage.
+func HashPassword(password string) (string, error) {
+	if len(password) < MinPasswordLength {
+		return "", ErrPasswordTooShort
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if errors.Is(err, bcrypt.ErrPasswordTooLong) {
+		return "", ErrPasswordTooLong
+	}
+	return string(hash), err
+}
+
+// CheckPassword reports whether password matches the stored hash.
+func CheckPassword(hash, password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
+
+// dummyHash is compared against when a login names an unknown user, so that
+// failed logins take the same time whether or not the account exists.
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("not-a-real-password"), bcrypt.DefaultCost)
+
+// CheckNoPassword burns the same time as CheckPassword and always fails.
+func CheckNoPassword(password string) bool {
+	bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+	return false
+}
+
+// NewToken returns a random, URL-safe session token and the hash to store for it.
+func NewToken() (token, hash string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token = base64.RawURLEncoding.EncodeToString(b)
+	return token, HashToken(token), nil
+}
+
+// HashToken returns the storage hash of a session token.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Signer produces and verifies HMAC-SHA256 signed cookie values, so a value
+// handed to the browser cannot be forged or altered.
+type Signer struct {
+	key []byte
+}
+
+// NewSigner returns a Signer using key. An empty key gets a random one,
+// which means signatures stop verifying when the process restarts.
+func NewSigner(key []byte) (*Signer, error) {
+	if len(key) == 0 {
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+	}
+	return &Signer{key: key}, nil
+}
+
+// Sign returns value followed by a dot and its signature.
+func (s *Signer) Sign(value string) string {
+	return value + "." + s.mac(value)
+}
+
+// Verify returns the value inside a string produced by Sign, and false if
+// the signature does not match.
+func (s *Signer) Verify(signed string) (string, bool) {
+	i := strings.LastIndexByte(signed, '.')
+	if i < 0 {
+		return "", false
+	}
+	value, sig := signed[:i], signed[i+1:]
+	if !hmac.Equal([]byte(sig), []byte(s.mac(value))) {
+		return "", false
+	}
+	return value, true
+}
+
+// mac returns the URL-safe HMAC of value.
+func (s *Signer) mac(value string) string {
+	m := hmac.New(sha256.New, s.key)
+	m.Write([]byte(value))
+	return base64.RawURLEncoding.EncodeToString(m.Sum(nil))
+}
@@ -0,0 +1,103 @@
+// Package broker fans out notices that a user's todos changed to every open
+// page of that user, so each can reload what it shows. It is entirely
+// in-process: notices reach the subscribers of this server instance only.
+package broker
+
+import "sync"
+
+// Event tells that the todos of a user changed.
+type Event struct {
+	UserID int
+	TodoID int    // Todo changed, or 0 for changes to several or to a list or tag
+	Action string // Request that made the change, such as "POST /todos/{id}/toggle"
+	Origin string // Tab the change was made from, which already shows it; empty if unknown
+}
+
+// Broker delivers each published event to the subscriptions of its user.
+// Publishing never blocks: a subscriber that hasn't taken its previous event
+// yet has the two merged into one, since either asks it to reload the same
+// todos. The zero value is ready to use.
+type Broker struct {
+	mu   sync.Mutex
+	subs map[int]map[*Subscription]struct{} // By user ID
+}
+
+// Subscription receives the events of one user until it is closed.
+type Subscription struct {
+	// C delivers the events. It holds at most one pending event and is
+	// never closed, so receive from it alongside a done channel.
+	C      <-chan Event
+	c      chan Event
+	userID int
+	tab    string
+	b      *Broker
+}
+
+// Subscribe starts receiving the events of a user. Events originating from
+// tab are skipped, as that tab already shows its own changes. The caller
+// must Close the subscription when done with it.
+func (b *Broker) Subscribe(userID int, tab string) *Subscription {
+	c := make(chan Event, 1)
+	s := &Subscription{C: c, c: c, userID: userID, tab: tab, b: b}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.subs == nil {
+		b.subs = map[int]map[*Subscription]struct{}{}
+	}
+	if b.subs[userID] == nil {
+		b.subs[userID] = map[*Subscription]struct{}{}
+	}
+	b.subs[userID][s] = struct{}{}
+	return s
+}
+
+// Close stops the subscription. It is safe to call more than once.
+func (s *Subscription) Close() {
+	s.b.mu.Lock()
+	defer s.b.mu.Unlock()
+	delete(s.b.subs[s.userID], s)
+	if len(s.b.subs[s.userID]) == 0 {
+		delete(s.b.subs, s.userID)
+	}
+}
+
+// Publish delivers e to the subscriptions of its user without waiting for
+// any of them.
+func (b *Broker) Publish(e Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for s := range b.subs[e.UserID] {
+		if e.Origin != "" && e.Origin == s.tab {
+			continue
+		}
+		s.deliver(e)
+	}
+}
+
+// Resync delivers an event to every subscription, whatever its user, for
+// when events may have been lost and every page should reload.
+func (b *Broker) Resync() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for userID, subs := range b.subs {
+		for s := range subs {
+			s.deliver(Event{UserID: userID})
+		}
+	}
+}
+
+// deliver queues e, merging it with the event already pending, if any.
+// Only Publish sends on s.c, under the broker's lock, so once the pending
+// event is taken out the send cannot fail.
+func (s *Subscription) deliver(e Event) {
+	select {
+	case s.c <- e:
+	default:
+		select {
+		case <-s.c:
+		default:
+		}
+		s.c <- e
+	}
+}
@@ -0,0 +1,61 @@
+package broker
+
+import "testing"
+
+// pending returns the event waiting on s, if any, without blocking.
+func pending(s *Subscription) (Event, bool) {
+	select {
+	case e := <-s.C:
+		return e, true
+	default:
+		return Event{}, false
+	}
+}
+
+func TestBroker(t *testing.T) {
+	var b Broker
+	tab := b.Subscribe(1, "tab")
+	other := b.Subscribe(1, "other")
+	stranger := b.Subscribe(2, "tab")
+	defer other.Close()
+	defer stranger.Close()
+
+	// A tab doesn't hear of its own changes, nor of other users'
+	b.Publish(Event{UserID: 1, TodoID: 7, Origin: "tab"})
+	if e, ok := pending(tab); ok {
+		t.Errorf("the tab that made the change got %+v", e)
+	}
+	if e, ok := pending(other); !ok || e.TodoID != 7 {
+		t.Errorf("the other tab got %+v, %v, want the change to todo 7", e, ok)
+	}
+	if e, ok := pending(stranger); ok {
+		t.Errorf("another user got %+v", e)
+	}
+
+	// Publishing to a subscriber that doesn't keep up merges the events
+	// rather than blocking
+	for id := 1; id <= 3; id++ {
+		b.Publish(Event{UserID: 1, TodoID: id})
+	}
+	if e, ok := pending(tab); !ok || e.TodoID != 3 {
+		t.Errorf("after three changes the tab got %+v, %v, want the last one", e, ok)
+	}
+	if e, ok := pending(tab); ok {
+		t.Errorf("a second event %+v is pending", e)
+	}
+	pending(other)
+
+	// Resync reaches everyone, and closing stops delivery
+	tab.Close()
+	tab.Close()
+	b.Resync()
+	if e, ok := pending(tab); ok {
+		t.Errorf("a closed subscription got %+v", e)
+	}
+	if e, ok := pending(stranger); !ok || e.UserID != 2 {
+		t.Errorf("resync gave another user %+v, %v", e, ok)
+	}
+	if _, ok := b.subs[1][tab]; ok || len(b.subs[1]) != 1 {
+		t.Errorf("subscriptions of user 1 after closing one: %v", b.subs[1])
+	}
+}
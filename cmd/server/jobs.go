@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/Tottitov/todo/store"
+)
+
+// every runs job immediately and then once per interval until ctx is done.
+// Failures are logged and retried on the next tick.
+func every(ctx context.Context, interval time.Duration, name string, job func(context.Context) error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := job(ctx); err != nil {
+			log.Printf("%s: %v", name, err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// purgeAnonymousUsers returns a job deleting anonymous lists idle for longer than ttl.
+func purgeAnonymousUsers(users store.UserStore, ttl time.Duration) func(context.Context) error {
+	return func(ctx context.Context) error {
+		n, err := users.DeleteIdleAnonymousUsers(ctx, time.Now().Add(-ttl))
+		if n > 0 {
+			log.Printf("purged %d idle anonymous list(s)", n)
+		}
+		return err
+	}
+}
+
+// purgeTrash returns a job deleting todos that have been in the trash for
+// longer than retention.
+func purgeTrash(todos store.TodoStore, retention time.Duration) func(context.Context) error {
+	return func(ctx context.Context) error {
+		n, err := todos.PurgeTrash(ctx, time.Now().Add(-retention))
+		if n > 0 {
+			log.Printf("purged %d todo(s) from the trash", n)
+		}
+		return err
+	}
+}
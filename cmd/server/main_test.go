@@ -0,0 +1,43 @@
+package main
+
+import "testing"
+
+// TestAnonymousSigner checks that anonymous lists need a secret, which
+// every instance shares to verify each other's cookies.
+func TestAnonymousSigner(t *testing.T) {
+	t.Setenv("ANONYMOUS_SECRET", "")
+	if _, err := anonymousSigner(); err == nil {
+		t.Error("anonymousSigner without ANONYMOUS_SECRET succeeded")
+	}
+
+	t.Setenv("ANONYMOUS_SECRET", "shared")
+	a, err := anonymousSigner()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := anonymousSigner()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, ok := b.Verify(a.Sign("42")); !ok || v != "42" {
+		t.Errorf("a cookie signed with the same secret verified as %q, %v", v, ok)
+	}
+}
+
+// TestUIDDomain checks that exported UIDs are in the domain of BASE_URL,
+// localhost by default.
+func TestUIDDomain(t *testing.T) {
+	t.Setenv("BASE_URL", "")
+	for base, want := range map[string]string{
+		"https://todo.example.com":       "todo.example.com",
+		"https://Todo.example.com:8443/": "Todo.example.com",
+		baseURL("8080"):                  "localhost",
+	} {
+		if got, err := uidDomain(base); err != nil || got != want {
+			t.Errorf("uidDomain(%q) = %q, %v, want %q", base, got, err, want)
+		}
+	}
+	if _, err := uidDomain("todo.example.com"); err == nil {
+		t.Error("uidDomain of a URL without a scheme succeeded")
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/Tottitov/todo/migrate"
+	"github.com/Tottitov/todo/store"
+)
+
+const migrateUsage = `usage: server migrate <command>
+
+commands:
+  status     list migrations and whether they have been applied
+  up         apply all pending migrations
+  down [n]   revert the last n applied migrations (default 1)
+  redo       revert and re-apply the last applied migration
+  claim <email>
+             give the todos created before accounts existed to the
+             account registered with email`
+
+// runMigrate implements the "migrate" subcommand against the store named by DATABASE_URL.
+func runMigrate(args []string) error {
+	fs := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	fs.Usage = func() { fmt.Fprintln(fs.Output(), migrateUsage) }
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errors.New("migrate: missing command")
+	}
+
+	ctx := context.Background()
+	todoStore, err := store.Open(ctx, databaseURL())
+	if err != nil {
+		return err
+	}
+	defer todoStore.Close()
+
+	m, err := migrator(todoStore)
+	if err != nil {
+		return err
+	}
+	if m == nil {
+		return errors.New("migrate: this store has no schema to migrate")
+	}
+
+	switch cmd := fs.Arg(0); cmd {
+	case "status":
+		statuses, err := m.Status(ctx)
+		if err != nil {
+			return err
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "VERSION\tNAME\tAPPLIED")
+		for _, s := range statuses {
+			applied := "pending"
+			if s.AppliedAt != nil {
+				applied = s.AppliedAt.Local().Format("2006-01-02 15:04:05")
+			}
+			fmt.Fprintf(tw, "%04d\t%s\t%s\n", s.Version, s.Name, applied)
+		}
+		return tw.Flush()
+	case "up":
+		n, err := m.Up(ctx)
+		log.Printf("applied %d migration(s)", n)
+		return err
+	case "down":
+		steps := 1
+		if fs.NArg() > 1 {
+			if steps, err = strconv.Atoi(fs.Arg(1)); err != nil || steps < 1 {
+				return fmt.Errorf("migrate: invalid step count %q", fs.Arg(1))
+			}
+		}
+		n, err := m.Down(ctx, steps)
+		log.Printf("reverted %d migration(s)", n)
+		return err
+	case "redo":
+		if err := m.Redo(ctx); err != nil {
+			return err
+		}
+		log.Print("re-applied the last migration")
+		return nil
+	case "claim":
+		if fs.NArg() != 2 {
+			fs.Usage()
+			return errors.New("migrate: claim needs the email of the account to give the todos to")
+		}
+		return claimOrphans(ctx, todoStore, fs.Arg(1))
+	default:
+		fs.Usage()
+		return fmt.Errorf("migrate: unknown command %q", cmd)
+	}
+}
+
+// migrateOnStart applies pending migrations before the server starts listening.
+func migrateOnStart(ctx context.Context, todoStore store.Store) error {
+	m, err := migrator(todoStore)
+	if err != nil || m == nil {
+		return err
+	}
+	n, err := m.Up(ctx)
+	if n > 0 {
+		log.Printf("applied %d migration(s)", n)
+	}
+	if err != nil {
+		return err
+	}
+	warnOrphans(ctx, todoStore)
+	return nil
+}
+
+// claimOrphans gives the todos without an owner to the account registered
+// with email.
+func claimOrphans(ctx context.Context, todoStore store.Store, email string) error {
+	oc, ok := todoStore.(store.OrphanClaimer)
+	if !ok {
+		return errors.New("migrate: this store has no todos from before accounts")
+	}
+	user, err := todoStore.GetUserByEmail(ctx, strings.ToLower(email))
+	if errors.Is(err, store.ErrNotFound) {
+		return fmt.Errorf("migrate: no account is registered with %s", email)
+	}
+	if err != nil {
+		return err
+	}
+	n, err := oc.ClaimOrphans(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+	log.Printf("gave %d todo(s) to %s", n, user.Email)
+	return nil
+}
+
+// warnOrphans logs how to claim the todos created before accounts existed,
+// which nobody can see until an account does.
+func warnOrphans(ctx context.Context, todoStore store.Store) {
+	oc, ok := todoStore.(store.OrphanClaimer)
+	if !ok {
+		return
+	}
+	n, err := oc.Orphans(ctx)
+	if err != nil {
+		log.Printf("unable to count todos without an owner: %v", err)
+		return
+	}
+	if n > 0 {
+		log.Printf("%d todo(s) created before accounts existed have no owner; run \"server migrate claim <email>\" to give them to an account", n)
+	}
+}
+
+// migrator returns the store's migrator, or nil if the store has no schema.
+func migrator(todoStore store.Store) (*migrate.Migrator, error) {
+	ms, ok := todoStore.(store.Migratable)
+	if !ok {
+		return nil, nil
+	}
+	return ms.Migrator()
+}
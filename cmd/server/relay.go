@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/Tottitov/todo/broker"
+	"github.com/Tottitov/todo/store"
+)
+
+const (
+	// relayMinDelay is how long to wait before listening again after the
+	// connection was lost, doubling with every failure up to relayMaxDelay.
+	relayMinDelay = time.Second
+	relayMaxDelay = 30 * time.Second
+	// relayTimeout bounds sending one change.
+	relayTimeout = 5 * time.Second
+	// relayQueue is how many changes can wait to be sent.
+	relayQueue = 256
+)
+
+// relay publishes events through the store's notifications, reaching the
+// brokers of every server instance sharing the database, this one included.
+// Events are sent in the background, in the order they were published, so
+// that publishing doesn't hold up the request that made the change.
+type relay struct {
+	notifier store.Notifier
+	local    *broker.Broker
+	queue    chan broker.Event
+}
+
+// newRelay returns a relay through notifier, falling back to local.
+func newRelay(notifier store.Notifier, local *broker.Broker) relay {
+	return relay{notifier: notifier, local: local, queue: make(chan broker.Event, relayQueue)}
+}
+
+// Publish queues e to be sent to every instance, without waiting. Should
+// the queue be full, the pages served by this instance at least still
+// learn of it.
+func (rl relay) Publish(e broker.Event) {
+	select {
+	case rl.queue <- e:
+	default:
+		log.Print("notify change: queue full")
+		rl.local.Publish(e)
+	}
+}
+
+// send sends the queued events until ctx is done. Should sending one fail,
+// the pages served by this instance at least still learn of it.
+func (rl relay) send(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case e := <-rl.queue:
+			sendCtx, cancel := context.WithTimeout(ctx, relayTimeout)
+			err := rl.notifier.Notify(sendCtx, store.Change{TodoID: e.TodoID, Action: e.Action, UserID: e.UserID, Tab: e.Origin})
+			cancel()
+			if err != nil {
+				log.Printf("notify change: %v", err)
+				rl.local.Publish(e)
+			}
+		}
+	}
+}
+
+// listen passes the changes notified by every instance on to the local
+// broker until ctx is done. When the connection is lost it listens again,
+// backing off while that fails, and then has every page reload, as the
+// changes made in the meantime were missed.
+func (rl relay) listen(ctx context.Context) {
+	delay := relayMinDelay
+	for attempt := 0; ; attempt++ {
+		err := rl.notifier.Listen(ctx, func() {
+			delay = relayMinDelay
+			if attempt > 0 {
+				log.Print("listening for changes again")
+				rl.local.Resync()
+			}
+		}, func(c store.Change) {
+			rl.local.Publish(broker.Event{UserID: c.UserID, TodoID: c.TodoID, Action: c.Action, Origin: c.Tab})
+		})
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("listen for changes: %v; retrying in %s", err, delay)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, relayMaxDelay)
+	}
+}
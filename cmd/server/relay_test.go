@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Tottitov/todo/broker"
+	"github.com/Tottitov/todo/store"
+)
+
+// fakeNotifier passes changes from Notify to Listen over a channel, the way
+// a database shared by instances would.
+type fakeNotifier struct {
+	changes chan store.Change
+	lose    chan struct{} // Receiving from it loses the listening connection
+	err     error         // Returned by Notify, if set
+}
+
+func newFakeNotifier() *fakeNotifier {
+	return &fakeNotifier{changes: make(chan store.Change), lose: make(chan struct{})}
+}
+
+func (n *fakeNotifier) Notify(ctx context.Context, c store.Change) error {
+	if n.err != nil {
+		return n.err
+	}
+	select {
+	case n.changes <- c:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (n *fakeNotifier) Listen(ctx context.Context, listening func(), deliver func(store.Change)) error {
+	listening()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-n.lose:
+			return errors.New("connection lost")
+		case c := <-n.changes:
+			deliver(c)
+		}
+	}
+}
+
+// receive returns the next event s receives, failing the test if none
+// arrives in time.
+func receive(t *testing.T, s *broker.Subscription) broker.Event {
+	t.Helper()
+	select {
+	case e := <-s.C:
+		return e
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event arrived")
+		return broker.Event{}
+	}
+}
+
+// TestRelay checks that published events go out through the notifier and
+// come back to the local broker, and that a lost connection has every page
+// resync once listening again.
+func TestRelay(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	n := newFakeNotifier()
+	local := &broker.Broker{}
+	sub := local.Subscribe(1, "watching")
+	defer sub.Close()
+	rl := newRelay(n, local)
+	go rl.listen(ctx)
+	go rl.send(ctx)
+
+	e := broker.Event{UserID: 1, TodoID: 7, Action: "POST /todos/{id}/toggle", Origin: "other"}
+	rl.Publish(e)
+	if got := receive(t, sub); got != e {
+		t.Errorf("received %+v, want %+v", got, e)
+	}
+
+	n.lose <- struct{}{}
+	if got := receive(t, sub); got != (broker.Event{UserID: 1}) {
+		t.Errorf("after listening again received %+v, want a resync", got)
+	}
+	rl.Publish(e)
+	if got := receive(t, sub); got != e {
+		t.Errorf("after listening again received %+v, want %+v", got, e)
+	}
+}
+
+// TestRelayFallback checks that events that can't go through the notifier
+// still reach the pages of this instance.
+func TestRelayFallback(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	n := newFakeNotifier()
+	n.err = errors.New("database is down")
+	local := &broker.Broker{}
+	sub := local.Subscribe(1, "")
+	defer sub.Close()
+
+	// With nothing sending, the queue fills up
+	rl := newRelay(n, local)
+	for range relayQueue {
+		rl.Publish(broker.Event{UserID: 1, TodoID: 1})
+	}
+	rl.Publish(broker.Event{UserID: 1, TodoID: 2})
+	if got := receive(t, sub); got.TodoID != 2 {
+		t.Errorf("with the queue full received %+v, want the change to todo 2", got)
+	}
+
+	// Events that fail to send are published locally
+	rl = newRelay(n, local)
+	go rl.send(ctx)
+	rl.Publish(broker.Event{UserID: 1, TodoID: 3})
+	if got := receive(t, sub); got.TodoID != 3 {
+		t.Errorf("with the database down received %+v, want the change to todo 3", got)
+	}
+}
@@ -0,0 +1,327 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/Tottitov/todo/todotxt"
+)
+
+const syncUsage = `usage: server sync [flags] <file>
+
+Syncs a local todo.txt file with your todos on a server, both ways: lines
+added or changed since the last sync are sent to the server, lines removed
+move their todos to the trash, and the file is then rewritten with every
+todo the server has. Where a todo changed on both sides, the file wins.
+
+The password is read from TODO_PASSWORD. The file as of the last sync is
+kept next to it, with .sync appended to its name.
+
+flags:`
+
+// runSync implements the "sync" subcommand, a client of a running server.
+func runSync(args []string) error {
+	fs := flag.NewFlagSet("sync", flag.ContinueOnError)
+	baseURL := fs.String("url", envOr("TODO_URL", "http://localhost:8080"), "address of the server (TODO_URL)")
+	email := fs.String("email", os.Getenv("TODO_EMAIL"), "email to log in with (TODO_EMAIL)")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), syncUsage)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("sync: missing file")
+	}
+	password := os.Getenv("TODO_PASSWORD")
+	if *email == "" || password == "" {
+		return errors.New("sync: set -email and TODO_PASSWORD to log in")
+	}
+
+	// Compare the file with the last sync to find what changed locally
+	file := fs.Arg(0)
+	local, err := readLines(file)
+	if err != nil {
+		return err
+	}
+	synced, err := readLines(file + ".sync")
+	if err != nil {
+		return err
+	}
+	changed, removed := syncChanges(local, synced)
+
+	c, err := newSyncClient(strings.TrimSuffix(*baseURL, "/"), *email, password)
+	if err != nil {
+		return err
+	}
+
+	// Preview the changed lines first, so a bad one stops the sync before
+	// anything has changed
+	var result importResult
+	lines := make([]string, len(changed))
+	for i, l := range changed {
+		lines[i] = l.text + "\n"
+	}
+	data := strings.Join(lines, "")
+	if len(changed) > 0 {
+		if result, err = c.importTasks(data, true); err != nil {
+			return err
+		}
+		invalid := 0
+		for _, row := range result.Rows {
+			if row.Error != "" {
+				fmt.Fprintf(os.Stderr, "%s:%d: %s\n", file, changed[row.Row-1].number, row.Error)
+				invalid++
+			}
+		}
+		if invalid > 0 {
+			return fmt.Errorf("sync: %d invalid lines, nothing synced", invalid)
+		}
+	}
+
+	// Then trash the todos of removed lines, and import the changed ones
+	for _, id := range removed {
+		if err := c.deleteTodo(id); err != nil {
+			return err
+		}
+	}
+	if len(changed) > 0 {
+		if result, err = c.importTasks(data, false); err != nil {
+			return err
+		}
+	}
+
+	// Pull everything back, changes made elsewhere included
+	export, err := c.export()
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(file, export); err != nil {
+		return err
+	}
+	if err := writeFileAtomic(file+".sync", export); err != nil {
+		return err
+	}
+	fmt.Printf("%s: %d created, %d updated and %d deleted on the server, %d todos in all\n",
+		file, result.Created, result.Updated, len(removed), bytes.Count(export, []byte("\n")))
+	return nil
+}
+
+// envOr returns the value of the environment variable key, or fallback if
+// it is unset.
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+// syncLine is a line of the local file, numbered from 1.
+type syncLine struct {
+	number int
+	text   string
+}
+
+// syncChanges compares the lines of the local file with those of the last
+// sync. It returns the lines that are new or changed since, and the IDs of
+// the todos whose lines were removed. Lines are compared as tasks, so
+// spacing doesn't count as a change.
+func syncChanges(local, synced []string) ([]syncLine, []int) {
+	was := make(map[int]string) // The task of each todo at the last sync, by ID
+	for _, line := range synced {
+		t := todotxt.Parse(line)
+		if id := taskID(t); id != 0 {
+			was[id] = t.String()
+		}
+	}
+
+	var changed []syncLine
+	kept := make(map[int]bool)
+	for i, line := range local {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		t := todotxt.Parse(line)
+		if id := taskID(t); id != 0 {
+			kept[id] = true
+			if was[id] == t.String() {
+				continue
+			}
+		}
+		changed = append(changed, syncLine{number: i + 1, text: line})
+	}
+
+	var removed []int
+	for id := range was {
+		if !kept[id] {
+			removed = append(removed, id)
+		}
+	}
+	slices.Sort(removed)
+	return changed, removed
+}
+
+// taskID returns the ID of the todo a task was synced from, or 0 for a new
+// task.
+func taskID(t todotxt.Task) int {
+	v, _ := t.Extension("id")
+	id, _ := strconv.Atoi(v)
+	return id
+}
+
+// readLines reads the lines of a file, none if it doesn't exist yet.
+func readLines(name string) ([]string, error) {
+	data, err := os.ReadFile(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n"), nil
+}
+
+// writeFileAtomic replaces a file with data, so that it is never left half
+// written.
+func writeFileAtomic(name string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(name), "."+filepath.Base(name)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), name)
+}
+
+// syncClient talks to the server's JSON endpoints as a logged-in user.
+type syncClient struct {
+	baseURL string
+	http    *http.Client
+}
+
+// importResult is the response to an import.
+type importResult struct {
+	Created int `json:"created"`
+	Updated int `json:"updated"`
+	Rows    []struct {
+		Row   int    `json:"row"`
+		Error string `json:"error"`
+	} `json:"rows"`
+}
+
+// newSyncClient logs in to the server at baseURL, keeping the session
+// cookie for the requests that follow.
+func newSyncClient(baseURL, email, password string) (*syncClient, error) {
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, err
+	}
+	c := &syncClient{baseURL: baseURL, http: &http.Client{Jar: jar}}
+	creds, err := json.Marshal(map[string]string{"email": email, "password": password})
+	if err != nil {
+		return nil, err
+	}
+	if _, err := c.do(http.MethodPost, "/login", "application/json", bytes.NewReader(creds)); err != nil {
+		return nil, fmt.Errorf("sync: log in: %w", err)
+	}
+	return c, nil
+}
+
+// importTasks imports todo.txt lines, or with dryRun previews them.
+func (c *syncClient) importTasks(data string, dryRun bool) (importResult, error) {
+	var result importResult
+	body, err := c.do(http.MethodPost, "/import?format=todotxt&dry_run="+strconv.FormatBool(dryRun),
+		"text/plain; charset=utf-8", strings.NewReader(data))
+	if err != nil {
+		return result, fmt.Errorf("sync: import: %w", err)
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return result, fmt.Errorf("sync: import: %w", err)
+	}
+	return result, nil
+}
+
+// deleteTodo moves a todo to the trash, unless it is gone already.
+func (c *syncClient) deleteTodo(id int) error {
+	_, err := c.do(http.MethodDelete, "/api/v1/todos/"+strconv.Itoa(id), "", nil)
+	var status statusError
+	if errors.As(err, &status) && status.code == http.StatusNotFound {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("sync: delete todo %d: %w", id, err)
+	}
+	return nil
+}
+
+// export downloads every todo as a todo.txt file.
+func (c *syncClient) export() ([]byte, error) {
+	data, err := c.do(http.MethodGet, "/export?format=todotxt", "", nil)
+	if err != nil {
+		return nil, fmt.Errorf("sync: export: %w", err)
+	}
+	return data, nil
+}
+
+// statusError is a response with a status other than 2xx, and the message
+// the server gave.
+type statusError struct {
+	code int
+	msg  string
+}
+
+func (e statusError) Error() string {
+	if e.msg == "" {
+		return http.StatusText(e.code)
+	}
+	return e.msg
+}
+
+// do sends a request asking for JSON and returns the body of a successful
+// response.
+func (c *syncClient) do(method, path, contentType string, body io.Reader) ([]byte, error) {
+	req, err := http.NewRequest(method, c.baseURL+path, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		var e struct {
+			Error string `json:"error"`
+		}
+		json.Unmarshal(data, &e)
+		return nil, statusError{code: resp.StatusCode, msg: e.Error}
+	}
+	return data, nil
+}
@@ -0,0 +1,63 @@
+// Code generated by templ - DO NOT EDIT.
+
+// templ: version: v0.3.857
+package components
+
+//lint:file-ignore SA4006 This context is only used if a nested component is present.
+
+import "github.com/a-h/templ"
+import templruntime "github.com/a-h/templ/runtime"
+
+// Layout renders the HTML document shell shared by every page: the head with
+// its external dependencies and the centered body the page content goes in
+func Layout(title string) templ.Component {
+	return templruntime.GeneratedTemplate(func(templ_7745c5c3_Input templruntime.GeneratedComponentInput) (templ_7745c5c3_Err error) {
+		templ_7745c5c3_W, ctx := templ_7745c5c3_Input.Writer, templ_7745c5c3_Input.Context
+		if templ_7745c5c3_CtxErr := ctx.Err(); templ_7745c5c3_CtxErr != nil {
+			return templ_7745c5c3_CtxErr
+		}
+		templ_7745c5c3_Buffer, templ_7745c5c3_IsBuffer := templruntime.GetBuffer(templ_7745c5c3_W)
+		if !templ_7745c5c3_IsBuffer {
+			defer func() {
+				templ_7745c5c3_BufErr := templruntime.ReleaseBuffer(templ_7745c5c3_Buffer)
+				if templ_7745c5c3_Err == nil {
+					templ_7745c5c3_Err = templ_7745c5c3_BufErr
+				}
+			}()
+		}
+		ctx = templ.InitializeContext(ctx)
+		templ_7745c5c3_Var1 := templ.GetChildren(ctx)
+		if templ_7745c5c3_Var1 == nil {
+			templ_7745c5c3_Var1 = templ.NopComponent
+		}
+		ctx = templ.ClearChildren(ctx)
+		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 1, "<!doctype html><html lang=\"en\"><head><!-- Meta tags for proper rendering and viewport settings --><meta charset=\"UTF-8\"><meta name=\"viewport\" content=\"width=device-width, initial-scale=1.0\"><title>")
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		var templ_7745c5c3_Var2 string
+		templ_7745c5c3_Var2, templ_7745c5c3_Err = templ.JoinStringErrs(title)
+		if templ_7745c5c3_Err != nil {
+			return templ.Error{Err: templ_7745c5c3_Err, FileName: `components/layout.templ`, Line: 12, Col: 17}
+		}
+		_, templ_7745c5c3_Err = templ_7745c5c3_Buffer.WriteString(templ.EscapeString(templ_7745c5c3_Var2))
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 2, "</title><!-- External dependencies: HTMX for dynamic updates and Tailwind for styling --><script src=\"https://unpkg.com/htmx.org@1.9.5\"></script><!-- HTMX extension for Server-Sent Events, which push changes made in other tabs --><script src=\"https://unpkg.com/htmx.org@1.9.5/dist/ext/sse.js\"></script><script src=\"https://cdn.tailwindcss.com\"></script><!-- SortableJS for dragging todos into a new order --><script src=\"https://cdn.jsdelivr.net/npm/sortablejs@1.15.2/Sortable.min.js\"></script><style>\n\t\t\t\t.sortable .drag-handle { display: inline; }\n\t\t\t</style><!-- Remember the browser's time zone so due dates are judged by the viewer's day --><script>\n\t\t\t\tdocument.cookie = \"tz=\" + encodeURIComponent(Intl.DateTimeFormat().resolvedOptions().timeZone) + \"; path=/; max-age=31536000; samesite=lax\";\n\t\t\t</script><!-- Make reorderable lists, and the subtasks under each todo, draggable as\n\t\t\t     HTMX loads them, and save each drop by telling the server which todos\n\t\t\t     the moved one now sits between. The list is only reloaded if the\n\t\t\t     server rejects the move --><script>\n\t\t\t\thtmx.onLoad(function (root) {\n\t\t\t\t\t[\n\t\t\t\t\t\t{ list: \".todo-items.sortable\", handle: \".drag-handle\", item: \".todo-item\" },\n\t\t\t\t\t\t{ list: \".subtask-items\", handle: \".subtask-handle\", item: \".subtask-item\" },\n\t\t\t\t\t].forEach(function (kind) {\n\t\t\t\t\t\troot.querySelectorAll(kind.list).forEach(function (el) {\n\t\t\t\t\t\t\tif (el.sortable) return;\n\t\t\t\t\t\t\tel.sortable = Sortable.create(el, {\n\t\t\t\t\t\t\t\thandle: kind.handle,\n\t\t\t\t\t\t\t\tdraggable: kind.item,\n\t\t\t\t\t\t\t\tanimation: 150,\n\t\t\t\t\t\t\t\tonEnd: function (evt) {\n\t\t\t\t\t\t\t\t\tif (evt.oldIndex === evt.newIndex) return;\n\t\t\t\t\t\t\t\t\tvar item = evt.item;\n\t\t\t\t\t\t\t\t\tvar prev = item.previousElementSibling;\n\t\t\t\t\t\t\t\t\tvar next = item.nextElementSibling;\n\t\t\t\t\t\t\t\t\tvar values = {};\n\t\t\t\t\t\t\t\t\tif (prev && prev.matches(kind.item)) values.after = prev.dataset.id;\n\t\t\t\t\t\t\t\t\tif (next && next.matches(kind.item)) values.before = next.dataset.id;\n\t\t\t\t\t\t\t\t\thtmx.ajax(\"POST\", \"/todos/\" + item.dataset.id + \"/move\", { values: values, swap: \"none\" }).catch(function () {});\n\t\t\t\t\t\t\t\t},\n\t\t\t\t\t\t\t});\n\t\t\t\t\t\t});\n\t\t\t\t\t});\n\t\t\t\t});\n\t\t\t\t// Toasts disappear once what they offer has expired\n\t\t\t\thtmx.onLoad(function (root) {\n\t\t\t\t\tvar toasts = Array.from(root.querySelectorAll(\".toast[data-expires]\"));\n\t\t\t\t\tif (root.matches && root.matches(\".toast[data-expires]\")) toasts.push(root);\n\t\t\t\t\ttoasts.forEach(function (toast) {\n\t\t\t\t\t\tsetTimeout(function () { toast.remove(); }, Number(toast.dataset.expires));\n\t\t\t\t\t});\n\t\t\t\t});\n\t\t\t\t// Name the tab in every request, so the changes it makes aren't\n\t\t\t\t// streamed back to it\n\t\t\t\tdocument.addEventListener(\"htmx:configRequest\", function (evt) {\n\t\t\t\t\tvar stream = document.getElementById(\"todo-stream\");\n\t\t\t\t\tif (stream) evt.detail.headers[\"X-Tab\"] = stream.dataset.tab;\n\t\t\t\t});\n\t\t\t\tdocument.addEventListener(\"htmx:responseError\", function (evt) {\n\t\t\t\t\tif (evt.detail.pathInfo.requestPath.endsWith(\"/move\")) {\n\t\t\t\t\t\thtmx.ajax(\"GET\", window.location.href, { target: \"#todo-list\", swap: \"outerHTML\" });\n\t\t\t\t\t}\n\t\t\t\t});\n\t\t\t</script></head><body class=\"bg-white text-gray-800 dark:bg-gray-900 dark:text-gray-100 font-sans max-w-4xl mx-auto p-6\">")
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		templ_7745c5c3_Err = templ_7745c5c3_Var1.Render(ctx, templ_7745c5c3_Buffer)
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 3, "</body></html>")
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		return nil
+	})
+}
+
+var _ = templruntime.GeneratedTemplate
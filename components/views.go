@@ -0,0 +1,429 @@
+package components
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Tottitov/todo/models"
+	"github.com/Tottitov/todo/recur"
+)
+
+// locationKey is the context key under which WithLocation stores the viewer's time zone
+type locationKey struct{}
+
+// WithLocation returns a copy of ctx carrying the viewer's time zone, which
+// components use to decide whether a due date is overdue, today or upcoming
+func WithLocation(ctx context.Context, loc *time.Location) context.Context {
+	return context.WithValue(ctx, locationKey{}, loc)
+}
+
+// Location returns the viewer's time zone stored by WithLocation, or UTC
+func Location(ctx context.Context) *time.Location {
+	if loc, ok := ctx.Value(locationKey{}).(*time.Location); ok {
+		return loc
+	}
+	return time.UTC
+}
+
+// ListView carries everything the todo page needs to render one list: the
+// signed-in user, the sidebar of lists, and the selected list's todos
+type ListView struct {
+	User           models.User   // Owner of the lists, shown in the header
+	Lists          []models.List // Every list of the user, for the sidebar
+	List           models.List   // The list being shown
+	Todos          []models.Todo // The page of todos of List that pass Filter
+	Next           int           // ID of the todo the next page follows, or 0 on the last page
+	Filter         string        // Active filter, one of the store.Filter constants
+	Sort           string        // Active order, one of the store.Sort constants
+	Tag            string        // Name of the tag the todos are narrowed to, if any
+	Query          string        // Search the todos are narrowed to, if any
+	ActiveCount    int           // Incomplete todos in List, regardless of Filter
+	CompletedCount int           // Completed todos in List, regardless of Filter
+	Tab            string        // ID of the browser tab showing the list, for its event stream
+}
+
+// listURL returns the page URL of a list, with an optional path suffix
+func listURL(list models.List, suffix string) string {
+	return "/lists/" + itoa(list.ID) + suffix
+}
+
+// listQueryURL returns the page URL of a list showing the given filter,
+// sort, tag and search, leaving out whichever is the default
+func listQueryURL(list models.List, filter, sort, tag, query string) string {
+	values := url.Values{}
+	if filter != "" {
+		values.Set("filter", filter)
+	}
+	if sort != "" {
+		values.Set("sort", sort)
+	}
+	if tag != "" {
+		values.Set("tag", tag)
+	}
+	if query != "" {
+		values.Set("q", query)
+	}
+	if len(values) == 0 {
+		return listURL(list, "")
+	}
+	return listURL(list, "?"+values.Encode())
+}
+
+// streamURL returns the URL of the event stream of a list, which renders
+// the list with the view's filter, sort, tag and search for the view's tab
+func streamURL(view ListView) string {
+	values := url.Values{"tab": {view.Tab}}
+	if view.Filter != "" {
+		values.Set("filter", view.Filter)
+	}
+	if view.Sort != "" {
+		values.Set("sort", view.Sort)
+	}
+	if view.Tag != "" {
+		values.Set("tag", view.Tag)
+	}
+	if view.Query != "" {
+		values.Set("q", view.Query)
+	}
+	return listURL(view.List, "/events?"+values.Encode())
+}
+
+// sortOptions are the orders offered by the sort selector, by query value
+var sortOptions = []struct{ Value, Label string }{
+	{"", "Manual"},
+	{"priority", "Priority"},
+	{"created", "Newest"},
+	{"due", "Due date"},
+	{"title", "Title"},
+}
+
+// priorityClass returns the CSS classes for a priority selector, colored
+// more loudly the more urgent the priority
+func priorityClass(p models.Priority) string {
+	base := "text-xs rounded border px-1 py-0.5 bg-white dark:bg-gray-800 "
+	switch p {
+	case models.PriorityUrgent:
+		return base + "border-red-500 text-red-600 dark:text-red-400 font-semibold"
+	case models.PriorityHigh:
+		return base + "border-orange-500 text-orange-600 dark:text-orange-400"
+	case models.PriorityMedium:
+		return base + "border-yellow-500 text-yellow-700 dark:text-yellow-400"
+	case models.PriorityLow:
+		return base + "border-blue-400 text-blue-600 dark:text-blue-400"
+	default:
+		return base + "border-gray-300 text-gray-400 dark:border-gray-600"
+	}
+}
+
+// colorDotClass returns the Tailwind classes for a list's color swatch
+func colorDotClass(color string) string {
+	switch color {
+	case "red":
+		return "inline-block h-3 w-3 rounded-full bg-red-500"
+	case "orange":
+		return "inline-block h-3 w-3 rounded-full bg-orange-500"
+	case "yellow":
+		return "inline-block h-3 w-3 rounded-full bg-yellow-400"
+	case "green":
+		return "inline-block h-3 w-3 rounded-full bg-green-500"
+	case "blue":
+		return "inline-block h-3 w-3 rounded-full bg-blue-500"
+	case "purple":
+		return "inline-block h-3 w-3 rounded-full bg-purple-500"
+	case "pink":
+		return "inline-block h-3 w-3 rounded-full bg-pink-500"
+	default:
+		return "inline-block h-3 w-3 rounded-full bg-gray-400"
+	}
+}
+
+// nextPageURL returns the URL of the page of todos following the view's last todo
+func nextPageURL(view ListView) string {
+	u := listQueryURL(view.List, view.Filter, view.Sort, view.Tag, view.Query)
+	if strings.Contains(u, "?") {
+		return u + "&after=" + itoa(view.Next)
+	}
+	return u + "?after=" + itoa(view.Next)
+}
+
+// sortable reports whether the view's todos can be dragged into a new order:
+// only in manual order, and not while searching, which ranks by relevance
+func sortable(view ListView) bool {
+	return view.Sort == "" && view.Query == ""
+}
+
+// tagURL returns the page URL of a list narrowed to the todos carrying a tag
+func tagURL(listID int, tag string) string {
+	return listQueryURL(models.List{ID: listID}, "", "", tag, "")
+}
+
+// tagChipClass returns the Tailwind classes for a tag chip of the given color
+func tagChipClass(color string) string {
+	base := "text-xs px-2 py-0.5 rounded-full hover:underline "
+	switch color {
+	case "red":
+		return base + "bg-red-100 text-red-700 dark:bg-red-900 dark:text-red-200"
+	case "orange":
+		return base + "bg-orange-100 text-orange-700 dark:bg-orange-900 dark:text-orange-200"
+	case "yellow":
+		return base + "bg-yellow-100 text-yellow-800 dark:bg-yellow-900 dark:text-yellow-200"
+	case "green":
+		return base + "bg-green-100 text-green-700 dark:bg-green-900 dark:text-green-200"
+	case "blue":
+		return base + "bg-blue-100 text-blue-700 dark:bg-blue-900 dark:text-blue-200"
+	case "purple":
+		return base + "bg-purple-100 text-purple-700 dark:bg-purple-900 dark:text-purple-200"
+	case "pink":
+		return base + "bg-pink-100 text-pink-700 dark:bg-pink-900 dark:text-pink-200"
+	default:
+		return base + "bg-gray-100 text-gray-700 dark:bg-gray-700 dark:text-gray-200"
+	}
+}
+
+// tagsValue returns a todo's tag names as the comma-separated list the edit form expects
+func tagsValue(tags []models.Tag) string {
+	return strings.Join(models.TagNames(tags), ", ")
+}
+
+// dueLabel returns the short form of a due date shown in a todo's badge,
+// such as "Mar 7" or "Mar 7, 09:30"
+func dueLabel(due models.Due) string {
+	label := due.Date
+	if d, err := time.Parse(models.DateLayout, due.Date); err == nil {
+		label = d.Format("Jan 2")
+	}
+	if due.Time != "" {
+		label += ", " + due.Time
+	}
+	return label
+}
+
+// dueTitle returns the full due date shown when hovering a todo's badge
+func dueTitle(due models.Due) string {
+	if due.Time == "" {
+		return "Due " + due.Date
+	}
+	return "Due " + due.Date + " " + due.Time + " " + due.TZ
+}
+
+// dueClass returns the CSS classes for a todo's due date badge, colored by
+// whether it is overdue, due today or upcoming for the viewer
+func dueClass(ctx context.Context, todo models.Todo) string {
+	base := "text-xs px-2 py-0.5 rounded-full border "
+	if todo.Completed {
+		return base + "border-gray-300 text-gray-400 dark:border-gray-600"
+	}
+	switch todo.Due.Status(time.Now().In(Location(ctx))) {
+	case models.DueOverdue:
+		return base + "border-red-500 text-red-600 dark:text-red-400"
+	case models.DueToday:
+		return base + "border-amber-500 text-amber-600 dark:text-amber-400"
+	default:
+		return base + "border-gray-300 text-gray-600 dark:border-gray-600 dark:text-gray-300"
+	}
+}
+
+// cascadeVals returns the hx-vals that ask, as a todo with open subtasks is
+// completed, whether to complete the subtasks with it
+func cascadeVals(todo models.Todo) string {
+	return `js:{cascade: confirm("Also complete its ` + subtaskCount(todo.Subtasks.Open()) + `?")}`
+}
+
+// subtaskCount returns "1 subtask" or "n subtasks"
+func subtaskCount(n int) string {
+	if n == 1 {
+		return "1 subtask"
+	}
+	return itoa(n) + " subtasks"
+}
+
+// recurPreset is a common recurrence rule offered in the edit form
+type recurPreset struct {
+	Rule  string
+	Label string
+}
+
+// recurPresets are the rules suggested for the edit form's repeat field
+var recurPresets = []recurPreset{
+	{"FREQ=DAILY", "Daily"},
+	{"FREQ=WEEKLY;BYDAY=MO,TU,WE,TH,FR", "Every weekday"},
+	{"FREQ=WEEKLY", "Weekly"},
+	{"FREQ=WEEKLY;INTERVAL=2", "Every 2 weeks"},
+	{"FREQ=MONTHLY", "Monthly"},
+	{"FREQ=MONTHLY;BYDAY=-1FR", "Monthly on the last Friday"},
+	{"FREQ=YEARLY", "Yearly"},
+}
+
+// recurLabel returns the English description of a todo's recurrence rule
+// shown in its repeat badge, or the rule itself if it doesn't parse
+func recurLabel(rule string) string {
+	r, err := recur.Parse(rule)
+	if err != nil {
+		return rule
+	}
+	return r.Text()
+}
+
+// TrashView is what the trash page shows: the deleted todos, the names of
+// the lists they belong to, and how long they are kept
+type TrashView struct {
+	Todos     []models.Todo
+	ListNames map[int]string
+	Retention time.Duration // 0 when the trash is never purged
+}
+
+// trashDetail describes where a deleted todo came from and when it was
+// deleted, and when it will be purged if the trash is purged at all
+func trashDetail(ctx context.Context, view TrashView, todo models.Todo) string {
+	detail := view.ListNames[todo.ListID]
+	if todo.ParentID != 0 {
+		detail += " · subtask"
+	} else if todo.Subtasks.Total > 0 {
+		detail += " · " + subtaskCount(todo.Subtasks.Total)
+	}
+	if todo.DeletedAt == nil {
+		return detail
+	}
+	deleted := todo.DeletedAt.In(Location(ctx))
+	detail += " · deleted " + deleted.Format("Jan 2, 15:04")
+	if view.Retention > 0 {
+		detail += ", gone after " + deleted.Add(view.Retention).Format("Jan 2")
+	}
+	return detail
+}
+
+// trashNotice explains how long deleted todos are kept
+func trashNotice(retention time.Duration) string {
+	keep := "until you restore them or delete them for good"
+	if retention > 0 {
+		keep = "for " + retentionLabel(retention) + ", unless you restore them or delete them for good first"
+	}
+	return "Deleted todos stay here " + keep + ". Restoring a todo brings back the subtasks deleted with it."
+}
+
+// retentionLabel returns how long the trash keeps todos, in whole days
+// where possible, such as "30 days" or "12h0m0s"
+func retentionLabel(d time.Duration) string {
+	if days := d / (24 * time.Hour); days > 0 && d%(24*time.Hour) == 0 {
+		if days == 1 {
+			return "1 day"
+		}
+		return itoa(int(days)) + " days"
+	}
+	return d.String()
+}
+
+// AuditView is what the audit page shows: the events passing its filters,
+// the users it can be filtered by, and the filters themselves
+type AuditView struct {
+	Events  []models.Event
+	Actors  []models.User
+	ActorID int           // 0 for anyone
+	Action  models.Action // Empty for any change
+	From    string        // First day shown, in models.DateLayout, if set
+	To      string        // Last day shown, in models.DateLayout, if set
+}
+
+// filterInputClass styles the inputs of filter forms
+const filterInputClass = "border border-gray-300 dark:border-gray-700 bg-white dark:bg-gray-800 text-black dark:text-white rounded px-2 py-1"
+
+// eventTime returns when an event happened, in the viewer's time zone
+func eventTime(ctx context.Context, e models.Event) string {
+	return e.CreatedAt.In(Location(ctx)).Format("Jan 2, 15:04")
+}
+
+// eventChange describes what an event changed, such as
+// `Renamed from "Milk" to "Oat milk"`
+func eventChange(e models.Event) string {
+	if e.Action == models.ActionTitleChanged {
+		return e.Action.Label() + " from " + strconv.Quote(e.From) + " to " + strconv.Quote(e.To)
+	}
+	return e.Action.Label()
+}
+
+// eventActor names the user who made a change
+func eventActor(e models.Event) string {
+	if e.Actor == "" {
+		return "a deleted account"
+	}
+	return e.Actor
+}
+
+// ImportView is what the import page shows: the rows of the file being
+// imported and what becomes of each, previewed or done, along with the file
+// itself, which the preview passes on to the import
+type ImportView struct {
+	Rows      []ImportRow
+	Format    string
+	Data      string
+	Committed bool   // Whether the rows were imported rather than previewed
+	Error     string // Why the file couldn't be imported at all, if it couldn't
+}
+
+// ImportRow is a row of an imported file and what becomes of it
+type ImportRow struct {
+	Number  int    `json:"row"`
+	ID      int    `json:"id,omitempty"` // ID of the todo in the file
+	Title   string `json:"title"`
+	List    string `json:"list"`
+	Outcome string `json:"outcome"`         // created, updated or skipped
+	Reason  string `json:"error,omitempty"` // Why an invalid row is skipped
+}
+
+// Count returns how many rows have the given outcome
+func (v ImportView) Count(outcome string) int {
+	n := 0
+	for _, row := range v.Rows {
+		if row.Outcome == outcome {
+			n++
+		}
+	}
+	return n
+}
+
+// importSummary tallies the outcomes of an import, such as
+// "2 to create, 1 to update, 0 to skip" for a preview
+func importSummary(view ImportView) string {
+	verbs := []string{"to create", "to update", "to skip"}
+	if view.Committed {
+		verbs = []string{"created", "updated", "skipped"}
+	}
+	return itoa(view.Count("created")) + " " + verbs[0] + ", " + itoa(view.Count("updated")) + " " + verbs[1] +
+		", " + itoa(view.Count("skipped")) + " " + verbs[2]
+}
+
+// importOutcomeClass colors the outcome of an imported row
+func importOutcomeClass(row ImportRow) string {
+	switch {
+	case row.Reason != "":
+		return "text-red-500"
+	case row.Outcome == "skipped":
+		return "text-gray-500 dark:text-gray-400"
+	}
+	return "text-green-600 dark:text-green-400"
+}
+
+// CalendarView is what the calendar page shows of the user's feed. Its URLs
+// are only known right after the feed is made, as only a hash of the token
+// in them is kept
+type CalendarView struct {
+	Enabled   bool      `json:"enabled"`
+	CreatedAt time.Time `json:"created_at,omitzero"`  // When the feed's URL was made
+	URL       string    `json:"url,omitempty"`        // Feed of VTODOs
+	EventsURL string    `json:"events_url,omitempty"` // Same feed with the due dates of open todos as VEVENTs
+}
+
+// webcal returns a feed URL with the webcal scheme, which calendar apps open
+// to subscribe
+func webcal(url string) string {
+	_, rest, _ := strings.Cut(url, "://")
+	return "webcal://" + rest
+}
+
+// feedCreated tells when the feed's URL was made, in the viewer's time zone
+func feedCreated(ctx context.Context, view CalendarView) string {
+	return view.CreatedAt.In(Location(ctx)).Format("Jan 2, 2006 15:04")
+}
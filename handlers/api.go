@@ -0,0 +1,439 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Tottitov/todo/models"
+	"github.com/Tottitov/todo/store"
+)
+
+// maxJSONBody caps the size of JSON request bodies accepted by the API.
+const maxJSONBody = 1 << 20
+
+// maxAPIPageSize caps the limit API clients can ask List for.
+const maxAPIPageSize = 500
+
+// errOutOfOrder is reported when a reorder names neighbours in the wrong
+// order, typically because the client's copy of the list is stale.
+const errOutOfOrder = "The list changed since it was loaded; reload and try again"
+
+// errCursor is reported when asked for the page after a todo that has since
+// been purged, which leaves nothing to continue the list from.
+const errCursor = "The list changed since it was loaded; reload it to see more"
+
+// errEmptyTitle is reported when creating a todo, or renaming one, without
+// a title.
+var errEmptyTitle = errors.New("Todo title cannot be empty")
+
+// errNested is reported when adding a subtask to a subtask.
+const errNested = "Subtasks cannot have subtasks of their own"
+
+// APIHandler serves the JSON REST API under /api/v1.
+// It shares the TodoStore with TodoHandler but speaks JSON instead of HTML fragments.
+// Requests that don't name a list with list_id act on the user's default list.
+type APIHandler struct {
+	Store store.TodoStore // Storage backend for todos
+	Lists store.ListStore // Storage backend for the lists todos belong to
+}
+
+// todoInput is the request body accepted by Create.
+type todoInput struct {
+	Title    string           `json:"title"`
+	Notes    *string          `json:"notes"`
+	ListID   int              `json:"list_id,omitempty"`
+	ParentID int              `json:"parent_id,omitempty"`
+	Priority *models.Priority `json:"priority"`
+	Due      optionalDue      `json:"due"`
+	Tags     *tagNames        `json:"tags"`
+	Recur    *recurRule       `json:"recur"`
+}
+
+// todo builds the todo to create in the given list from the input.
+func (in todoInput) todo(listID int) models.Todo {
+	todo := models.Todo{ListID: listID, ParentID: in.ParentID, Title: in.Title, Due: in.Due.Due}
+	if in.Notes != nil {
+		todo.Notes = *in.Notes
+	}
+	if in.Priority != nil {
+		todo.Priority = *in.Priority
+	}
+	if in.Tags != nil {
+		for _, name := range *in.Tags {
+			todo.Tags = append(todo.Tags, models.Tag{Name: name})
+		}
+	}
+	if in.Recur != nil {
+		todo.Recur = string(*in.Recur)
+	}
+	return todo
+}
+
+// validate checks the fields of a todo to create or update, which every
+// route doing so answers 422 Unprocessable Entity when they are invalid.
+func (in todoInput) validate() error {
+	if in.Title == "" {
+		return errEmptyTitle
+	}
+	return in.Due.Err
+}
+
+// patch returns the change to make to a todo to give it the input's title
+// and whichever of its other fields were sent.
+func (in todoInput) patch() store.TodoPatch {
+	return todoPatch{Title: &in.Title, Notes: in.Notes, Priority: in.Priority, Due: in.Due, Tags: in.Tags, Recur: in.Recur}.patch()
+}
+
+// todoPatch is the request body accepted by Update. Absent fields are left unchanged.
+type todoPatch struct {
+	Title     *string          `json:"title"`
+	Notes     *string          `json:"notes"`
+	Completed *bool            `json:"completed"`
+	Cascade   bool             `json:"cascade"` // Completing also completes the open subtasks
+	ListID    *int             `json:"list_id"`
+	Priority  *models.Priority `json:"priority"`
+	Due       optionalDue      `json:"due"`
+	Tags      *tagNames        `json:"tags"`
+	Recur     *recurRule       `json:"recur"`
+}
+
+// validate is todoInput.validate for updates, which also have to change
+// something.
+func (p todoPatch) validate() error {
+	if p.Title == nil && p.Notes == nil && p.Completed == nil && p.Priority == nil && p.ListID == nil && p.Tags == nil && !p.Due.Set && p.Recur == nil {
+		return errors.New("Nothing to update: provide title, notes, completed, priority, list_id, tags, due and/or recur")
+	}
+	if p.Title != nil && *p.Title == "" {
+		return errEmptyTitle
+	}
+	return p.Due.Err
+}
+
+// patch returns the change to make to a todo's fields other than its
+// completion and list, which have operations of their own.
+func (p todoPatch) patch() store.TodoPatch {
+	patch := store.TodoPatch{Title: p.Title, Notes: p.Notes, Priority: p.Priority, SetDue: p.Due.Set, Due: p.Due.Due}
+	if p.Tags != nil {
+		names := []string(*p.Tags)
+		patch.Tags = &names
+	}
+	if p.Recur != nil {
+		rule := string(*p.Recur)
+		patch.Recur = &rule
+	}
+	return patch
+}
+
+// List handles GET /api/v1/todos, optionally filtered with
+// ?filter=active|completed|today|overdue|upcoming, ordered with
+// ?sort=priority|created|due|title and narrowed to a list with ?list_id=
+// and to the todos carrying a tag with ?tag=. ?q= searches titles and notes.
+// With ?limit= the todos come in pages: the response's next_after is passed
+// as ?after= to fetch the next one. Only top-level todos are listed, unless
+// ?parent_id= asks for the subtasks of a todo.
+func (h *APIHandler) List(w http.ResponseWriter, r *http.Request) {
+	// Validate the filter and sort so typos don't silently return everything
+	q := store.TodoQuery{Filter: r.URL.Query().Get("filter"), Sort: r.URL.Query().Get("sort"), Tag: r.URL.Query().Get("tag"), Search: r.URL.Query().Get("q")}
+	if !store.ValidFilter(q.Filter) {
+		sendJSONError(w, "filter must be one of "+strings.Join(store.Filters, ", "), http.StatusBadRequest)
+		return
+	}
+	if !store.ValidSort(q.Sort) {
+		sendJSONError(w, "sort must be one of "+strings.Join(store.Sorts[1:], ", "), http.StatusBadRequest)
+		return
+	}
+
+	var err error
+	if v := r.URL.Query().Get("limit"); v != "" {
+		if q.Limit, err = strconv.Atoi(v); err != nil || q.Limit < 1 || q.Limit > maxAPIPageSize {
+			sendJSONError(w, "limit must be a number from 1 to "+strconv.Itoa(maxAPIPageSize), http.StatusBadRequest)
+			return
+		}
+	}
+	if v := r.URL.Query().Get("after"); v != "" {
+		if q.After, err = strconv.Atoi(v); err != nil {
+			sendJSONError(w, "after must be a todo ID", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if v := r.URL.Query().Get("parent_id"); v != "" {
+		if q.Parent, err = strconv.Atoi(v); err != nil {
+			sendJSONError(w, "parent_id must be a todo ID", http.StatusBadRequest)
+			return
+		}
+	}
+
+	list, ok := h.queryList(w, r, q.Parent)
+	if !ok {
+		return
+	}
+
+	q.ListID = list.ID
+	page, err := listTodos(r, h.Store, q)
+	if errors.Is(err, store.ErrCursor) {
+		sendJSONError(w, errCursor, http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		sendJSONError(w, "Failed to fetch todos", http.StatusInternalServerError)
+		return
+	}
+
+	sendJSON(w, http.StatusOK, todoListJSON(list, page))
+}
+
+// Get handles GET /api/v1/todos/{id}.
+func (h *APIHandler) Get(w http.ResponseWriter, r *http.Request) {
+	id, err := parseID(r)
+	if err != nil {
+		sendJSONError(w, "Invalid ID format", http.StatusBadRequest)
+		return
+	}
+
+	todo, err := h.Store.Get(r.Context(), currentUser(r).ID, id)
+	if err != nil {
+		sendJSONStoreError(w, err, "Failed to fetch todo")
+		return
+	}
+	sendJSON(w, http.StatusOK, todo)
+}
+
+// Create handles POST /api/v1/todos with a {"title": "...", "list_id": n} body,
+// where list_id is optional. With "parent_id" the todo is added as a subtask
+// of that todo, in its list. It responds 201 Created with the new todo and
+// its URL in the Location header.
+func (h *APIHandler) Create(w http.ResponseWriter, r *http.Request) {
+	var in todoInput
+	if err := decodeJSON(w, r, &in); err != nil {
+		sendJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := in.validate(); err != nil {
+		sendJSONError(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	// Without a list_id the todo goes into the default list; subtasks go into their parent's
+	userID := currentUser(r).ID
+	listID := in.ListID
+	if listID == 0 && in.ParentID == 0 {
+		list, err := h.Lists.DefaultList(r.Context(), userID)
+		if err != nil {
+			sendJSONError(w, "Failed to fetch list", http.StatusInternalServerError)
+			return
+		}
+		listID = list.ID
+	}
+
+	todo, err := h.Store.Create(r.Context(), userID, in.todo(listID))
+	if errors.Is(err, store.ErrNotFound) && in.ParentID != 0 {
+		sendJSONError(w, "Parent todo not found", http.StatusUnprocessableEntity)
+		return
+	}
+	if errors.Is(err, store.ErrNotFound) {
+		sendJSONError(w, "List not found", http.StatusUnprocessableEntity)
+		return
+	}
+	if errors.Is(err, store.ErrNested) {
+		sendJSONError(w, errNested, http.StatusUnprocessableEntity)
+		return
+	}
+	if err != nil {
+		sendJSONError(w, "Failed to create todo", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Location", "/api/v1/todos/"+strconv.Itoa(todo.ID))
+	sendJSON(w, http.StatusCreated, todo)
+}
+
+// Update handles PATCH /api/v1/todos/{id} with a body containing any of
+// "title", "notes", "completed" (with "cascade": true also completing the
+// todo's open subtasks), "priority", "list_id", "tags" (replacing all of the
+// todo's tags), "due" (null clears it) and "recur" (an RRULE such as
+// "FREQ=WEEKLY;BYDAY=MO", or "" to stop repeating).
+// It responds with the updated todo.
+func (h *APIHandler) Update(w http.ResponseWriter, r *http.Request) {
+	id, err := parseID(r)
+	if err != nil {
+		sendJSONError(w, "Invalid ID format", http.StatusBadRequest)
+		return
+	}
+
+	var patch todoPatch
+	if err := decodeJSON(w, r, &patch); err != nil {
+		sendJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := patch.validate(); err != nil {
+		sendJSONError(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	// Check the list to move the todo to before changing anything
+	userID := currentUser(r).ID
+	if patch.ListID != nil {
+		if _, err := h.Lists.GetList(r.Context(), userID, *patch.ListID); err != nil {
+			if errors.Is(err, store.ErrNotFound) {
+				sendJSONError(w, "List not found", http.StatusUnprocessableEntity)
+			} else {
+				sendJSONError(w, "Failed to fetch list", http.StatusInternalServerError)
+			}
+			return
+		}
+	}
+
+	// Change the todo's fields in one go; the last write returns the final state
+	todo, err := h.Store.Update(r.Context(), userID, id, patch.patch())
+	// Completion comes next, so the next occurrence of a repeating todo
+	// copies the todo as patched
+	if err == nil && patch.Completed != nil {
+		todo, err = h.Store.SetCompleted(r.Context(), userID, id, *patch.Completed, patch.Cascade)
+	}
+	if err == nil && patch.ListID != nil {
+		todo, err = h.Store.Move(r.Context(), userID, id, *patch.ListID)
+	}
+	if err != nil {
+		sendJSONStoreError(w, err, "Failed to update todo")
+		return
+	}
+	sendJSON(w, http.StatusOK, todo)
+}
+
+// Reorder handles POST /api/v1/todos/{id}/move with a body of
+// {"after": id, "before": id}, placing the todo between those two of its
+// list. Either may be left out to move it to that end of the list.
+func (h *APIHandler) Reorder(w http.ResponseWriter, r *http.Request) {
+	id, err := parseID(r)
+	if err != nil {
+		sendJSONError(w, "Invalid ID format", http.StatusBadRequest)
+		return
+	}
+
+	var n neighbours
+	if err := decodeJSON(w, r, &n); err != nil {
+		sendJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	todo, err := h.Store.Reorder(r.Context(), currentUser(r).ID, id, n.After, n.Before)
+	if err != nil {
+		sendJSONStoreError(w, err, "Failed to move todo")
+		return
+	}
+	sendJSON(w, http.StatusOK, todo)
+}
+
+// Delete handles DELETE /api/v1/todos/{id}, moving the todo to the trash,
+// and responds 204 No Content.
+func (h *APIHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	id, err := parseID(r)
+	if err != nil {
+		sendJSONError(w, "Invalid ID format", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.Store.Delete(r.Context(), currentUser(r).ID, id); err != nil {
+		sendJSONStoreError(w, err, "Failed to delete todo")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// DeleteCompleted handles DELETE /api/v1/todos/completed, optionally with
+// ?list_id=, and reports how many todos were moved to the trash.
+func (h *APIHandler) DeleteCompleted(w http.ResponseWriter, r *http.Request) {
+	list, ok := h.queryList(w, r, 0)
+	if !ok {
+		return
+	}
+
+	ids, err := h.Store.DeleteCompleted(r.Context(), currentUser(r).ID, list.ID)
+	if err != nil {
+		sendJSONError(w, "Error clearing completed todos", http.StatusInternalServerError)
+		return
+	}
+	sendJSON(w, http.StatusOK, map[string]int{"deleted": len(ids)})
+}
+
+// queryList resolves the list named by the list_id query parameter, or the
+// user's default list without one. Given a parent todo, it resolves the
+// parent's list instead. On failure it writes the error response and
+// returns false.
+func (h *APIHandler) queryList(w http.ResponseWriter, r *http.Request, parentID int) (models.List, bool) {
+	userID := currentUser(r).ID
+	if parentID != 0 {
+		parent, err := h.Store.Get(r.Context(), userID, parentID)
+		if err != nil {
+			sendJSONStoreError(w, err, "Failed to fetch todo")
+			return models.List{}, false
+		}
+		list, err := h.Lists.GetList(r.Context(), userID, parent.ListID)
+		if err != nil {
+			sendJSONListError(w, err, "Failed to fetch list")
+			return list, false
+		}
+		return list, true
+	}
+	param := r.URL.Query().Get("list_id")
+	if param == "" {
+		list, err := h.Lists.DefaultList(r.Context(), userID)
+		if err != nil {
+			sendJSONError(w, "Failed to fetch list", http.StatusInternalServerError)
+			return list, false
+		}
+		return list, true
+	}
+
+	id, err := strconv.Atoi(param)
+	if err != nil {
+		sendJSONError(w, "list_id must be a number", http.StatusBadRequest)
+		return models.List{}, false
+	}
+	list, err := h.Lists.GetList(r.Context(), userID, id)
+	if err != nil {
+		sendJSONListError(w, err, "Failed to fetch list")
+		return list, false
+	}
+	return list, true
+}
+
+// decodeJSON reads a single JSON object from the request body into v,
+// rejecting unknown fields and bodies larger than maxJSONBody.
+func decodeJSON(w http.ResponseWriter, r *http.Request, v any) error {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxJSONBody))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return errors.New("Invalid JSON body: " + err.Error())
+	}
+	if dec.More() {
+		return errors.New("Invalid JSON body: unexpected data after object")
+	}
+	return nil
+}
+
+// sendJSONStoreError is the JSON counterpart of sendStoreError.
+func sendJSONStoreError(w http.ResponseWriter, err error, msg string) {
+	if errors.Is(err, store.ErrNotFound) {
+		sendJSONError(w, "Todo not found", http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, store.ErrOutOfOrder) {
+		sendJSONError(w, errOutOfOrder, http.StatusConflict)
+		return
+	}
+	sendJSONError(w, msg, http.StatusInternalServerError)
+}
+
+// sendJSONListError is sendJSONStoreError for lists.
+func sendJSONListError(w http.ResponseWriter, err error, msg string) {
+	if errors.Is(err, store.ErrNotFound) {
+		sendJSONError(w, "List not found", http.StatusNotFound)
+		return
+	}
+	sendJSONError(w, msg, http.StatusInternalServerError)
+}
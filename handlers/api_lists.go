@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/Tottitov/todo/models"
+	"github.com/Tottitov/todo/store"
+)
+
+// APIListHandler serves the lists resource of the JSON REST API under /api/v1/lists.
+type APIListHandler struct {
+	Lists store.ListStore // Storage backend for lists
+}
+
+// List handles GET /api/v1/lists and returns every list of the user.
+func (h *APIListHandler) List(w http.ResponseWriter, r *http.Request) {
+	lists, err := h.Lists.Lists(r.Context(), currentUser(r).ID)
+	if err != nil {
+		sendJSONError(w, "Failed to fetch lists", http.StatusInternalServerError)
+		return
+	}
+	if lists == nil {
+		lists = []models.List{}
+	}
+	sendJSON(w, http.StatusOK, map[string]any{"lists": lists})
+}
+
+// Get handles GET /api/v1/lists/{listID}.
+func (h *APIListHandler) Get(w http.ResponseWriter, r *http.Request) {
+	id, err := parseListID(r)
+	if err != nil {
+		sendJSONError(w, "Invalid list ID", http.StatusBadRequest)
+		return
+	}
+
+	list, err := h.Lists.GetList(r.Context(), currentUser(r).ID, id)
+	if err != nil {
+		sendJSONListError(w, err, "Failed to fetch list")
+		return
+	}
+	sendJSON(w, http.StatusOK, list)
+}
+
+// Create handles POST /api/v1/lists with a {"name": "...", "color": "..."} body.
+// It responds 201 Created with the new list and its URL in the Location header.
+func (h *APIListHandler) Create(w http.ResponseWriter, r *http.Request) {
+	var in listInput
+	if err := decodeJSON(w, r, &in); err != nil {
+		sendJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := in.validate(); err != nil {
+		sendJSONError(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	list, err := h.Lists.CreateList(r.Context(), currentUser(r).ID, in.Name, in.Color)
+	if err != nil {
+		sendJSONError(w, "Failed to create list", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Location", "/api/v1/lists/"+strconv.Itoa(list.ID))
+	sendJSON(w, http.StatusCreated, list)
+}
+
+// Update handles PATCH /api/v1/lists/{listID} with a body containing any of
+// "name" and "color". It responds with the updated list.
+func (h *APIListHandler) Update(w http.ResponseWriter, r *http.Request) {
+	id, err := parseListID(r)
+	if err != nil {
+		sendJSONError(w, "Invalid list ID", http.StatusBadRequest)
+		return
+	}
+
+	var patch struct {
+		Name  *string `json:"name"`
+		Color *string `json:"color"`
+	}
+	if err := decodeJSON(w, r, &patch); err != nil {
+		sendJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Start from the stored list so absent fields are left unchanged
+	userID := currentUser(r).ID
+	list, err := h.Lists.GetList(r.Context(), userID, id)
+	if err != nil {
+		sendJSONListError(w, err, "Failed to update list")
+		return
+	}
+	in := listInput{Name: list.Name, Color: list.Color}
+	if patch.Name != nil {
+		in.Name = *patch.Name
+	}
+	if patch.Color != nil {
+		in.Color = *patch.Color
+	}
+	if err := in.validate(); err != nil {
+		sendJSONError(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	list, err = h.Lists.UpdateList(r.Context(), userID, id, in.Name, in.Color)
+	if err != nil {
+		sendJSONListError(w, err, "Failed to update list")
+		return
+	}
+	sendJSON(w, http.StatusOK, list)
+}
+
+// Delete handles DELETE /api/v1/lists/{listID}, removing the list together
+// with its todos, and responds 204 No Content.
+func (h *APIListHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	id, err := parseListID(r)
+	if err != nil {
+		sendJSONError(w, "Invalid list ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.Lists.DeleteList(r.Context(), currentUser(r).ID, id); err != nil {
+		sendJSONListError(w, err, "Failed to delete list")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
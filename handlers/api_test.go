@@ -0,0 +1,196 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"strconv"
+	"testing"
+
+	"github.com/Tottitov/todo/models"
+)
+
+// apiPage is the JSON of a page of GET /api/v1/todos.
+type apiPage struct {
+	todoList
+	List      models.List `json:"list"`
+	NextAfter int         `json:"next_after"`
+}
+
+func apiPath(id int, rest string) string {
+	return "/api/v1/todos/" + strconv.Itoa(id) + rest
+}
+
+func TestAPITodos(t *testing.T) {
+	ts := newTestServer(t)
+
+	var milk models.Todo
+	rec := ts.do("POST", "/api/v1/todos", `{"title": "Buy milk", "notes": "Oat", "priority": "high"}`, &milk)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("POST /api/v1/todos = %d %s", rec.Code, rec.Body)
+	}
+	if milk.Title != "Buy milk" || milk.Notes != "Oat" || milk.Priority != models.PriorityHigh || milk.ListID == 0 {
+		t.Errorf("created %+v", milk)
+	}
+	if loc := rec.Header().Get("Location"); loc != apiPath(milk.ID, "") {
+		t.Errorf("Location = %q", loc)
+	}
+
+	var got models.Todo
+	if rec := ts.do("GET", apiPath(milk.ID, ""), "", &got); rec.Code != http.StatusOK || got.ID != milk.ID || got.Title != "Buy milk" {
+		t.Errorf("GET = %d %+v", rec.Code, got)
+	}
+
+	rec = ts.do("PATCH", apiPath(milk.ID, ""), `{"title": "Buy oat milk", "completed": true}`, &got)
+	if rec.Code != http.StatusOK || got.Title != "Buy oat milk" || !got.Completed {
+		t.Errorf("PATCH = %d %+v", rec.Code, got)
+	}
+
+	ts.do("POST", "/api/v1/todos", `{"title": "Call mom"}`, nil)
+	var page apiPage
+	if rec := ts.do("GET", "/api/v1/todos?filter=active", "", &page); rec.Code != http.StatusOK {
+		t.Fatalf("GET /api/v1/todos = %d %s", rec.Code, rec.Body)
+	}
+	if len(page.Todos) != 1 || page.Todos[0].Title != "Call mom" || page.Active != 1 || page.Completed != 1 || page.List.ID != milk.ListID {
+		t.Errorf("active todos %v, counts %d and %d, list %+v", titles(page.Todos), page.Active, page.Completed, page.List)
+	}
+
+	var deleted map[string]int
+	if rec := ts.do("DELETE", "/api/v1/todos/completed", "", &deleted); rec.Code != http.StatusOK || deleted["deleted"] != 1 {
+		t.Errorf("DELETE /api/v1/todos/completed = %d %v, want 1 deleted", rec.Code, deleted)
+	}
+	if rec := ts.do("GET", apiPath(milk.ID, ""), "", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("GET of a deleted todo = %d, want 404", rec.Code)
+	}
+
+	mom := ts.list("").Todos[0]
+	if rec := ts.do("DELETE", apiPath(mom.ID, ""), "", nil); rec.Code != http.StatusNoContent {
+		t.Errorf("DELETE = %d %s", rec.Code, rec.Body)
+	}
+	if rec := ts.do("DELETE", apiPath(mom.ID, ""), "", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("second DELETE = %d, want 404", rec.Code)
+	}
+}
+
+// TestAPIPages pages through the todos with limit and next_after.
+func TestAPIPages(t *testing.T) {
+	ts := newTestServer(t)
+	want := []string{"a", "b", "c", "d", "e"}
+	for _, title := range want {
+		ts.create(`{"title": "` + title + `"}`)
+	}
+
+	var got []string
+	path := "/api/v1/todos?limit=2"
+	for range want {
+		var page apiPage
+		if rec := ts.do("GET", path, "", &page); rec.Code != http.StatusOK {
+			t.Fatalf("GET %s = %d %s", path, rec.Code, rec.Body)
+		}
+		got = append(got, titles(page.Todos)...)
+		if page.NextAfter == 0 {
+			break
+		}
+		path = "/api/v1/todos?limit=2&after=" + strconv.Itoa(page.NextAfter)
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("paged through %v, want %v", got, want)
+	}
+}
+
+// TestPageAfterPurged checks that asking for the page after a todo purged
+// since the page before was fetched is an error rather than an empty page,
+// which would end the list early.
+func TestPageAfterPurged(t *testing.T) {
+	ts := newTestServer(t)
+	for _, title := range []string{"a", "b", "c"} {
+		ts.create(`{"title": "` + title + `"}`)
+	}
+	var page apiPage
+	ts.do("GET", "/api/v1/todos?limit=1", "", &page)
+	ctx, cursor := context.Background(), page.NextAfter
+	if err := ts.store.Delete(ctx, ts.user.ID, cursor); err != nil {
+		t.Fatal(err)
+	}
+	after := strconv.Itoa(cursor)
+	if rec := ts.do("GET", "/api/v1/todos?limit=1&after="+after, "", &page); rec.Code != http.StatusOK || len(page.Todos) != 1 {
+		t.Errorf("page after a todo in the trash = %d %s", rec.Code, rec.Body)
+	}
+
+	if err := ts.store.Purge(ctx, ts.user.ID, cursor); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{"/api/v1/todos?limit=1&after=" + after, "/?after=" + after} {
+		if rec := ts.do("GET", path, "", nil); rec.Code != http.StatusBadRequest {
+			t.Errorf("GET %s after purging = %d, want 400", path, rec.Code)
+		}
+	}
+	req := ts.form("GET", "/?after="+after, "")
+	req.Header.Set("HX-Request", "true")
+	if rec := ts.serve(req, nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("loading more after purging = %d, want 400", rec.Code)
+	}
+}
+
+func TestAPIErrors(t *testing.T) {
+	ts := newTestServer(t)
+	todo := ts.create(`{"title": "Buy milk"}`)
+
+	tests := []struct {
+		method, path, body string
+		code               int
+	}{
+		{"GET", "/api/v1/todos?filter=someday", "", http.StatusBadRequest},
+		{"GET", "/api/v1/todos?sort=random", "", http.StatusBadRequest},
+		{"GET", "/api/v1/todos?limit=0", "", http.StatusBadRequest},
+		{"GET", "/api/v1/todos?limit=501", "", http.StatusBadRequest},
+		{"GET", "/api/v1/todos?list_id=x", "", http.StatusBadRequest},
+		{"GET", "/api/v1/todos?list_id=999", "", http.StatusNotFound},
+		{"GET", "/api/v1/todos/x", "", http.StatusBadRequest},
+		{"GET", apiPath(todo.ID+100, ""), "", http.StatusNotFound},
+		{"POST", "/api/v1/todos", `{"title": "x"`, http.StatusBadRequest},
+		{"POST", "/api/v1/todos", `{"title": "x"} {}`, http.StatusBadRequest},
+		{"POST", "/api/v1/todos", `{"title": "x", "unknown": 1}`, http.StatusBadRequest},
+		{"POST", "/api/v1/todos", `{"title": "x", "list_id": 999}`, http.StatusUnprocessableEntity},
+		{"POST", "/api/v1/todos", `{"title": "x", "due": {"date": "2026-13-01"}}`, http.StatusUnprocessableEntity},
+		{"PATCH", apiPath(todo.ID, ""), `{}`, http.StatusUnprocessableEntity},
+		{"PATCH", apiPath(todo.ID, ""), `{"list_id": 999}`, http.StatusUnprocessableEntity},
+		{"PATCH", apiPath(todo.ID+100, ""), `{"title": "x"}`, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		if rec := ts.do(tt.method, tt.path, tt.body, nil); rec.Code != tt.code {
+			t.Errorf("%s %s %s = %d, want %d", tt.method, tt.path, tt.body, rec.Code, tt.code)
+		}
+	}
+	if list := ts.list(""); len(list.Todos) != 1 || list.Todos[0].Title != "Buy milk" {
+		t.Errorf("failed requests changed the todos: %v", titles(list.Todos))
+	}
+}
+
+// TestAPIValidation checks that the API and the negotiated routes reject
+// the same todos with the same status.
+func TestAPIValidation(t *testing.T) {
+	ts := newTestServer(t)
+	todo := ts.create(`{"title": "Buy milk"}`)
+
+	for _, body := range []string{
+		`{"title": ""}`,
+		`{"title": "x", "due": {"date": "2026-13-01"}}`,
+		`{"title": "x", "due": {"date": "2026-10-20", "tz": "Europe/Paris"}}`,
+		`{"title": "x", "unknown": 1}`,
+	} {
+		negotiated := ts.do("POST", "/todos", body, nil)
+		api := ts.do("POST", "/api/v1/todos", body, nil)
+		if negotiated.Code != api.Code || negotiated.Body.String() != api.Body.String() {
+			t.Errorf("POST %s = %d %s from /todos but %d %s from /api/v1/todos", body, negotiated.Code, negotiated.Body, api.Code, api.Body)
+		}
+		negotiated = ts.do("PATCH", todoPath(todo.ID, ""), body, nil)
+		api = ts.do("PATCH", apiPath(todo.ID, ""), body, nil)
+		if negotiated.Code != api.Code || negotiated.Body.String() != api.Body.String() {
+			t.Errorf("PATCH %s = %d %s from /todos but %d %s from /api/v1/todos", body, negotiated.Code, negotiated.Body, api.Code, api.Body)
+		}
+	}
+	if list := ts.list(""); len(list.Todos) != 1 || list.Todos[0].Title != "Buy milk" {
+		t.Errorf("rejected requests changed the todos: %v", titles(list.Todos))
+	}
+}
@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Tottitov/todo/components"
+	"github.com/Tottitov/todo/models"
+	"github.com/Tottitov/todo/store"
+)
+
+// auditPageSize is how many events the audit page shows at most.
+const auditPageSize = 500
+
+// AuditHandler serves the log of changes to the user's todos: the audit
+// page, filterable by actor, action and date range, and the history of a
+// single todo.
+type AuditHandler struct {
+	Events store.EventStore // Storage backend for the change log
+	Todos  store.TodoStore  // Storage backend for todos, to tell unknown ones apart
+}
+
+// Page handles GET /audit, listing the latest changes to the user's todos,
+// newest first. The 'actor' (a user ID), 'action', 'from' and 'to' query
+// parameters narrow them down; the dates are days in the client's time zone
+// and both are included. HTMX receives the refreshed table, JSON clients
+// {"events": [...]}.
+func (h *AuditHandler) Page(w http.ResponseWriter, r *http.Request) {
+	repr := negotiate(w, r)
+
+	// Read the filters; a date range is turned into instants of the client's days
+	view, q, err := readAuditQuery(r)
+	if err != nil {
+		fail(w, repr, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Fetch the matching events, and the users who can be filtered by
+	userID := currentUser(r).ID
+	view.Events, err = h.Events.Events(r.Context(), userID, q)
+	if err != nil {
+		fail(w, repr, "Failed to fetch audit log", http.StatusInternalServerError)
+		return
+	}
+	if view.Events == nil {
+		view.Events = []models.Event{}
+	}
+
+	switch repr {
+	case reprJSON:
+		sendJSON(w, http.StatusOK, map[string][]models.Event{"events": view.Events})
+	case reprFragment:
+		setHTMLHeader(w)
+		components.AuditTable(view).Render(r.Context(), w)
+	default:
+		view.Actors, err = h.Events.Actors(r.Context(), userID)
+		if err != nil {
+			fail(w, repr, "Failed to fetch audit log", http.StatusInternalServerError)
+			return
+		}
+		setHTMLHeader(w)
+		components.AuditPage(view).Render(r.Context(), w)
+	}
+}
+
+// History handles GET /todos/{id}/history, listing the changes to one todo,
+// newest first. It works for todos in the trash, and for deleted todos as
+// long as their history is kept. HTMX receives the history panel, JSON
+// clients {"events": [...]}.
+func (h *AuditHandler) History(w http.ResponseWriter, r *http.Request) {
+	repr := negotiate(w, r)
+
+	// Extract and validate the todo ID from the URL
+	id, err := parseID(r)
+	if err != nil {
+		fail(w, repr, "Invalid ID format", http.StatusBadRequest)
+		return
+	}
+
+	// Fetch the todo's events; a todo without any must at least exist
+	userID := currentUser(r).ID
+	events, err := h.Events.Events(r.Context(), userID, store.EventQuery{TodoID: id})
+	if err != nil {
+		fail(w, repr, "Failed to fetch history", http.StatusInternalServerError)
+		return
+	}
+	if len(events) == 0 {
+		if _, err := h.Todos.Get(r.Context(), userID, id); err != nil {
+			failStore(w, repr, err, "Failed to fetch history")
+			return
+		}
+		events = []models.Event{}
+	}
+
+	switch repr {
+	case reprJSON:
+		sendJSON(w, http.StatusOK, map[string][]models.Event{"events": events})
+	default:
+		setHTMLHeader(w)
+		components.TodoHistory(events).Render(r.Context(), w)
+	}
+}
+
+// readAuditQuery reads the audit page's filters from the query string, both
+// as the view echoing them back and as the query for the store.
+func readAuditQuery(r *http.Request) (components.AuditView, store.EventQuery, error) {
+	values := r.URL.Query()
+	view := components.AuditView{From: values.Get("from"), To: values.Get("to")}
+	q := store.EventQuery{Limit: auditPageSize}
+
+	if actor := values.Get("actor"); actor != "" {
+		id, err := strconv.Atoi(actor)
+		if err != nil {
+			return view, q, errors.New("Invalid actor ID")
+		}
+		view.ActorID, q.ActorID = id, id
+	}
+	action, err := models.ParseAction(values.Get("action"))
+	if err != nil {
+		return view, q, err
+	}
+	view.Action, q.Action = action, action
+
+	loc := components.Location(r.Context())
+	if view.From != "" {
+		day, err := time.ParseInLocation(models.DateLayout, view.From, loc)
+		if err != nil {
+			return view, q, errors.New("Dates must look like 2006-01-02")
+		}
+		q.Since = day
+	}
+	if view.To != "" {
+		day, err := time.ParseInLocation(models.DateLayout, view.To, loc)
+		if err != nil {
+			return view, q, errors.New("Dates must look like 2006-01-02")
+		}
+		q.Until = day.AddDate(0, 0, 1)
+	}
+	return view, q, nil
+}
@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"testing"
+
+	"github.com/Tottitov/todo/models"
+)
+
+// auditLog is the JSON answer of the audit routes.
+type auditLog struct {
+	Events []models.Event `json:"events"`
+}
+
+// actions returns the actions of events, in order.
+func actions(events []models.Event) []models.Action {
+	var got []models.Action
+	for _, e := range events {
+		got = append(got, e.Action)
+	}
+	return got
+}
+
+func TestAudit(t *testing.T) {
+	ts := newTestServer(t)
+	todo := ts.create(`{"title": "Buy milk"}`)
+	ts.do("PATCH", todoPath(todo.ID, ""), `{"title": "Buy oat milk"}`, nil)
+	ts.do("POST", todoPath(todo.ID, "/toggle"), "", nil)
+	other := ts.create(`{"title": "Call mum"}`)
+	ts.do("DELETE", todoPath(other.ID, ""), "", nil)
+
+	var history auditLog
+	if rec := ts.do("GET", todoPath(todo.ID, "/history"), "", &history); rec.Code != http.StatusOK {
+		t.Fatalf("GET history = %d %s", rec.Code, rec.Body)
+	}
+	want := []models.Action{models.ActionCompleted, models.ActionTitleChanged, models.ActionCreated}
+	if got := actions(history.Events); !slices.Equal(got, want) {
+		t.Errorf("history = %v, want %v", got, want)
+	}
+	if e := history.Events[1]; e.From != "Buy milk" || e.To != "Buy oat milk" || e.Actor != ts.user.Email {
+		t.Errorf("rename = %+v", e)
+	}
+	// A deleted todo keeps its history
+	ts.do("GET", todoPath(other.ID, "/history"), "", &history)
+	if got := actions(history.Events); !slices.Equal(got, []models.Action{models.ActionDeleted, models.ActionCreated}) {
+		t.Errorf("history of a deleted todo = %v", got)
+	}
+
+	var page auditLog
+	if rec := ts.do("GET", "/audit", "", &page); rec.Code != http.StatusOK || len(page.Events) != 5 {
+		t.Errorf("GET /audit = %d with %d events, want 5", rec.Code, len(page.Events))
+	}
+	ts.do("GET", "/audit?action=completed", "", &page)
+	if len(page.Events) != 1 || page.Events[0].TodoID != todo.ID {
+		t.Errorf("completions = %+v", page.Events)
+	}
+	ts.do("GET", "/audit?to=2000-01-01", "", &page)
+	if len(page.Events) != 0 {
+		t.Errorf("changes up to 2000 = %+v", page.Events)
+	}
+
+	for _, tt := range []struct {
+		path string
+		code int
+	}{
+		{"/audit?action=shredded", http.StatusBadRequest},
+		{"/audit?actor=me", http.StatusBadRequest},
+		{"/audit?from=yesterday", http.StatusBadRequest},
+		{todoPath(9999, "/history"), http.StatusNotFound},
+	} {
+		if rec := ts.do("GET", tt.path, "", nil); rec.Code != tt.code {
+			t.Errorf("GET %s = %d, want %d", tt.path, rec.Code, tt.code)
+		}
+	}
+
+	// Another user sees neither the changes nor the todo's history
+	stranger, err := ts.store.CreateUser(context.Background(), "b@example.com", "hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	theirs := &testServer{t: t, store: ts.store, user: stranger, router: testRouter(ts.store, stranger)}
+	if rec := theirs.do("GET", "/audit", "", &page); rec.Code != http.StatusOK || len(page.Events) != 0 {
+		t.Errorf("another user's audit = %d %+v", rec.Code, page.Events)
+	}
+	if rec := theirs.do("GET", todoPath(todo.ID, "/history"), "", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("another user's view of the history = %d, want 404", rec.Code)
+	}
+}
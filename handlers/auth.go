@@ -0,0 +1,390 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"mime"
+	"net/http"
+	"net/mail"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Tottitov/todo/auth"
+	"github.com/Tottitov/todo/components"
+	"github.com/Tottitov/todo/models"
+	"github.com/Tottitov/todo/store"
+	"github.com/a-h/templ"
+)
+
+const (
+	// sessionCookie is the name of the cookie holding the session token.
+	sessionCookie = "session"
+	// sessionTTL is how long a login lasts.
+	sessionTTL = 30 * 24 * time.Hour
+	// anonymousCookie is the name of the cookie holding the signed ID of an anonymous user.
+	anonymousCookie = "anon"
+	// anonymousCookieTTL is how long the browser keeps the anonymous cookie.
+	// Idle lists are purged server-side long before it runs out.
+	anonymousCookieTTL = 365 * 24 * time.Hour
+)
+
+// contextKey namespaces values stored in request contexts by this package.
+type contextKey int
+
+const (
+	userKey  contextKey = iota
+	quietKey            // Set by handlers that changed nothing, see unchanged
+)
+
+// AuthHandler serves registration, login and logout, and provides the
+// middleware that resolves the session cookie to the current user.
+type AuthHandler struct {
+	Users    store.UserStore    // Registered and anonymous accounts
+	Sessions store.SessionStore // Server-side login sessions
+
+	// AnonymousSigner, when set, enables anonymous per-browser lists: visitors
+	// without a session get an anonymous user identified by a cookie signed
+	// with it, instead of being sent to the login page.
+	AnonymousSigner *auth.Signer
+}
+
+// credentials is the JSON body accepted by Login and Register.
+type credentials struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+// LoginPage handles GET /login and renders the login form.
+func (h *AuthHandler) LoginPage(w http.ResponseWriter, r *http.Request) {
+	setHTMLHeader(w)
+	components.Login(components.AuthForm{}).Render(r.Context(), w)
+}
+
+// RegisterPage handles GET /register and renders the sign-up form.
+func (h *AuthHandler) RegisterPage(w http.ResponseWriter, r *http.Request) {
+	setHTMLHeader(w)
+	components.Register(components.AuthForm{}).Render(r.Context(), w)
+}
+
+// Login handles POST /login. On success it starts a session and redirects to
+// the todo list (or returns the user as JSON); on failure it re-renders the
+// form with an error.
+func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
+	repr := negotiate(w, r)
+
+	creds, err := readCredentials(w, r)
+	if err != nil {
+		h.authFailed(w, r, repr, components.Login, creds.Email, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Verify the password, spending the same time whether or not the user exists
+	user, err := h.Users.GetUserByEmail(r.Context(), creds.Email)
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		auth.CheckNoPassword(creds.Password)
+	case err != nil:
+		fail(w, repr, "Failed to log in", http.StatusInternalServerError)
+		return
+	}
+	if err != nil || !auth.CheckPassword(user.PasswordHash, creds.Password) {
+		h.authFailed(w, r, repr, components.Login, creds.Email, "Incorrect email or password", http.StatusUnauthorized)
+		return
+	}
+
+	if err := h.startSession(w, r, user); err != nil {
+		fail(w, repr, "Failed to start session", http.StatusInternalServerError)
+		return
+	}
+	h.authSucceeded(w, r, repr, user, http.StatusOK)
+}
+
+// Register handles POST /register. It creates the account, logs the new
+// user in and redirects to their (empty) todo list.
+func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
+	repr := negotiate(w, r)
+
+	creds, err := readCredentials(w, r)
+	if err != nil {
+		h.authFailed(w, r, repr, components.Register, creds.Email, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// Keep the bare address, so "Bob <bob@x.io>" is the same account as
+	// bob@x.io and logs in as it
+	addr, err := mail.ParseAddress(creds.Email)
+	if err != nil || strings.HasSuffix(addr.Address, ".invalid") {
+		h.authFailed(w, r, repr, components.Register, creds.Email, "Enter a valid email address", http.StatusUnprocessableEntity)
+		return
+	}
+	creds.Email = strings.ToLower(addr.Address)
+
+	// Hash the password; this also enforces the length limits
+	hash, err := auth.HashPassword(creds.Password)
+	if err != nil {
+		h.authFailed(w, r, repr, components.Register, creds.Email, "Password "+strings.TrimPrefix(err.Error(), "password "), http.StatusUnprocessableEntity)
+		return
+	}
+
+	// Claim the visitor's anonymous list if they have one, otherwise start fresh
+	var user models.User
+	if anon, ok := h.anonymousUser(r); ok {
+		user, err = h.Users.ClaimAnonymousUser(r.Context(), anon.ID, creds.Email, hash)
+		if err == nil {
+			h.clearCookie(w, r, anonymousCookie)
+		}
+	} else {
+		user, err = h.Users.CreateUser(r.Context(), creds.Email, hash)
+	}
+	if errors.Is(err, store.ErrEmailTaken) {
+		h.authFailed(w, r, repr, components.Register, creds.Email, "An account with that email already exists", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		fail(w, repr, "Failed to create account", http.StatusInternalServerError)
+		return
+	}
+
+	if err := h.startSession(w, r, user); err != nil {
+		fail(w, repr, "Failed to start session", http.StatusInternalServerError)
+		return
+	}
+	h.authSucceeded(w, r, repr, user, http.StatusCreated)
+}
+
+// Logout handles POST /logout by ending the session and clearing the cookie.
+func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	if c, err := r.Cookie(sessionCookie); err == nil {
+		if err := h.Sessions.DeleteSession(r.Context(), auth.HashToken(c.Value)); err != nil {
+			sendError(w, "Failed to log out", http.StatusInternalServerError)
+			return
+		}
+	}
+	h.clearCookie(w, r, sessionCookie)
+
+	if negotiate(w, r) == reprJSON {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	http.Redirect(w, r, "/login", http.StatusSeeOther)
+}
+
+// RequireUser is middleware that resolves the session cookie to a user and
+// stores it in the request context. Requests without a valid session are
+// sent to the login page (or get a 401 for JSON and HTMX clients).
+func (h *AuthHandler) RequireUser(next http.Handler) http.Handler {
+	return h.requireUser(next, false)
+}
+
+// RequireAPIUser is RequireUser for the JSON API: failures are always JSON.
+func (h *AuthHandler) RequireAPIUser(next http.Handler) http.Handler {
+	return h.requireUser(next, true)
+}
+
+// requireUser implements RequireUser and RequireAPIUser.
+func (h *AuthHandler) requireUser(next http.Handler, api bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, err := h.sessionUser(r)
+		if errors.Is(err, store.ErrNotFound) && h.AnonymousSigner != nil {
+			// Only full-page visits mint new anonymous users, so API clients
+			// and stray requests without cookies don't pile up empty accounts
+			mint := !api && r.Method == http.MethodGet && r.Header.Get("HX-Request") != "true"
+			user, err = h.anonymousOwner(w, r, mint)
+		}
+		if err == nil {
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), userKey, user)))
+			return
+		}
+
+		repr := reprJSON
+		if !api {
+			repr = negotiate(w, r)
+		}
+		if !errors.Is(err, store.ErrNotFound) {
+			fail(w, repr, "Failed to load session", http.StatusInternalServerError)
+			return
+		}
+		switch repr {
+		case reprJSON:
+			sendJSONError(w, "Authentication required", http.StatusUnauthorized)
+		case reprFragment:
+			// Tell HTMX to navigate the whole page rather than swap in an error
+			w.Header().Set("HX-Redirect", "/login")
+			w.WriteHeader(http.StatusUnauthorized)
+		default:
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+		}
+	})
+}
+
+// sessionUser returns the user owning the request's session cookie, or
+// ErrNotFound if there is no valid session.
+func (h *AuthHandler) sessionUser(r *http.Request) (models.User, error) {
+	c, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return models.User{}, store.ErrNotFound
+	}
+	session, err := h.Sessions.GetSession(r.Context(), auth.HashToken(c.Value))
+	if err != nil {
+		return models.User{}, err
+	}
+	return h.Users.GetUser(r.Context(), session.UserID)
+}
+
+// anonymousOwner returns the anonymous user identified by the request's signed
+// cookie, recording the visit so the list isn't purged as idle. Without a
+// valid cookie it mints a new anonymous user if mint is set, and otherwise
+// returns ErrNotFound.
+func (h *AuthHandler) anonymousOwner(w http.ResponseWriter, r *http.Request, mint bool) (models.User, error) {
+	if user, ok := h.anonymousUser(r); ok {
+		return user, h.Users.TouchUser(r.Context(), user.ID, time.Now())
+	}
+	if !mint {
+		return models.User{}, store.ErrNotFound
+	}
+
+	user, err := h.Users.CreateAnonymousUser(r.Context())
+	if err != nil {
+		return models.User{}, err
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     anonymousCookie,
+		Value:    h.AnonymousSigner.Sign(strconv.Itoa(user.ID)),
+		Path:     "/",
+		MaxAge:   int(anonymousCookieTTL / time.Second),
+		HttpOnly: true,
+		Secure:   isHTTPS(r),
+		SameSite: http.SameSiteLaxMode,
+	})
+	return user, nil
+}
+
+// anonymousUser returns the still-anonymous user named by the request's
+// signed cookie, if anonymous lists are enabled and the cookie is valid.
+func (h *AuthHandler) anonymousUser(r *http.Request) (models.User, bool) {
+	if h.AnonymousSigner == nil {
+		return models.User{}, false
+	}
+	c, err := r.Cookie(anonymousCookie)
+	if err != nil {
+		return models.User{}, false
+	}
+	value, ok := h.AnonymousSigner.Verify(c.Value)
+	if !ok {
+		return models.User{}, false
+	}
+	id, err := strconv.Atoi(value)
+	if err != nil {
+		return models.User{}, false
+	}
+	// A purged or already claimed user no longer identifies an anonymous list
+	user, err := h.Users.GetUser(r.Context(), id)
+	if err != nil || !user.Anonymous {
+		return models.User{}, false
+	}
+	return user, true
+}
+
+// startSession creates a session for user and sets its cookie.
+func (h *AuthHandler) startSession(w http.ResponseWriter, r *http.Request, user models.User) error {
+	token, hash, err := auth.NewToken()
+	if err != nil {
+		return err
+	}
+
+	// Opportunistically clear out sessions that have expired
+	now := time.Now()
+	if err := h.Sessions.DeleteExpiredSessions(r.Context(), now); err != nil {
+		return err
+	}
+
+	expires := now.Add(sessionTTL)
+	if err := h.Sessions.CreateSession(r.Context(), models.Session{
+		TokenHash: hash,
+		UserID:    user.ID,
+		ExpiresAt: expires,
+	}); err != nil {
+		return err
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    token,
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   isHTTPS(r),
+		SameSite: http.SameSiteLaxMode,
+	})
+	return nil
+}
+
+// clearCookie tells the browser to drop the named cookie.
+func (h *AuthHandler) clearCookie(w http.ResponseWriter, r *http.Request, name string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   isHTTPS(r),
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// authSucceeded finishes a successful login or registration.
+func (h *AuthHandler) authSucceeded(w http.ResponseWriter, r *http.Request, repr representation, user models.User, code int) {
+	if repr == reprJSON {
+		sendJSON(w, code, user)
+		return
+	}
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// authFailed re-renders the login or register form with an error message.
+func (h *AuthHandler) authFailed(w http.ResponseWriter, r *http.Request, repr representation,
+	page func(components.AuthForm) templ.Component, email, msg string, code int) {
+	if repr == reprJSON {
+		sendJSONError(w, msg, code)
+		return
+	}
+	setHTMLHeader(w)
+	w.WriteHeader(code)
+	page(components.AuthForm{Email: email, Error: msg}).Render(r.Context(), w)
+}
+
+// readCredentials extracts the email and password from a JSON body or form
+// data. The email is normalized to lower case.
+func readCredentials(w http.ResponseWriter, r *http.Request) (credentials, error) {
+	var creds credentials
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == contentTypeJSON {
+		if err := decodeJSON(w, r, &creds); err != nil {
+			return credentials{}, err
+		}
+	} else {
+		if err := r.ParseForm(); err != nil {
+			return credentials{}, errFormParse
+		}
+		creds.Email = r.PostForm.Get("email")
+		creds.Password = r.PostForm.Get("password")
+	}
+
+	creds.Email = strings.ToLower(strings.TrimSpace(creds.Email))
+	if creds.Email == "" || creds.Password == "" {
+		return creds, errors.New("Email and password are required")
+	}
+	return creds, nil
+}
+
+// currentUser returns the user stored in the request context by RequireUser.
+// It must only be called from handlers mounted behind that middleware.
+func currentUser(r *http.Request) models.User {
+	user, _ := r.Context().Value(userKey).(models.User)
+	return user
+}
+
+// isHTTPS reports whether the client connected over TLS, either directly or
+// through a proxy such as Fly's edge that terminates TLS.
+func isHTTPS(r *http.Request) bool {
+	return r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https"
+}
@@ -0,0 +1,241 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Tottitov/todo/auth"
+	"github.com/Tottitov/todo/store"
+	"github.com/go-chi/chi/v5"
+)
+
+// authServer serves the account routes and, behind the session
+// middleware, the todo list and the API on the memory store. Like a
+// browser, it keeps the cookies its responses set and sends them back.
+type authServer struct {
+	t       *testing.T
+	store   store.Store
+	router  http.Handler
+	cookies map[string]*http.Cookie
+}
+
+// newAuthServer returns a server on a fresh memory store, with anonymous
+// lists signed by signer if it isn't nil.
+func newAuthServer(t *testing.T, signer *auth.Signer) *authServer {
+	t.Helper()
+	s, err := store.Open(context.Background(), "memory://")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(s.Close)
+	return &authServer{t: t, store: s, router: authRouter(s, signer), cookies: map[string]*http.Cookie{}}
+}
+
+// instance returns another server instance on as's store, with anonymous
+// lists signed by signer, to which the browser sends the same cookies.
+func (as *authServer) instance(signer *auth.Signer) *authServer {
+	return &authServer{t: as.t, store: as.store, router: authRouter(as.store, signer), cookies: as.cookies}
+}
+
+// authRouter routes the requests of an authServer.
+func authRouter(s store.Store, signer *auth.Signer) http.Handler {
+	h := &AuthHandler{Users: s, Sessions: s, AnonymousSigner: signer}
+	todos := &TodoHandler{Store: s, Lists: s, Undos: s}
+	api := &APIHandler{Store: s, Lists: s}
+	r := chi.NewRouter()
+	r.Post("/register", h.Register)
+	r.Post("/login", h.Login)
+	r.Post("/logout", h.Logout)
+	r.With(h.RequireUser).Get("/", todos.List)
+	r.With(h.RequireUser).Post("/todos", todos.Create)
+	r.With(h.RequireAPIUser).Get("/api/v1/todos", api.List)
+	return r
+}
+
+// do sends a request with the kept cookies, accepting accept, with body
+// sent as JSON if it is an object and as a form otherwise.
+func (as *authServer) do(method, path, accept, body string) *httptest.ResponseRecorder {
+	as.t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Accept", accept)
+	switch {
+	case strings.HasPrefix(body, "{"):
+		req.Header.Set("Content-Type", "application/json")
+	case body != "":
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	for _, c := range as.cookies {
+		req.AddCookie(c)
+	}
+	rec := httptest.NewRecorder()
+	as.router.ServeHTTP(rec, req)
+	for _, c := range rec.Result().Cookies() {
+		if c.MaxAge < 0 {
+			delete(as.cookies, c.Name)
+		} else {
+			as.cookies[c.Name] = c
+		}
+	}
+	return rec
+}
+
+func TestRegisterAndLogin(t *testing.T) {
+	as := newAuthServer(t, nil)
+
+	rec := as.do("POST", "/register", "application/json", `{"email": "Ann <Ann@Example.com>", "password": "correct horse"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("register = %d %s", rec.Code, rec.Body)
+	}
+	c := as.cookies[sessionCookie]
+	if c == nil || !c.HttpOnly || c.SameSite != http.SameSiteLaxMode {
+		t.Fatalf("session cookie %+v, want an HTTP-only SameSite=Lax one", c)
+	}
+	if _, err := as.store.GetSession(context.Background(), c.Value); err == nil {
+		t.Error("the session is stored under its token rather than its hash")
+	}
+	if rec := as.do("GET", "/", "application/json", ""); rec.Code != http.StatusOK {
+		t.Errorf("GET / signed in = %d %s", rec.Code, rec.Body)
+	}
+
+	if rec := as.do("POST", "/logout", "application/json", ""); rec.Code != http.StatusNoContent || as.cookies[sessionCookie] != nil {
+		t.Errorf("logout = %d, session cookie %+v", rec.Code, as.cookies[sessionCookie])
+	}
+	// The old token no longer works, even if the browser kept it
+	as.cookies[sessionCookie] = c
+	if rec := as.do("GET", "/", "application/json", ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("GET / with a logged out session = %d, want 401", rec.Code)
+	}
+	delete(as.cookies, sessionCookie)
+
+	if rec := as.do("POST", "/login", "text/html", "email=ann%40example.com&password=wrong+horse"); rec.Code != http.StatusUnauthorized {
+		t.Errorf("login with a wrong password = %d, want 401", rec.Code)
+	}
+	rec = as.do("POST", "/login", "text/html", "email=ANN%40example.com&password=correct+horse")
+	if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/" || as.cookies[sessionCookie] == nil {
+		t.Errorf("login = %d to %q, want a session and a redirect to /", rec.Code, rec.Header().Get("Location"))
+	}
+	if rec := as.do("GET", "/api/v1/todos", "application/json", ""); rec.Code != http.StatusOK {
+		t.Errorf("GET /api/v1/todos signed in = %d %s", rec.Code, rec.Body)
+	}
+}
+
+func TestRegisterErrors(t *testing.T) {
+	as := newAuthServer(t, nil)
+	if rec := as.do("POST", "/register", "application/json", `{"email": "a@example.com", "password": "correct horse"}`); rec.Code != http.StatusCreated {
+		t.Fatalf("register = %d %s", rec.Code, rec.Body)
+	}
+	delete(as.cookies, sessionCookie)
+
+	tests := []struct {
+		body string
+		code int
+	}{
+		{`{"email": "", "password": "correct horse"}`, http.StatusBadRequest},
+		{`{"email": "b@example.com"}`, http.StatusBadRequest},
+		{`{"email": "not an address", "password": "correct horse"}`, http.StatusUnprocessableEntity},
+		{`{"email": "b@anon.invalid", "password": "correct horse"}`, http.StatusUnprocessableEntity},
+		{`{"email": "b@example.com", "password": "short"}`, http.StatusUnprocessableEntity},
+		{`{"email": "A@example.com", "password": "other horse"}`, http.StatusConflict},
+	}
+	for _, tt := range tests {
+		if rec := as.do("POST", "/register", "application/json", tt.body); rec.Code != tt.code {
+			t.Errorf("register %s = %d, want %d", tt.body, rec.Code, tt.code)
+		}
+		if c := as.cookies[sessionCookie]; c != nil {
+			t.Errorf("register %s started a session", tt.body)
+			delete(as.cookies, sessionCookie)
+		}
+	}
+}
+
+// TestRequireUser checks how each kind of client is turned away without a
+// session.
+func TestRequireUser(t *testing.T) {
+	as := newAuthServer(t, nil)
+
+	if rec := as.do("GET", "/", "text/html", ""); rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/login" {
+		t.Errorf("page = %d to %q, want a redirect to /login", rec.Code, rec.Header().Get("Location"))
+	}
+	req := httptest.NewRequest("POST", "/todos", strings.NewReader("title=x"))
+	req.Header.Set("HX-Request", "true")
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	as.router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized || rec.Header().Get("HX-Redirect") != "/login" {
+		t.Errorf("HTMX request = %d, HX-Redirect %q, want 401 to /login", rec.Code, rec.Header().Get("HX-Redirect"))
+	}
+	for _, path := range []string{"/", "/api/v1/todos"} {
+		if rec := as.do("GET", path, "application/json", ""); rec.Code != http.StatusUnauthorized {
+			t.Errorf("JSON GET %s = %d, want 401", path, rec.Code)
+		}
+	}
+	as.cookies[sessionCookie] = &http.Cookie{Name: sessionCookie, Value: "forged"}
+	if rec := as.do("GET", "/api/v1/todos", "text/html", ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("API request with a forged session = %d, want 401", rec.Code)
+	}
+}
+
+func TestAnonymousLists(t *testing.T) {
+	signer, err := auth.NewSigner([]byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	as := newAuthServer(t, signer)
+
+	// Page visits mint an anonymous owner, API requests don't
+	if rec := as.do("GET", "/api/v1/todos", "application/json", ""); rec.Code != http.StatusUnauthorized || as.cookies[anonymousCookie] != nil {
+		t.Errorf("API request without a cookie = %d, cookie %+v, want 401 and none", rec.Code, as.cookies[anonymousCookie])
+	}
+	if rec := as.do("GET", "/", "text/html", ""); rec.Code != http.StatusOK || as.cookies[anonymousCookie] == nil {
+		t.Fatalf("page without a cookie = %d, cookie %+v, want an anonymous list", rec.Code, as.cookies[anonymousCookie])
+	}
+	if rec := as.do("POST", "/todos", "application/json", `{"title": "Buy milk"}`); rec.Code != http.StatusCreated {
+		t.Fatalf("create = %d %s", rec.Code, rec.Body)
+	}
+
+	// Another instance, or this one restarted, knows the visitor by the
+	// same secret, and takes a cookie signed with another key for a stranger
+	same, err := auth.NewSigner([]byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if list := anonymousTitles(t, as.instance(same)); len(list) != 1 || list[0] != "Buy milk" {
+		t.Errorf("anonymous list on another instance %v, want [Buy milk]", list)
+	}
+	other, err := auth.NewSigner([]byte("other"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec := as.instance(other).do("GET", "/api/v1/todos", "application/json", ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("API request with a cookie signed with another key = %d, want 401", rec.Code)
+	}
+
+	// Signing up keeps the list and drops the anonymous cookie
+	if rec := as.do("POST", "/register", "application/json", `{"email": "a@example.com", "password": "correct horse"}`); rec.Code != http.StatusCreated {
+		t.Fatalf("register = %d %s", rec.Code, rec.Body)
+	}
+	if as.cookies[anonymousCookie] != nil || as.cookies[sessionCookie] == nil {
+		t.Errorf("cookies after signing up: %v", as.cookies)
+	}
+	if list := anonymousTitles(t, as); len(list) != 1 || list[0] != "Buy milk" {
+		t.Errorf("list after signing up %v, want [Buy milk]", list)
+	}
+}
+
+// anonymousTitles returns the titles of the todos as's visitor sees.
+func anonymousTitles(t *testing.T, as *authServer) []string {
+	t.Helper()
+	rec := as.do("GET", "/api/v1/todos", "application/json", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /api/v1/todos = %d %s", rec.Code, rec.Body)
+	}
+	var page apiPage
+	if err := json.Unmarshal(rec.Body.Bytes(), &page); err != nil {
+		t.Fatal(err)
+	}
+	return titles(page.Todos)
+}
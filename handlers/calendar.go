@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Tottitov/todo/auth"
+	"github.com/Tottitov/todo/components"
+	"github.com/Tottitov/todo/store"
+	"github.com/Tottitov/todo/transfer"
+	"github.com/go-chi/chi/v5"
+)
+
+// CalendarHandler serves the user's todos as an iCalendar feed that
+// calendar apps subscribe to, at a URL whose secret token stands in for a
+// login, and the page to turn the feed on, reset its URL and turn it off.
+type CalendarHandler struct {
+	Feeds    store.FeedStore  // Storage backend for the feed tokens
+	Transfer *TransferHandler // Writes the feed, as an export
+	BaseURL  string           // Where the app is reached, e.g. https://todo.example.com
+}
+
+// Page handles GET /calendar, telling whether the user's feed is on. JSON
+// clients get {"enabled", "created_at"}.
+func (h *CalendarHandler) Page(w http.ResponseWriter, r *http.Request) {
+	repr := negotiate(w, r)
+
+	view, err := h.view(r)
+	if err != nil {
+		fail(w, repr, "Failed to fetch the calendar feed", http.StatusInternalServerError)
+		return
+	}
+	h.render(w, r, repr, view, http.StatusOK)
+}
+
+// CreateFeed handles POST /calendar/feed, giving the user a feed URL with
+// a new token, in place of the one they had. Only the token's hash is
+// kept, so the URL is shown this once. JSON clients get {"enabled",
+// "created_at", "url", "events_url"} with 201 Created.
+func (h *CalendarHandler) CreateFeed(w http.ResponseWriter, r *http.Request) {
+	repr := negotiate(w, r)
+
+	token, hash, err := auth.NewToken()
+	if err != nil {
+		fail(w, repr, "Failed to create the calendar feed", http.StatusInternalServerError)
+		return
+	}
+	if err := h.Feeds.SetFeedToken(r.Context(), currentUser(r).ID, hash); err != nil {
+		fail(w, repr, "Failed to create the calendar feed", http.StatusInternalServerError)
+		return
+	}
+	view, err := h.view(r)
+	if err != nil {
+		fail(w, repr, "Failed to fetch the calendar feed", http.StatusInternalServerError)
+		return
+	}
+	view.URL = h.feedURL(token)
+	view.EventsURL = view.URL + "?events=true"
+	h.render(w, r, repr, view, http.StatusCreated)
+}
+
+// DeleteFeed handles DELETE /calendar/feed, turning the user's feed off:
+// its URL stops working.
+func (h *CalendarHandler) DeleteFeed(w http.ResponseWriter, r *http.Request) {
+	repr := negotiate(w, r)
+
+	if err := h.Feeds.DeleteFeedToken(r.Context(), currentUser(r).ID); err != nil {
+		fail(w, repr, "Failed to turn the calendar feed off", http.StatusInternalServerError)
+		return
+	}
+	switch repr {
+	case reprJSON:
+		w.WriteHeader(http.StatusNoContent)
+	case reprFragment:
+		setHTMLHeader(w)
+		components.CalendarFeed(components.CalendarView{}).Render(r.Context(), w)
+	default:
+		http.Redirect(w, r, "/calendar", http.StatusSeeOther)
+	}
+}
+
+// Feed handles GET /calendar/{token}.ics, the feed itself: every todo of
+// the user the token belongs to outside the trash, as a VTODO, and with
+// ?events=true the due date of each open one as a VEVENT too. It needs no
+// login; an unknown token is not found.
+func (h *CalendarHandler) Feed(w http.ResponseWriter, r *http.Request) {
+	repr := negotiate(w, r)
+
+	userID, err := h.Feeds.FeedUser(r.Context(), auth.HashToken(chi.URLParam(r, "token")))
+	if errors.Is(err, store.ErrNotFound) {
+		fail(w, repr, "Calendar feed not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		fail(w, repr, "Failed to fetch the calendar feed", http.StatusInternalServerError)
+		return
+	}
+	events := false
+	if v := r.URL.Query().Get("events"); v != "" {
+		if events, err = strconv.ParseBool(v); err != nil {
+			fail(w, repr, "events must be true or false", http.StatusBadRequest)
+			return
+		}
+	}
+	w.Header().Set("Cache-Control", "private, no-cache")
+	h.Transfer.export(w, r, repr, userID, transfer.FormatICS, `inline; filename="todos.ics"`, events)
+}
+
+// view returns the view of the user's feed, without its URL.
+func (h *CalendarHandler) view(r *http.Request) (components.CalendarView, error) {
+	created, err := h.Feeds.FeedCreated(r.Context(), currentUser(r).ID)
+	if errors.Is(err, store.ErrNotFound) {
+		return components.CalendarView{}, nil
+	}
+	if err != nil {
+		return components.CalendarView{}, err
+	}
+	return components.CalendarView{Enabled: true, CreatedAt: created}, nil
+}
+
+// render writes the view of the user's feed as JSON, the feed's section of
+// the page, or the whole page.
+func (h *CalendarHandler) render(w http.ResponseWriter, r *http.Request, repr representation, view components.CalendarView, code int) {
+	switch repr {
+	case reprJSON:
+		sendJSON(w, code, view)
+	case reprFragment:
+		setHTMLHeader(w)
+		w.WriteHeader(code)
+		components.CalendarFeed(view).Render(r.Context(), w)
+	default:
+		setHTMLHeader(w)
+		w.WriteHeader(code)
+		components.CalendarPage(view).Render(r.Context(), w)
+	}
+}
+
+// feedURL returns the URL of the feed with the given token, under BaseURL.
+// The Host header is not used: the client sets it, and the URL is a secret.
+func (h *CalendarHandler) feedURL(token string) string {
+	return strings.TrimSuffix(h.BaseURL, "/") + "/calendar/" + token + ".ics"
+}
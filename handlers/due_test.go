@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Tottitov/todo/models"
+)
+
+// inZone returns req with the tz cookie naming zone.
+func inZone(req *http.Request, zone string) *http.Request {
+	req.AddCookie(&http.Cookie{Name: tzCookie, Value: zone})
+	return req
+}
+
+// TestDueFilters checks that the date filters go by the day in the
+// client's time zone: a day ahead of UTC in Kiritimati, and a day behind
+// in Pago Pago.
+func TestDueFilters(t *testing.T) {
+	ts := newTestServer(t)
+	east, err := time.LoadLocation("Pacific/Kiritimati")
+	if err != nil {
+		t.Fatal(err)
+	}
+	today := time.Now().In(east)
+	day := func(days int) string { return today.AddDate(0, 0, days).Format(models.DateLayout) }
+	ts.create(`{"title": "Yesterday", "due": {"date": "` + day(-1) + `"}}`)
+	ts.create(`{"title": "Today", "due": {"date": "` + day(0) + `"}}`)
+	ts.create(`{"title": "Tomorrow", "due": {"date": "` + day(1) + `"}}`)
+	ts.create(`{"title": "Whenever"}`)
+	done := ts.create(`{"title": "Done yesterday", "due": {"date": "` + day(-1) + `"}}`)
+	ts.do("POST", todoPath(done.ID, "/toggle"), "", nil)
+
+	tests := []struct {
+		zone, filter string
+		want         []string
+	}{
+		{"Pacific/Kiritimati", "today", []string{"Today"}},
+		{"Pacific/Kiritimati", "overdue", []string{"Yesterday"}},
+		{"Pacific/Kiritimati", "upcoming", []string{"Tomorrow"}},
+		// Kiritimati's today is tomorrow or later in Pago Pago
+		{"Pacific/Pago_Pago", "overdue", nil},
+		{"Pacific/Pago_Pago", "upcoming", []string{"Today", "Tomorrow"}},
+	}
+	for _, tt := range tests {
+		var list todoList
+		if rec := ts.serve(inZone(ts.request("GET", "/?filter="+tt.filter, ""), tt.zone), &list); rec.Code != http.StatusOK {
+			t.Fatalf("GET /?filter=%s = %d %s", tt.filter, rec.Code, rec.Body)
+		}
+		got := titles(list.Todos)
+		if tt.zone == "Pacific/Pago_Pago" && tt.filter == "upcoming" {
+			// Yesterday in Kiritimati may still be today in Pago Pago
+			got = slices.DeleteFunc(got, func(s string) bool { return s == "Yesterday" })
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s in %s = %v, want %v", tt.filter, tt.zone, got, tt.want)
+		}
+	}
+}
+
+// TestDueForm checks that due dates from the HTML form are in the client's
+// time zone, and that the list highlights overdue todos.
+func TestDueForm(t *testing.T) {
+	ts := newTestServer(t)
+	form := url.Values{"title": {"Call the bank"}, "due_date": {"2020-01-02"}, "due_time": {"09:30"}}
+	req := inZone(ts.form("POST", "/todos", form.Encode()), "Asia/Tokyo")
+	if rec := ts.serve(req, nil); rec.Code != http.StatusSeeOther {
+		t.Fatalf("form POST /todos = %d %s", rec.Code, rec.Body)
+	}
+	todo := ts.list("").Todos[0]
+	if todo.Due == nil || *todo.Due != (models.Due{Date: "2020-01-02", Time: "09:30", TZ: "Asia/Tokyo"}) {
+		t.Errorf("due from the form = %+v", todo.Due)
+	}
+
+	// Leaving due_date out leaves the due date alone, and an empty one clears it
+	ts.serve(ts.form("PATCH", todoPath(todo.ID, ""), "title=Call+the+bank+first"), nil)
+	if todo := ts.list("").Todos[0]; todo.Due == nil || todo.Title != "Call the bank first" {
+		t.Errorf("renamed to %q, due %+v", todo.Title, todo.Due)
+	}
+	ts.serve(ts.form("PATCH", todoPath(todo.ID, ""), "title=Call+the+bank&due_date="), nil)
+	if todo := ts.list("").Todos[0]; todo.Due != nil {
+		t.Errorf("due after clearing = %+v", todo.Due)
+	}
+
+	ts.create(`{"title": "Late", "due": {"date": "2020-01-02"}}`)
+	req = ts.form("GET", "/", "")
+	req.Header.Set("HX-Request", "true")
+	rec := ts.serve(req, nil)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "border-red-500") {
+		t.Errorf("list fragment = %d, without an overdue badge:\n%s", rec.Code, rec.Body)
+	}
+}
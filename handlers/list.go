@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"errors"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Tottitov/todo/models"
+	"github.com/Tottitov/todo/store"
+)
+
+// ListHandler handles creating, renaming, recoloring and deleting todo lists
+// from the sidebar. Like TodoHandler it negotiates its responses, but since a
+// list change affects the sidebar as well as the list, HTML clients are sent
+// to a freshly rendered page instead of receiving a fragment.
+type ListHandler struct {
+	Lists store.ListStore // Storage backend for lists
+}
+
+// listInput is the request body accepted when creating or updating a list.
+type listInput struct {
+	Name  string `json:"name"`
+	Color string `json:"color"`
+}
+
+// Create handles POST /lists. It expects 'name' and an optional 'color'
+// and sends the client to the new list.
+func (h *ListHandler) Create(w http.ResponseWriter, r *http.Request) {
+	repr := negotiate(w, r)
+
+	// Read and validate the list's name and color
+	in, err := readList(w, r)
+	if err != nil {
+		fail(w, repr, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := in.validate(); err != nil {
+		fail(w, repr, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	// Insert the new list into the store
+	list, err := h.Lists.CreateList(r.Context(), currentUser(r).ID, in.Name, in.Color)
+	if err != nil {
+		fail(w, repr, "Failed to create list", http.StatusInternalServerError)
+		return
+	}
+
+	if repr == reprJSON {
+		w.Header().Set("Location", "/api/v1/lists/"+strconv.Itoa(list.ID))
+		sendJSON(w, http.StatusCreated, list)
+		return
+	}
+	redirect(w, r, repr, listPath(list.ID))
+}
+
+// Update handles PATCH /lists/{listID}, renaming and recoloring the list.
+func (h *ListHandler) Update(w http.ResponseWriter, r *http.Request) {
+	repr := negotiate(w, r)
+
+	// Extract and validate the list ID from the URL
+	id, err := parseListID(r)
+	if err != nil {
+		fail(w, repr, "Invalid list ID", http.StatusBadRequest)
+		return
+	}
+
+	// Read and validate the new name and color
+	in, err := readList(w, r)
+	if err != nil {
+		fail(w, repr, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := in.validate(); err != nil {
+		fail(w, repr, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	// Update the list in the store
+	list, err := h.Lists.UpdateList(r.Context(), currentUser(r).ID, id, in.Name, in.Color)
+	if err != nil {
+		failList(w, repr, err, "Failed to update list")
+		return
+	}
+
+	if repr == reprJSON {
+		sendJSON(w, http.StatusOK, list)
+		return
+	}
+	redirect(w, r, repr, listPath(list.ID))
+}
+
+// Delete handles DELETE /lists/{listID}, removing the list together with its
+// todos, and sends the client back to the default list.
+func (h *ListHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	repr := negotiate(w, r)
+
+	// Extract and validate the list ID from the URL
+	id, err := parseListID(r)
+	if err != nil {
+		fail(w, repr, "Invalid list ID", http.StatusBadRequest)
+		return
+	}
+
+	// Delete the list and its todos from the store
+	if err := h.Lists.DeleteList(r.Context(), currentUser(r).ID, id); err != nil {
+		failList(w, repr, err, "Failed to delete list")
+		return
+	}
+
+	if repr == reprJSON {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	redirect(w, r, repr, "/")
+}
+
+// readList extracts a list's name and color from either a JSON body or form
+// data, for validate to check.
+func readList(w http.ResponseWriter, r *http.Request) (listInput, error) {
+	var in listInput
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == contentTypeJSON {
+		if err := decodeJSON(w, r, &in); err != nil {
+			return in, err
+		}
+	} else {
+		if err := r.ParseForm(); err != nil {
+			return in, errFormParse
+		}
+		in.Name = r.PostForm.Get("name")
+		in.Color = r.PostForm.Get("color")
+	}
+	return in, nil
+}
+
+// validate checks the name and color of a list, defaulting an empty color
+// to the first of models.Colors. Like todos, lists that don't validate are
+// answered 422 Unprocessable Entity by every route.
+func (in *listInput) validate() error {
+	in.Name = strings.TrimSpace(in.Name)
+	if in.Name == "" {
+		return errors.New("List name cannot be empty")
+	}
+	if in.Color == "" {
+		in.Color = models.Colors[0]
+	}
+	if !models.ValidColor(in.Color) {
+		return errors.New("List color must be one of " + strings.Join(models.Colors, ", "))
+	}
+	return nil
+}
+
+// redirect sends an HTML client to url: HTMX through the HX-Redirect header,
+// which makes it load the whole page, and browsers with a 303 See Other.
+func redirect(w http.ResponseWriter, r *http.Request, repr representation, url string) {
+	if repr == reprFragment {
+		w.Header().Set("HX-Redirect", url)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	http.Redirect(w, r, url, http.StatusSeeOther)
+}
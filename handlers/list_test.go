@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/Tottitov/todo/models"
+)
+
+func listURL(id int, rest string) string {
+	return "/lists/" + strconv.Itoa(id) + rest
+}
+
+func TestLists(t *testing.T) {
+	ts := newTestServer(t)
+	inbox := ts.create(`{"title": "Buy milk"}`).ListID
+
+	var work models.List
+	rec := ts.do("POST", "/lists", `{"name": " Work ", "color": "blue"}`, &work)
+	if rec.Code != http.StatusCreated || work.Name != "Work" || work.Color != "blue" {
+		t.Fatalf("POST /lists = %d %+v", rec.Code, work)
+	}
+	if loc := rec.Header().Get("Location"); loc != "/api/v1/lists/"+strconv.Itoa(work.ID) {
+		t.Errorf("Location = %q", loc)
+	}
+
+	var report models.Todo
+	if rec := ts.do("POST", listURL(work.ID, "/todos"), `{"title": "Write report"}`, &report); rec.Code != http.StatusCreated || report.ListID != work.ID {
+		t.Fatalf("creating in the new list = %d %+v", rec.Code, report)
+	}
+	var list todoList
+	ts.do("GET", listURL(work.ID, ""), "", &list)
+	if len(list.Todos) != 1 || list.Todos[0].ID != report.ID {
+		t.Errorf("new list holds %v, want [Write report]", titles(list.Todos))
+	}
+	if got := titles(ts.list("").Todos); len(got) != 1 || got[0] != "Buy milk" {
+		t.Errorf("default list holds %v, want [Buy milk]", got)
+	}
+
+	// Moving a todo takes it out of one list into the other
+	var moved models.Todo
+	rec = ts.do("POST", todoPath(report.ID, "/list"), `{"list_id": `+strconv.Itoa(inbox)+`}`, &moved)
+	if rec.Code != http.StatusOK || moved.ListID != inbox {
+		t.Errorf("move = %d %+v", rec.Code, moved)
+	}
+	if got := titles(ts.list("").Todos); len(got) != 2 {
+		t.Errorf("default list after the move holds %v", got)
+	}
+
+	var renamed models.List
+	if rec := ts.do("PATCH", listURL(work.ID, ""), `{"name": "Job", "color": "red"}`, &renamed); rec.Code != http.StatusOK || renamed.Name != "Job" || renamed.Color != "red" {
+		t.Errorf("PATCH = %d %+v", rec.Code, renamed)
+	}
+	var lists struct {
+		Lists []models.List `json:"lists"`
+	}
+	ts.do("GET", "/api/v1/lists", "", &lists)
+	if len(lists.Lists) != 2 || lists.Lists[1].Name != "Job" {
+		t.Errorf("lists %+v", lists.Lists)
+	}
+
+	// Deleting a list deletes its todos
+	ts.do("POST", listURL(work.ID, "/todos"), `{"title": "Expenses"}`, nil)
+	if rec := ts.do("DELETE", listURL(work.ID, ""), "", nil); rec.Code != http.StatusNoContent {
+		t.Fatalf("DELETE = %d %s", rec.Code, rec.Body)
+	}
+	if rec := ts.do("GET", listURL(work.ID, ""), "", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("GET of a deleted list = %d, want 404", rec.Code)
+	}
+	if got := titles(ts.list("").Todos); len(got) != 2 {
+		t.Errorf("deleting a list changed the default list to %v", got)
+	}
+}
+
+// TestListErrors checks that the negotiated and the API list routes reject
+// the same requests alike, and keep other users' lists out of reach.
+func TestListErrors(t *testing.T) {
+	ts := newTestServer(t)
+	ctx := context.Background()
+	other, err := ts.store.CreateUser(ctx, "b@example.com", "hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	theirs, err := ts.store.CreateList(ctx, other.ID, "Theirs", "gray")
+	if err != nil {
+		t.Fatal(err)
+	}
+	todo := ts.create(`{"title": "Buy milk"}`)
+
+	for _, tt := range []struct {
+		body string
+		code int
+	}{
+		{`{"name": " "}`, http.StatusUnprocessableEntity},
+		{`{"name": "x", "color": "plaid"}`, http.StatusUnprocessableEntity},
+		{`{"name": "x", "unknown": 1}`, http.StatusBadRequest},
+	} {
+		for _, path := range []string{"/lists", "/api/v1/lists"} {
+			if rec := ts.do("POST", path, tt.body, nil); rec.Code != tt.code {
+				t.Errorf("POST %s %s = %d, want %d", path, tt.body, rec.Code, tt.code)
+			}
+		}
+	}
+
+	theirsPath := listURL(theirs.ID, "")
+	for _, req := range []struct{ method, path, body string }{
+		{"GET", theirsPath, ""},
+		{"PATCH", theirsPath, `{"name": "Mine"}`},
+		{"DELETE", theirsPath, ""},
+		{"POST", listURL(theirs.ID, "/todos"), `{"title": "Sneaky"}`},
+		{"POST", todoPath(todo.ID, "/list"), `{"list_id": ` + strconv.Itoa(theirs.ID) + `}`},
+		{"GET", "/api/v1" + theirsPath, ""},
+		{"PATCH", "/api/v1" + theirsPath, `{"name": "Mine"}`},
+		{"DELETE", "/api/v1" + theirsPath, ""},
+	} {
+		if rec := ts.do(req.method, req.path, req.body, nil); rec.Code != http.StatusNotFound {
+			t.Errorf("%s %s of another user's list = %d, want 404", req.method, req.path, rec.Code)
+		}
+	}
+	if got, err := ts.store.GetList(ctx, other.ID, theirs.ID); err != nil || got.Name != "Theirs" {
+		t.Errorf("their list is now %+v, %v", got, err)
+	}
+}
@@ -0,0 +1,196 @@
+package handlers
+
+import (
+	"errors"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Tottitov/todo/models"
+	"github.com/Tottitov/todo/store"
+)
+
+// representation is the response format chosen for a request.
+type representation int
+
+const (
+	reprPage     representation = iota // Full HTML page for plain browser requests
+	reprFragment                       // HTML fragment for HTMX to swap in
+	reprJSON                           // JSON for API clients
+)
+
+// negotiate picks the representation for a request. Clients that prefer
+// application/json over text/html in their Accept header get JSON; otherwise
+// HTMX requests (HX-Request: true) get a fragment and everything else gets a
+// full page. It records the headers it looked at in Vary so caches keep the
+// representations apart.
+func negotiate(w http.ResponseWriter, r *http.Request) representation {
+	w.Header().Add("Vary", "Accept, HX-Request")
+
+	if prefersJSON(r.Header.Get("Accept")) {
+		return reprJSON
+	}
+	if r.Header.Get("HX-Request") == "true" {
+		return reprFragment
+	}
+	return reprPage
+}
+
+// prefersJSON reports whether an Accept header ranks application/json
+// strictly above text/html. Ties go to HTML so browsers, which send */*,
+// keep getting pages.
+func prefersJSON(accept string) bool {
+	if accept == "" {
+		return false
+	}
+	var jsonQ, htmlQ float64
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if parsed, err := strconv.ParseFloat(v, 64); err == nil {
+				q = parsed
+			}
+		}
+		switch mediaType {
+		case contentTypeJSON:
+			jsonQ = max(jsonQ, q)
+		case contentTypeHTML:
+			htmlQ = max(htmlQ, q)
+		case "*/*", "text/*":
+			// Wildcards only count toward HTML, the default representation
+			htmlQ = max(htmlQ, q*0.001)
+		}
+	}
+	return jsonQ > htmlQ
+}
+
+// fail reports an error in the representation the client asked for.
+func fail(w http.ResponseWriter, repr representation, msg string, code int) {
+	if repr == reprJSON {
+		sendJSONError(w, msg, code)
+		return
+	}
+	sendError(w, msg, code)
+}
+
+// failStore is fail for store errors, reporting missing todos as 404.
+func failStore(w http.ResponseWriter, repr representation, err error, msg string) {
+	if repr == reprJSON {
+		sendJSONStoreError(w, err, msg)
+		return
+	}
+	sendStoreError(w, err, msg)
+}
+
+// failList is fail for store errors about lists, reporting missing lists as 404.
+func failList(w http.ResponseWriter, repr representation, err error, msg string) {
+	if errors.Is(err, store.ErrNotFound) {
+		fail(w, repr, "List not found", http.StatusNotFound)
+		return
+	}
+	fail(w, repr, msg, http.StatusInternalServerError)
+}
+
+// readTodo extracts a todo's title, notes, priority, tags, due date and
+// recurrence rule from either a JSON body or form data, depending on the
+// request's Content-Type.
+// Everything but the title is left unset when the request doesn't carry it.
+// An invalid due date is not an error here but kept in the due date's Err.
+func readTodo(w http.ResponseWriter, r *http.Request) (todoInput, error) {
+	var in todoInput
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == contentTypeJSON {
+		err := decodeJSON(w, r, &in)
+		return in, err
+	}
+	if err := r.ParseForm(); err != nil {
+		return in, errFormParse
+	}
+	in.Title = r.PostForm.Get("title")
+	if r.PostForm.Has("notes") {
+		notes := r.PostForm.Get("notes")
+		in.Notes = &notes
+	}
+	if r.PostForm.Has("priority") {
+		priority, err := models.ParsePriority(r.PostForm.Get("priority"))
+		if err != nil {
+			return in, err
+		}
+		in.Priority = &priority
+	}
+	if r.PostForm.Has("tags") {
+		names, err := models.ParseTags(r.PostForm.Get("tags"))
+		if err != nil {
+			return in, err
+		}
+		in.Tags = (*tagNames)(&names)
+	}
+	if r.PostForm.Has("recur") {
+		rule, err := parseRecur(r.PostForm.Get("recur"))
+		if err != nil {
+			return in, err
+		}
+		in.Recur = &rule
+	}
+	in.Due = readDue(r)
+	return in, nil
+}
+
+// readListID extracts the destination list of a move from either a JSON
+// body ({"list_id": n}) or the 'list_id' form field.
+func readListID(w http.ResponseWriter, r *http.Request) (int, error) {
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == contentTypeJSON {
+		var in struct {
+			ListID int `json:"list_id"`
+		}
+		if err := decodeJSON(w, r, &in); err != nil {
+			return 0, err
+		}
+		return in.ListID, nil
+	}
+	if err := r.ParseForm(); err != nil {
+		return 0, errFormParse
+	}
+	id, err := strconv.Atoi(r.PostForm.Get("list_id"))
+	if err != nil {
+		return 0, errors.New("Invalid list ID")
+	}
+	return id, nil
+}
+
+// neighbours names the todos a reordered todo is placed between. A zero
+// After puts it first, a zero Before last.
+type neighbours struct {
+	After  int `json:"after"`
+	Before int `json:"before"`
+}
+
+// readNeighbours extracts 'after' and 'before' todo IDs from either a JSON
+// body or form data. Missing or empty values read as zero.
+func readNeighbours(w http.ResponseWriter, r *http.Request) (neighbours, error) {
+	var n neighbours
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == contentTypeJSON {
+		err := decodeJSON(w, r, &n)
+		return n, err
+	}
+	if err := r.ParseForm(); err != nil {
+		return n, errFormParse
+	}
+	for _, f := range []struct {
+		name string
+		id   *int
+	}{{"after", &n.After}, {"before", &n.Before}} {
+		if v := r.PostForm.Get(f.name); v != "" {
+			id, err := strconv.Atoi(v)
+			if err != nil {
+				return n, errors.New("Invalid " + f.name + " ID")
+			}
+			*f.id = id
+		}
+	}
+	return n, nil
+}
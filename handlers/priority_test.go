@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"net/http"
+	"slices"
+	"testing"
+
+	"github.com/Tottitov/todo/models"
+)
+
+func TestSetPriority(t *testing.T) {
+	ts := newTestServer(t)
+	milk := ts.create(`{"title": "Buy milk"}`)
+	taxes := ts.create(`{"title": "File taxes", "priority": "high"}`)
+	ts.create(`{"title": "Call mom", "priority": "low"}`)
+	if milk.Priority != models.PriorityNone || taxes.Priority != models.PriorityHigh {
+		t.Errorf("created with priorities %s and %s", milk.Priority, taxes.Priority)
+	}
+
+	var got models.Todo
+	if rec := ts.do("POST", todoPath(milk.ID, "/priority"), `{"priority": "urgent"}`, &got); rec.Code != http.StatusOK || got.Priority != models.PriorityUrgent {
+		t.Errorf("JSON priority = %d %+v", rec.Code, got)
+	}
+	if rec := ts.serve(ts.form("POST", todoPath(taxes.ID, "/priority"), "priority=none"), nil); rec.Code != http.StatusSeeOther {
+		t.Errorf("form priority = %d %s", rec.Code, rec.Body)
+	}
+
+	if got := titles(ts.list("sort=priority").Todos); !slices.Equal(got, []string{"Buy milk", "Call mom", "File taxes"}) {
+		t.Errorf("sorted by priority: %v", got)
+	}
+	// Pages fall back to the manual order for sorts they don't know
+	if got := titles(ts.list("sort=urgency").Todos); !slices.Equal(got, []string{"Buy milk", "File taxes", "Call mom"}) {
+		t.Errorf("sorted by urgency: %v", got)
+	}
+
+	for _, tt := range []struct {
+		method, path, body string
+		code               int
+	}{
+		{"POST", todoPath(milk.ID, "/priority"), `{"priority": "asap"}`, http.StatusBadRequest},
+		{"POST", todoPath(milk.ID, "/priority"), `{}`, http.StatusBadRequest},
+		{"POST", todoPath(milk.ID+100, "/priority"), `{"priority": "low"}`, http.StatusNotFound},
+		{"POST", "/todos", `{"title": "x", "priority": 3}`, http.StatusBadRequest},
+		{"GET", "/api/v1/todos?sort=urgency", "", http.StatusBadRequest},
+	} {
+		if rec := ts.do(tt.method, tt.path, tt.body, nil); rec.Code != tt.code {
+			t.Errorf("%s %s %s = %d, want %d", tt.method, tt.path, tt.body, rec.Code, tt.code)
+		}
+	}
+	if rec := ts.serve(ts.form("POST", todoPath(milk.ID, "/priority"), "priority=asap"), nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("form priority asap = %d, want 400", rec.Code)
+	}
+}
@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/Tottitov/todo/recur"
+)
+
+// recurRule is a todo's recurrence rule, validated and put into canonical
+// form when decoded from JSON, so API clients and forms store the same rule.
+// The empty rule means the todo doesn't repeat.
+type recurRule string
+
+// UnmarshalJSON decodes a rule such as "FREQ=WEEKLY;BYDAY=MO", rejecting
+// the parts of RRULE todos don't support.
+func (r *recurRule) UnmarshalJSON(data []byte) error {
+	var raw string
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	rule, err := parseRecur(raw)
+	*r = rule
+	return err
+}
+
+// parseRecur validates a recurrence rule and returns it in canonical form.
+// A blank rule is valid and clears the recurrence.
+func parseRecur(s string) (recurRule, error) {
+	if strings.TrimSpace(s) == "" {
+		return "", nil
+	}
+	rule, err := recur.Parse(s)
+	if err != nil {
+		return "", errors.New("Invalid repeat rule: " + strings.TrimPrefix(err.Error(), recur.ErrInvalid.Error()+": "))
+	}
+	return recurRule(rule.String()), nil
+}
@@ -0,0 +1,29 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// TestSearchHighlight checks that the list marks what a search matched,
+// escaping the rest of the title.
+func TestSearchHighlight(t *testing.T) {
+	ts := newTestServer(t)
+	ts.create(`{"title": "Buy <b>milk</b>"}`)
+	ts.create(`{"title": "Call mom"}`)
+
+	req := ts.form("GET", "/?q=milk", "")
+	req.Header.Set("HX-Request", "true")
+	rec := ts.serve(req, nil)
+	body := rec.Body.String()
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /?q=milk = %d %s", rec.Code, body)
+	}
+	if !strings.Contains(body, "&lt;b&gt;<mark") || !strings.Contains(body, ">milk</mark>&lt;/b&gt;") {
+		t.Errorf("search results don't mark milk in the escaped title:\n%s", body)
+	}
+	if strings.Contains(body, "Call mom") || strings.Contains(body, "<b>") {
+		t.Errorf("search results:\n%s", body)
+	}
+}
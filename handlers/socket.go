@@ -0,0 +1,234 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Tottitov/todo/broker"
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	// socketPing is how often an open socket is pinged, to notice clients
+	// that went away.
+	socketPing = 30 * time.Second
+	// socketWriteTimeout is how long a client gets to take each frame
+	// before it is considered too slow and disconnected.
+	socketWriteTimeout = 10 * time.Second
+)
+
+// SocketHandler serves /ws, a WebSocket over which a client receives the
+// changes made to the user's todos, like the event stream of a page, and
+// sends commands changing them. Commands are served by the TodoHandler
+// routes they stand for, as JSON requests, so they are validated and
+// answered just the same.
+type SocketHandler struct {
+	Todos   *TodoHandler   // Serves the commands
+	Broker  *broker.Broker // Announces the changes to watch on this server instance
+	Changes Publisher      // Announces the changes the commands make
+}
+
+// socketCommand is a command frame sent by the client. ID is the client's
+// own and comes back in the reply.
+type socketCommand struct {
+	ID      string          `json:"id"`
+	Type    string          `json:"type"`    // create, toggle, rename, delete or reorder
+	TodoID  int             `json:"todo_id"` // Todo acted on, for all but create
+	ListID  int             `json:"list_id"` // create: list to add the todo to; the default list if absent
+	Todo    json.RawMessage `json:"todo"`    // create: the todo, as POST /todos accepts it
+	Title   string          `json:"title"`   // rename: the new title
+	Cascade bool            `json:"cascade"` // toggle: also complete the open subtasks
+	After   int             `json:"after"`   // reorder: todo to place it after, 0 for the top
+	Before  int             `json:"before"`  // reorder: todo to place it before, 0 for the bottom
+}
+
+// socketFrame is a frame sent to the client: an "ack" of a command with the
+// todo it returned, if any; an "error" with the status and message a
+// command, or a malformed frame, failed with; or a "change" to the todos.
+type socketFrame struct {
+	Type   string          `json:"type"`
+	ID     string          `json:"id,omitempty"`
+	Todo   json.RawMessage `json:"todo,omitempty"`
+	Status int             `json:"status,omitempty"`
+	Error  string          `json:"error,omitempty"`
+	TodoID int             `json:"todo_id,omitempty"`
+	Action string          `json:"action,omitempty"`
+}
+
+// Serve handles GET /ws, upgrading the connection to a WebSocket. Commands
+// are served one at a time, in the order they arrive, each answered by an
+// ack or an error frame. Changes made by other tabs and clients arrive as
+// change frames; those made by the socket's own commands are only acked.
+func (h *SocketHandler) Serve(w http.ResponseWriter, r *http.Request) {
+	conn, err := websocket.Accept(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.CloseNow()
+	conn.SetReadLimit(maxJSONBody)
+
+	// The socket is a tab of its own, so its changes aren't sent back to it
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	tab := newTabID()
+	sub := h.Broker.Subscribe(currentUser(r).ID, tab)
+	defer sub.Close()
+	go h.watch(ctx, conn, sub)
+
+	for {
+		// A malformed frame is answered with an error, keeping the socket open
+		_, data, err := conn.Read(ctx)
+		if err != nil {
+			return
+		}
+		var c socketCommand
+		reply := socketFrame{Type: "error", Status: http.StatusBadRequest, Error: "Invalid JSON"}
+		if err := json.Unmarshal(data, &c); err == nil {
+			reply = h.run(r, tab, c)
+		}
+		if err := writeFrame(ctx, conn, reply); err != nil {
+			return
+		}
+	}
+}
+
+// watch sends a change frame for each event of sub, and pings the client
+// now and then, until ctx is done or the client stops keeping up.
+func (h *SocketHandler) watch(ctx context.Context, conn *websocket.Conn, sub *broker.Subscription) {
+	ping := time.NewTicker(socketPing)
+	defer ping.Stop()
+	for {
+		var err error
+		select {
+		case <-ctx.Done():
+			return
+		case <-ping.C:
+			pingCtx, cancel := context.WithTimeout(ctx, socketWriteTimeout)
+			err = conn.Ping(pingCtx)
+			cancel()
+		case e := <-sub.C:
+			err = writeFrame(ctx, conn, socketFrame{Type: "change", TodoID: e.TodoID, Action: e.Action})
+		}
+		if err != nil {
+			conn.Close(websocket.StatusPolicyViolation, "too slow")
+			return
+		}
+	}
+}
+
+// run serves a command with the TodoHandler route it stands for, on behalf
+// of the user of the socket's request r, and turns the response into the
+// command's reply. A successful command is announced to the user's other
+// tabs and clients.
+func (h *SocketHandler) run(r *http.Request, tab string, c socketCommand) socketFrame {
+	var (
+		serve   http.HandlerFunc
+		method  = http.MethodPost
+		pattern string
+		body    any
+		query   url.Values
+	)
+	switch c.Type {
+	case "create":
+		serve, pattern, body = h.Todos.Create, "/todos", c.Todo
+		if c.ListID != 0 {
+			pattern = "/lists/{listID}/todos"
+		}
+	case "toggle":
+		serve, pattern = h.Todos.ToggleComplete, "/todos/{id}/toggle"
+		query = url.Values{"cascade": {strconv.FormatBool(c.Cascade)}}
+	case "rename":
+		serve, method, pattern, body = h.Todos.Update, http.MethodPatch, "/todos/{id}", map[string]string{"title": c.Title}
+	case "delete":
+		serve, method, pattern = h.Todos.Delete, http.MethodDelete, "/todos/{id}"
+	case "reorder":
+		serve, pattern, body = h.Todos.Reorder, "/todos/{id}/move", neighbours{After: c.After, Before: c.Before}
+	default:
+		return socketFrame{Type: "error", ID: c.ID, Status: http.StatusBadRequest, Error: "Command type must be one of create, toggle, rename, delete, reorder"}
+	}
+
+	// Build the JSON request the route would receive, with its parameters
+	rctx := chi.NewRouteContext()
+	rctx.RoutePatterns = []string{pattern}
+	path := pattern
+	for name, v := range map[string]int{"id": c.TodoID, "listID": c.ListID} {
+		if strings.Contains(pattern, "{"+name+"}") {
+			rctx.URLParams.Add(name, strconv.Itoa(v))
+			path = strings.Replace(path, "{"+name+"}", strconv.Itoa(v), 1)
+		}
+	}
+	if query != nil {
+		path += "?" + query.Encode()
+	}
+	var payload []byte
+	if body != nil {
+		payload, _ = json.Marshal(body)
+	}
+	ctx := context.WithValue(r.Context(), chi.RouteCtxKey, rctx)
+	req, err := http.NewRequestWithContext(ctx, method, path, bytes.NewReader(payload))
+	if err != nil {
+		return socketFrame{Type: "error", ID: c.ID, Status: http.StatusBadRequest, Error: "Invalid command"}
+	}
+	req.Header.Set("Accept", contentTypeJSON)
+	req.Header.Set("Content-Type", contentTypeJSON)
+
+	rec := &socketRecorder{header: http.Header{}, code: http.StatusOK}
+	serve(rec, req)
+	if rec.code >= http.StatusBadRequest {
+		var failure struct {
+			Error string `json:"error"`
+		}
+		json.Unmarshal(rec.body.Bytes(), &failure)
+		return socketFrame{Type: "error", ID: c.ID, Status: rec.code, Error: failure.Error}
+	}
+
+	e := broker.Event{UserID: currentUser(r).ID, TodoID: c.TodoID, Action: method + " " + pattern, Origin: tab}
+	reply := socketFrame{Type: "ack", ID: c.ID}
+	if rec.body.Len() > 0 {
+		reply.Todo = bytes.TrimSpace(rec.body.Bytes())
+		if e.TodoID == 0 {
+			// A created todo only has an ID now
+			var created struct {
+				ID int `json:"id"`
+			}
+			json.Unmarshal(reply.Todo, &created)
+			e.TodoID = created.ID
+		}
+	}
+	h.Changes.Publish(e)
+	return reply
+}
+
+// writeFrame sends f, giving the client socketWriteTimeout to take it.
+func writeFrame(ctx context.Context, conn *websocket.Conn, f socketFrame) error {
+	ctx, cancel := context.WithTimeout(ctx, socketWriteTimeout)
+	defer cancel()
+	return wsjson.Write(ctx, conn, f)
+}
+
+// socketRecorder keeps the response a route writes for a command.
+type socketRecorder struct {
+	header http.Header
+	code   int
+	body   bytes.Buffer
+}
+
+func (rec *socketRecorder) Header() http.Header {
+	return rec.header
+}
+
+func (rec *socketRecorder) Write(b []byte) (int, error) {
+	return rec.body.Write(b)
+}
+
+func (rec *socketRecorder) WriteHeader(code int) {
+	rec.code = code
+}
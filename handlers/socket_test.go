@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Tottitov/todo/broker"
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
+	"github.com/go-chi/chi/v5"
+)
+
+// socketClient is a client of the /ws endpoint.
+type socketClient struct {
+	t    *testing.T
+	ctx  context.Context
+	conn *websocket.Conn
+}
+
+// dialSocket connects to the /ws endpoint of the server at url.
+func dialSocket(t *testing.T, ctx context.Context, url string) *socketClient {
+	t.Helper()
+	conn, _, err := websocket.Dial(ctx, "ws"+strings.TrimPrefix(url, "http")+"/ws", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.CloseNow() })
+	return &socketClient{t: t, ctx: ctx, conn: conn}
+}
+
+// send sends the command frame msg and returns the next frame, its reply.
+func (sc *socketClient) send(msg string) socketFrame {
+	sc.t.Helper()
+	if err := sc.conn.Write(sc.ctx, websocket.MessageText, []byte(msg)); err != nil {
+		sc.t.Fatal(err)
+	}
+	return sc.next()
+}
+
+// next returns the next frame received.
+func (sc *socketClient) next() socketFrame {
+	sc.t.Helper()
+	var f socketFrame
+	if err := wsjson.Read(sc.ctx, sc.conn, &f); err != nil {
+		sc.t.Fatalf("reading a frame: %v", err)
+	}
+	return f
+}
+
+func TestSocket(t *testing.T) {
+	ts := newTestServer(t)
+	b := &broker.Broker{}
+	ts.router = streamRouter(ts.store, ts.user, b, b)
+	sh := &SocketHandler{Todos: &TodoHandler{Store: ts.store, Lists: ts.store, Undos: ts.store}, Broker: b, Changes: b}
+	r := chi.NewRouter()
+	r.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), userKey, ts.user)))
+		})
+	})
+	r.Get("/ws", sh.Serve)
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	client, watcher := dialSocket(t, ctx, srv.URL), dialSocket(t, ctx, srv.URL)
+
+	// Commands are acked with the todo they return, and announced to the
+	// other clients only
+	ack := client.send(`{"id": "1", "type": "create", "todo": {"title": "Buy milk"}}`)
+	milk := ts.list("").Todos
+	if ack.Type != "ack" || ack.ID != "1" || len(milk) != 1 || !strings.Contains(string(ack.Todo), `"Buy milk"`) {
+		t.Fatalf("create = %+v, list %v", ack, titles(milk))
+	}
+	id := milk[0].ID
+	if f := watcher.next(); f.Type != "change" || f.TodoID != id || f.Action != "POST /todos" {
+		t.Errorf("the watcher got %+v, want the creation of todo %d", f, id)
+	}
+	if ack := client.send(`{"id": "2", "type": "rename", "todo_id": ` + strconv.Itoa(id) + `, "title": "Buy oat milk"}`); ack.Type != "ack" || ack.ID != "2" {
+		t.Errorf("rename = %+v", ack)
+	}
+	if f := watcher.next(); f.TodoID != id || f.Action != "PATCH /todos/{id}" {
+		t.Errorf("the watcher got %+v, want the rename", f)
+	}
+	if ack := client.send(`{"type": "toggle", "todo_id": ` + strconv.Itoa(id) + `}`); ack.Type != "ack" || !strings.Contains(string(ack.Todo), `"completed":true`) {
+		t.Errorf("toggle = %+v", ack)
+	}
+	watcher.next()
+
+	// Changes made elsewhere arrive as change frames; the client's next
+	// frame being this one shows its own changes weren't sent back to it
+	bread := ts.create(`{"title": "Buy bread"}`)
+	if f := client.next(); f.Type != "change" || f.TodoID != 0 || f.Action != "POST /todos" {
+		t.Errorf("the client got %+v, want the creation from elsewhere", f)
+	}
+	watcher.next()
+	if ack := client.send(`{"type": "reorder", "todo_id": ` + strconv.Itoa(id) + `, "after": ` + strconv.Itoa(bread.ID) + `}`); ack.Type != "ack" {
+		t.Errorf("reorder = %+v", ack)
+	}
+	watcher.next()
+	if got := titles(ts.list("").Todos); !slices.Equal(got, []string{"Buy bread", "Buy oat milk"}) {
+		t.Errorf("after reordering the list is %v", got)
+	}
+	if ack := client.send(`{"type": "delete", "todo_id": ` + strconv.Itoa(id) + `}`); ack.Type != "ack" || ack.Todo != nil {
+		t.Errorf("delete = %+v", ack)
+	}
+	watcher.next()
+
+	// Failures are answered by error frames, and the socket stays open
+	for _, tt := range []struct {
+		msg    string
+		status int
+	}{
+		{`not json`, http.StatusBadRequest},
+		{`{"id": "3", "type": "shred"}`, http.StatusBadRequest},
+		{`{"id": "4", "type": "rename", "todo_id": ` + strconv.Itoa(bread.ID) + `, "title": ""}`, http.StatusUnprocessableEntity},
+		{`{"id": "5", "type": "toggle", "todo_id": ` + strconv.Itoa(id) + `}`, http.StatusNotFound},
+		{`{"id": "6", "type": "create", "list_id": 9999, "todo": {"title": "Nowhere"}}`, http.StatusNotFound},
+	} {
+		f := client.send(tt.msg)
+		if f.Type != "error" || f.Status != tt.status || f.Error == "" {
+			t.Errorf("%s = %+v, want an error frame with %d", tt.msg, f, tt.status)
+		}
+	}
+	if got := titles(ts.list("").Todos); len(got) != 1 || got[0] != "Buy bread" {
+		t.Errorf("after the failed commands the list is %v", got)
+	}
+}
@@ -0,0 +1,199 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Tottitov/todo/broker"
+	"github.com/Tottitov/todo/components"
+	"github.com/Tottitov/todo/store"
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	// tabHeader carries the ID of the tab an HTMX request comes from, so
+	// the change it makes isn't pushed back to that same tab.
+	tabHeader = "X-Tab"
+	// streamPing is how often an idle stream sends a comment, to notice
+	// clients that went away and keep proxies from closing the connection.
+	streamPing = 30 * time.Second
+	// streamWriteTimeout is how long a client gets to take each message
+	// before it is considered too slow and disconnected.
+	streamWriteTimeout = 10 * time.Second
+)
+
+// Stream handles GET /lists/{listID}/events, a Server-Sent Events stream
+// that pushes the list, as the todo list content component, whenever
+// another tab or client changes the user's todos. The list is rendered with
+// the filter, sort, tag and search in the query string, those of the page
+// listening. The 'tab' query parameter names that page, whose own changes
+// are not pushed back to it.
+// Without a Broker the stream answers 204 No Content, which tells
+// EventSource not to reconnect.
+func (h *TodoHandler) Stream(w http.ResponseWriter, r *http.Request) {
+	if h.Broker == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	// Resolve the list being watched
+	list, err := h.currentList(r)
+	if err != nil {
+		failList(w, reprFragment, err, "Failed to fetch list")
+		return
+	}
+	q := listQuery(r.URL.Query())
+	q.ListID = list.ID
+
+	// Subscribe before answering, so no change made from now on is missed
+	userID := currentUser(r).ID
+	sub := h.Broker.Subscribe(userID, r.URL.Query().Get("tab"))
+	defer sub.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	rc := http.NewResponseController(w)
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	ping := time.NewTicker(streamPing)
+	defer ping.Stop()
+	for {
+		var msg []byte
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ping.C:
+			msg = []byte(": ping\n\n")
+		case <-sub.C:
+			// Render the list as this page shows it. Once the list is
+			// deleted there is nothing left to watch
+			current, err := h.Lists.GetList(r.Context(), userID, list.ID)
+			if errors.Is(err, store.ErrNotFound) {
+				return
+			}
+			if err != nil {
+				continue
+			}
+			list = current
+			page, err := listTodos(r, h.Store, q)
+			if err != nil {
+				continue
+			}
+			var buf bytes.Buffer
+			if err := components.TodoListContent(listView(list, q, page)).Render(r.Context(), &buf); err != nil {
+				continue
+			}
+			msg = sseMessage("todos", buf.String())
+		}
+
+		// Drop clients that can't keep up rather than letting them hold
+		// this goroutine forever
+		rc.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+		if _, err := w.Write(msg); err != nil {
+			return
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// Publisher announces changes to users' todos. A broker.Broker announces
+// them to the pages served by this server instance only.
+type Publisher interface {
+	Publish(e broker.Event)
+}
+
+// Broadcast is middleware that publishes an event for the signed-in user
+// after every request that may have changed their todos, which is any
+// successful request but GET and HEAD, unless its handler found it changed
+// nothing after all, see unchanged. The event names the route and the todo
+// in its {id} parameter, if any. The tab named by the X-Tab header made the
+// change and is left out. p must not block, as the response waits for it.
+func Broadcast(p Publisher) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodGet || r.Method == http.MethodHead {
+				next.ServeHTTP(w, r)
+				return
+			}
+			sw := &statusWriter{ResponseWriter: w, code: http.StatusOK}
+			quiet := false
+			next.ServeHTTP(sw, r.WithContext(context.WithValue(r.Context(), quietKey, &quiet)))
+			if sw.code >= http.StatusBadRequest || quiet {
+				return
+			}
+			// Routing is done by now, so the route and its parameters are known
+			e := broker.Event{UserID: currentUser(r).ID, Origin: r.Header.Get(tabHeader)}
+			if rctx := chi.RouteContext(r.Context()); rctx != nil {
+				e.Action = r.Method + " " + rctx.RoutePattern()
+				e.TodoID, _ = strconv.Atoi(rctx.URLParam("id"))
+			}
+			p.Publish(e)
+		})
+	}
+}
+
+// unchanged tells Broadcast that the request changed none of the user's
+// todos, such as a dry run, so that no page reloads for it.
+func unchanged(r *http.Request) {
+	if quiet, ok := r.Context().Value(quietKey).(*bool); ok {
+		*quiet = true
+	}
+}
+
+// statusWriter records the status code written through it.
+type statusWriter struct {
+	http.ResponseWriter
+	code int
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	w.code = code
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// sseMessage formats an event of the given name carrying data, one "data:"
+// field per line.
+func sseMessage(event, data string) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "event: %s\n", event)
+	for _, line := range strings.Split(data, "\n") {
+		fmt.Fprintf(&b, "data: %s\n", line)
+	}
+	b.WriteString("\n")
+	return []byte(b.String())
+}
+
+// tabID returns the ID of the tab a request comes from, or a new one for a
+// page being loaded afresh.
+func tabID(r *http.Request) string {
+	if tab := r.Header.Get(tabHeader); tab != "" {
+		return tab
+	}
+	return newTabID()
+}
+
+// newTabID returns a new random tab ID.
+func newTabID() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,168 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Tottitov/todo/broker"
+	"github.com/Tottitov/todo/models"
+	"github.com/Tottitov/todo/store"
+	"github.com/go-chi/chi/v5"
+)
+
+// streamRouter serves the routes of testRouter and the event stream of a
+// list, announcing changes through p and streaming those b delivers.
+func streamRouter(s store.Store, user models.User, p Publisher, b *broker.Broker) http.Handler {
+	h := &TodoHandler{Store: s, Lists: s, Undos: s, Broker: b}
+	r := chi.NewRouter()
+	r.Use(Localize)
+	r.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), userKey, user)))
+		})
+	})
+	r.Use(Broadcast(p))
+	r.Get("/lists/{listID}/events", h.Stream)
+	r.Mount("/", testRouter(s, user))
+	return r
+}
+
+// publishes records the events published through it.
+type publishes []broker.Event
+
+func (p *publishes) Publish(e broker.Event) {
+	*p = append(*p, e)
+}
+
+// TestBroadcast checks which requests announce a change, and how.
+func TestBroadcast(t *testing.T) {
+	ts := newTestServer(t)
+	var p publishes
+	ts.router = streamRouter(ts.store, ts.user, &p, nil)
+
+	todo := ts.create(`{"title": "Buy milk"}`)
+	req := ts.request("POST", todoPath(todo.ID, "/toggle"), "")
+	req.Header.Set(tabHeader, "tab")
+	ts.serve(req, nil)
+	ts.list("")
+	ts.do("POST", todoPath(9999, "/toggle"), "", nil)
+	ts.importFile("json", ts.export("json"), true)
+
+	want := publishes{
+		{UserID: ts.user.ID, Action: "POST /todos"},
+		{UserID: ts.user.ID, TodoID: todo.ID, Action: "POST /todos/{id}/toggle", Origin: "tab"},
+	}
+	if len(p) != len(want) {
+		t.Fatalf("published %+v, want %+v", p, want)
+	}
+	for i := range want {
+		if p[i] != want[i] {
+			t.Errorf("event %d = %+v, want %+v", i, p[i], want[i])
+		}
+	}
+}
+
+// sseReader reads the events of a stream.
+type sseReader struct {
+	t *testing.T
+	r *bufio.Reader
+}
+
+// next returns the name and data of the next event, skipping comments, or
+// ok false once the stream ends.
+func (sr *sseReader) next() (event, data string, ok bool) {
+	sr.t.Helper()
+	var lines []string
+	for {
+		line, err := sr.r.ReadString('\n')
+		if err != nil {
+			return "", "", false
+		}
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "" && event != "":
+			return event, strings.Join(lines, "\n"), true
+		case strings.HasPrefix(line, "event: "):
+			event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			lines = append(lines, strings.TrimPrefix(line, "data: "))
+		}
+	}
+}
+
+func TestStream(t *testing.T) {
+	ts := newTestServer(t)
+	b := &broker.Broker{}
+	ts.router = streamRouter(ts.store, ts.user, b, b)
+	srv := httptest.NewServer(ts.router)
+	defer srv.Close()
+	var work models.List
+	ts.do("POST", "/lists", `{"name": "Work"}`, &work)
+
+	// Open the stream of the Work list, as the tab "watching"
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "GET", srv.URL+listURL(work.ID, "/events?tab=watching"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("stream = %d %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	stream := &sseReader{t: t, r: bufio.NewReader(resp.Body)}
+
+	// Changes from the watching tab itself aren't pushed, another tab's are,
+	// as the list content with everything up to then
+	own := ts.request("POST", listURL(work.ID, "/todos"), `{"title": "Own change"}`)
+	own.Header.Set(tabHeader, "watching")
+	ts.serve(own, nil)
+	ts.do("POST", listURL(work.ID, "/todos"), `{"title": "Write report"}`, nil)
+	event, data, ok := stream.next()
+	if !ok || event != "todos" || !strings.Contains(data, "Write report") || !strings.Contains(data, "Own change") {
+		t.Fatalf("pushed %q, %v:\n%s", event, ok, data)
+	}
+
+	// Deleting the list ends its stream
+	ts.do("DELETE", listURL(work.ID, ""), "", nil)
+	if event, _, ok := stream.next(); ok {
+		t.Errorf("after deleting the list the stream sent %q", event)
+	}
+}
+
+// TestStreamDisconnect checks that the stream returns once its client goes
+// away, and that without a broker it tells the client not to reconnect.
+func TestStreamDisconnect(t *testing.T) {
+	ts := newTestServer(t)
+	h := &TodoHandler{Store: ts.store, Lists: ts.store, Broker: &broker.Broker{}}
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), userKey, ts.user))
+	req := httptest.NewRequest("GET", "/events", nil).WithContext(ctx)
+	done := make(chan struct{})
+	rec := httptest.NewRecorder()
+	go func() {
+		h.Stream(rec, req)
+		close(done)
+	}()
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the stream is still running after its client went away")
+	}
+
+	h.Broker = nil
+	rec = httptest.NewRecorder()
+	h.Stream(rec, httptest.NewRequest("GET", "/events", nil).WithContext(context.WithValue(context.Background(), userKey, ts.user)))
+	if rec.Code != http.StatusNoContent {
+		t.Errorf("stream without a broker = %d, want 204", rec.Code)
+	}
+}
@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/Tottitov/todo/components"
+	"github.com/Tottitov/todo/models"
+	"github.com/Tottitov/todo/store"
+)
+
+// Subtasks handles GET requests for the subtasks of a todo, in the order the
+// user arranged them. HTMX receives the todo's tree, expanded to show them;
+// JSON clients receive {"subtasks": [...]}.
+func (h *TodoHandler) Subtasks(w http.ResponseWriter, r *http.Request) {
+	repr := negotiate(w, r)
+
+	// Extract and validate the todo ID from the URL
+	id, err := parseID(r)
+	if err != nil {
+		fail(w, repr, "Invalid ID format", http.StatusBadRequest)
+		return
+	}
+
+	// Fetch the todo and its subtasks
+	parent, subtasks, err := h.tree(r, id)
+	if err != nil {
+		failStore(w, repr, err, "Failed to fetch subtasks")
+		return
+	}
+
+	switch repr {
+	case reprJSON:
+		sendJSON(w, http.StatusOK, map[string][]models.Todo{"subtasks": subtasks})
+	case reprFragment:
+		setHTMLHeader(w)
+		components.TodoTree(parent, subtasks).Render(r.Context(), w)
+	default:
+		http.Redirect(w, r, listPath(parent.ListID), http.StatusSeeOther)
+	}
+}
+
+// CreateSubtask handles POST requests to add a subtask to a todo, with the
+// same fields Create accepts. Subtasks are one level deep, so adding one to a
+// subtask fails with 422. HTMX receives the parent's updated tree, JSON
+// clients the created subtask.
+func (h *TodoHandler) CreateSubtask(w http.ResponseWriter, r *http.Request) {
+	repr := negotiate(w, r)
+
+	// Extract and validate the parent's ID from the URL
+	id, err := parseID(r)
+	if err != nil {
+		fail(w, repr, "Invalid ID format", http.StatusBadRequest)
+		return
+	}
+
+	// Extract and validate the subtask's title and other fields
+	in, err := readTodo(w, r)
+	if err != nil {
+		fail(w, repr, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := in.validate(); err != nil {
+		fail(w, repr, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	// Insert the subtask; the store puts it into the parent's list
+	todo := in.todo(0)
+	todo.ParentID = id
+	todo, err = h.Store.Create(r.Context(), currentUser(r).ID, todo)
+	if errors.Is(err, store.ErrNested) {
+		fail(w, repr, errNested, http.StatusUnprocessableEntity)
+		return
+	}
+	if err != nil {
+		failStore(w, repr, err, "Failed to create subtask")
+		return
+	}
+
+	switch repr {
+	case reprJSON:
+		w.Header().Set("Location", "/api/v1/todos/"+strconv.Itoa(todo.ID))
+		sendJSON(w, http.StatusCreated, todo)
+	case reprFragment:
+		h.renderTree(w, r, id, http.StatusCreated)
+	default:
+		http.Redirect(w, r, listPath(todo.ListID), http.StatusSeeOther)
+	}
+}
+
+// tree fetches one of the user's todos together with its subtasks, which is
+// never nil so it encodes as an empty JSON array.
+func (h *TodoHandler) tree(r *http.Request, id int) (models.Todo, []models.Todo, error) {
+	userID := currentUser(r).ID
+	parent, err := h.Store.Get(r.Context(), userID, id)
+	if err != nil {
+		return parent, nil, err
+	}
+	subtasks := []models.Todo{}
+	if parent.ParentID == 0 {
+		todos, err := h.Store.List(r.Context(), userID, store.TodoQuery{ListID: parent.ListID, Parent: parent.ID})
+		if err != nil {
+			return parent, nil, err
+		}
+		subtasks = append(subtasks, todos...)
+	}
+	return parent, subtasks, nil
+}
+
+// renderTree renders a todo expanded to show its subtasks, with the given
+// status code. Handlers changing a subtask use it to hand HTMX the parent's
+// tree with its progress brought up to date.
+func (h *TodoHandler) renderTree(w http.ResponseWriter, r *http.Request, id int, code int) {
+	parent, subtasks, err := h.tree(r, id)
+	if err != nil {
+		sendError(w, "Failed to reload subtasks", http.StatusInternalServerError)
+		return
+	}
+
+	setHTMLHeader(w)
+	w.WriteHeader(code)
+	components.TodoTree(parent, subtasks).Render(r.Context(), w)
+}
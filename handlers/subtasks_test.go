@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/Tottitov/todo/models"
+)
+
+// subtasks returns the subtasks of the todo with the given ID.
+func (ts *testServer) subtasks(id int) []models.Todo {
+	ts.t.Helper()
+	var body struct {
+		Subtasks []models.Todo `json:"subtasks"`
+	}
+	if rec := ts.do("GET", todoPath(id, "/subtasks"), "", &body); rec.Code != http.StatusOK {
+		ts.t.Fatalf("GET %s = %d %s", todoPath(id, "/subtasks"), rec.Code, rec.Body)
+	}
+	return body.Subtasks
+}
+
+func TestSubtasks(t *testing.T) {
+	ts := newTestServer(t)
+	trip := ts.create(`{"title": "Plan trip"}`)
+	if got := ts.subtasks(trip.ID); got == nil || len(got) != 0 {
+		t.Errorf("subtasks of a new todo = %#v, want an empty array", got)
+	}
+
+	var flights models.Todo
+	rec := ts.do("POST", todoPath(trip.ID, "/subtasks"), `{"title": "Book flights"}`, &flights)
+	if rec.Code != http.StatusCreated || flights.ParentID != trip.ID || rec.Header().Get("Location") != apiPath(flights.ID, "") {
+		t.Fatalf("POST subtasks = %d %+v, Location %q", rec.Code, flights, rec.Header().Get("Location"))
+	}
+	// HTMX gets the parent's tree back, its progress brought up to date
+	req := ts.form("POST", todoPath(trip.ID, "/subtasks"), "title=Book+hotel")
+	req.Header.Set("HX-Request", "true")
+	rec = ts.serve(req, nil)
+	if body := rec.Body.String(); rec.Code != http.StatusCreated || !strings.Contains(body, "Book hotel") || !strings.Contains(body, "0/2 done") {
+		t.Errorf("HTMX POST subtasks = %d:\n%s", rec.Code, body)
+	}
+	if got := titles(ts.subtasks(trip.ID)); !slices.Equal(got, []string{"Book flights", "Book hotel"}) {
+		t.Errorf("subtasks = %v", got)
+	}
+	if got := titles(ts.list("").Todos); !slices.Equal(got, []string{"Plan trip"}) {
+		t.Errorf("list = %v, want only the top-level todo", got)
+	}
+
+	tests := []struct {
+		path, body string
+		code       int
+	}{
+		{todoPath(flights.ID, "/subtasks"), `{"title": "Compare prices"}`, http.StatusUnprocessableEntity},
+		{todoPath(trip.ID, "/subtasks"), `{"title": ""}`, http.StatusUnprocessableEntity},
+		{todoPath(trip.ID+100, "/subtasks"), `{"title": "Pack"}`, http.StatusNotFound},
+		{todoPath(trip.ID+100, "/subtasks"), "", http.StatusNotFound},
+		{"/todos/x/subtasks", "", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		method := "POST"
+		if tt.body == "" {
+			method = "GET"
+		}
+		if rec := ts.do(method, tt.path, tt.body, nil); rec.Code != tt.code {
+			t.Errorf("%s %s %s = %d, want %d", method, tt.path, tt.body, rec.Code, tt.code)
+		}
+	}
+
+	// Toggling a subtask answers HTMX with the parent's tree, and completing
+	// the parent with cascade completes the rest
+	req = ts.form("POST", todoPath(flights.ID, "/toggle"), "")
+	req.Header.Set("HX-Request", "true")
+	if rec := ts.serve(req, nil); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "1/2 done") {
+		t.Errorf("HTMX toggle of a subtask = %d:\n%s", rec.Code, rec.Body)
+	}
+	var done models.Todo
+	ts.serve(ts.form("POST", todoPath(trip.ID, "/toggle?cascade=true"), ""), nil)
+	ts.do("GET", apiPath(trip.ID, ""), "", &done)
+	if !done.Completed || done.Subtasks != (models.Progress{Done: 2, Total: 2}) {
+		t.Errorf("trip after completing it with cascade = %+v", done)
+	}
+
+	// Deleting the parent takes its subtasks along
+	ts.do("DELETE", todoPath(trip.ID, ""), "", nil)
+	if rec := ts.do("GET", apiPath(flights.ID, ""), "", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("subtask of a deleted todo = %d, want 404", rec.Code)
+	}
+}
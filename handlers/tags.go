@@ -0,0 +1,240 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/Tottitov/todo/components"
+	"github.com/Tottitov/todo/models"
+	"github.com/Tottitov/todo/store"
+)
+
+// TagHandler serves the tag management page, where tags are renamed,
+// recolored, merged into one another and deleted. Tags themselves are
+// created implicitly by tagging a todo. HTMX requests receive the refreshed
+// tag table, browsers are redirected back to the page and JSON clients get
+// the tag or the tag list.
+type TagHandler struct {
+	Tags store.TagStore // Storage backend for tags
+}
+
+// tagNames is a list of tag names that normalizes and de-duplicates itself
+// when decoded from JSON, so API clients and forms produce the same tags.
+type tagNames []string
+
+// UnmarshalJSON decodes an array of tag names, rejecting invalid ones.
+func (t *tagNames) UnmarshalJSON(data []byte) error {
+	var raw []string
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	names := tagNames{}
+	for _, name := range raw {
+		name, err := models.NormalizeTagName(strings.TrimPrefix(strings.TrimSpace(name), "#"))
+		if err != nil {
+			return err
+		}
+		if !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	*t = names
+	return nil
+}
+
+// tagInput is the request body accepted when updating a tag.
+type tagInput struct {
+	Name  string `json:"name"`
+	Color string `json:"color"`
+}
+
+// Page handles GET /tags, listing the user's tags with how many todos carry each.
+func (h *TagHandler) Page(w http.ResponseWriter, r *http.Request) {
+	repr := negotiate(w, r)
+
+	tags, err := h.Tags.Tags(r.Context(), currentUser(r).ID)
+	if err != nil {
+		fail(w, repr, "Failed to fetch tags", http.StatusInternalServerError)
+		return
+	}
+
+	switch repr {
+	case reprJSON:
+		if tags == nil {
+			tags = []models.Tag{}
+		}
+		sendJSON(w, http.StatusOK, map[string]any{"tags": tags})
+	case reprFragment:
+		setHTMLHeader(w)
+		components.TagTable(tags).Render(r.Context(), w)
+	default:
+		setHTMLHeader(w)
+		components.TagsPage(tags).Render(r.Context(), w)
+	}
+}
+
+// Update handles PATCH /tags/{tagID}, renaming and recoloring the tag.
+// Renaming a tag to the name of another one is refused with 409 Conflict;
+// merging is the way to combine two tags.
+func (h *TagHandler) Update(w http.ResponseWriter, r *http.Request) {
+	repr := negotiate(w, r)
+
+	// Extract and validate the tag ID from the URL
+	id, err := parseTagID(r)
+	if err != nil {
+		fail(w, repr, "Invalid tag ID", http.StatusBadRequest)
+		return
+	}
+
+	// Read and validate the new name and color
+	in, err := readTag(w, r)
+	if err != nil {
+		fail(w, repr, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Update the tag in the store
+	tag, err := h.Tags.UpdateTag(r.Context(), currentUser(r).ID, id, in.Name, in.Color)
+	if errors.Is(err, store.ErrTagExists) {
+		fail(w, repr, "A tag named \""+in.Name+"\" already exists; merge the tags instead", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		failTag(w, repr, err, "Failed to update tag")
+		return
+	}
+
+	if repr == reprJSON {
+		sendJSON(w, http.StatusOK, tag)
+		return
+	}
+	h.renderTags(w, r, repr)
+}
+
+// Merge handles POST /tags/{tagID}/merge, moving every todo tagged with the
+// tag onto the tag given as 'into' in the form data (or a JSON body), then
+// deleting it.
+func (h *TagHandler) Merge(w http.ResponseWriter, r *http.Request) {
+	repr := negotiate(w, r)
+
+	// Extract and validate the tag ID from the URL
+	id, err := parseTagID(r)
+	if err != nil {
+		fail(w, repr, "Invalid tag ID", http.StatusBadRequest)
+		return
+	}
+
+	// Read the tag to merge into
+	var in struct {
+		Into int `json:"into"`
+	}
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == contentTypeJSON {
+		err = decodeJSON(w, r, &in)
+	} else if err = r.ParseForm(); err == nil {
+		in.Into, err = strconv.Atoi(r.PostForm.Get("into"))
+	}
+	if err != nil || in.Into == 0 {
+		fail(w, repr, "Choose a tag to merge into", http.StatusBadRequest)
+		return
+	}
+	if in.Into == id {
+		fail(w, repr, "A tag cannot be merged into itself", http.StatusBadRequest)
+		return
+	}
+
+	// Merge the tags in the store
+	if err := h.Tags.MergeTag(r.Context(), currentUser(r).ID, id, in.Into); err != nil {
+		failTag(w, repr, err, "Failed to merge tags")
+		return
+	}
+
+	if repr == reprJSON {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	h.renderTags(w, r, repr)
+}
+
+// Delete handles DELETE /tags/{tagID}, removing the tag from every todo.
+func (h *TagHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	repr := negotiate(w, r)
+
+	// Extract and validate the tag ID from the URL
+	id, err := parseTagID(r)
+	if err != nil {
+		fail(w, repr, "Invalid tag ID", http.StatusBadRequest)
+		return
+	}
+
+	// Delete the tag from the store
+	if err := h.Tags.DeleteTag(r.Context(), currentUser(r).ID, id); err != nil {
+		failTag(w, repr, err, "Failed to delete tag")
+		return
+	}
+
+	if repr == reprJSON {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	h.renderTags(w, r, repr)
+}
+
+// renderTags answers a successful change with the refreshed tag table for
+// HTMX, or by sending browsers back to the tags page.
+func (h *TagHandler) renderTags(w http.ResponseWriter, r *http.Request, repr representation) {
+	if repr != reprFragment {
+		http.Redirect(w, r, "/tags", http.StatusSeeOther)
+		return
+	}
+	tags, err := h.Tags.Tags(r.Context(), currentUser(r).ID)
+	if err != nil {
+		sendError(w, "Failed to reload tags", http.StatusInternalServerError)
+		return
+	}
+	setHTMLHeader(w)
+	components.TagTable(tags).Render(r.Context(), w)
+}
+
+// readTag extracts a tag's name and color from either a JSON body or form
+// data and validates them. A missing color defaults to the first of
+// models.Colors.
+func readTag(w http.ResponseWriter, r *http.Request) (tagInput, error) {
+	var in tagInput
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == contentTypeJSON {
+		if err := decodeJSON(w, r, &in); err != nil {
+			return in, err
+		}
+	} else {
+		if err := r.ParseForm(); err != nil {
+			return in, errFormParse
+		}
+		in.Name = r.PostForm.Get("name")
+		in.Color = r.PostForm.Get("color")
+	}
+
+	var err error
+	if in.Name, err = models.NormalizeTagName(strings.TrimPrefix(strings.TrimSpace(in.Name), "#")); err != nil {
+		return in, err
+	}
+	if in.Color == "" {
+		in.Color = models.Colors[0]
+	}
+	if !models.ValidColor(in.Color) {
+		return in, errors.New("Tag color must be one of " + strings.Join(models.Colors, ", "))
+	}
+	return in, nil
+}
+
+// failTag is fail for store errors about tags, reporting missing tags as 404.
+func failTag(w http.ResponseWriter, repr representation, err error, msg string) {
+	if errors.Is(err, store.ErrNotFound) {
+		fail(w, repr, "Tag not found", http.StatusNotFound)
+		return
+	}
+	fail(w, repr, msg, http.StatusInternalServerError)
+}
@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"strconv"
+	"testing"
+
+	"github.com/Tottitov/todo/models"
+)
+
+// tags returns the user's tags by name.
+func (ts *testServer) tags() map[string]models.Tag {
+	ts.t.Helper()
+	var page struct {
+		Tags []models.Tag `json:"tags"`
+	}
+	if rec := ts.do("GET", "/tags", "", &page); rec.Code != http.StatusOK {
+		ts.t.Fatalf("GET /tags = %d %s", rec.Code, rec.Body)
+	}
+	tags := map[string]models.Tag{}
+	for _, tag := range page.Tags {
+		tags[tag.Name] = tag
+	}
+	return tags
+}
+
+func tagPath(id int, rest string) string {
+	return "/tags/" + strconv.Itoa(id) + rest
+}
+
+func TestTags(t *testing.T) {
+	ts := newTestServer(t)
+	milk := ts.create(`{"title": "Buy milk", "tags": ["#Shop", "food", "shop"]}`)
+	if got := models.TagNames(milk.Tags); !slices.Equal(got, []string{"food", "shop"}) {
+		t.Errorf("created with tags %v, want [food shop]", got)
+	}
+	if rec := ts.serve(ts.form("POST", "/todos", "title=Call+mom&tags=Family,+Phone+calls"), nil); rec.Code != http.StatusSeeOther {
+		t.Fatalf("form POST /todos = %d %s", rec.Code, rec.Body)
+	}
+	ts.create(`{"title": "Call the shop", "tags": ["shop", "phone-calls"]}`)
+
+	if got := titles(ts.list("tag=shop").Todos); !slices.Equal(got, []string{"Buy milk", "Call the shop"}) {
+		t.Errorf("tagged shop: %v", got)
+	}
+	tags := ts.tags()
+	if len(tags) != 4 || tags["shop"].Count != 2 || tags["phone-calls"].Count != 2 || tags["family"].Count != 1 {
+		t.Errorf("tags %+v", tags)
+	}
+
+	// Renaming onto another tag is refused; merging combines them
+	if rec := ts.do("PATCH", tagPath(tags["food"].ID, ""), `{"name": "shop"}`, nil); rec.Code != http.StatusConflict {
+		t.Errorf("renaming onto another tag = %d, want 409", rec.Code)
+	}
+	var renamed models.Tag
+	if rec := ts.do("PATCH", tagPath(tags["food"].ID, ""), `{"name": "Groceries", "color": "green"}`, &renamed); rec.Code != http.StatusOK || renamed.Name != "groceries" || renamed.Color != "green" {
+		t.Errorf("rename = %d %+v", rec.Code, renamed)
+	}
+	if rec := ts.do("POST", tagPath(tags["phone-calls"].ID, "/merge"), `{"into": `+strconv.Itoa(tags["family"].ID)+`}`, nil); rec.Code != http.StatusNoContent {
+		t.Errorf("merge = %d %s", rec.Code, rec.Body)
+	}
+	if got := titles(ts.list("tag=family").Todos); !slices.Equal(got, []string{"Call mom", "Call the shop"}) {
+		t.Errorf("tagged family after merging: %v", got)
+	}
+	if rec := ts.do("DELETE", tagPath(tags["shop"].ID, ""), "", nil); rec.Code != http.StatusNoContent {
+		t.Errorf("delete = %d %s", rec.Code, rec.Body)
+	}
+	if got := titles(ts.list("tag=shop").Todos); len(got) != 0 {
+		t.Errorf("tagged shop after deleting the tag: %v", got)
+	}
+	if got := len(ts.list("").Todos); got != 3 {
+		t.Errorf("deleting tags left %d todos, want 3", got)
+	}
+}
+
+func TestTagErrors(t *testing.T) {
+	ts := newTestServer(t)
+	ts.create(`{"title": "Buy milk", "tags": ["shop"]}`)
+	shop := ts.tags()["shop"]
+	ctx := context.Background()
+	other, err := ts.store.CreateUser(ctx, "b@example.com", "hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	list, err := ts.store.DefaultList(ctx, other.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	theirs, err := ts.store.Create(ctx, other.ID, models.Todo{ListID: list.ID, Title: "Theirs", Tags: []models.Tag{{Name: "secret"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret := theirs.Tags[0]
+
+	for _, tt := range []struct {
+		method, path, body string
+		code               int
+	}{
+		{"POST", "/todos", `{"title": "x", "tags": ["a,b"]}`, http.StatusBadRequest},
+		{"POST", "/todos", `{"title": "x", "tags": "shop"}`, http.StatusBadRequest},
+		{"PATCH", tagPath(shop.ID, ""), `{"name": " "}`, http.StatusBadRequest},
+		{"POST", tagPath(shop.ID, "/merge"), `{"into": ` + strconv.Itoa(shop.ID) + `}`, http.StatusBadRequest},
+		{"POST", tagPath(shop.ID, "/merge"), `{}`, http.StatusBadRequest},
+		{"POST", tagPath(shop.ID, "/merge"), `{"into": ` + strconv.Itoa(secret.ID) + `}`, http.StatusNotFound},
+		{"PATCH", tagPath(secret.ID, ""), `{"name": "mine"}`, http.StatusNotFound},
+		{"DELETE", tagPath(secret.ID, ""), "", http.StatusNotFound},
+	} {
+		if rec := ts.do(tt.method, tt.path, tt.body, nil); rec.Code != tt.code {
+			t.Errorf("%s %s %s = %d, want %d", tt.method, tt.path, tt.body, rec.Code, tt.code)
+		}
+	}
+	if got := ts.tags(); len(got) != 1 || got["shop"].Count != 1 {
+		t.Errorf("tags after failed requests %+v", got)
+	}
+	if got, err := ts.store.Get(ctx, other.ID, theirs.ID); err != nil || !slices.Equal(models.TagNames(got.Tags), []string{"secret"}) {
+		t.Errorf("their todo is now %+v, %v", got, err)
+	}
+}
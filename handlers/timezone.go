@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/Tottitov/todo/components"
+	"github.com/Tottitov/todo/models"
+)
+
+// tzCookie is the name of the cookie in which the page layout stores the
+// browser's IANA time zone.
+const tzCookie = "tz"
+
+// Localize is middleware that resolves the client's time zone from the tz
+// cookie, falling back to UTC, and stores it in the request context. The
+// date filters and the due date rendering in components use it to decide
+// which day is "today".
+func Localize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		loc := time.UTC
+		if c, err := r.Cookie(tzCookie); err == nil && c.Value != "" {
+			if l, err := time.LoadLocation(c.Value); err == nil {
+				loc = l
+			}
+		}
+		next.ServeHTTP(w, r.WithContext(components.WithLocation(r.Context(), loc)))
+	})
+}
+
+// clientNow returns the current time in the client's time zone.
+func clientNow(r *http.Request) time.Time {
+	return time.Now().In(components.Location(r.Context()))
+}
+
+// optionalDue is a due date in a request. It tells an absent "due" (leave
+// unchanged) apart from "due": null (clear it), and keeps why the due date
+// is invalid rather than failing to decode, so handlers can answer 422.
+type optionalDue struct {
+	Set bool        // Whether the body contained "due" at all
+	Due *models.Due // The validated due date, nil to clear it
+	Err error       // Why the due date is invalid, if it is
+}
+
+// UnmarshalJSON records that "due" was present and validates it. A time
+// zone only goes with a time: an all-day due date has none.
+func (o *optionalDue) UnmarshalJSON(data []byte) error {
+	o.Set = true
+	var due *models.Due
+	if err := json.Unmarshal(data, &due); err != nil || due == nil {
+		o.Due = nil
+		return err
+	}
+	if due.Time == "" && due.TZ != "" {
+		o.Err = errors.New("A due time zone needs a due time")
+		return nil
+	}
+	o.Due, o.Err = models.ParseDue(due.Date, due.Time, due.TZ)
+	return nil
+}
+
+// readDue extracts the due date from the 'due_date' and 'due_time' fields
+// of a parsed form. Times are taken to be in the client's time zone. It
+// reports Set only when the form has a due_date field.
+func readDue(r *http.Request) optionalDue {
+	if !r.PostForm.Has("due_date") {
+		return optionalDue{}
+	}
+	due, err := models.ParseDue(r.PostForm.Get("due_date"), r.PostForm.Get("due_time"),
+		components.Location(r.Context()).String())
+	return optionalDue{Set: true, Due: due, Err: err}
+}
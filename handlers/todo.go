@@ -1,327 +1,662 @@
 // Package handlers provides HTTP request handlers for the todo application.
 // It manages all CRUD operations for todos and handles HTMX-based partial page updates.
+// Every TodoHandler route negotiates its response: a full page for browsers,
+// a fragment for HTMX, or JSON for API clients.
 package handlers
 
 import (
-	"context"
+	"errors"
 	"net/http"
+	"net/url"
+	"strconv"
 
+	"github.com/Tottitov/todo/broker"
 	"github.com/Tottitov/todo/components"
 	"github.com/Tottitov/todo/models"
-	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/Tottitov/todo/store"
+	"github.com/go-chi/chi/v5"
 )
 
+// errFormParse is returned by readTodo when the form body is malformed.
+var errFormParse = errors.New("Failed to parse form")
+
+// todoPageSize is how many todos a list page shows before loading more.
+const todoPageSize = 50
+
+// todoPage is one page of the todos of a list, with the list's counts.
+type todoPage struct {
+	Todos  []models.Todo
+	Next   int // ID to pass as 'after' for the following page, or 0 on the last page
+	Counts store.TodoCounts
+}
+
 // TodoHandler encapsulates the dependencies and methods needed to handle todo-related HTTP requests.
-// It maintains a connection pool to the PostgreSQL database for persistent storage.
+// It persists todos through a TodoStore, so any storage backend can be plugged in.
+// Todos live in lists: routes with a {listID} parameter act on that list,
+// all others on the user's default list.
 type TodoHandler struct {
-	DB *pgxpool.Pool // Connection pool for PostgreSQL database
+	Store  store.TodoStore // Storage backend for todos
+	Lists  store.ListStore // Storage backend for the lists todos belong to
+	Undos  store.UndoStore // Undo offers made after destructive actions; nil disables undo
+	Broker *broker.Broker  // Pushes changes to the user's other tabs; nil disables live updates
 }
 
-// List handles GET requests to display all todos.
-// It supports filtering todos by their completion status using the 'filter' query parameter.
-// The handler renders either all todos, active todos, or completed todos based on the filter.
-// It also calculates and passes the count of active todos to the template.
+// List handles GET requests to display the todos of a list.
+// It supports filtering todos by their completion status or due date using the 'filter' query parameter,
+// narrowing them to the todos carrying a tag with the 'tag' query parameter,
+// and searching their titles and notes with the 'q' query parameter.
+// The handler renders all todos, active or completed todos, or those due today, overdue or upcoming.
+// Todos come a page at a time: the 'after' query parameter asks for the page
+// following the todo with that ID, which HTMX receives on its own so it can
+// be appended to the list. The list's active and completed counts are
+// computed by the store and passed to the template.
 func (h *TodoHandler) List(w http.ResponseWriter, r *http.Request) {
-	// Extract the filter parameter from URL query string (all, active, completed)
-	filter := r.URL.Query().Get("filter")
+	repr := negotiate(w, r)
+	userID := currentUser(r).ID
+
+	// Extract the filter and sort parameters from URL query string; unknown values are ignored
+	q := listQuery(r.URL.Query())
 
-	// Fetch all todos from the database to calculate counts and apply filters
-	allTodos, err := h.fetchAllTodos(r.Context())
+	// Resolve the list being shown: the one in the URL, or the default list on "/"
+	list, err := h.currentList(r)
 	if err != nil {
-		sendError(w, "Failed to fetch todos", http.StatusInternalServerError)
+		failList(w, repr, err, "Failed to fetch list")
 		return
 	}
 
-	// Calculate the number of active (incomplete) todos for the counter
-	activeCount := countActive(allTodos)
-
-	// Apply the filter to show only relevant todos
-	displayTodos := filterTodos(allTodos, filter)
+	// Fetch a page of the todos passing the filter in the chosen order, and count the list's todos
+	q.ListID = list.ID
+	page, err := listTodos(r, h.Store, q)
+	if errors.Is(err, store.ErrCursor) {
+		fail(w, repr, errCursor, http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		fail(w, repr, "Failed to fetch todos", http.StatusInternalServerError)
+		return
+	}
+	view := listView(list, q, page)
 
-	// Set content type to HTML and render the todo list component
-	setHTMLHeader(w)
-	components.TodoList(displayTodos, filter, activeCount).Render(r.Context(), w)
+	// Render the whole page, just the list (or the requested page of it) for HTMX, or JSON
+	switch repr {
+	case reprJSON:
+		sendJSON(w, http.StatusOK, todoListJSON(list, page))
+	case reprFragment:
+		setHTMLHeader(w)
+		if q.After != 0 {
+			components.TodoPage(view).Render(r.Context(), w)
+			return
+		}
+		// The filter, sort or search may have changed, so reconnect the
+		// tab's event stream to have the list pushed as it is now shown
+		view.Tab = tabID(r)
+		components.TodoListContent(view).Render(r.Context(), w)
+		components.TodoStream(view).Render(r.Context(), w)
+	default:
+		// The full page also needs the user and every list for the sidebar,
+		// and an ID for the tab to connect its event stream with
+		view.User = currentUser(r)
+		view.Tab = tabID(r)
+		if view.Lists, err = h.Lists.Lists(r.Context(), userID); err != nil {
+			fail(w, repr, "Failed to fetch lists", http.StatusInternalServerError)
+			return
+		}
+		setHTMLHeader(w)
+		components.TodoList(view).Render(r.Context(), w)
+	}
 }
 
-// Create handles POST requests to add a new todo.
-// It expects a 'title' field in the form data.
-// After creating the todo, it returns an updated todo list component for HTMX to swap.
+// Create handles POST requests to add a new todo to a list.
+// It expects a 'title' field and optional 'priority', 'due_date', 'due_time' and 'recur' fields in the form data (or a JSON body).
+// After creating the todo, it returns an updated todo list component for HTMX to swap,
+// the created todo for JSON clients, or redirects browsers back to the list.
 func (h *TodoHandler) Create(w http.ResponseWriter, r *http.Request) {
-	// Parse the form data from the request
-	if err := r.ParseForm(); err != nil {
-		sendError(w, "Failed to parse form", http.StatusBadRequest)
+	repr := negotiate(w, r)
+
+	// Extract and validate the todo title and due date
+	in, err := readTodo(w, r)
+	if err != nil {
+		fail(w, repr, err.Error(), http.StatusBadRequest)
 		return
 	}
-
-	// Extract and validate the todo title
-	title := r.PostForm.Get("title")
-	if title == "" {
-		sendError(w, "Todo title cannot be empty", http.StatusBadRequest)
+	if err := in.validate(); err != nil {
+		fail(w, repr, err.Error(), http.StatusUnprocessableEntity)
 		return
 	}
 
-	// Insert the new todo into the database (defaults to not completed)
-	_, err := h.DB.Exec(r.Context(),
-		"INSERT INTO todos (title, completed) VALUES ($1, $2)",
-		title, false)
+	// Resolve the list the todo goes into
+	list, err := h.currentList(r)
 	if err != nil {
-		sendError(w, "Failed to create todo", http.StatusInternalServerError)
+		failList(w, repr, err, "Failed to fetch list")
 		return
 	}
 
-	// Fetch the updated list of todos to reflect the new addition
-	allTodos, err := h.fetchAllTodos(r.Context())
+	// Insert the new todo into the store (defaults to not completed)
+	todo, err := h.Store.Create(r.Context(), currentUser(r).ID, in.todo(list.ID))
 	if err != nil {
-		sendError(w, "Failed to reload todos", http.StatusInternalServerError)
+		fail(w, repr, "Failed to create todo", http.StatusInternalServerError)
 		return
 	}
 
-	// Apply any active filters and calculate the new active count
-	displayTodos := filterTodos(allTodos, "")
-	activeCount := countActive(allTodos)
-
-	// Return the updated todo list component with status 201 Created
-	setHTMLHeader(w)
-	w.WriteHeader(http.StatusCreated)
-	components.TodoListContent(displayTodos, "", activeCount).Render(r.Context(), w)
+	switch repr {
+	case reprJSON:
+		w.Header().Set("Location", "/api/v1/todos/"+strconv.Itoa(todo.ID))
+		sendJSON(w, http.StatusCreated, todo)
+	case reprFragment:
+		// Return the updated todo list component with status 201 Created
+		h.renderListContent(w, r, list.ID, http.StatusCreated)
+	default:
+		http.Redirect(w, r, listPath(list.ID), http.StatusSeeOther)
+	}
 }
 
 // Edit handles GET requests to show the edit form for a specific todo.
-// It's triggered by double-clicking a todo item and returns the edit form component.
+// It's triggered by double-clicking a todo item and returns the edit form component,
+// which also offers the user's lists to move the todo to. JSON clients receive the todo itself.
 func (h *TodoHandler) Edit(w http.ResponseWriter, r *http.Request) {
+	repr := negotiate(w, r)
+
 	// Extract and validate the todo ID from the URL
 	id, err := parseID(r)
 	if err != nil {
-		sendError(w, "Invalid ID", http.StatusBadRequest)
+		fail(w, repr, "Invalid ID", http.StatusBadRequest)
 		return
 	}
 
-	// Fetch the todo from the database
-	var todo models.Todo
-	err = h.DB.QueryRow(r.Context(),
-		"SELECT id, title, completed FROM todos WHERE id = $1",
-		id,
-	).Scan(&todo.ID, &todo.Title, &todo.Completed)
+	// Fetch the todo from the store
+	todo, err := h.Store.Get(r.Context(), currentUser(r).ID, id)
 	if err != nil {
-		sendError(w, "Todo not found", http.StatusNotFound)
+		failStore(w, repr, err, "Failed to fetch todo")
+		return
+	}
+
+	if repr == reprJSON {
+		sendJSON(w, http.StatusOK, todo)
+		return
+	}
+
+	// Fetch the lists the todo can be moved to
+	lists, err := h.Lists.Lists(r.Context(), currentUser(r).ID)
+	if err != nil {
+		fail(w, repr, "Failed to fetch lists", http.StatusInternalServerError)
 		return
 	}
 
 	// Render the edit form component for the todo
 	setHTMLHeader(w)
-	components.TodoEdit(todo).Render(r.Context(), w)
+	components.TodoEdit(todo, lists).Render(r.Context(), w)
 }
 
-// Update handles PATCH requests to modify a todo's title.
+// Update handles PATCH requests to modify a todo's title and, when the request
+// carries them, its notes, priority, tags (a comma-separated 'tags' field),
+// due date (an empty 'due_date' clears it) and recurrence rule (an RRULE in
+// 'recur', empty to stop repeating).
 // It's triggered by the edit form submission or when the input loses focus.
-// Returns either the updated todo item component or redirects to the home page.
+// Returns the updated todo item component, the todo as JSON, or redirects to the home page.
 func (h *TodoHandler) Update(w http.ResponseWriter, r *http.Request) {
+	repr := negotiate(w, r)
+
 	// Extract and validate the todo ID from the URL
 	id, err := parseID(r)
 	if err != nil {
-		sendError(w, "Invalid ID format", http.StatusBadRequest)
+		fail(w, repr, "Invalid ID format", http.StatusBadRequest)
 		return
 	}
 
-	// Parse the form data containing the updated title
-	if err := r.ParseForm(); err != nil {
-		sendError(w, "Failed to parse form", http.StatusBadRequest)
+	// Read and validate every field before writing any
+	in, err := readTodo(w, r)
+	if err != nil {
+		fail(w, repr, err.Error(), http.StatusBadRequest)
 		return
 	}
-
-	// Validate the new title
-	title := r.PostForm.Get("title")
-	if title == "" {
-		sendError(w, "Todo title cannot be empty", http.StatusBadRequest)
+	if err := in.validate(); err != nil {
+		fail(w, repr, err.Error(), http.StatusUnprocessableEntity)
 		return
 	}
 
-	// Update the todo's title in the database
-	_, err = h.DB.Exec(r.Context(), "UPDATE todos SET title = $1 WHERE id = $2", title, id)
+	// Update the todo's title, and its notes, priority, due date, tags and recurrence if they were sent, in one go
+	todo, err := h.Store.Update(r.Context(), currentUser(r).ID, id, in.patch())
 	if err != nil {
-		sendError(w, "Failed to update todo", http.StatusInternalServerError)
+		failStore(w, repr, err, "Failed to update todo")
 		return
 	}
 
-	// Handle HTMX requests differently from regular form submissions
-	if r.Header.Get("HX-Request") == "true" {
-		// For HTMX requests, return the updated todo item component
-		todo := models.Todo{ID: id, Title: title}
-		err = h.DB.QueryRow(r.Context(),
-			"SELECT completed FROM todos WHERE id = $1", id,
-		).Scan(&todo.Completed)
-		if err != nil {
-			sendError(w, "Failed to get todo status", http.StatusInternalServerError)
+	switch repr {
+	case reprJSON:
+		sendJSON(w, http.StatusOK, todo)
+	case reprFragment:
+		if todo.ParentID != 0 {
+			// Subtasks are shown within their parent's tree
+			h.renderTree(w, r, todo.ParentID, http.StatusOK)
 			return
 		}
+		// For HTMX requests, return the updated todo item component
 		setHTMLHeader(w)
 		components.TodoItem(todo).Render(r.Context(), w)
-		return
+	default:
+		// For regular requests, redirect to the todo's list
+		http.Redirect(w, r, listPath(todo.ListID), http.StatusSeeOther)
 	}
-	// For regular requests, redirect to the home page
-	http.Redirect(w, r, "/", http.StatusSeeOther)
 }
 
-// Delete handles DELETE requests to remove a specific todo.
-// After deletion, it returns the updated todo list component.
+// Delete handles DELETE requests to move a specific todo and its subtasks to
+// the trash. After deletion, it returns the updated todo list component, or the parent's
+// tree for subtasks, with a toast offering to undo it (204 No Content for JSON clients).
 func (h *TodoHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	repr := negotiate(w, r)
+
 	// Extract and validate the todo ID from the URL
 	id, err := parseID(r)
 	if err != nil {
-		sendError(w, "Invalid ID format", http.StatusBadRequest)
+		fail(w, repr, "Invalid ID format", http.StatusBadRequest)
 		return
 	}
 
-	// Delete the todo from the database
-	_, err = h.DB.Exec(r.Context(), "DELETE FROM todos WHERE id = $1", id)
+	// Look the todo up first to know which list, or parent, to re-render
+	userID := currentUser(r).ID
+	todo, err := h.Store.Get(r.Context(), userID, id)
 	if err != nil {
-		sendError(w, "Failed to delete todo", http.StatusInternalServerError)
+		failStore(w, repr, err, "Failed to delete todo")
 		return
 	}
 
-	// Fetch the updated list of todos
-	allTodos, err := h.fetchAllTodos(r.Context())
-	if err != nil {
-		sendError(w, "Failed to reload todos", http.StatusInternalServerError)
+	// Move the todo to the trash
+	if err := h.Store.Delete(r.Context(), userID, id); err != nil {
+		failStore(w, repr, err, "Failed to delete todo")
 		return
 	}
 
-	// Apply any active filters and calculate the new active count
-	displayTodos := filterTodos(allTodos, "")
-	activeCount := countActive(allTodos)
-
-	// Return the updated todo list component
-	setHTMLHeader(w)
-	components.TodoListContent(displayTodos, "", activeCount).Render(r.Context(), w)
+	switch repr {
+	case reprJSON:
+		w.WriteHeader(http.StatusNoContent)
+	case reprFragment:
+		if todo.ParentID != 0 {
+			h.renderTree(w, r, todo.ParentID, http.StatusOK)
+		} else {
+			// Return the updated todo list component
+			h.renderListContent(w, r, todo.ListID, http.StatusOK)
+		}
+		// Offer to take the todo, and the subtasks deleted with it, back out of the trash
+		h.offerUndo(w, r, todo.ListID, `Deleted "`+todo.Title+`"`, store.UndoAction{Restore: id})
+	default:
+		http.Redirect(w, r, listPath(todo.ListID), http.StatusSeeOther)
+	}
 }
 
 // ToggleComplete handles POST requests to toggle a todo's completion status.
-// After toggling, it returns the updated todo list component.
+// A 'cascade' value of true, in the form data or query string, completes the
+// todo's open subtasks along with it.
+// After toggling, it returns the updated todo list component, or the parent's
+// tree for subtasks, with a toast offering to undo it, or the toggled todo as JSON.
 func (h *TodoHandler) ToggleComplete(w http.ResponseWriter, r *http.Request) {
+	repr := negotiate(w, r)
+
 	// Extract and validate the todo ID from the URL
 	id, err := parseID(r)
 	if err != nil {
-		sendError(w, "Invalid ID format", http.StatusBadRequest)
+		fail(w, repr, "Invalid ID format", http.StatusBadRequest)
 		return
 	}
+	cascade, _ := strconv.ParseBool(r.FormValue("cascade"))
 
-	// Fetch the current completion status
-	var completed bool
-	err = h.DB.QueryRow(r.Context(),
-		"SELECT completed FROM todos WHERE id = $1", id,
-	).Scan(&completed)
+	// Note the todo as it is, and the subtasks completing it would complete,
+	// so that the toggle can be undone exactly
+	userID := currentUser(r).ID
+	before, err := h.Store.Get(r.Context(), userID, id)
 	if err != nil {
-		sendError(w, "Todo not found", http.StatusNotFound)
+		failStore(w, repr, err, "Failed to update todo")
 		return
 	}
+	var reopen []int
+	if cascade && !before.Completed && before.Subtasks.Open() > 0 {
+		subtasks, err := h.Store.List(r.Context(), userID, store.TodoQuery{ListID: before.ListID, Parent: id, Filter: store.FilterActive})
+		if err != nil {
+			fail(w, repr, "Failed to update todo", http.StatusInternalServerError)
+			return
+		}
+		for _, sub := range subtasks {
+			reopen = append(reopen, sub.ID)
+		}
+	}
 
-	// Toggle the completion status in the database
-	_, err = h.DB.Exec(r.Context(),
-		"UPDATE todos SET completed = $1 WHERE id = $2", !completed, id,
-	)
+	// Toggle the completion status in the store
+	todo, err := h.Store.Toggle(r.Context(), userID, id, cascade)
 	if err != nil {
-		sendError(w, "Failed to update todo", http.StatusInternalServerError)
+		failStore(w, repr, err, "Failed to update todo")
 		return
 	}
 
-	// Fetch the updated list of todos
-	allTodos, err := h.fetchAllTodos(r.Context())
+	switch repr {
+	case reprJSON:
+		sendJSON(w, http.StatusOK, todo)
+	case reprFragment:
+		if todo.ParentID != 0 {
+			// Subtasks only change their parent's tree
+			h.renderTree(w, r, todo.ParentID, http.StatusOK)
+		} else {
+			// Return the updated todo list component
+			h.renderListContent(w, r, todo.ListID, http.StatusOK)
+		}
+		message := `Completed "` + todo.Title + `"`
+		if !todo.Completed {
+			message = `Reopened "` + todo.Title + `"`
+		}
+		h.offerUndo(w, r, todo.ListID, message, untoggle(before, todo, reopen))
+	default:
+		http.Redirect(w, r, listPath(todo.ListID), http.StatusSeeOther)
+	}
+}
+
+// SetPriority handles POST requests to change a todo's priority, given as
+// 'priority' in the form data (or a JSON body). Since the list may be sorted
+// by priority, HTMX receives the whole updated list.
+func (h *TodoHandler) SetPriority(w http.ResponseWriter, r *http.Request) {
+	repr := negotiate(w, r)
+
+	// Extract and validate the todo ID from the URL
+	id, err := parseID(r)
 	if err != nil {
-		sendError(w, "Failed to reload todos", http.StatusInternalServerError)
+		fail(w, repr, "Invalid ID format", http.StatusBadRequest)
+		return
+	}
+
+	// Read and validate the new priority
+	in, err := readTodo(w, r)
+	if err != nil {
+		fail(w, repr, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if in.Priority == nil {
+		fail(w, repr, "Priority is required", http.StatusBadRequest)
 		return
 	}
 
-	// Apply any active filters and calculate the new active count
-	displayTodos := filterTodos(allTodos, "")
-	activeCount := countActive(allTodos)
+	// Update the todo's priority in the store
+	todo, err := h.Store.SetPriority(r.Context(), currentUser(r).ID, id, *in.Priority)
+	if err != nil {
+		failStore(w, repr, err, "Failed to update todo")
+		return
+	}
 
-	// Return the updated todo list component
-	setHTMLHeader(w)
-	components.TodoListContent(displayTodos, "", activeCount).Render(r.Context(), w)
+	switch repr {
+	case reprJSON:
+		sendJSON(w, http.StatusOK, todo)
+	case reprFragment:
+		// Return the updated todo list component
+		h.renderListContent(w, r, todo.ListID, http.StatusOK)
+	default:
+		http.Redirect(w, r, listPath(todo.ListID), http.StatusSeeOther)
+	}
 }
 
-// DeleteCompleted handles POST requests to remove all completed todos.
-// After deletion, it returns the updated todo list component.
-func (h *TodoHandler) DeleteCompleted(w http.ResponseWriter, r *http.Request) {
-	// Delete all completed todos from the database
-	_, err := h.DB.Exec(r.Context(), "DELETE FROM todos WHERE completed = true")
+// Move handles POST requests to put a todo into another of the user's lists,
+// given as 'list_id' in the form data (or a JSON body). HTMX receives the
+// list the todo came from, now without it; JSON clients receive the moved todo.
+func (h *TodoHandler) Move(w http.ResponseWriter, r *http.Request) {
+	repr := negotiate(w, r)
+
+	// Extract and validate the todo ID from the URL
+	id, err := parseID(r)
 	if err != nil {
-		sendError(w, "Error clearing completed todos", http.StatusInternalServerError)
+		fail(w, repr, "Invalid ID format", http.StatusBadRequest)
 		return
 	}
 
-	// Fetch the updated list of todos
-	allTodos, err := h.fetchAllTodos(r.Context())
+	// Read the destination list
+	listID, err := readListID(w, r)
 	if err != nil {
-		sendError(w, "Failed to reload todos", http.StatusInternalServerError)
+		fail(w, repr, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	// Apply any active filters and calculate the new active count
-	displayTodos := filterTodos(allTodos, "")
-	activeCount := countActive(allTodos)
+	// Remember the list the todo is leaving so it can be re-rendered
+	userID := currentUser(r).ID
+	from, err := h.Store.Get(r.Context(), userID, id)
+	if err != nil {
+		failStore(w, repr, err, "Failed to move todo")
+		return
+	}
 
-	// Return the updated todo list component
-	setHTMLHeader(w)
-	components.TodoListContent(displayTodos, "", activeCount).Render(r.Context(), w)
+	// Move the todo; a list that isn't the user's is reported as not found
+	todo, err := h.Store.Move(r.Context(), userID, id, listID)
+	if err != nil {
+		failList(w, repr, err, "Failed to move todo")
+		return
+	}
+
+	switch repr {
+	case reprJSON:
+		sendJSON(w, http.StatusOK, todo)
+	case reprFragment:
+		// Return the former list's updated todo list component
+		h.renderListContent(w, r, from.ListID, http.StatusOK)
+	default:
+		http.Redirect(w, r, listPath(from.ListID), http.StatusSeeOther)
+	}
 }
 
-// fetchAllTodos is a helper function that retrieves all todos from the database.
-// Todos are ordered by their ID to maintain a consistent display order.
-func (h *TodoHandler) fetchAllTodos(ctx context.Context) ([]models.Todo, error) {
-	// Query all todos ordered by ID
-	query := "SELECT id, title, completed FROM todos ORDER BY id"
+// Reorder handles POST requests to place a todo between two others of its
+// list, given as 'after' and 'before' todo IDs in the form data (or a JSON
+// body); leave either out to move the todo to that end of the list. Only the
+// moved todo changes, so HTMX, whose list was already rearranged by the drag,
+// receives 204 No Content; JSON clients receive the reordered todo.
+func (h *TodoHandler) Reorder(w http.ResponseWriter, r *http.Request) {
+	repr := negotiate(w, r)
 
-	rows, err := h.DB.Query(ctx, query)
+	// Extract and validate the todo ID from the URL
+	id, err := parseID(r)
 	if err != nil {
-		return nil, err
+		fail(w, repr, "Invalid ID format", http.StatusBadRequest)
+		return
 	}
-	defer rows.Close()
 
-	// Scan rows into todo structs
-	var todos []models.Todo
-	for rows.Next() {
-		var t models.Todo
-		if err := rows.Scan(&t.ID, &t.Title, &t.Completed); err != nil {
-			return nil, err
-		}
-		todos = append(todos, t)
+	// Read the neighbours to place the todo between
+	n, err := readNeighbours(w, r)
+	if err != nil {
+		fail(w, repr, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Store the new position; stale neighbours are reported as a conflict
+	todo, err := h.Store.Reorder(r.Context(), currentUser(r).ID, id, n.After, n.Before)
+	if err != nil {
+		failStore(w, repr, err, "Failed to move todo")
+		return
+	}
+
+	switch repr {
+	case reprJSON:
+		sendJSON(w, http.StatusOK, todo)
+	case reprFragment:
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Redirect(w, r, listPath(todo.ListID), http.StatusSeeOther)
 	}
-	return todos, nil
 }
 
-// filterTodos is a helper function that filters todos based on their completion status.
-// It supports three filter modes: all (empty string), active, and completed.
-func filterTodos(todos []models.Todo, filter string) []models.Todo {
-	var filtered []models.Todo
-	for _, todo := range todos {
-		switch filter {
-		case "active":
-			// Only include incomplete todos
-			if !todo.Completed {
-				filtered = append(filtered, todo)
-			}
-		case "completed":
-			// Only include completed todos
-			if todo.Completed {
-				filtered = append(filtered, todo)
-			}
-		default:
-			// Include all todos when no filter is specified
-			filtered = append(filtered, todo)
+// DeleteCompleted handles requests to move all completed todos of a list to
+// the trash. After deletion, it returns the updated todo list component with a
+// toast offering to undo it, or the number of removed todos for JSON clients.
+func (h *TodoHandler) DeleteCompleted(w http.ResponseWriter, r *http.Request) {
+	repr := negotiate(w, r)
+
+	// Resolve the list to clear
+	list, err := h.currentList(r)
+	if err != nil {
+		failList(w, repr, err, "Failed to fetch list")
+		return
+	}
+
+	// Move all of the list's completed todos to the trash
+	userID := currentUser(r).ID
+	ids, err := h.Store.DeleteCompleted(r.Context(), userID, list.ID)
+	if err != nil {
+		fail(w, repr, "Error clearing completed todos", http.StatusInternalServerError)
+		return
+	}
+
+	switch repr {
+	case reprJSON:
+		sendJSON(w, http.StatusOK, map[string]int{"deleted": len(ids)})
+	case reprFragment:
+		// Return the updated todo list component
+		h.renderListContent(w, r, list.ID, http.StatusOK)
+		// Offer to take back every todo that was removed, and only those
+		if len(ids) > 0 {
+			h.offerUndo(w, r, list.ID, "Deleted "+todoCount(len(ids)), store.UndoAction{Undelete: ids})
 		}
+	default:
+		http.Redirect(w, r, listPath(list.ID), http.StatusSeeOther)
 	}
-	return filtered
 }
 
-// countActive is a helper function that counts the number of incomplete todos.
-// This count is displayed in the UI as "X items left".
-func countActive(todos []models.Todo) int {
-	count := 0
-	for _, todo := range todos {
-		if !todo.Completed {
-			count++
-		}
+// currentList resolves the list a request acts on: the one named by the
+// {listID} URL parameter, or the user's default list on routes without one.
+// An unknown or foreign list ID is reported as store.ErrNotFound.
+func (h *TodoHandler) currentList(r *http.Request) (models.List, error) {
+	userID := currentUser(r).ID
+	if chi.URLParam(r, "listID") == "" {
+		return h.Lists.DefaultList(r.Context(), userID)
+	}
+	id, err := parseListID(r)
+	if err != nil {
+		return models.List{}, store.ErrNotFound
+	}
+	return h.Lists.GetList(r.Context(), userID, id)
+}
+
+// renderListContent reloads a list's todos and renders the todo list
+// component with the given status code. Mutating handlers use it to hand
+// HTMX a fresh list to swap in, keeping the filter and sort of the page the
+// request came from.
+func (h *TodoHandler) renderListContent(w http.ResponseWriter, r *http.Request, listID int, code int) {
+	// Fetch the list and its updated todos
+	userID := currentUser(r).ID
+	list, err := h.Lists.GetList(r.Context(), userID, listID)
+	if err != nil {
+		sendError(w, "Failed to reload todos", http.StatusInternalServerError)
+		return
+	}
+	q := listQuery(currentURLQuery(r))
+	q.ListID, q.After = listID, 0
+	page, err := listTodos(r, h.Store, q)
+	if err != nil {
+		sendError(w, "Failed to reload todos", http.StatusInternalServerError)
+		return
+	}
+
+	setHTMLHeader(w)
+	w.WriteHeader(code)
+	components.TodoListContent(listView(list, q, page)).Render(r.Context(), w)
+}
+
+// listView builds the view of a page of a list's todos shown for q.
+func listView(list models.List, q store.TodoQuery, page todoPage) components.ListView {
+	return components.ListView{
+		List:           list,
+		Filter:         q.Filter,
+		Sort:           q.Sort,
+		Tag:            q.Tag,
+		Query:          q.Search,
+		Todos:          page.Todos,
+		Next:           page.Next,
+		ActiveCount:    page.Counts.Active,
+		CompletedCount: page.Counts.Completed,
+	}
+}
+
+// todoListJSON builds the JSON body for a page of the todos of a list. It
+// always encodes an array, never null, for empty results, and includes
+// next_after only when there is another page.
+func todoListJSON(list models.List, page todoPage) map[string]any {
+	if page.Todos == nil {
+		page.Todos = []models.Todo{}
+	}
+	body := map[string]any{
+		"list":            list,
+		"todos":           page.Todos,
+		"active_count":    page.Counts.Active,
+		"completed_count": page.Counts.Completed,
+	}
+	if page.Next != 0 {
+		body["next_after"] = page.Next
+	}
+	return body
+}
+
+// sendStoreError maps a store error onto an HTTP response, reporting missing
+// todos as 404 and anything else as a 500 with the given message.
+func sendStoreError(w http.ResponseWriter, err error, msg string) {
+	if errors.Is(err, store.ErrNotFound) {
+		sendError(w, "Todo not found", http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, store.ErrOutOfOrder) {
+		sendError(w, errOutOfOrder, http.StatusConflict)
+		return
+	}
+	sendError(w, msg, http.StatusInternalServerError)
+}
+
+// listQuery reads the filter, sort, tag, search and page cursor of a list
+// view from query string values, dropping unknown values so a mistyped URL
+// still shows the list. Pages hold todoPageSize todos.
+func listQuery(values url.Values) store.TodoQuery {
+	q := store.TodoQuery{Filter: values.Get("filter"), Sort: values.Get("sort"), Tag: values.Get("tag"), Search: values.Get("q")}
+	q.After, _ = strconv.Atoi(values.Get("after"))
+	q.Limit = todoPageSize
+	if !store.ValidFilter(q.Filter) {
+		q.Filter = store.FilterAll
+	}
+	if !store.ValidSort(q.Sort) {
+		q.Sort = store.SortManual
+	}
+	return q
+}
+
+// currentURLQuery returns the query string values of the page an HTMX
+// request was made from, as reported in its HX-Current-URL header.
+func currentURLQuery(r *http.Request) url.Values {
+	u, err := url.Parse(r.Header.Get("HX-Current-URL"))
+	if err != nil {
+		return url.Values{}
+	}
+	return u.Query()
+}
+
+// listTodos fetches the page of the todos of a list that q selects, with the
+// filter applied relative to the client's current day, together with the
+// list's counts. It asks the store for one todo more than q.Limit to learn
+// whether another page follows.
+func listTodos(r *http.Request, todos store.TodoStore, q store.TodoQuery) (todoPage, error) {
+	userID := currentUser(r).ID
+	q.Now = clientNow(r)
+
+	limit := q.Limit
+	if limit > 0 {
+		q.Limit++
+	}
+	var (
+		page todoPage
+		err  error
+	)
+	if page.Todos, err = todos.List(r.Context(), userID, q); err != nil {
+		return page, err
+	}
+	if limit > 0 && len(page.Todos) > limit {
+		page.Todos = page.Todos[:limit]
+		page.Next = page.Todos[limit-1].ID
+	}
+
+	// The counters always cover the whole list
+	page.Counts, err = todos.Counts(r.Context(), userID, q.ListID)
+	return page, err
+}
+
+// todoCount returns "1 todo" or "n todos".
+func todoCount(n int) string {
+	if n == 1 {
+		return "1 todo"
 	}
-	return count
+	return strconv.Itoa(n) + " todos"
 }
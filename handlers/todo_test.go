@@ -0,0 +1,423 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Tottitov/todo/models"
+	"github.com/Tottitov/todo/store"
+	"github.com/go-chi/chi/v5"
+)
+
+// testServer serves the todo, list, tag, trash, export and import routes
+// and the /api/v1 routes for JSON clients on the memory store, as the user
+// signed in.
+type testServer struct {
+	t      *testing.T
+	store  store.Store
+	user   models.User
+	router http.Handler
+}
+
+// newTestServer returns a server on a fresh memory store with one user,
+// who is signed in to every request.
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+	ctx := context.Background()
+	s, err := store.Open(ctx, "memory://")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(s.Close)
+	user, err := s.CreateUser(ctx, "a@example.com", "hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testServer{t: t, store: s, user: user, router: testRouter(s, user)}
+}
+
+// instance returns another server instance on ts's store, as the same user.
+func (ts *testServer) instance() *testServer {
+	return &testServer{t: ts.t, store: ts.store, user: ts.user, router: testRouter(ts.store, ts.user)}
+}
+
+// testRouter routes the requests of a testServer, signing user in to each.
+func testRouter(s store.Store, user models.User) http.Handler {
+	h := &TodoHandler{Store: s, Lists: s, Undos: s}
+	transfers := &TransferHandler{Todos: s, Lists: s, Events: s}
+	api := &APIHandler{Store: s, Lists: s}
+	lists := &ListHandler{Lists: s}
+	apiLists := &APIListHandler{Lists: s}
+	tags := &TagHandler{Tags: s}
+	trash := &TrashHandler{Todos: s, Lists: s, Retention: 30 * 24 * time.Hour}
+	audit := &AuditHandler{Events: s, Todos: s}
+	r := chi.NewRouter()
+	r.Use(Localize)
+	r.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), userKey, user)))
+		})
+	})
+	r.Get("/", h.List)
+	r.Post("/todos", h.Create)
+	r.Delete("/todos/completed", h.DeleteCompleted)
+	r.Patch("/todos/{id}", h.Update)
+	r.Delete("/todos/{id}", h.Delete)
+	r.Post("/todos/{id}/toggle", h.ToggleComplete)
+	r.Post("/todos/{id}/priority", h.SetPriority)
+	r.Post("/todos/{id}/list", h.Move)
+	r.Post("/todos/{id}/move", h.Reorder)
+	r.Get("/todos/{id}/subtasks", h.Subtasks)
+	r.Post("/todos/{id}/subtasks", h.CreateSubtask)
+	r.Post("/undo/{token}", h.Undo)
+	r.Post("/lists", lists.Create)
+	r.Patch("/lists/{listID}", lists.Update)
+	r.Delete("/lists/{listID}", lists.Delete)
+	r.Get("/lists/{listID}", h.List)
+	r.Get("/tags", tags.Page)
+	r.Patch("/tags/{tagID}", tags.Update)
+	r.Post("/tags/{tagID}/merge", tags.Merge)
+	r.Delete("/tags/{tagID}", tags.Delete)
+	r.Post("/lists/{listID}/todos", h.Create)
+	r.Get("/trash", trash.Page)
+	r.Delete("/trash", trash.Empty)
+	r.Post("/trash/{id}/restore", trash.Restore)
+	r.Delete("/trash/{id}", trash.Purge)
+	r.Get("/audit", audit.Page)
+	r.Get("/todos/{id}/history", audit.History)
+	r.Get("/export", transfers.Export)
+	r.Post("/import", transfers.Import)
+	r.Route("/api/v1/todos", func(r chi.Router) {
+		r.Get("/", api.List)
+		r.Post("/", api.Create)
+		r.Delete("/completed", api.DeleteCompleted)
+		r.Get("/{id}", api.Get)
+		r.Patch("/{id}", api.Update)
+		r.Delete("/{id}", api.Delete)
+		r.Post("/{id}/move", api.Reorder)
+	})
+	r.Route("/api/v1/lists", func(r chi.Router) {
+		r.Get("/", apiLists.List)
+		r.Post("/", apiLists.Create)
+		r.Get("/{listID}", apiLists.Get)
+		r.Patch("/{listID}", apiLists.Update)
+		r.Delete("/{listID}", apiLists.Delete)
+	})
+	return r
+}
+
+// do sends a request with body, if any, as JSON and returns the response,
+// decoding its JSON body into out unless out is nil.
+func (ts *testServer) do(method, path, body string, out any) *httptest.ResponseRecorder {
+	ts.t.Helper()
+	return ts.serve(ts.request(method, path, body), out)
+}
+
+// request returns a request for JSON with body, if any, as JSON.
+func (ts *testServer) request(method, path, body string) *http.Request {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Accept", "application/json")
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return req
+}
+
+// form returns a request from the HTML page with body, if any, as form
+// data.
+func (ts *testServer) form(method, path, body string) *http.Request {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	return req
+}
+
+// serve serves req and returns the response, decoding its JSON body into
+// out unless out is nil.
+func (ts *testServer) serve(req *http.Request, out any) *httptest.ResponseRecorder {
+	ts.t.Helper()
+	rec := httptest.NewRecorder()
+	ts.router.ServeHTTP(rec, req)
+	if out != nil && rec.Code < 300 {
+		if err := json.Unmarshal(rec.Body.Bytes(), out); err != nil {
+			ts.t.Fatalf("%s %s: decoding %q: %v", req.Method, req.URL, rec.Body, err)
+		}
+	}
+	return rec
+}
+
+// create creates a todo with the given JSON fields and returns it.
+func (ts *testServer) create(body string) models.Todo {
+	ts.t.Helper()
+	var todo models.Todo
+	if rec := ts.do("POST", "/todos", body, &todo); rec.Code != http.StatusCreated {
+		ts.t.Fatalf("POST /todos %s = %d %s", body, rec.Code, rec.Body)
+	}
+	return todo
+}
+
+// todoList is the JSON of a list page.
+type todoList struct {
+	Todos     []models.Todo `json:"todos"`
+	Active    int           `json:"active_count"`
+	Completed int           `json:"completed_count"`
+}
+
+// list returns the default list, filtered by query.
+func (ts *testServer) list(query string) todoList {
+	ts.t.Helper()
+	var list todoList
+	if rec := ts.do("GET", "/?"+query, "", &list); rec.Code != http.StatusOK {
+		ts.t.Fatalf("GET /?%s = %d %s", query, rec.Code, rec.Body)
+	}
+	return list
+}
+
+func todoPath(id int, rest string) string {
+	return "/todos/" + strconv.Itoa(id) + rest
+}
+
+func titles(todos []models.Todo) []string {
+	names := make([]string, len(todos))
+	for i, t := range todos {
+		names[i] = t.Title
+	}
+	return names
+}
+
+func TestCreateTodo(t *testing.T) {
+	ts := newTestServer(t)
+
+	rec := ts.do("POST", "/todos", `{"title": "Buy milk", "priority": "high", "tags": ["shop"], "due": {"date": "2026-10-20"}}`, nil)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("POST /todos = %d %s", rec.Code, rec.Body)
+	}
+	var todo models.Todo
+	if err := json.Unmarshal(rec.Body.Bytes(), &todo); err != nil {
+		t.Fatal(err)
+	}
+	if todo.ID == 0 || todo.Title != "Buy milk" || todo.Priority != models.PriorityHigh || todo.Completed {
+		t.Errorf("created %+v", todo)
+	}
+	if todo.Due == nil || todo.Due.Date != "2026-10-20" {
+		t.Errorf("created due %+v, want 2026-10-20", todo.Due)
+	}
+	if got := models.TagNames(todo.Tags); len(got) != 1 || got[0] != "shop" {
+		t.Errorf("created tags %v, want [shop]", got)
+	}
+	if loc := rec.Header().Get("Location"); loc != "/api/v1/todos/"+strconv.Itoa(todo.ID) {
+		t.Errorf("Location = %q", loc)
+	}
+
+	tests := []struct {
+		body string
+		code int
+	}{
+		{`{"title": ""}`, http.StatusUnprocessableEntity},
+		{`{"title": "x", "unknown": 1}`, http.StatusBadRequest},
+		{`{"title": "x", "due": {"date": "2026-13-01"}}`, http.StatusUnprocessableEntity},
+		{`{"title": "x", "due": {"date": "2026-10-20", "tz": "Europe/Paris"}}`, http.StatusUnprocessableEntity},
+	}
+	for _, tt := range tests {
+		if rec := ts.do("POST", "/todos", tt.body, nil); rec.Code != tt.code {
+			t.Errorf("POST /todos %s = %d, want %d", tt.body, rec.Code, tt.code)
+		}
+	}
+	if list := ts.list(""); len(list.Todos) != 1 {
+		t.Errorf("failed creations made todos: %v", titles(list.Todos))
+	}
+}
+
+func TestListTodos(t *testing.T) {
+	ts := newTestServer(t)
+	if list := ts.list(""); len(list.Todos) != 0 || list.Active != 0 {
+		t.Fatalf("new list = %+v, want it empty", list)
+	}
+
+	milk := ts.create(`{"title": "Buy milk"}`)
+	ts.create(`{"title": "Call mom", "tags": ["family"]}`)
+	ts.create(`{"title": "Milk the cow"}`)
+	ts.do("POST", todoPath(milk.ID, "/toggle"), "", nil)
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"", []string{"Buy milk", "Call mom", "Milk the cow"}},
+		{"filter=active", []string{"Call mom", "Milk the cow"}},
+		{"filter=completed", []string{"Buy milk"}},
+		{"tag=family", []string{"Call mom"}},
+		{"q=milk", []string{"Buy milk", "Milk the cow"}},
+	}
+	for _, tt := range tests {
+		list := ts.list(tt.query)
+		if got := strings.Join(titles(list.Todos), ", "); got != strings.Join(tt.want, ", ") {
+			t.Errorf("GET /?%s = %s, want %s", tt.query, got, strings.Join(tt.want, ", "))
+		}
+		if list.Active != 2 || list.Completed != 1 {
+			t.Errorf("GET /?%s counts %d active, %d completed, want 2 and 1", tt.query, list.Active, list.Completed)
+		}
+	}
+}
+
+func TestUpdateTodo(t *testing.T) {
+	ts := newTestServer(t)
+	todo := ts.create(`{"title": "Buy milk", "tags": ["shop"]}`)
+
+	var got models.Todo
+	rec := ts.do("PATCH", todoPath(todo.ID, ""), `{"title": "Buy oat milk", "notes": "Two", "priority": "urgent", "tags": []}`, &got)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("PATCH = %d %s", rec.Code, rec.Body)
+	}
+	if got.Title != "Buy oat milk" || got.Notes != "Two" || got.Priority != models.PriorityUrgent || len(got.Tags) != 0 {
+		t.Errorf("updated %+v", got)
+	}
+
+	// An invalid field rejects the whole update
+	rec = ts.do("PATCH", todoPath(todo.ID, ""), `{"title": "Changed", "due": {"date": "2026-10-20", "tz": "UTC"}}`, nil)
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("PATCH with a bad due = %d, want 422", rec.Code)
+	}
+	if list := ts.list(""); list.Todos[0].Title != "Buy oat milk" {
+		t.Errorf("a rejected update changed the title to %q", list.Todos[0].Title)
+	}
+
+	if rec := ts.do("PATCH", todoPath(todo.ID+100, ""), `{"title": "Nobody"}`, nil); rec.Code != http.StatusNotFound {
+		t.Errorf("PATCH of an unknown todo = %d, want 404", rec.Code)
+	}
+}
+
+func TestToggleTodo(t *testing.T) {
+	ts := newTestServer(t)
+	todo := ts.create(`{"title": "Buy milk"}`)
+
+	for _, want := range []bool{true, false} {
+		var got models.Todo
+		rec := ts.do("POST", todoPath(todo.ID, "/toggle"), "", &got)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("toggle = %d %s", rec.Code, rec.Body)
+		}
+		if got.Completed != want {
+			t.Errorf("toggled to completed %v, want %v", got.Completed, want)
+		}
+	}
+
+	if rec := ts.do("POST", todoPath(todo.ID+100, "/toggle"), "", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("toggle of an unknown todo = %d, want 404", rec.Code)
+	}
+}
+
+func TestToggleRepeatingTodo(t *testing.T) {
+	ts := newTestServer(t)
+	todo := ts.create(`{"title": "Water plants", "due": {"date": "2026-10-20"}, "recur": "FREQ=WEEKLY"}`)
+
+	var got models.Todo
+	if rec := ts.do("POST", todoPath(todo.ID, "/toggle"), "", &got); rec.Code != http.StatusOK {
+		t.Fatalf("toggle = %d %s", rec.Code, rec.Body)
+	}
+	if !got.Completed || got.NextID == 0 {
+		t.Fatalf("toggled %+v, want it completed with a next occurrence", got)
+	}
+	list := ts.list("filter=active")
+	if len(list.Todos) != 1 || list.Todos[0].ID != got.NextID || list.Todos[0].Due.Date != "2026-10-27" {
+		t.Errorf("open todos %+v, want the next occurrence due 2026-10-27", list.Todos)
+	}
+}
+
+func TestDeleteTodo(t *testing.T) {
+	ts := newTestServer(t)
+	todo := ts.create(`{"title": "Buy milk"}`)
+	ts.create(`{"title": "Call mom"}`)
+
+	if rec := ts.do("DELETE", todoPath(todo.ID, ""), "", nil); rec.Code != http.StatusNoContent {
+		t.Fatalf("DELETE = %d %s", rec.Code, rec.Body)
+	}
+	if list := ts.list(""); len(list.Todos) != 1 || list.Todos[0].Title != "Call mom" {
+		t.Errorf("after deleting, todos %v", titles(list.Todos))
+	}
+	if rec := ts.do("DELETE", todoPath(todo.ID, ""), "", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("second DELETE = %d, want 404", rec.Code)
+	}
+	if rec := ts.do("PATCH", todoPath(todo.ID, ""), `{"title": "Back"}`, nil); rec.Code != http.StatusNotFound {
+		t.Errorf("PATCH of a deleted todo = %d, want 404", rec.Code)
+	}
+}
+
+func TestOtherUsersTodos(t *testing.T) {
+	ts := newTestServer(t)
+	other, err := ts.store.CreateUser(context.Background(), "b@example.com", "hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	list, err := ts.store.DefaultList(context.Background(), other.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	theirs, err := ts.store.Create(context.Background(), other.ID, models.Todo{ListID: list.ID, Title: "Theirs"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, req := range []struct{ method, path, body string }{
+		{"PATCH", todoPath(theirs.ID, ""), `{"title": "Mine"}`},
+		{"POST", todoPath(theirs.ID, "/toggle"), ""},
+		{"DELETE", todoPath(theirs.ID, ""), ""},
+	} {
+		if rec := ts.do(req.method, req.path, req.body, nil); rec.Code != http.StatusNotFound {
+			t.Errorf("%s %s of another user's todo = %d, want 404", req.method, req.path, rec.Code)
+		}
+	}
+	if list := ts.list(""); len(list.Todos) != 0 {
+		t.Errorf("another user's todo is listed: %v", titles(list.Todos))
+	}
+}
+
+func TestReorderTodo(t *testing.T) {
+	ts := newTestServer(t)
+	a := ts.create(`{"title": "a"}`)
+	b := ts.create(`{"title": "b"}`)
+	c := ts.create(`{"title": "c"}`)
+
+	// HTMX already shows the dragged order, so it gets no content back
+	req := ts.form("POST", todoPath(c.ID, "/move"), "after="+strconv.Itoa(a.ID)+"&before="+strconv.Itoa(b.ID))
+	req.Header.Set("HX-Request", "true")
+	if rec := ts.serve(req, nil); rec.Code != http.StatusNoContent {
+		t.Fatalf("HTMX move = %d %s", rec.Code, rec.Body)
+	}
+	if got := titles(ts.list("").Todos); !slices.Equal(got, []string{"a", "c", "b"}) {
+		t.Errorf("after dragging c up: %v, want [a c b]", got)
+	}
+
+	var moved models.Todo
+	for _, path := range []string{todoPath(a.ID, "/move"), "/api/v1" + todoPath(a.ID, "/move")} {
+		if rec := ts.do("POST", path, `{"after": `+strconv.Itoa(b.ID)+`}`, &moved); rec.Code != http.StatusOK || moved.ID != a.ID {
+			t.Errorf("POST %s = %d %+v", path, rec.Code, moved)
+		}
+	}
+	if got := titles(ts.list("").Todos); !slices.Equal(got, []string{"c", "b", "a"}) {
+		t.Errorf("after moving a to the end: %v, want [c b a]", got)
+	}
+
+	// A client whose copy of the list is stale is told so
+	tests := []struct {
+		body string
+		code int
+	}{
+		{`{"after": ` + strconv.Itoa(a.ID) + `, "before": ` + strconv.Itoa(c.ID) + `}`, http.StatusConflict},
+		{`{"after": 999}`, http.StatusNotFound},
+		{`{"after": "b"}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		if rec := ts.do("POST", todoPath(b.ID, "/move"), tt.body, nil); rec.Code != tt.code {
+			t.Errorf("move %s = %d, want %d", tt.body, rec.Code, tt.code)
+		}
+	}
+}
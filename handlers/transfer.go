@@ -0,0 +1,459 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Tottitov/todo/components"
+	"github.com/Tottitov/todo/models"
+	"github.com/Tottitov/todo/rank"
+	"github.com/Tottitov/todo/store"
+	"github.com/Tottitov/todo/todotxt"
+	"github.com/Tottitov/todo/transfer"
+)
+
+// maxImportSize caps the size of the files users import.
+const maxImportSize = 10 << 20
+
+// TransferHandler serves the export of the user's todos as a file, and the
+// import of such a file: previewed first, then imported in one transaction.
+type TransferHandler struct {
+	Todos  store.TransferStore // Storage backend to export and import todos
+	Lists  store.ListStore     // Storage backend for the lists todos belong to
+	Events store.EventStore    // Audit log, which dates the completion of todos in todo.txt and iCalendar
+	Domain string              // Domain of the UIDs of iCalendar todos, the host of BASE_URL; localhost if empty
+}
+
+// Export handles GET /export, downloading every todo of the user outside
+// the trash, subtasks included, in the format given by the 'format' query
+// parameter: json, the default, csv, todotxt or ics. The file is streamed
+// as the todos are read, so exports of any size take little memory.
+func (h *TransferHandler) Export(w http.ResponseWriter, r *http.Request) {
+	repr := negotiate(w, r)
+
+	// Validate the format so typos don't download something unexpected
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = transfer.FormatJSON
+	}
+	if !transfer.ValidFormat(format) {
+		fail(w, repr, "Format must be one of "+strings.Join(transfer.Formats, ", "), http.StatusBadRequest)
+		return
+	}
+
+	filename := "todos-" + time.Now().Format(models.DateLayout) + "." + transfer.Extension(format)
+	h.export(w, r, repr, currentUser(r).ID, format, `attachment; filename="`+filename+`"`, false)
+}
+
+// export streams every todo of the user outside the trash to w as a file
+// in the given format, served with the given Content-Disposition. Formats
+// that date completions take the dates from the audit log, and events has
+// an iCalendar file carry the due dates of open todos as events too.
+func (h *TransferHandler) export(w http.ResponseWriter, r *http.Request, repr representation, userID int, format, disposition string, events bool) {
+	// Records name their lists, and users have few, so fetch them all up front
+	lists, err := h.Lists.Lists(r.Context(), userID)
+	if err != nil {
+		fail(w, repr, "Failed to fetch lists", http.StatusInternalServerError)
+		return
+	}
+	byID := make(map[int]models.List, len(lists))
+	for _, l := range lists {
+		byID[l.ID] = l
+	}
+	// Completed todos are dated by the latest completion the audit log has
+	var completed map[int]time.Time
+	if format == transfer.FormatTodoTxt || format == transfer.FormatICS {
+		if completed, err = h.Events.Completions(r.Context(), userID); err != nil {
+			fail(w, repr, "Failed to fetch completions", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", transfer.ContentType(format))
+	w.Header().Set("Content-Disposition", disposition)
+	tw := transfer.NewWriter(w, format)
+	tw.Events = events
+	if h.Domain != "" {
+		tw.Host = h.Domain
+	}
+	err = h.Todos.ExportTodos(r.Context(), userID, func(t models.Todo) error {
+		rec := transfer.NewRecord(t, byID[t.ListID])
+		if t.Completed {
+			rec.CompletedAt = completed[t.ID]
+		}
+		return tw.Write(rec)
+	})
+	if err == nil {
+		err = tw.Close()
+	}
+	if err != nil {
+		// The status is long sent, so break the download off rather than
+		// let it pass for a whole file
+		panic(http.ErrAbortHandler)
+	}
+}
+
+// ImportPage handles GET /import, showing the export downloads and the form
+// to upload a file to import.
+func (h *TransferHandler) ImportPage(w http.ResponseWriter, r *http.Request) {
+	setHTMLHeader(w)
+	components.ImportPage(components.ImportView{}).Render(r.Context(), w)
+}
+
+// Import handles POST /import. Browsers upload a 'file' in the 'format'
+// given, or told by the file's name, and get a preview of what importing it
+// does to each todo; the preview posts the file back as 'data', with
+// 'confirm' set, to import it for real. JSON clients send the file itself
+// as the request body, in the format given by ?format= or its Content-Type,
+// and preview it with ?dry_run=true; they get
+// {"dry_run", "created", "updated", "skipped", "rows": [...]}.
+//
+// Todos whose ID the user still has are updated, the others created. Rows
+// that are invalid are skipped with the reason, and the others imported in
+// a single transaction. A todo.txt file leaves the notes of the todos it
+// updates as they are, see completeTodoTxt.
+func (h *TransferHandler) Import(w http.ResponseWriter, r *http.Request) {
+	repr := negotiate(w, r)
+
+	// Read the file and its rows; a file that can't be read fails as a whole
+	view, commit, err := readImport(w, r, repr)
+	if err != nil {
+		importFailed(w, r, repr, view, err.Error(), http.StatusBadRequest)
+		return
+	}
+	rows, err := transfer.Read(strings.NewReader(view.Data), view.Format)
+	if err != nil {
+		importFailed(w, r, repr, view, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(rows) == 0 {
+		importFailed(w, r, repr, view, "The file holds no todos", http.StatusBadRequest)
+		return
+	}
+	if view.Format == transfer.FormatTodoTxt {
+		if err := h.completeTodoTxt(r, rows); err != nil {
+			fail(w, repr, "Failed to fetch todos", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// Import the valid rows, or just see what importing them would do
+	view.Rows, err = h.importRows(r, rows, !commit)
+	if err != nil {
+		fail(w, repr, "Failed to import todos", http.StatusInternalServerError)
+		return
+	}
+	view.Committed = commit
+	if !commit || view.Count(string(store.ImportCreated))+view.Count(string(store.ImportUpdated)) == 0 {
+		unchanged(r)
+	}
+
+	switch repr {
+	case reprJSON:
+		sendJSON(w, http.StatusOK, map[string]any{
+			"dry_run": !commit,
+			"created": view.Count(string(store.ImportCreated)),
+			"updated": view.Count(string(store.ImportUpdated)),
+			"skipped": view.Count(string(store.ImportSkipped)),
+			"rows":    view.Rows,
+		})
+	case reprFragment:
+		setHTMLHeader(w)
+		components.ImportResult(view).Render(r.Context(), w)
+	default:
+		setHTMLHeader(w)
+		components.ImportPage(view).Render(r.Context(), w)
+	}
+}
+
+// completeTodoTxt fills in the rows of a todo.txt file with what the format
+// can't carry. A project stands for the user's list it was written for,
+// spaces and all. A todo the user has keeps its notes, and without a
+// project its list, where a new one goes into the default list.
+func (h *TransferHandler) completeTodoTxt(r *http.Request, rows []transfer.Row) error {
+	userID := currentUser(r).ID
+	lists, err := h.Lists.Lists(r.Context(), userID)
+	if err != nil {
+		return err
+	}
+	byID := make(map[int]models.List, len(lists))
+	byProject := make(map[string]models.List, len(lists))
+	for _, l := range lists {
+		byID[l.ID] = l
+		if _, ok := byProject[todotxt.ProjectName(l.Name)]; !ok {
+			byProject[todotxt.ProjectName(l.Name)] = l
+		}
+	}
+	existing := make(map[int]models.Todo)
+	err = h.Todos.ExportTodos(r.Context(), userID, func(t models.Todo) error {
+		existing[t.ID] = t
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for i := range rows {
+		rec := &rows[i].Record
+		if l, ok := byProject[rec.List]; ok {
+			rec.List, rec.ListColor = l.Name, l.Color
+		}
+		t, ok := existing[rec.ID]
+		if rec.ID == 0 || !ok {
+			continue
+		}
+		rec.Notes = t.Notes
+		if rec.List == "" {
+			rec.List = byID[t.ListID].Name
+		}
+	}
+	return nil
+}
+
+// importRows validates the rows of a file and imports the valid ones, or
+// with dryRun only tells what importing them would do, returning what
+// becomes of every row. Rows the store can't import, because their parent
+// is unknown or a subtask itself, are found one at a time: each is skipped
+// and the import tried again without it.
+func (h *TransferHandler) importRows(r *http.Request, rows []transfer.Row, dryRun bool) ([]components.ImportRow, error) {
+	result := make([]components.ImportRow, len(rows))
+	todos := make([]store.ImportTodo, len(rows))
+	errs := make([]error, len(rows))
+	for i, row := range rows {
+		rec := row.Record
+		result[i] = components.ImportRow{Number: row.Number, ID: rec.ID, Title: rec.Title, List: rec.List}
+		todos[i], errs[i] = importTodo(row)
+	}
+	checkImportParents(rows, errs)
+
+	for {
+		var valid []int // Indices of the rows imported
+		var batch []store.ImportTodo
+		for i, err := range errs {
+			if err == nil {
+				valid = append(valid, i)
+				batch = append(batch, todos[i])
+			}
+		}
+		outcomes, err := h.Todos.Import(r.Context(), currentUser(r).ID, batch, dryRun)
+		var importErr *store.ImportError
+		if errors.As(err, &importErr) {
+			errs[valid[importErr.Index]] = importFailure(importErr.Err)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		for j, i := range valid {
+			result[i].Outcome = string(outcomes[j])
+		}
+		for i, err := range errs {
+			if err != nil {
+				result[i].Outcome, result[i].Reason = string(store.ImportSkipped), err.Error()
+			}
+		}
+		return result, nil
+	}
+}
+
+// importTodo validates a row of an imported file like the todos users
+// create, and returns the todo to import. A row without a list goes into
+// the default list's namesake, and an unknown list color becomes the first.
+func importTodo(row transfer.Row) (store.ImportTodo, error) {
+	if row.Err != nil {
+		return store.ImportTodo{}, row.Err
+	}
+	rec := row.Record
+	in := store.ImportTodo{
+		Todo: models.Todo{ID: rec.ID, ParentID: rec.ParentID, Title: rec.Title, Notes: rec.Notes,
+			Completed: rec.Completed, Position: rec.Position, CreatedAt: rec.CreatedAt},
+		List:        strings.TrimSpace(rec.List),
+		ListColor:   rec.ListColor,
+		CompletedAt: rec.CompletedAt,
+	}
+	if in.ID < 0 || in.ParentID < 0 {
+		return in, errors.New("IDs cannot be negative")
+	}
+	if strings.TrimSpace(in.Title) == "" {
+		return in, errEmptyTitle
+	}
+
+	var err error
+	if in.Priority, err = models.ParsePriority(rec.Priority); err != nil {
+		return in, err
+	}
+	if rec.Due != nil {
+		if in.Due, err = models.ParseDue(rec.Due.Date, rec.Due.Time, rec.Due.TZ); err != nil {
+			return in, err
+		}
+	}
+	names, err := models.ParseTags(strings.Join(rec.Tags, ","))
+	if err != nil {
+		return in, err
+	}
+	for _, name := range names {
+		in.Tags = append(in.Tags, models.Tag{Name: name})
+	}
+	rule, err := parseRecur(rec.Recur)
+	if err != nil {
+		return in, err
+	}
+	in.Recur = string(rule)
+	if in.Position != "" && !rank.Valid(in.Position) {
+		return in, errors.New("Invalid position")
+	}
+
+	if in.List == "" {
+		in.List = models.DefaultListName
+	}
+	if !models.ValidColor(in.ListColor) {
+		in.ListColor = models.Colors[0]
+	}
+	return in, nil
+}
+
+// checkImportParents records in errs why rows are invalid for their place
+// in the file: a row repeating the ID of an earlier one, a todo naming
+// itself as its parent, and a subtask of a row that is a subtask itself.
+func checkImportParents(rows []transfer.Row, errs []error) {
+	parents := make(map[int]int) // The parent ID of each row, by the row's ID
+	for i, row := range rows {
+		rec := row.Record
+		if errs[i] != nil || rec.ID == 0 {
+			continue
+		}
+		if _, ok := parents[rec.ID]; ok {
+			errs[i] = errors.New("Another row has the same ID")
+			continue
+		}
+		parents[rec.ID] = rec.ParentID
+	}
+	for i, row := range rows {
+		rec := row.Record
+		switch {
+		case errs[i] != nil || rec.ParentID == 0:
+		case rec.ParentID == rec.ID:
+			errs[i] = errors.New("A todo cannot be its own subtask")
+		case parents[rec.ParentID] != 0:
+			errs[i] = errors.New(errNested)
+		}
+	}
+}
+
+// importFailure describes why the store couldn't import a row.
+func importFailure(err error) error {
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		return errors.New("Parent todo not found")
+	case errors.Is(err, store.ErrNested):
+		return errors.New(errNested)
+	}
+	return err
+}
+
+// readImport reads the file to import from r, into the view of the import
+// along with its format, and reports whether it is to be imported for real
+// rather than previewed.
+func readImport(w http.ResponseWriter, r *http.Request, repr representation) (components.ImportView, bool, error) {
+	var view components.ImportView
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportSize)
+
+	// JSON clients send the file as the body
+	if repr == reprJSON {
+		q := r.URL.Query()
+		dryRun := false
+		if v := q.Get("dry_run"); v != "" {
+			var err error
+			if dryRun, err = strconv.ParseBool(v); err != nil {
+				return view, false, errors.New("dry_run must be true or false")
+			}
+		}
+		view.Format = q.Get("format")
+		if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); view.Format == "" {
+			switch mediaType {
+			case "text/csv":
+				view.Format = transfer.FormatCSV
+			case "text/plain":
+				view.Format = transfer.FormatTodoTxt
+			}
+		}
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			return view, false, importReadError(err)
+		}
+		view.Data = string(data)
+		return view, !dryRun, checkImportFormat(&view)
+	}
+
+	// Browsers upload the file, or pass it on from the preview
+	if err := r.ParseMultipartForm(maxImportSize); err != nil && !errors.Is(err, http.ErrNotMultipart) {
+		return view, false, importReadError(err)
+	}
+	view.Format = r.PostFormValue("format")
+	commit := r.PostFormValue("confirm") == "true"
+	file, header, err := r.FormFile("file")
+	switch {
+	case err == nil:
+		defer file.Close()
+		data, err := io.ReadAll(file)
+		if err != nil {
+			return view, false, importReadError(err)
+		}
+		view.Data = string(data)
+		if view.Format == "" {
+			view.Format = transfer.FormatOf(header.Filename)
+		}
+	case errors.Is(err, http.ErrMissingFile) || errors.Is(err, http.ErrNotMultipart):
+		view.Data = r.PostFormValue("data")
+	default:
+		return view, false, importReadError(err)
+	}
+	if view.Data == "" {
+		return view, false, errors.New("Choose a file to import")
+	}
+	return view, commit, checkImportFormat(&view)
+}
+
+// checkImportFormat defaults the format of a file to import to JSON, and
+// rejects formats that aren't supported.
+func checkImportFormat(view *components.ImportView) error {
+	if view.Format == "" {
+		view.Format = transfer.FormatJSON
+	}
+	if !transfer.ValidFormat(view.Format) {
+		return errors.New("Format must be one of " + strings.Join(transfer.Formats, ", "))
+	}
+	return nil
+}
+
+// importReadError describes why the file to import couldn't be read.
+func importReadError(err error) error {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return errors.New("Files to import must be at most 10 MB")
+	}
+	return errors.New("Failed to read the file")
+}
+
+// importFailed reports a file that can't be imported at all: on the import
+// page, under the form, or as a JSON error.
+func importFailed(w http.ResponseWriter, r *http.Request, repr representation, view components.ImportView, msg string, code int) {
+	switch repr {
+	case reprJSON:
+		sendJSONError(w, msg, code)
+		return
+	case reprFragment:
+		fail(w, repr, msg, code)
+		return
+	}
+	view.Error, view.Data = msg, ""
+	setHTMLHeader(w)
+	w.WriteHeader(code)
+	components.ImportPage(view).Render(r.Context(), w)
+}
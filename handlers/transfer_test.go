@@ -0,0 +1,250 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/Tottitov/todo/components"
+	"github.com/Tottitov/todo/models"
+	"github.com/Tottitov/todo/store"
+	"github.com/Tottitov/todo/transfer"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// importResult is the JSON of an import.
+type importResult struct {
+	DryRun  bool                   `json:"dry_run"`
+	Created int                    `json:"created"`
+	Updated int                    `json:"updated"`
+	Skipped int                    `json:"skipped"`
+	Rows    []components.ImportRow `json:"rows"`
+}
+
+// seed gives the user todos of every kind an export carries: in two lists,
+// with notes, priorities, due dates, tags and rules, a subtask and a
+// completed todo.
+func (ts *testServer) seed() {
+	ts.t.Helper()
+	ctx := context.Background()
+	milk := ts.create(`{"title": "Buy milk", "notes": "Oat", "priority": "high", "tags": ["shop", "food"], "due": {"date": "2026-10-20"}}`)
+	ts.create(`{"title": "Water plants", "due": {"date": "2026-10-20", "time": "09:30", "tz": "Europe/Paris"}, "recur": "FREQ=WEEKLY;BYDAY=MO,TH"}`)
+	taxes := ts.create(`{"title": "File taxes", "priority": "urgent"}`)
+	if rec := ts.do("POST", todoPath(taxes.ID, "/toggle"), "", nil); rec.Code != http.StatusOK {
+		ts.t.Fatalf("toggle = %d %s", rec.Code, rec.Body)
+	}
+	if _, err := ts.store.Create(ctx, ts.user.ID, models.Todo{ListID: milk.ListID, ParentID: milk.ID, Title: "Check the date"}); err != nil {
+		ts.t.Fatal(err)
+	}
+	work, err := ts.store.CreateList(ctx, ts.user.ID, "Work stuff", "blue")
+	if err != nil {
+		ts.t.Fatal(err)
+	}
+	if _, err := ts.store.Create(ctx, ts.user.ID, models.Todo{ListID: work.ID, Title: "Write report", Priority: models.PriorityLow}); err != nil {
+		ts.t.Fatal(err)
+	}
+}
+
+// dtstamp matches the time an iCalendar file was written, which differs
+// between exports.
+var dtstamp = regexp.MustCompile(`(?m)^DTSTAMP:.*$`)
+
+// export returns the user's todos exported in format.
+func (ts *testServer) export(format string) string {
+	ts.t.Helper()
+	rec := ts.do("GET", "/export?format="+format, "", nil)
+	if rec.Code != http.StatusOK {
+		ts.t.Fatalf("export %s = %d %s", format, rec.Code, rec.Body)
+	}
+	return dtstamp.ReplaceAllString(rec.Body.String(), "DTSTAMP:")
+}
+
+// importFile imports a file in format, or previews the import with dryRun.
+func (ts *testServer) importFile(format, file string, dryRun bool) importResult {
+	ts.t.Helper()
+	query := "/import?format=" + format
+	if dryRun {
+		query += "&dry_run=true"
+	}
+	var result importResult
+	if rec := ts.do("POST", query, file, &result); rec.Code != http.StatusOK {
+		ts.t.Fatalf("import %s = %d %s", format, rec.Code, rec.Body)
+	}
+	return result
+}
+
+// events returns how many events the audit log has of the user's todos.
+func (ts *testServer) events() int {
+	ts.t.Helper()
+	events, err := ts.store.Events(context.Background(), ts.user.ID, store.EventQuery{})
+	if err != nil {
+		ts.t.Fatal(err)
+	}
+	return len(events)
+}
+
+// TestExportImportRoundTrip imports each format's export back, which has to
+// skip every todo and change nothing.
+func TestExportImportRoundTrip(t *testing.T) {
+	for _, format := range transfer.Formats {
+		t.Run(format, func(t *testing.T) {
+			ts := newTestServer(t)
+			ts.seed()
+			file := ts.export(format)
+			events := ts.events()
+
+			for _, dryRun := range []bool{true, false} {
+				result := ts.importFile(format, file, dryRun)
+				if result.DryRun != dryRun || result.Created != 0 || result.Updated != 0 || result.Skipped != 5 {
+					t.Errorf("importing the export (dry run %v): %+v", dryRun, result)
+				}
+				for _, row := range result.Rows {
+					if row.Outcome != string(store.ImportSkipped) || row.Reason != "" {
+						t.Errorf("row %d (%s): %s %s, want it skipped as it is", row.Number, row.Title, row.Outcome, row.Reason)
+					}
+				}
+			}
+			if again := ts.export(format); again != file {
+				t.Errorf("the export changed after importing it:\n%s\nwant:\n%s", again, file)
+			}
+			if n := ts.events(); n != events {
+				t.Errorf("importing the export logged %d events", n-events)
+			}
+		})
+	}
+}
+
+// TestImportDryRun previews an import that would change todos, which has to
+// tell what it would do without doing it, then imports it.
+func TestImportDryRun(t *testing.T) {
+	ts := newTestServer(t)
+	ts.seed()
+	file := ts.export(transfer.FormatJSON)
+	events := ts.events()
+
+	var records []transfer.Record
+	if err := json.Unmarshal([]byte(file), &records); err != nil {
+		t.Fatal(err)
+	}
+	records[0].Title = "Buy more milk"
+	records[1].Completed = true
+	records = append(records, transfer.Record{Title: "New one", List: "New list", Priority: "none"})
+	changed, err := json.Marshal(records)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	preview := ts.importFile(transfer.FormatJSON, string(changed), true)
+	if !preview.DryRun || preview.Created != 1 || preview.Updated != 2 || preview.Skipped != 3 {
+		t.Errorf("dry run: %+v, want 1 created, 2 updated and 3 skipped", preview)
+	}
+	if again := ts.export(transfer.FormatJSON); again != file {
+		t.Errorf("a dry run changed the todos:\n%s\nwant:\n%s", again, file)
+	}
+	if n := ts.events(); n != events {
+		t.Errorf("a dry run logged %d events", n-events)
+	}
+	lists, err := ts.store.Lists(context.Background(), ts.user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lists) != 2 {
+		t.Errorf("a dry run made lists: %+v", lists)
+	}
+
+	// The import itself does what the dry run said it would
+	result := ts.importFile(transfer.FormatJSON, string(changed), false)
+	result.DryRun = true
+	if !equalImports(result, preview) {
+		t.Errorf("import: %+v, want it as previewed: %+v", result, preview)
+	}
+	if ts.export(transfer.FormatJSON) == file {
+		t.Error("the import changed nothing")
+	}
+	if again := ts.importFile(transfer.FormatJSON, ts.export(transfer.FormatJSON), false); again.Skipped != 6 {
+		t.Errorf("importing the new export: %+v, want every todo skipped", again)
+	}
+}
+
+// equalImports reports whether two imports had the same outcomes.
+func equalImports(a, b importResult) bool {
+	if a.DryRun != b.DryRun || a.Created != b.Created || a.Updated != b.Updated || a.Skipped != b.Skipped || len(a.Rows) != len(b.Rows) {
+		return false
+	}
+	for i := range a.Rows {
+		if a.Rows[i] != b.Rows[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// TestImportTodoTxtCompletion imports a completed todo.txt task, whose
+// dates have to come back in the export.
+func TestImportTodoTxtCompletion(t *testing.T) {
+	ts := newTestServer(t)
+	const line = "x 2026-10-01 2026-09-30 Done thing +Inbox"
+	result := ts.importFile(transfer.FormatTodoTxt, line+"\n", false)
+	if result.Created != 1 {
+		t.Fatalf("import: %+v", result)
+	}
+	file := ts.export(transfer.FormatTodoTxt)
+	if !strings.HasPrefix(file, line+" id:") {
+		t.Errorf("export = %q, want %q with its ID", file, line)
+	}
+}
+
+// uidLines matches the lines of an iCalendar file naming the UID of a todo.
+var uidLines = regexp.MustCompile(`(?m)^(UID|RELATED-TO):[^\r\n]*`)
+
+// TestExportUIDs checks that the UIDs of an iCalendar export take their
+// domain from the configured one, or localhost, whatever Host the request
+// names, so calendars recognize the todos they already have.
+func TestExportUIDs(t *testing.T) {
+	ts := newTestServer(t)
+	ts.seed()
+	for _, tt := range []struct{ domain, golden string }{
+		{"todo.example.com", "uids.txt"},
+		{"", "uids-localhost.txt"},
+	} {
+		h := &TransferHandler{Todos: ts.store, Lists: ts.store, Events: ts.store, Domain: tt.domain}
+		for _, host := range []string{"todo.example.com", "evil.example:8443"} {
+			req := ts.request("GET", "/export?format=ics", "")
+			req.Host = host
+			rec := httptest.NewRecorder()
+			h.Export(rec, req.WithContext(context.WithValue(req.Context(), userKey, ts.user)))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("export = %d %s", rec.Code, rec.Body)
+			}
+			uids := strings.Join(uidLines.FindAllString(rec.Body.String(), -1), "\n") + "\n"
+			golden(t, tt.golden, []byte(uids))
+		}
+	}
+}
+
+// golden compares got with the golden file testdata/name, or rewrites the
+// file with -update.
+func golden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", name)
+	if *update {
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(want) {
+		t.Errorf("%s differs:\n%s\nwant:\n%s", name, got, want)
+	}
+}
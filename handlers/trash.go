@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/Tottitov/todo/components"
+	"github.com/Tottitov/todo/models"
+	"github.com/Tottitov/todo/store"
+)
+
+// TrashHandler serves the trash, where deleted todos wait until they are
+// restored, deleted for good, or purged once Retention has passed. HTMX
+// requests receive the refreshed trash table, browsers are redirected back
+// to the page and JSON clients get the todos.
+type TrashHandler struct {
+	Todos     store.TodoStore // Storage backend for todos
+	Lists     store.ListStore // Storage backend for lists, to name each todo's list
+	Retention time.Duration   // How long todos stay in the trash before they are purged
+}
+
+// Page handles GET /trash, listing the user's deleted todos, most recently
+// deleted first.
+func (h *TrashHandler) Page(w http.ResponseWriter, r *http.Request) {
+	repr := negotiate(w, r)
+
+	view, err := h.view(r)
+	if err != nil {
+		fail(w, repr, "Failed to fetch trash", http.StatusInternalServerError)
+		return
+	}
+
+	switch repr {
+	case reprJSON:
+		sendJSON(w, http.StatusOK, map[string]any{"todos": view.Todos})
+	case reprFragment:
+		setHTMLHeader(w)
+		components.TrashTable(view).Render(r.Context(), w)
+	default:
+		setHTMLHeader(w)
+		components.TrashPage(view).Render(r.Context(), w)
+	}
+}
+
+// Restore handles POST /trash/{id}/restore, putting the todo back into its
+// list along with the subtasks deleted with it. JSON clients receive the
+// restored todo.
+func (h *TrashHandler) Restore(w http.ResponseWriter, r *http.Request) {
+	repr := negotiate(w, r)
+
+	// Extract and validate the todo ID from the URL
+	id, err := parseID(r)
+	if err != nil {
+		fail(w, repr, "Invalid ID format", http.StatusBadRequest)
+		return
+	}
+
+	// Take the todo out of the trash
+	todo, err := h.Todos.Restore(r.Context(), currentUser(r).ID, id)
+	if err != nil {
+		failStore(w, repr, err, "Failed to restore todo")
+		return
+	}
+
+	if repr == reprJSON {
+		sendJSON(w, http.StatusOK, todo)
+		return
+	}
+	h.renderTrash(w, r, repr)
+}
+
+// Purge handles DELETE /trash/{id}, deleting the todo and its subtasks for
+// good (204 No Content for JSON clients).
+func (h *TrashHandler) Purge(w http.ResponseWriter, r *http.Request) {
+	repr := negotiate(w, r)
+
+	// Extract and validate the todo ID from the URL
+	id, err := parseID(r)
+	if err != nil {
+		fail(w, repr, "Invalid ID format", http.StatusBadRequest)
+		return
+	}
+
+	// Delete the todo from the store
+	if err := h.Todos.Purge(r.Context(), currentUser(r).ID, id); err != nil {
+		failStore(w, repr, err, "Failed to delete todo")
+		return
+	}
+
+	if repr == reprJSON {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	h.renderTrash(w, r, repr)
+}
+
+// Empty handles DELETE /trash, deleting every todo in the trash for good.
+// JSON clients receive the number of deleted todos.
+func (h *TrashHandler) Empty(w http.ResponseWriter, r *http.Request) {
+	repr := negotiate(w, r)
+
+	n, err := h.Todos.EmptyTrash(r.Context(), currentUser(r).ID)
+	if err != nil {
+		fail(w, repr, "Failed to empty trash", http.StatusInternalServerError)
+		return
+	}
+
+	if repr == reprJSON {
+		sendJSON(w, http.StatusOK, map[string]int{"deleted": n})
+		return
+	}
+	h.renderTrash(w, r, repr)
+}
+
+// view gathers the trashed todos along with the names of their lists.
+func (h *TrashHandler) view(r *http.Request) (components.TrashView, error) {
+	userID := currentUser(r).ID
+	todos, err := h.Todos.Trash(r.Context(), userID)
+	if err != nil {
+		return components.TrashView{}, err
+	}
+	lists, err := h.Lists.Lists(r.Context(), userID)
+	if err != nil {
+		return components.TrashView{}, err
+	}
+
+	view := components.TrashView{Todos: todos, ListNames: map[int]string{}, Retention: h.Retention}
+	if view.Todos == nil {
+		view.Todos = []models.Todo{}
+	}
+	for _, list := range lists {
+		view.ListNames[list.ID] = list.Name
+	}
+	return view, nil
+}
+
+// renderTrash answers a successful change with the refreshed trash table for
+// HTMX, or by redirecting browsers back to the trash page.
+func (h *TrashHandler) renderTrash(w http.ResponseWriter, r *http.Request, repr representation) {
+	if repr != reprFragment {
+		http.Redirect(w, r, "/trash", http.StatusSeeOther)
+		return
+	}
+	view, err := h.view(r)
+	if err != nil {
+		sendError(w, "Failed to reload trash", http.StatusInternalServerError)
+		return
+	}
+	setHTMLHeader(w)
+	components.TrashTable(view).Render(r.Context(), w)
+}
@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// trash returns the titles of the todos in the trash.
+func (ts *testServer) trash() []string {
+	ts.t.Helper()
+	var body todoList
+	if rec := ts.do("GET", "/trash", "", &body); rec.Code != http.StatusOK {
+		ts.t.Fatalf("GET /trash = %d %s", rec.Code, rec.Body)
+	}
+	return titles(body.Todos)
+}
+
+func TestTrash(t *testing.T) {
+	ts := newTestServer(t)
+	if got := ts.trash(); got == nil || len(got) != 0 {
+		t.Errorf("empty trash = %#v, want an empty array", got)
+	}
+	milk := ts.create(`{"title": "Buy milk"}`)
+	rent := ts.create(`{"title": "Pay rent"}`)
+	ts.create(`{"title": "Water plants"}`)
+	for _, id := range []int{milk.ID, rent.ID} {
+		if rec := ts.do("DELETE", todoPath(id, ""), "", nil); rec.Code != http.StatusNoContent {
+			t.Fatalf("DELETE %s = %d", todoPath(id, ""), rec.Code)
+		}
+	}
+	if got := ts.trash(); !slices.Equal(got, []string{"Pay rent", "Buy milk"}) {
+		t.Errorf("trash = %v, want the most recently deleted first", got)
+	}
+
+	// HTMX gets the table, naming each todo's list and when it goes for good
+	req := ts.form("GET", "/trash", "")
+	req.Header.Set("HX-Request", "true")
+	rec := ts.serve(req, nil)
+	if body := rec.Body.String(); rec.Code != http.StatusOK || !strings.Contains(body, `id="trash-table"`) || !strings.Contains(body, "gone after") {
+		t.Errorf("trash table = %d:\n%s", rec.Code, body)
+	}
+
+	var restored struct{ Title string }
+	if rec := ts.do("POST", "/trash/"+strconv.Itoa(milk.ID)+"/restore", "", &restored); rec.Code != http.StatusOK || restored.Title != "Buy milk" {
+		t.Errorf("restore = %d %+v", rec.Code, restored)
+	}
+	if got := titles(ts.list("").Todos); len(got) != 2 {
+		t.Errorf("list after restoring = %v", got)
+	}
+	req = ts.form("DELETE", "/trash/"+strconv.Itoa(rent.ID), "")
+	if rec := ts.serve(req, nil); rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/trash" {
+		t.Errorf("purge from the page = %d to %q, want a redirect to /trash", rec.Code, rec.Header().Get("Location"))
+	}
+	if got := ts.trash(); len(got) != 0 {
+		t.Errorf("trash after purging = %v", got)
+	}
+
+	tests := []struct {
+		method, path string
+		code         int
+	}{
+		{"POST", "/trash/" + strconv.Itoa(milk.ID) + "/restore", http.StatusNotFound},
+		{"DELETE", "/trash/" + strconv.Itoa(milk.ID), http.StatusNotFound},
+		{"DELETE", "/trash/" + strconv.Itoa(rent.ID), http.StatusNotFound},
+		{"POST", "/trash/x/restore", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		if rec := ts.do(tt.method, tt.path, "", nil); rec.Code != tt.code {
+			t.Errorf("%s %s = %d, want %d", tt.method, tt.path, rec.Code, tt.code)
+		}
+	}
+
+	ts.do("DELETE", todoPath(milk.ID, ""), "", nil)
+	var emptied struct{ Deleted int }
+	if rec := ts.do("DELETE", "/trash", "", &emptied); rec.Code != http.StatusOK || emptied.Deleted != 1 {
+		t.Errorf("emptying the trash = %d %+v, want 1 deleted", rec.Code, emptied)
+	}
+}
@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/Tottitov/todo/auth"
+	"github.com/Tottitov/todo/components"
+	"github.com/Tottitov/todo/models"
+	"github.com/Tottitov/todo/store"
+	"github.com/go-chi/chi/v5"
+)
+
+// undoWindow is how long the undo offered after a destructive action lasts.
+const undoWindow = 8 * time.Second
+
+// Undo handles POST /undo/{token}, reversing the action the token was
+// offered for while the offer lasts; afterwards it fails with 410 Gone.
+// HTMX receives the list the action happened in along with the cleared
+// toast, JSON clients 204 No Content.
+func (h *TodoHandler) Undo(w http.ResponseWriter, r *http.Request) {
+	repr := negotiate(w, r)
+
+	// Claim the offer, so it can't be undone twice
+	if h.Undos == nil {
+		fail(w, repr, "Nothing to undo", http.StatusGone)
+		return
+	}
+	userID := currentUser(r).ID
+	offer, err := h.Undos.TakeUndo(r.Context(), userID, auth.HashToken(chi.URLParam(r, "token")))
+	if errors.Is(err, store.ErrNotFound) {
+		fail(w, repr, "Nothing to undo", http.StatusGone)
+		return
+	}
+	if err != nil {
+		fail(w, repr, "Failed to undo", http.StatusInternalServerError)
+		return
+	}
+
+	// Reverse the action
+	if err := h.undo(r.Context(), userID, offer.Action); err != nil {
+		failStore(w, repr, err, "Failed to undo")
+		return
+	}
+
+	switch repr {
+	case reprJSON:
+		w.WriteHeader(http.StatusNoContent)
+	case reprFragment:
+		h.renderListContent(w, r, offer.ListID, http.StatusOK)
+		components.Toast().Render(r.Context(), w)
+	default:
+		http.Redirect(w, r, listPath(offer.ListID), http.StatusSeeOther)
+	}
+}
+
+// offerUndo makes an undo offer for an action in a list and renders the
+// toast announcing it with message, out of band after the fragment already
+// written. Offers that have expired in the meantime are dropped. Without
+// Undos, actions can't be undone and no toast is shown.
+func (h *TodoHandler) offerUndo(w http.ResponseWriter, r *http.Request, listID int, message string, action store.UndoAction) {
+	if h.Undos == nil {
+		return
+	}
+	token, hash, err := auth.NewToken()
+	if err != nil {
+		return
+	}
+	now := time.Now()
+	offer := store.UndoOffer{TokenHash: hash, UserID: currentUser(r).ID, ListID: listID, Action: action, ExpiresAt: now.Add(undoWindow)}
+	if err := h.Undos.CreateUndo(r.Context(), offer); err != nil {
+		return
+	}
+	h.Undos.DeleteExpiredUndos(r.Context(), now)
+	components.UndoToast(message, "/undo/"+token, undoWindow).Render(r.Context(), w)
+}
+
+// undo reverses the action of one of the user's undo offers.
+func (h *TodoHandler) undo(ctx context.Context, userID int, action store.UndoAction) error {
+	switch {
+	case action.Untoggle != nil:
+		return h.Store.Untoggle(ctx, userID, *action.Untoggle)
+	case action.Undelete != nil:
+		_, err := h.Store.Undelete(ctx, userID, action.Undelete)
+		return err
+	default:
+		_, err := h.Store.Restore(ctx, userID, action.Restore)
+		return err
+	}
+}
+
+// untoggle returns the undo of a toggle that turned before into after,
+// completing reopen along the way. The store takes back the next
+// occurrence of a repeating todo for good, puts the rule and completion
+// status back without repeating the todo again, and reopens the subtasks
+// the completion cascaded to, all at once.
+func untoggle(before, after models.Todo, reopen []int) store.UndoAction {
+	return store.UndoAction{Untoggle: &store.ToggleUndo{
+		ID:        before.ID,
+		Completed: before.Completed,
+		Recur:     before.Recur,
+		NextID:    after.NextID,
+		Reopen:    reopen,
+	}}
+}
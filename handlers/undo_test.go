@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"slices"
+	"testing"
+
+	"github.com/Tottitov/todo/models"
+)
+
+// undoButton finds the URL of the Undo button in a toast.
+var undoButton = regexp.MustCompile(`hx-post="(/undo/[^"]+)"`)
+
+// htmx sends an HTMX request from the list page with body, if any, as form
+// data.
+func (ts *testServer) htmx(method, path, body string) *httptest.ResponseRecorder {
+	ts.t.Helper()
+	req := ts.form(method, path, body)
+	req.Header.Set("HX-Request", "true")
+	return ts.serve(req, nil)
+}
+
+// undoURL returns the URL of the Undo button of the toast rec carries.
+func undoURL(t *testing.T, rec *httptest.ResponseRecorder) string {
+	t.Helper()
+	m := undoButton.FindStringSubmatch(rec.Body.String())
+	if rec.Code != http.StatusOK || m == nil {
+		t.Fatalf("response %d without an undo toast:\n%s", rec.Code, rec.Body)
+	}
+	return m[1]
+}
+
+// TestUndoDelete undoes a deletion on another instance than the one that
+// offered it, as happens behind a load balancer, and only once.
+func TestUndoDelete(t *testing.T) {
+	ts := newTestServer(t)
+	todo := ts.create(`{"title": "Buy milk"}`)
+	undo := undoURL(t, ts.htmx("DELETE", todoPath(todo.ID, ""), ""))
+
+	other := ts.instance()
+	if rec := other.htmx("POST", undo, ""); rec.Code != http.StatusOK {
+		t.Fatalf("undo on another instance = %d %s", rec.Code, rec.Body)
+	}
+	if got := titles(ts.list("").Todos); !slices.Equal(got, []string{"Buy milk"}) {
+		t.Errorf("list after undoing = %v, want [Buy milk]", got)
+	}
+	for _, s := range []*testServer{ts, other} {
+		if rec := s.htmx("POST", undo, ""); rec.Code != http.StatusGone {
+			t.Errorf("undoing twice = %d, want 410", rec.Code)
+		}
+	}
+	if rec := ts.do("POST", "/undo/forged", "", nil); rec.Code != http.StatusGone {
+		t.Errorf("undo with a made-up token = %d, want 410", rec.Code)
+	}
+
+	// JSON clients may take an offer too
+	undo = undoURL(t, ts.htmx("DELETE", todoPath(todo.ID, ""), ""))
+	if rec := ts.do("POST", undo, "", nil); rec.Code != http.StatusNoContent {
+		t.Errorf("JSON undo = %d, want 204", rec.Code)
+	}
+}
+
+// TestUndoToggle undoes completing a repeating todo together with its open
+// subtasks, which reopens exactly those and takes the next occurrence back.
+func TestUndoToggle(t *testing.T) {
+	ts := newTestServer(t)
+	todo := ts.create(`{"title": "Water plants", "due": {"date": "2026-10-20"}, "recur": "FREQ=WEEKLY"}`)
+	var done, open models.Todo
+	ts.do("POST", todoPath(todo.ID, "/subtasks"), `{"title": "Fill the can"}`, &done)
+	ts.do("POST", todoPath(todo.ID, "/subtasks"), `{"title": "Check the soil"}`, &open)
+	ts.do("POST", todoPath(done.ID, "/toggle"), "", nil)
+
+	undo := undoURL(t, ts.htmx("POST", todoPath(todo.ID, "/toggle"), "cascade=true"))
+	if got := ts.list(""); len(got.Todos) != 2 {
+		t.Fatalf("list after completing = %v, want the todo and its next occurrence", titles(got.Todos))
+	}
+	if rec := ts.instance().htmx("POST", undo, ""); rec.Code != http.StatusOK {
+		t.Fatalf("undo = %d %s", rec.Code, rec.Body)
+	}
+
+	list := ts.list("")
+	if len(list.Todos) != 1 || list.Todos[0].Completed || list.Todos[0].Recur != "FREQ=WEEKLY" {
+		t.Errorf("list after undoing = %+v, want the todo open and repeating, without a next occurrence", list.Todos)
+	}
+	for _, sub := range ts.subtasks(todo.ID) {
+		if want := sub.ID == done.ID; sub.Completed != want {
+			t.Errorf("subtask %q completed = %v after undoing, want %v", sub.Title, sub.Completed, want)
+		}
+	}
+}
+
+// TestUndoDeleteCompleted undoes clearing completed todos, which brings
+// back every todo the clearing moved to the trash and nothing else.
+func TestUndoDeleteCompleted(t *testing.T) {
+	ts := newTestServer(t)
+	rent := ts.create(`{"title": "Pay rent"}`)
+	trip := ts.create(`{"title": "Plan trip"}`)
+	ts.do("POST", todoPath(trip.ID, "/subtasks"), `{"title": "Book hotel"}`, nil)
+	old := ts.create(`{"title": "Old news"}`)
+	ts.create(`{"title": "Buy milk"}`)
+	for _, id := range []int{rent.ID, trip.ID, old.ID} {
+		ts.do("POST", todoPath(id, "/toggle"), "", nil)
+	}
+	ts.do("DELETE", todoPath(old.ID, ""), "", nil)
+
+	undo := undoURL(t, ts.htmx("DELETE", "/todos/completed", ""))
+	if got := titles(ts.list("").Todos); !slices.Equal(got, []string{"Buy milk"}) {
+		t.Fatalf("list after clearing = %v", got)
+	}
+	if rec := ts.instance().htmx("POST", undo, ""); rec.Code != http.StatusOK {
+		t.Fatalf("undo = %d %s", rec.Code, rec.Body)
+	}
+	if got := titles(ts.list("").Todos); !slices.Equal(got, []string{"Pay rent", "Plan trip", "Buy milk"}) {
+		t.Errorf("list after undoing = %v", got)
+	}
+	if got := ts.subtasks(trip.ID); len(got) != 1 {
+		t.Errorf("subtasks after undoing = %v, want the hotel back", titles(got))
+	}
+	if got := ts.trash(); !slices.Equal(got, []string{"Old news"}) {
+		t.Errorf("trash after undoing = %v, want the todo deleted before", got)
+	}
+}
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"encoding/json"
 	"net/http"
 	"strconv"
 
@@ -9,16 +10,44 @@ import (
 
 const (
 	contentTypeHTML = "text/html"
+	contentTypeJSON = "application/json"
 )
 
 func sendError(w http.ResponseWriter, msg string, code int) {
 	http.Error(w, msg, code)
 }
 
+// sendJSONError writes an error as {"error": msg} with the given status code.
+func sendJSONError(w http.ResponseWriter, msg string, code int) {
+	sendJSON(w, code, map[string]string{"error": msg})
+}
+
+// sendJSON writes v as a JSON response with the given status code.
+func sendJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", contentTypeJSON)
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
 func parseID(r *http.Request) (int, error) {
 	return strconv.Atoi(chi.URLParam(r, "id"))
 }
 
+// parseListID reads the {listID} URL parameter.
+func parseListID(r *http.Request) (int, error) {
+	return strconv.Atoi(chi.URLParam(r, "listID"))
+}
+
+// parseTagID reads the {tagID} URL parameter.
+func parseTagID(r *http.Request) (int, error) {
+	return strconv.Atoi(chi.URLParam(r, "tagID"))
+}
+
+// listPath returns the page URL of a list.
+func listPath(id int) string {
+	return "/lists/" + strconv.Itoa(id)
+}
+
 func setHTMLHeader(w http.ResponseWriter) {
 	w.Header().Set("Content-Type", contentTypeHTML)
 }
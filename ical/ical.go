@@ -0,0 +1,300 @@
+// Package ical reads and writes iCalendar data (RFC 5545): components such
+// as VCALENDAR and VTODO, between BEGIN and END lines, made of properties,
+// one per content line:
+//
+//	DUE;VALUE=DATE:20250309
+//
+// A property has a name, parameters and a value. Lines longer than 75
+// octets are folded, continuing on lines that start with a space.
+//
+// The package knows nothing of what components and properties mean, beyond
+// the escaping of text values and the forms of dates and times.
+package ical
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Property is a content line. Its value is kept as written: text values
+// are escaped, see Text and EscapeText.
+type Property struct {
+	Name   string
+	Params map[string]string // By upper-case name, unquoted
+	Value  string
+}
+
+// Param returns the value of a parameter of the property, empty if unset.
+func (p Property) Param(name string) string {
+	return p.Params[name]
+}
+
+// Component is a component with its properties and the components nested
+// in it, such as the VTODOs of a VCALENDAR.
+type Component struct {
+	Name       string
+	Props      []Property
+	Components []Component
+}
+
+// Get returns the component's first property with the given name.
+func (c Component) Get(name string) (Property, bool) {
+	for _, p := range c.Props {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return Property{}, false
+}
+
+// All returns every property of the component with the given name.
+func (c Component) All(name string) []Property {
+	var props []Property
+	for _, p := range c.Props {
+		if p.Name == name {
+			props = append(props, p)
+		}
+	}
+	return props
+}
+
+// Formats of the values of dates and times.
+const (
+	DateLayout     = "20060102"
+	DateTimeLayout = "20060102T150405"
+	UTCLayout      = "20060102T150405Z"
+)
+
+// Time returns the date or date-time value of a property, and whether it
+// is a date only, in UTC. A date-time is read in the time zone its TZID
+// parameter names, and a floating one, in no time zone, as UTC.
+func (p Property) Time() (time.Time, bool, error) {
+	if p.Param("VALUE") == "DATE" || len(p.Value) == len(DateLayout) {
+		t, err := time.Parse(DateLayout, p.Value)
+		return t, true, err
+	}
+	if strings.HasSuffix(p.Value, "Z") {
+		t, err := time.Parse(UTCLayout, p.Value)
+		return t, false, err
+	}
+	loc := time.UTC
+	if tzid := p.Param("TZID"); tzid != "" {
+		var err error
+		if loc, err = time.LoadLocation(tzid); err != nil {
+			return time.Time{}, false, fmt.Errorf("unknown time zone %s", tzid)
+		}
+	}
+	t, err := time.ParseInLocation(DateTimeLayout, p.Value, loc)
+	return t, false, err
+}
+
+// textEscaper escapes text values, and textUnescaper reads them back.
+var (
+	textEscaper   = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+	textUnescaper = strings.NewReplacer(`\\`, `\`, `\;`, ";", `\,`, ",", `\n`, "\n", `\N`, "\n")
+)
+
+// EscapeText escapes a text value.
+func EscapeText(s string) string {
+	return textEscaper.Replace(s)
+}
+
+// Text returns the property's value as text, unescaped.
+func (p Property) Text() string {
+	return textUnescaper.Replace(p.Value)
+}
+
+// TextList returns the property's value as a comma-separated list of texts,
+// each unescaped.
+func (p Property) TextList() []string {
+	var items []string
+	start := 0
+	for i := 0; i < len(p.Value); i++ {
+		switch p.Value[i] {
+		case '\\':
+			i++ // The escaped character can't end the item
+		case ',':
+			items = append(items, textUnescaper.Replace(p.Value[start:i]))
+			start = i + 1
+		}
+	}
+	return append(items, textUnescaper.Replace(p.Value[start:]))
+}
+
+// Writer writes content lines, folded and ending in CRLF as RFC 5545 has
+// them. The first error is kept, and returned by Flush.
+type Writer struct {
+	w   *bufio.Writer
+	err error
+}
+
+// NewWriter returns a Writer to w.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: bufio.NewWriter(w)}
+}
+
+// Begin starts a component.
+func (w *Writer) Begin(name string) {
+	w.Write(Property{Name: "BEGIN", Value: name})
+}
+
+// End ends a component.
+func (w *Writer) End(name string) {
+	w.Write(Property{Name: "END", Value: name})
+}
+
+// Write writes a property. Parameter values are quoted where they have to
+// be, and written in the order of params' names.
+func (w *Writer) Write(p Property) {
+	var b strings.Builder
+	b.WriteString(p.Name)
+	for _, name := range slices.Sorted(maps.Keys(p.Params)) {
+		value := p.Params[name]
+		if strings.ContainsAny(value, ";:,") {
+			value = `"` + strings.ReplaceAll(value, `"`, "'") + `"`
+		}
+		b.WriteString(";" + name + "=" + value)
+	}
+	b.WriteString(":" + p.Value)
+	w.writeLine(b.String())
+}
+
+// writeLine writes a line, folded after 75 octets without splitting a
+// character.
+func (w *Writer) writeLine(line string) {
+	if w.err != nil {
+		return
+	}
+	limit := 75
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		if _, w.err = w.w.WriteString(line[:cut] + "\r\n "); w.err != nil {
+			return
+		}
+		line = line[cut:]
+		limit = 74 // The space starting a continued line counts
+	}
+	_, w.err = w.w.WriteString(line + "\r\n")
+}
+
+// Flush writes whatever is buffered, and returns the first error met.
+func (w *Writer) Flush() error {
+	if w.err != nil {
+		return w.err
+	}
+	return w.w.Flush()
+}
+
+// Parse reads the components of iCalendar data, usually a single VCALENDAR.
+// Lines may end in CRLF or LF alone, and blank lines are skipped.
+func Parse(r io.Reader) ([]Component, error) {
+	lines, err := unfold(r)
+	if err != nil {
+		return nil, err
+	}
+	var top []Component
+	var open []*Component // Components begun and not yet ended, innermost last
+	for n, line := range lines {
+		p, err := parseLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("content line %d: %w", n+1, err)
+		}
+		switch {
+		case p.Name == "BEGIN":
+			open = append(open, &Component{Name: strings.ToUpper(p.Value)})
+		case p.Name == "END":
+			if len(open) == 0 || open[len(open)-1].Name != strings.ToUpper(p.Value) {
+				return nil, fmt.Errorf("content line %d: END:%s without its BEGIN", n+1, p.Value)
+			}
+			c := *open[len(open)-1]
+			open = open[:len(open)-1]
+			if len(open) == 0 {
+				top = append(top, c)
+			} else {
+				parent := open[len(open)-1]
+				parent.Components = append(parent.Components, c)
+			}
+		case len(open) == 0:
+			return nil, fmt.Errorf("content line %d: %s outside of any component", n+1, p.Name)
+		default:
+			c := open[len(open)-1]
+			c.Props = append(c.Props, p)
+		}
+	}
+	if len(open) > 0 {
+		return nil, fmt.Errorf("%s is never ended", open[len(open)-1].Name)
+	}
+	return top, nil
+}
+
+// unfold reads the content lines of r, joining folded ones back together.
+func unfold(r io.Reader) ([]string, error) {
+	var lines []string
+	sc := bufio.NewScanner(r)
+	sc.Buffer(nil, 1<<20)
+	for sc.Scan() {
+		line := strings.TrimSuffix(sc.Text(), "\r")
+		if len(lines) == 0 {
+			line = strings.TrimPrefix(line, "\ufeff") // A byte order mark
+		}
+		switch {
+		case line == "":
+		case (line[0] == ' ' || line[0] == '\t') && len(lines) > 0:
+			lines[len(lines)-1] += line[1:]
+		default:
+			lines = append(lines, line)
+		}
+	}
+	return lines, sc.Err()
+}
+
+// parseLine reads a content line: NAME;PARAM=value;...:value.
+func parseLine(line string) (Property, error) {
+	p := Property{Params: map[string]string{}}
+	i := strings.IndexAny(line, ";:")
+	if i <= 0 {
+		return p, errors.New("not a content line")
+	}
+	p.Name = strings.ToUpper(line[:i])
+	for line[i] == ';' {
+		line = line[i+1:]
+		eq := strings.IndexByte(line, '=')
+		if eq <= 0 {
+			return p, errors.New("malformed parameter")
+		}
+		name := strings.ToUpper(line[:eq])
+		line = line[eq+1:]
+		// A quoted value may hold ; and :, up to its closing quote
+		var value string
+		if strings.HasPrefix(line, `"`) {
+			end := strings.IndexByte(line[1:], '"')
+			if end < 0 {
+				return p, errors.New("unterminated quoted parameter")
+			}
+			value, line = line[1:end+1], line[end+2:]
+			i = 0
+			if line == "" || (line[0] != ';' && line[0] != ':') {
+				return p, errors.New("malformed parameter")
+			}
+		} else {
+			i = strings.IndexAny(line, ";:")
+			if i < 0 {
+				return p, errors.New("missing value")
+			}
+			value = line[:i]
+		}
+		p.Params[name] = value
+	}
+	p.Value = line[i+1:]
+	return p, nil
+}
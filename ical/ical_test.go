@@ -0,0 +1,185 @@
+package ical
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// golden compares got with the golden file testdata/name, or rewrites the
+// file with -update.
+func golden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", name)
+	if *update {
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s differs:\n%s\nwant:\n%s", name, got, want)
+	}
+}
+
+func TestWriter(t *testing.T) {
+	var b bytes.Buffer
+	w := NewWriter(&b)
+	w.Begin("VCALENDAR")
+	w.Write(Property{Name: "VERSION", Value: "2.0"})
+	w.Begin("VTODO")
+	w.Write(Property{Name: "SUMMARY", Value: EscapeText("Milk, eggs; and a \\ backslash\non two lines")})
+	// Folded at 75 octets, then 74 after the leading space
+	w.Write(Property{Name: "DESCRIPTION", Value: EscapeText(strings.Repeat("0123456789", 16))})
+	// Folded without splitting a character
+	w.Write(Property{Name: "X-NOTE", Value: strings.Repeat("é", 40)})
+	w.Write(Property{Name: "DUE", Params: map[string]string{"VALUE": "DATE"}, Value: "20261020"})
+	w.Write(Property{Name: "DTSTART", Params: map[string]string{"TZID": "Europe/Paris", "X-ODD": `a;b:"c"`}, Value: "20261020T093000"})
+	w.Write(Property{Name: "RRULE", Value: "FREQ=WEEKLY;BYDAY=MO,TH"})
+	w.End("VTODO")
+	w.End("VCALENDAR")
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	for i, line := range strings.Split(strings.TrimSuffix(b.String(), "\r\n"), "\r\n") {
+		if len(line) > 75 {
+			t.Errorf("line %d is %d octets long", i+1, len(line))
+		}
+	}
+	golden(t, "writer.ics", b.Bytes())
+
+	// What is written parses back
+	cals, err := Parse(bytes.NewReader(b.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	todo := cals[0].Components[0]
+	for name, want := range map[string]string{
+		"SUMMARY":     "Milk, eggs; and a \\ backslash\non two lines",
+		"DESCRIPTION": strings.Repeat("0123456789", 16),
+		"X-NOTE":      strings.Repeat("é", 40),
+	} {
+		if p, _ := todo.Get(name); p.Text() != want {
+			t.Errorf("%s = %q, want %q", name, p.Text(), want)
+		}
+	}
+	if p, _ := todo.Get("DTSTART"); p.Param("X-ODD") != "a;b:'c'" || p.Param("TZID") != "Europe/Paris" {
+		t.Errorf("DTSTART parameters %v", p.Params)
+	}
+}
+
+func TestParse(t *testing.T) {
+	f, err := os.Open(filepath.Join("testdata", "parse.ics"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	got, err := Parse(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Component{{
+		Name: "VCALENDAR",
+		Props: []Property{
+			{Name: "VERSION", Params: map[string]string{}, Value: "2.0"},
+			{Name: "PRODID", Params: map[string]string{}, Value: "-//Example//Other app//EN"},
+		},
+		Components: []Component{
+			{
+				Name: "VTODO",
+				Props: []Property{
+					{Name: "UID", Params: map[string]string{}, Value: "abc@example.com"},
+					{Name: "SUMMARY", Params: map[string]string{"LANGUAGE": "en"}, Value: `Folded over three lines\, with a tab`},
+					{Name: "DUE", Params: map[string]string{"TZID": "America/New_York"}, Value: "20261020T093000"},
+					{Name: "CATEGORIES", Params: map[string]string{}, Value: `home,garden\,yard`},
+					{Name: "X-QUOTED", Params: map[string]string{"X-P": "a;b:c", "X-Q": "d"}, Value: "value:with:colons"},
+				},
+			},
+			{Name: "VEVENT", Props: []Property{{Name: "SUMMARY", Params: map[string]string{}, Value: "Ignored"}}},
+		},
+	}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Parse =\n%+v\nwant\n%+v", got, want)
+	}
+	if tags := got[0].Components[0].Props[3].TextList(); !reflect.DeepEqual(tags, []string{"home", "garden,yard"}) {
+		t.Errorf("TextList = %q", tags)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, data := range []string{
+		"BEGIN:VCALENDAR\r\nEND:VTODO\r\n",
+		"BEGIN:VCALENDAR\r\n",
+		"SUMMARY:Outside\r\n",
+		"BEGIN:VCALENDAR\r\nno colon\r\nEND:VCALENDAR\r\n",
+		"BEGIN:VCALENDAR\r\nX;P=\"open:x\r\nEND:VCALENDAR\r\n",
+		"BEGIN:VCALENDAR\r\nX;P:x\r\nEND:VCALENDAR\r\n",
+	} {
+		if _, err := Parse(strings.NewReader(data)); err == nil {
+			t.Errorf("Parse(%q) succeeded", data)
+		}
+	}
+}
+
+func TestTime(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		p        Property
+		want     time.Time
+		dateOnly bool
+	}{
+		{Property{Value: "20261020"}, time.Date(2026, 10, 20, 0, 0, 0, 0, time.UTC), true},
+		{Property{Params: map[string]string{"VALUE": "DATE"}, Value: "20261020"}, time.Date(2026, 10, 20, 0, 0, 0, 0, time.UTC), true},
+		{Property{Value: "20261020T093000Z"}, time.Date(2026, 10, 20, 9, 30, 0, 0, time.UTC), false},
+		{Property{Params: map[string]string{"TZID": "America/New_York"}, Value: "20261020T093000"}, time.Date(2026, 10, 20, 9, 30, 0, 0, newYork), false},
+		{Property{Value: "20261020T093000"}, time.Date(2026, 10, 20, 9, 30, 0, 0, time.UTC), false},
+	}
+	for _, tt := range tests {
+		got, dateOnly, err := tt.p.Time()
+		if err != nil || !got.Equal(tt.want) || dateOnly != tt.dateOnly {
+			t.Errorf("Time of %+v = %v, %v, %v, want %v, %v", tt.p, got, dateOnly, err, tt.want, tt.dateOnly)
+		}
+	}
+	for _, p := range []Property{
+		{Value: "2026-10-20"},
+		{Value: "20261320"},
+		{Params: map[string]string{"TZID": "Nowhere/Special"}, Value: "20261020T093000"},
+	} {
+		if _, _, err := p.Time(); err == nil {
+			t.Errorf("Time of %+v succeeded", p)
+		}
+	}
+}
+
+func TestEscapeText(t *testing.T) {
+	tests := []struct{ text, escaped string }{
+		{"plain", "plain"},
+		{"a,b;c", `a\,b\;c`},
+		{`back\slash`, `back\\slash`},
+		{"two\nlines", `two\nlines`},
+		{"crlf\r\nlines", `crlf\nlines`},
+		{`\n is not a newline`, `\\n is not a newline`},
+	}
+	for _, tt := range tests {
+		if got := EscapeText(tt.text); got != tt.escaped {
+			t.Errorf("EscapeText(%q) = %q, want %q", tt.text, got, tt.escaped)
+		}
+		want := strings.ReplaceAll(tt.text, "\r\n", "\n")
+		if got := (Property{Value: tt.escaped}).Text(); got != want {
+			t.Errorf("Text of %q = %q, want %q", tt.escaped, got, want)
+		}
+	}
+}
@@ -0,0 +1,223 @@
+// Package migrate applies versioned, embedded SQL migrations to the database.
+// Migration files are named NNNN_description.up.sql / NNNN_description.down.sql
+// and applied in version order; applied versions are tracked in the
+// schema_migrations table. A per-database lock keeps concurrent server
+// instances from migrating at the same time.
+package migrate
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+//go:embed postgres/*.sql sqlite/*.sql
+var files embed.FS
+
+// Migration is a single schema change with its forward and reverse SQL.
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string // empty when the migration cannot be reverted
+}
+
+// Status describes whether a known migration has been applied.
+type Status struct {
+	Migration
+	AppliedAt *time.Time // nil while the migration is pending
+}
+
+// Driver is the database-specific half of the migrator.
+type Driver interface {
+	// Lock blocks until the caller holds the migration lock or ctx is done.
+	// It is called before Init, so it must not need schema_migrations.
+	Lock(ctx context.Context) error
+	// Unlock releases the lock taken by Lock.
+	Unlock(ctx context.Context) error
+	// Init creates the schema_migrations table if it does not exist. It is
+	// only called while holding the lock, since instances starting at once
+	// would otherwise race on the DDL.
+	Init(ctx context.Context) error
+	// Applied returns the applied versions and when they were applied.
+	Applied(ctx context.Context) (map[int64]time.Time, error)
+	// Apply runs the migration's SQL in the given direction and records
+	// (or forgets) its version in the same transaction.
+	Apply(ctx context.Context, m Migration, up bool) error
+}
+
+// ErrIrreversible is returned when rolling back a migration without down SQL.
+var ErrIrreversible = errors.New("migrate: migration has no down script")
+
+// fileName matches migration file names such as 0001_create_todos.up.sql.
+var fileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// Load reads every migration in dir of fsys and returns them sorted by version.
+func Load(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, e := range entries {
+		m := fileName.FindStringSubmatch(e.Name())
+		if m == nil {
+			continue
+		}
+		version, err := strconv.ParseInt(m[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("migrate: bad version in %s: %w", e.Name(), err)
+		}
+		body, err := fs.ReadFile(fsys, path.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		mig, ok := byVersion[version]
+		if !ok {
+			mig = &Migration{Version: version, Name: m[2]}
+			byVersion[version] = mig
+		} else if mig.Name != m[2] {
+			return nil, fmt.Errorf("migrate: version %d used by both %s and %s", version, mig.Name, m[2])
+		}
+		if m[3] == "up" {
+			mig.Up = string(body)
+		} else {
+			mig.Down = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migrate: version %d (%s) has no up script", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// Migrator applies a fixed set of migrations through a Driver.
+type Migrator struct {
+	driver     Driver
+	migrations []Migration
+}
+
+// New returns a Migrator for the given driver and migrations.
+func New(driver Driver, migrations []Migration) *Migrator {
+	return &Migrator{driver: driver, migrations: migrations}
+}
+
+// Status reports every known migration and whether it has been applied.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	statuses := make([]Status, len(m.migrations))
+	err := m.locked(ctx, func(applied map[int64]time.Time) error {
+		for i, mig := range m.migrations {
+			statuses[i].Migration = mig
+			if at, ok := applied[mig.Version]; ok {
+				statuses[i].AppliedAt = &at
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return statuses, nil
+}
+
+// Up applies every pending migration in version order and returns how many ran.
+func (m *Migrator) Up(ctx context.Context) (int, error) {
+	n := 0
+	err := m.locked(ctx, func(applied map[int64]time.Time) error {
+		for _, mig := range m.migrations {
+			if _, ok := applied[mig.Version]; ok {
+				continue
+			}
+			if err := m.driver.Apply(ctx, mig, true); err != nil {
+				return fmt.Errorf("migrate: applying %d_%s: %w", mig.Version, mig.Name, err)
+			}
+			n++
+		}
+		return nil
+	})
+	return n, err
+}
+
+// Down reverts the most recently applied steps migrations and returns how many ran.
+func (m *Migrator) Down(ctx context.Context, steps int) (int, error) {
+	n := 0
+	err := m.locked(ctx, func(applied map[int64]time.Time) error {
+		for i := len(m.migrations) - 1; i >= 0 && n < steps; i-- {
+			mig := m.migrations[i]
+			if _, ok := applied[mig.Version]; !ok {
+				continue
+			}
+			if mig.Down == "" {
+				return fmt.Errorf("migrate: reverting %d_%s: %w", mig.Version, mig.Name, ErrIrreversible)
+			}
+			if err := m.driver.Apply(ctx, mig, false); err != nil {
+				return fmt.Errorf("migrate: reverting %d_%s: %w", mig.Version, mig.Name, err)
+			}
+			n++
+		}
+		return nil
+	})
+	return n, err
+}
+
+// Redo reverts and re-applies the most recently applied migration.
+func (m *Migrator) Redo(ctx context.Context) error {
+	return m.locked(ctx, func(applied map[int64]time.Time) error {
+		for i := len(m.migrations) - 1; i >= 0; i-- {
+			mig := m.migrations[i]
+			if _, ok := applied[mig.Version]; !ok {
+				continue
+			}
+			if mig.Down == "" {
+				return fmt.Errorf("migrate: reverting %d_%s: %w", mig.Version, mig.Name, ErrIrreversible)
+			}
+			if err := m.driver.Apply(ctx, mig, false); err != nil {
+				return fmt.Errorf("migrate: reverting %d_%s: %w", mig.Version, mig.Name, err)
+			}
+			if err := m.driver.Apply(ctx, mig, true); err != nil {
+				return fmt.Errorf("migrate: applying %d_%s: %w", mig.Version, mig.Name, err)
+			}
+			return nil
+		}
+		return errors.New("migrate: no applied migrations to redo")
+	})
+}
+
+// locked runs fn while holding the migration lock, passing it the set of
+// versions applied at the moment the lock was acquired. The lock is taken
+// before schema_migrations is created, which would race otherwise.
+func (m *Migrator) locked(ctx context.Context, fn func(applied map[int64]time.Time) error) (err error) {
+	if err := m.driver.Lock(ctx); err != nil {
+		return fmt.Errorf("migrate: acquiring lock: %w", err)
+	}
+	defer func() {
+		// Release with a fresh context so a cancelled ctx cannot leave the lock held
+		if uerr := m.driver.Unlock(context.Background()); uerr != nil && err == nil {
+			err = fmt.Errorf("migrate: releasing lock: %w", uerr)
+		}
+	}()
+
+	if err := m.driver.Init(ctx); err != nil {
+		return err
+	}
+	applied, err := m.driver.Applied(ctx)
+	if err != nil {
+		return err
+	}
+	return fn(applied)
+}
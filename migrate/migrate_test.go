@@ -0,0 +1,317 @@
+package migrate
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	_ "modernc.org/sqlite"
+)
+
+func TestLoad(t *testing.T) {
+	fsys := fstest.MapFS{
+		"m/0002_add_b.up.sql":   {Data: []byte("B")},
+		"m/0001_add_a.up.sql":   {Data: []byte("A")},
+		"m/0001_add_a.down.sql": {Data: []byte("-A")},
+		"m/0010_add_c.up.sql":   {Data: []byte("C")},
+		"m/README.md":           {Data: []byte("not a migration")},
+	}
+	got, err := Load(fsys, "m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Migration{
+		{Version: 1, Name: "add_a", Up: "A", Down: "-A"},
+		{Version: 2, Name: "add_b", Up: "B"},
+		{Version: 10, Name: "add_c", Up: "C"},
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("Load = %+v, want %+v", got, want)
+	}
+
+	for name, fsys := range map[string]fstest.MapFS{
+		"a version with two names": {
+			"m/0001_add_a.up.sql": {Data: []byte("A")},
+			"m/0001_add_b.up.sql": {Data: []byte("B")},
+		},
+		"a version without up": {
+			"m/0001_add_a.down.sql": {Data: []byte("-A")},
+		},
+	} {
+		if _, err := Load(fsys, "m"); err == nil {
+			t.Errorf("Load of %s succeeded", name)
+		}
+	}
+}
+
+// TestEmbedded checks that both backends have the same migrations, each of
+// which can be reverted.
+func TestEmbedded(t *testing.T) {
+	pg, err := PostgresMigrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlite, err := SQLiteMigrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pg) == 0 || len(pg) != len(sqlite) {
+		t.Fatalf("%d PostgreSQL and %d SQLite migrations", len(pg), len(sqlite))
+	}
+	for i := range pg {
+		if pg[i].Version != int64(i+1) || pg[i].Version != sqlite[i].Version || pg[i].Name != sqlite[i].Name {
+			t.Errorf("migration %d is %d_%s for PostgreSQL and %d_%s for SQLite",
+				i+1, pg[i].Version, pg[i].Name, sqlite[i].Version, sqlite[i].Name)
+		}
+		if pg[i].Down == "" || sqlite[i].Down == "" {
+			t.Errorf("migration %d_%s can't be reverted", pg[i].Version, pg[i].Name)
+		}
+	}
+}
+
+// fakeDriver records the calls made to it, failing Apply of version fail.
+type fakeDriver struct {
+	calls   []string
+	applied map[int64]time.Time
+	fail    int64
+}
+
+func (d *fakeDriver) Lock(ctx context.Context) error { d.calls = append(d.calls, "lock"); return nil }
+func (d *fakeDriver) Unlock(ctx context.Context) error {
+	d.calls = append(d.calls, "unlock")
+	return nil
+}
+func (d *fakeDriver) Init(ctx context.Context) error { d.calls = append(d.calls, "init"); return nil }
+
+func (d *fakeDriver) Applied(ctx context.Context) (map[int64]time.Time, error) {
+	d.calls = append(d.calls, "applied")
+	return d.applied, nil
+}
+
+func (d *fakeDriver) Apply(ctx context.Context, m Migration, up bool) error {
+	dir := "up "
+	if !up {
+		dir = "down "
+	}
+	d.calls = append(d.calls, dir+m.Name)
+	if m.Version == d.fail {
+		return errors.New("boom")
+	}
+	if up {
+		d.applied[m.Version] = time.Now()
+	} else {
+		delete(d.applied, m.Version)
+	}
+	return nil
+}
+
+// TestLocking checks that the lock is taken before schema_migrations is
+// created and is released even when a migration fails.
+func TestLocking(t *testing.T) {
+	ctx := context.Background()
+	migrations := []Migration{{Version: 1, Name: "a", Up: "A", Down: "-A"}, {Version: 2, Name: "b", Up: "B", Down: "-B"}}
+
+	d := &fakeDriver{applied: map[int64]time.Time{}}
+	m := New(d, migrations)
+	if n, err := m.Up(ctx); n != 2 || err != nil {
+		t.Fatalf("Up = %d, %v", n, err)
+	}
+	if want := []string{"lock", "init", "applied", "up a", "up b", "unlock"}; !slices.Equal(d.calls, want) {
+		t.Errorf("Up called %v, want %v", d.calls, want)
+	}
+
+	d.calls = nil
+	if n, err := m.Down(ctx, 5); n != 2 || err != nil {
+		t.Fatalf("Down = %d, %v", n, err)
+	}
+	if want := []string{"lock", "init", "applied", "down b", "down a", "unlock"}; !slices.Equal(d.calls, want) {
+		t.Errorf("Down called %v, want %v", d.calls, want)
+	}
+
+	d = &fakeDriver{applied: map[int64]time.Time{}, fail: 2}
+	m = New(d, migrations)
+	if n, err := m.Up(ctx); n != 1 || err == nil || !strings.Contains(err.Error(), "2_b") {
+		t.Errorf("Up with a failing migration = %d, %v", n, err)
+	}
+	if d.calls[len(d.calls)-1] != "unlock" {
+		t.Errorf("a failed Up called %v, leaving the lock held", d.calls)
+	}
+
+	m = New(&fakeDriver{applied: map[int64]time.Time{1: time.Now()}}, []Migration{{Version: 1, Name: "a", Up: "A"}})
+	if _, err := m.Down(ctx, 1); !errors.Is(err, ErrIrreversible) {
+		t.Errorf("Down of a migration without down SQL: error = %v, want ErrIrreversible", err)
+	}
+}
+
+// openSQLite opens the SQLite database file at path, creating it if needed.
+func openSQLite(t *testing.T, path string) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite", path+"?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// sqliteTables returns the names of the tables in db, bar SQLite's own.
+func sqliteTables(t *testing.T, db *sql.DB) []string {
+	t.Helper()
+	rows, err := db.Query("SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%' ORDER BY name")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+// testUpDown migrates a database all the way up, down and up again, and
+// checks the migrations applied and, through tables, what is left of the
+// schema when they are all reverted.
+func testUpDown(t *testing.T, m *Migrator, count int, tables func() []string) {
+	t.Helper()
+	ctx := context.Background()
+	if n, err := m.Up(ctx); n != count || err != nil {
+		t.Fatalf("Up = %d, %v, want %d", n, err, count)
+	}
+	if n, err := m.Up(ctx); n != 0 || err != nil {
+		t.Errorf("Up again = %d, %v, want nothing applied", n, err)
+	}
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range statuses {
+		if s.AppliedAt == nil {
+			t.Errorf("%d_%s is pending after Up", s.Version, s.Name)
+		}
+	}
+	if err := m.Redo(ctx); err != nil {
+		t.Errorf("Redo: %v", err)
+	}
+
+	if n, err := m.Down(ctx, count); n != count || err != nil {
+		t.Fatalf("Down = %d, %v, want %d", n, err, count)
+	}
+	if got := tables(); !slices.Equal(got, []string{"schema_migrations", "schema_migrations_lock"}) &&
+		!slices.Equal(got, []string{"schema_migrations"}) {
+		t.Errorf("tables left after reverting every migration: %v", got)
+	}
+	if n, err := m.Up(ctx); n != count || err != nil {
+		t.Errorf("Up after Down = %d, %v, want %d", n, err, count)
+	}
+}
+
+func TestSQLite(t *testing.T) {
+	migrations, err := SQLiteMigrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := openSQLite(t, filepath.Join(t.TempDir(), "todos.db"))
+	testUpDown(t, New(NewSQLiteDriver(db), migrations), len(migrations), func() []string { return sqliteTables(t, db) })
+}
+
+// TestSQLiteConcurrent starts migrators on one database at once, as server
+// instances starting together do, which must apply each migration once.
+func TestSQLiteConcurrent(t *testing.T) {
+	migrations, err := SQLiteMigrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "todos.db")
+	var (
+		wg    sync.WaitGroup
+		mu    sync.Mutex
+		total int
+	)
+	for range 4 {
+		db := openSQLite(t, path)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			n, err := New(NewSQLiteDriver(db), migrations).Up(context.Background())
+			if err != nil {
+				t.Error(err)
+			}
+			mu.Lock()
+			total += n
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	if total != len(migrations) {
+		t.Errorf("applied %d migrations, want %d", total, len(migrations))
+	}
+}
+
+// TestPostgres migrates a schema of its own in the database
+// TEST_DATABASE_URL names, a postgres:// URL, and is skipped without it.
+func TestPostgres(t *testing.T) {
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	ctx := context.Background()
+	admin, err := pgxpool.New(ctx, dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer admin.Close()
+	b := make([]byte, 6)
+	rand.Read(b)
+	schema := "migrate_test_" + hex.EncodeToString(b)
+	if _, err := admin.Exec(ctx, "CREATE SCHEMA "+schema); err != nil {
+		t.Fatal(err)
+	}
+	defer admin.Exec(ctx, "DROP SCHEMA "+schema+" CASCADE")
+
+	sep := "?"
+	if strings.Contains(dsn, "?") {
+		sep = "&"
+	}
+	pool, err := pgxpool.New(ctx, dsn+sep+"search_path="+schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	migrations, err := PostgresMigrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	testUpDown(t, New(NewPostgresDriver(pool), migrations), len(migrations), func() []string {
+		rows, err := pool.Query(ctx, "SELECT table_name FROM information_schema.tables WHERE table_schema = $1 ORDER BY table_name", schema)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+		var names []string
+		for rows.Next() {
+			var name string
+			if err := rows.Scan(&name); err != nil {
+				t.Fatal(err)
+			}
+			names = append(names, name)
+		}
+		return names
+	})
+}
@@ -0,0 +1,115 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// postgresLockKey is the pg_advisory_lock key guarding migrations.
+// Any constant works as long as every instance of the app uses the same one.
+const postgresLockKey = 7_236_001
+
+// PostgresMigrations returns the embedded PostgreSQL migrations.
+func PostgresMigrations() ([]Migration, error) {
+	return Load(files, "postgres")
+}
+
+// PostgresDriver runs migrations against a PostgreSQL pool. It serializes
+// migrators across processes with a session-level advisory lock, so two
+// machines starting at once apply each migration exactly once.
+type PostgresDriver struct {
+	pool *pgxpool.Pool
+	conn *pgxpool.Conn // connection holding the advisory lock
+}
+
+// NewPostgresDriver returns a Driver for the given pool.
+func NewPostgresDriver(pool *pgxpool.Pool) *PostgresDriver {
+	return &PostgresDriver{pool: pool}
+}
+
+// Lock takes the advisory lock on a dedicated connection, since advisory
+// locks belong to the session that acquired them.
+func (d *PostgresDriver) Lock(ctx context.Context) error {
+	conn, err := d.pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	if _, err := conn.Exec(ctx, "SELECT pg_advisory_lock($1)", postgresLockKey); err != nil {
+		conn.Release()
+		return err
+	}
+	d.conn = conn
+	return nil
+}
+
+// Unlock releases the advisory lock and returns its connection to the pool.
+func (d *PostgresDriver) Unlock(ctx context.Context) error {
+	if d.conn == nil {
+		return errors.New("not locked")
+	}
+	defer func() {
+		d.conn.Release()
+		d.conn = nil
+	}()
+	_, err := d.conn.Exec(ctx, "SELECT pg_advisory_unlock($1)", postgresLockKey)
+	return err
+}
+
+// Init creates the schema_migrations table if needed.
+func (d *PostgresDriver) Init(ctx context.Context) error {
+	_, err := d.pool.Exec(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version    BIGINT      PRIMARY KEY,
+			name       TEXT        NOT NULL,
+			applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+		)`)
+	return err
+}
+
+// Applied returns the versions recorded in schema_migrations.
+func (d *PostgresDriver) Applied(ctx context.Context) (map[int64]time.Time, error) {
+	rows, err := d.pool.Query(ctx, "SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int64]time.Time)
+	for rows.Next() {
+		var version int64
+		var at time.Time
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, err
+		}
+		applied[version] = at
+	}
+	return applied, rows.Err()
+}
+
+// Apply runs the migration and updates schema_migrations in one transaction.
+func (d *PostgresDriver) Apply(ctx context.Context, m Migration, up bool) error {
+	tx, err := d.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if up {
+		if _, err := tx.Exec(ctx, m.Up); err != nil {
+			return err
+		}
+		_, err = tx.Exec(ctx, "INSERT INTO schema_migrations (version, name) VALUES ($1, $2)", m.Version, m.Name)
+	} else {
+		if _, err := tx.Exec(ctx, m.Down); err != nil {
+			return err
+		}
+		_, err = tx.Exec(ctx, "DELETE FROM schema_migrations WHERE version = $1", m.Version)
+	}
+	if err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
@@ -0,0 +1,7 @@
+-- IF NOT EXISTS lets databases created by hand before migrations existed
+-- adopt this history without changes.
+CREATE TABLE IF NOT EXISTS todos (
+    id        SERIAL  PRIMARY KEY,
+    title     TEXT    NOT NULL,
+    completed BOOLEAN NOT NULL DEFAULT FALSE
+);
@@ -0,0 +1,21 @@
+CREATE TABLE users (
+    id            SERIAL      PRIMARY KEY,
+    email         TEXT        NOT NULL UNIQUE,
+    password_hash TEXT        NOT NULL,
+    created_at    TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE sessions (
+    token_hash TEXT        PRIMARY KEY,
+    user_id    INTEGER     NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    expires_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX sessions_user_id_idx ON sessions (user_id);
+
+-- Todos created before accounts existed keep a NULL owner and are no longer
+-- listed until "server migrate claim <email>" gives them to an account.
+ALTER TABLE todos ADD COLUMN user_id INTEGER REFERENCES users (id) ON DELETE CASCADE;
+
+CREATE INDEX todos_user_id_idx ON todos (user_id);
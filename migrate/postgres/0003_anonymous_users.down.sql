@@ -0,0 +1,4 @@
+DELETE FROM users WHERE anonymous;
+DROP INDEX users_anonymous_last_seen_idx;
+ALTER TABLE users DROP COLUMN last_seen_at;
+ALTER TABLE users DROP COLUMN anonymous;
@@ -0,0 +1,21 @@
+CREATE TABLE lists (
+    id         SERIAL      PRIMARY KEY,
+    user_id    INTEGER     NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    name       TEXT        NOT NULL,
+    color      TEXT        NOT NULL DEFAULT 'gray',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX lists_user_id_idx ON lists (user_id);
+
+ALTER TABLE todos ADD COLUMN list_id INTEGER REFERENCES lists (id) ON DELETE CASCADE;
+
+CREATE INDEX todos_list_id_idx ON todos (list_id);
+
+-- Give every user who already has todos an Inbox holding all of them.
+INSERT INTO lists (user_id, name)
+SELECT DISTINCT user_id, 'Inbox' FROM todos WHERE user_id IS NOT NULL;
+
+UPDATE todos SET list_id = lists.id
+FROM lists
+WHERE lists.user_id = todos.user_id;
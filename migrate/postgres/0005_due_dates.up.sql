@@ -0,0 +1,9 @@
+-- due_date is the calendar day in the todo's own zone; due_time and due_tz
+-- are empty for all-day todos. due_at caches the instant of timed todos so
+-- the overdue filter can compare it against the current time.
+ALTER TABLE todos ADD COLUMN due_date DATE;
+ALTER TABLE todos ADD COLUMN due_time TEXT NOT NULL DEFAULT '';
+ALTER TABLE todos ADD COLUMN due_tz   TEXT NOT NULL DEFAULT '';
+ALTER TABLE todos ADD COLUMN due_at   TIMESTAMPTZ;
+
+CREATE INDEX todos_list_id_due_date_idx ON todos (list_id, due_date);
@@ -0,0 +1,4 @@
+-- priority runs from 0 (none) to 4 (urgent). Existing todos get the time of
+-- the migration as their creation time.
+ALTER TABLE todos ADD COLUMN priority   INTEGER     NOT NULL DEFAULT 0;
+ALTER TABLE todos ADD COLUMN created_at TIMESTAMPTZ NOT NULL DEFAULT now();
@@ -0,0 +1,15 @@
+CREATE TABLE tags (
+    id      SERIAL  PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    name    TEXT    NOT NULL,
+    color   TEXT    NOT NULL DEFAULT 'gray',
+    UNIQUE (user_id, name)
+);
+
+CREATE TABLE todo_tags (
+    todo_id INTEGER NOT NULL REFERENCES todos (id) ON DELETE CASCADE,
+    tag_id  INTEGER NOT NULL REFERENCES tags (id) ON DELETE CASCADE,
+    PRIMARY KEY (todo_id, tag_id)
+);
+
+CREATE INDEX todo_tags_tag_id_idx ON todo_tags (tag_id);
@@ -0,0 +1,4 @@
+DROP INDEX todos_search_idx;
+
+ALTER TABLE todos DROP COLUMN search;
+ALTER TABLE todos DROP COLUMN notes;
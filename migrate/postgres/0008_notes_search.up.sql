@@ -0,0 +1,9 @@
+-- search is a weighted full-text vector of the title and notes, kept up to
+-- date by Postgres, so title hits rank above notes hits.
+ALTER TABLE todos ADD COLUMN notes TEXT NOT NULL DEFAULT '';
+ALTER TABLE todos ADD COLUMN search tsvector GENERATED ALWAYS AS (
+    setweight(to_tsvector('english', title), 'A') ||
+    setweight(to_tsvector('english', notes), 'B')
+) STORED;
+
+CREATE INDEX todos_search_idx ON todos USING GIN (search);
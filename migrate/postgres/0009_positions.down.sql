@@ -0,0 +1,3 @@
+DROP INDEX todos_list_id_position_idx;
+
+ALTER TABLE todos DROP COLUMN position;
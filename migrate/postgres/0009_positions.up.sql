@@ -0,0 +1,8 @@
+-- position holds a rank key (see package rank) giving the manual order of
+-- the todos in a list. Keys compare byte by byte, hence the C collation.
+-- Existing todos keep their creation order: 'j' starts a ten-digit integer
+-- key, which the zero-padded ID fills.
+ALTER TABLE todos ADD COLUMN position TEXT COLLATE "C" NOT NULL DEFAULT '';
+UPDATE todos SET position = 'j' || lpad(id::text, 10, '0');
+
+CREATE INDEX todos_list_id_position_idx ON todos (list_id, position);
@@ -0,0 +1,4 @@
+-- recur is the RRULE a todo repeats by, such as FREQ=WEEKLY;BYDAY=MO, or empty
+-- for todos that happen once. Completing a repeating todo creates its next
+-- occurrence and clears recur on the completed one, which stays as history.
+ALTER TABLE todos ADD COLUMN recur TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,3 @@
+-- Without deleted_at trashed todos would come back, so remove them for good
+DELETE FROM todos WHERE deleted_at IS NOT NULL;
+ALTER TABLE todos DROP COLUMN deleted_at;
@@ -0,0 +1,7 @@
+-- Deleting a todo moves it to the trash by setting deleted_at; it is only
+-- removed for good when the trash is emptied or purged. Subtasks deleted
+-- together with their parent share its deleted_at, so they are restored
+-- together too.
+ALTER TABLE todos ADD COLUMN deleted_at TIMESTAMPTZ;
+
+CREATE INDEX todos_deleted_at_idx ON todos (deleted_at) WHERE deleted_at IS NOT NULL;
@@ -0,0 +1,18 @@
+-- todo_events is the append-only log of changes to todos, written in the
+-- same transaction as each change. It has no foreign key to todos, so a
+-- todo's history outlives the todo; title keeps the todo's title as it was
+-- when the event happened. actor_id is the user who made the change.
+CREATE TABLE todo_events (
+    id         SERIAL      PRIMARY KEY,
+    user_id    INTEGER     NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    actor_id   INTEGER     REFERENCES users (id) ON DELETE SET NULL,
+    todo_id    INTEGER     NOT NULL,
+    action     TEXT        NOT NULL,
+    title      TEXT        NOT NULL,
+    from_value TEXT        NOT NULL DEFAULT '',
+    to_value   TEXT        NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX todo_events_user_id_idx ON todo_events (user_id, created_at);
+CREATE INDEX todo_events_todo_id_idx ON todo_events (todo_id);
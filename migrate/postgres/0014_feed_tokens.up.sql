@@ -0,0 +1,8 @@
+-- feed_tokens holds the secret token of each user's calendar feed, by hash
+-- like sessions, so the feed URL can't be read back from the database. A
+-- user has at most one; making a new one replaces it.
+CREATE TABLE feed_tokens (
+    token_hash TEXT        PRIMARY KEY,
+    user_id    INTEGER     NOT NULL UNIQUE REFERENCES users (id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
@@ -0,0 +1,11 @@
+-- undo_offers holds the undo offered after a destructive action until it is
+-- taken or expires, so that whichever instance serves the Undo click can
+-- reverse the action. Offers are looked up by the hash of their token like
+-- sessions; action is the JSON of the store's UndoAction.
+CREATE TABLE undo_offers (
+    token_hash TEXT        PRIMARY KEY,
+    user_id    INTEGER     NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    list_id    INTEGER     NOT NULL REFERENCES lists (id) ON DELETE CASCADE,
+    action     TEXT        NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL
+);
@@ -0,0 +1,130 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// sqliteLockPoll is how often Lock retries while another process holds the lock.
+const sqliteLockPoll = 250 * time.Millisecond
+
+// sqliteLockStale is the age after which a lock row is assumed to belong to
+// a crashed process and may be taken over.
+const sqliteLockStale = 10 * time.Minute
+
+// SQLiteMigrations returns the embedded SQLite migrations.
+func SQLiteMigrations() ([]Migration, error) {
+	return Load(files, "sqlite")
+}
+
+// SQLiteDriver runs migrations against a SQLite database. SQLite has no
+// advisory locks, so the lock is a single row in schema_migrations_lock that
+// only one process can insert at a time.
+type SQLiteDriver struct {
+	db *sql.DB
+}
+
+// NewSQLiteDriver returns a Driver for the given database.
+func NewSQLiteDriver(db *sql.DB) *SQLiteDriver {
+	return &SQLiteDriver{db: db}
+}
+
+// Lock inserts the lock row, polling until it succeeds or ctx is done. It
+// is called before Init, so it creates the lock table itself; SQLite runs
+// the DDL of competing processes one at a time.
+func (d *SQLiteDriver) Lock(ctx context.Context) error {
+	if _, err := d.db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations_lock (
+			id        INTEGER PRIMARY KEY CHECK (id = 1),
+			locked_at INTEGER NOT NULL
+		)`); err != nil {
+		return err
+	}
+	for {
+		now := time.Now().UTC()
+		if _, err := d.db.ExecContext(ctx,
+			"DELETE FROM schema_migrations_lock WHERE locked_at < $1", now.Add(-sqliteLockStale).Unix(),
+		); err != nil {
+			return err
+		}
+		res, err := d.db.ExecContext(ctx,
+			"INSERT OR IGNORE INTO schema_migrations_lock (id, locked_at) VALUES (1, $1)", now.Unix(),
+		)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 1 {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(sqliteLockPoll):
+		}
+	}
+}
+
+// Unlock deletes the lock row.
+func (d *SQLiteDriver) Unlock(ctx context.Context) error {
+	_, err := d.db.ExecContext(ctx, "DELETE FROM schema_migrations_lock WHERE id = 1")
+	return err
+}
+
+// Init creates the schema_migrations table if needed.
+func (d *SQLiteDriver) Init(ctx context.Context) error {
+	_, err := d.db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version    INTEGER PRIMARY KEY,
+			name       TEXT    NOT NULL,
+			applied_at INTEGER NOT NULL
+		)`)
+	return err
+}
+
+// Applied returns the versions recorded in schema_migrations.
+func (d *SQLiteDriver) Applied(ctx context.Context) (map[int64]time.Time, error) {
+	rows, err := d.db.QueryContext(ctx, "SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int64]time.Time)
+	for rows.Next() {
+		var version, at int64
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, err
+		}
+		applied[version] = time.Unix(at, 0)
+	}
+	return applied, rows.Err()
+}
+
+// Apply runs the migration and updates schema_migrations in one transaction.
+func (d *SQLiteDriver) Apply(ctx context.Context, m Migration, up bool) error {
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if up {
+		if _, err := tx.ExecContext(ctx, m.Up); err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx,
+			"INSERT INTO schema_migrations (version, name, applied_at) VALUES ($1, $2, $3)",
+			m.Version, m.Name, time.Now().Unix())
+	} else {
+		if _, err := tx.ExecContext(ctx, m.Down); err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, "DELETE FROM schema_migrations WHERE version = $1", m.Version)
+	}
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
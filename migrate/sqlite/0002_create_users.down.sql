@@ -0,0 +1,12 @@
+-- SQLite cannot drop a column that carries a foreign key, so rebuild todos.
+CREATE TABLE todos_rebuild (
+    id        INTEGER PRIMARY KEY AUTOINCREMENT,
+    title     TEXT    NOT NULL,
+    completed BOOLEAN NOT NULL DEFAULT FALSE
+);
+INSERT INTO todos_rebuild (id, title, completed) SELECT id, title, completed FROM todos;
+DROP TABLE todos;
+ALTER TABLE todos_rebuild RENAME TO todos;
+
+DROP TABLE sessions;
+DROP TABLE users;
@@ -0,0 +1,6 @@
+-- Anonymous users back the per-browser lists of the public demo. They carry a
+-- placeholder email and an empty password hash until claimed at sign-up.
+ALTER TABLE users ADD COLUMN anonymous BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE users ADD COLUMN last_seen_at DATETIME;
+
+CREATE INDEX users_anonymous_last_seen_idx ON users (last_seen_at) WHERE anonymous;
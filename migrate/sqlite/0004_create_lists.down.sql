@@ -0,0 +1,14 @@
+-- SQLite cannot drop a column that carries a foreign key, so rebuild todos.
+CREATE TABLE todos_rebuild (
+    id        INTEGER PRIMARY KEY AUTOINCREMENT,
+    title     TEXT    NOT NULL,
+    completed BOOLEAN NOT NULL DEFAULT FALSE,
+    user_id   INTEGER REFERENCES users (id) ON DELETE CASCADE
+);
+INSERT INTO todos_rebuild (id, title, completed, user_id)
+SELECT id, title, completed, user_id FROM todos;
+DROP TABLE todos;
+ALTER TABLE todos_rebuild RENAME TO todos;
+CREATE INDEX todos_user_id_idx ON todos (user_id);
+
+DROP TABLE lists;
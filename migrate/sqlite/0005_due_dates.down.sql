@@ -0,0 +1,6 @@
+DROP INDEX todos_list_id_due_date_idx;
+
+ALTER TABLE todos DROP COLUMN due_at;
+ALTER TABLE todos DROP COLUMN due_tz;
+ALTER TABLE todos DROP COLUMN due_time;
+ALTER TABLE todos DROP COLUMN due_date;
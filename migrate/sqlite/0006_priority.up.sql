@@ -0,0 +1,7 @@
+-- priority runs from 0 (none) to 4 (urgent). SQLite cannot add a column
+-- defaulting to CURRENT_TIMESTAMP, so existing todos get the time of the
+-- migration in a second step and new ones are given created_at on insert.
+ALTER TABLE todos ADD COLUMN priority   INTEGER  NOT NULL DEFAULT 0;
+ALTER TABLE todos ADD COLUMN created_at DATETIME NOT NULL DEFAULT '1970-01-01 00:00:00';
+
+UPDATE todos SET created_at = CURRENT_TIMESTAMP;
@@ -0,0 +1,2 @@
+-- SQLite searches with LIKE, so notes need no index.
+ALTER TABLE todos ADD COLUMN notes TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,8 @@
+-- position holds a rank key (see package rank) giving the manual order of
+-- the todos in a list. SQLite compares text byte by byte by default.
+-- Existing todos keep their creation order: 'j' starts a ten-digit integer
+-- key, which the zero-padded ID fills.
+ALTER TABLE todos ADD COLUMN position TEXT NOT NULL DEFAULT '';
+UPDATE todos SET position = 'j' || substr('0000000000' || id, -10);
+
+CREATE INDEX todos_list_id_position_idx ON todos (list_id, position);
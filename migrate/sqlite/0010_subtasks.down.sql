@@ -0,0 +1,5 @@
+DROP INDEX todos_parent_id_idx;
+
+-- Without parent_id subtasks would turn into top-level todos, so drop them
+DELETE FROM todos WHERE parent_id IS NOT NULL;
+ALTER TABLE todos DROP COLUMN parent_id;
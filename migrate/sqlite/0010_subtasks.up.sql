@@ -0,0 +1,5 @@
+-- A todo with a parent_id is a subtask of that todo. Subtasks are one level
+-- deep, live in their parent's list and go away with their parent.
+ALTER TABLE todos ADD COLUMN parent_id INTEGER REFERENCES todos (id) ON DELETE CASCADE;
+
+CREATE INDEX todos_parent_id_idx ON todos (parent_id);
@@ -0,0 +1,5 @@
+DROP INDEX todos_deleted_at_idx;
+
+-- Without deleted_at trashed todos would come back, so remove them for good
+DELETE FROM todos WHERE deleted_at IS NOT NULL;
+ALTER TABLE todos DROP COLUMN deleted_at;
@@ -0,0 +1 @@
+DROP TABLE undo_offers;
@@ -0,0 +1,93 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+const (
+	// DateLayout is the format of Due.Date, as used by <input type="date">.
+	DateLayout = "2006-01-02"
+	// ClockLayout is the format of Due.Time, as used by <input type="time">.
+	ClockLayout = "15:04"
+)
+
+// Due is when a todo is due: a calendar date, optionally with a wall-clock
+// time in a named IANA time zone. A todo without a time is due all day.
+type Due struct {
+	Date string `json:"date"`           // Calendar date in DateLayout
+	Time string `json:"time,omitempty"` // Wall-clock time in ClockLayout, empty for all day
+	TZ   string `json:"tz,omitempty"`   // Time zone of Time, empty for all day
+}
+
+// DueStatus classifies a due date relative to the current day.
+type DueStatus string
+
+const (
+	DueOverdue  DueStatus = "overdue"
+	DueToday    DueStatus = "today"
+	DueUpcoming DueStatus = "upcoming"
+)
+
+// ParseDue validates the parts of a due date and returns it, or nil if date
+// is empty. A time without a zone is taken to be in UTC.
+func ParseDue(date, clock, tz string) (*Due, error) {
+	if date == "" {
+		if clock != "" {
+			return nil, errors.New("A due time needs a due date")
+		}
+		return nil, nil
+	}
+	if _, err := time.Parse(DateLayout, date); err != nil {
+		return nil, errors.New("Due date must look like 2006-01-02")
+	}
+	if clock == "" {
+		return &Due{Date: date}, nil
+	}
+	if _, err := time.Parse(ClockLayout, clock); err != nil {
+		return nil, errors.New("Due time must look like 15:04")
+	}
+	if tz == "" {
+		tz = "UTC"
+	}
+	if _, err := time.LoadLocation(tz); err != nil {
+		return nil, errors.New("Unknown time zone " + tz)
+	}
+	return &Due{Date: date, Time: clock, TZ: tz}, nil
+}
+
+// At returns the instant a timed due date falls on. It reports false for
+// all-day due dates, which have no single instant.
+func (d Due) At() (time.Time, bool) {
+	if d.Time == "" {
+		return time.Time{}, false
+	}
+	loc, err := time.LoadLocation(d.TZ)
+	if err != nil {
+		return time.Time{}, false
+	}
+	t, err := time.ParseInLocation(DateLayout+" "+ClockLayout, d.Date+" "+d.Time, loc)
+	return t, err == nil
+}
+
+// Status classifies the due date relative to now, which should be in the
+// viewer's time zone so that "today" is the viewer's today. A timed due
+// date is overdue as soon as its instant has passed.
+func (d Due) Status(now time.Time) DueStatus {
+	today := now.Format(DateLayout)
+	date := d.Date
+	if at, ok := d.At(); ok {
+		if at.Before(now) {
+			return DueOverdue
+		}
+		date = at.In(now.Location()).Format(DateLayout)
+	}
+	switch {
+	case date < today:
+		return DueOverdue
+	case date == today:
+		return DueToday
+	default:
+		return DueUpcoming
+	}
+}
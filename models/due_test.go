@@ -0,0 +1,59 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDue(t *testing.T) {
+	tests := []struct {
+		date, clock, tz string
+		want            *Due
+		ok              bool
+	}{
+		{"", "", "", nil, true},
+		{"2026-10-20", "", "Europe/Paris", &Due{Date: "2026-10-20"}, true},
+		{"2026-10-20", "09:30", "", &Due{Date: "2026-10-20", Time: "09:30", TZ: "UTC"}, true},
+		{"2026-10-20", "09:30", "Europe/Paris", &Due{Date: "2026-10-20", Time: "09:30", TZ: "Europe/Paris"}, true},
+		{"", "09:30", "", nil, false},
+		{"2026-13-01", "", "", nil, false},
+		{"20/10/2026", "", "", nil, false},
+		{"2026-10-20", "9.30", "", nil, false},
+		{"2026-10-20", "09:30", "Nowhere/Special", nil, false},
+	}
+	for _, tt := range tests {
+		got, err := ParseDue(tt.date, tt.clock, tt.tz)
+		if (err == nil) != tt.ok || (got == nil) != (tt.want == nil) || got != nil && *got != *tt.want {
+			t.Errorf("ParseDue(%q, %q, %q) = %+v, %v, want %+v", tt.date, tt.clock, tt.tz, got, err, tt.want)
+		}
+	}
+}
+
+// TestDueStatus classifies due dates as seen from Paris at 5 in the morning
+// of 2026-10-17, when it is still the 16th in New York.
+func TestDueStatus(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2026, 10, 17, 5, 0, 0, 0, paris)
+	tests := []struct {
+		due  Due
+		want DueStatus
+	}{
+		{Due{Date: "2026-10-16"}, DueOverdue},
+		{Due{Date: "2026-10-17"}, DueToday},
+		{Due{Date: "2026-10-18"}, DueUpcoming},
+		// A timed due date is overdue once it has passed, even today
+		{Due{Date: "2026-10-17", Time: "04:59", TZ: "Europe/Paris"}, DueOverdue},
+		{Due{Date: "2026-10-17", Time: "05:01", TZ: "Europe/Paris"}, DueToday},
+		// and falls on the day it is in the viewer's time zone
+		{Due{Date: "2026-10-16", Time: "23:30", TZ: "America/New_York"}, DueToday},
+		{Due{Date: "2026-10-17", Time: "18:00", TZ: "America/New_York"}, DueUpcoming},
+	}
+	for _, tt := range tests {
+		if got := tt.due.Status(now); got != tt.want {
+			t.Errorf("%+v: Status = %s, want %s", tt.due, got, tt.want)
+		}
+	}
+}
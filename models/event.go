@@ -0,0 +1,65 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// Action is the kind of change an Event records.
+type Action string
+
+const (
+	ActionCreated      Action = "created"
+	ActionTitleChanged Action = "title_changed"
+	ActionCompleted    Action = "completed"
+	ActionUncompleted  Action = "uncompleted"
+	ActionDeleted      Action = "deleted"
+	ActionRestored     Action = "restored"
+)
+
+// Actions lists every action, in the order filters offer them.
+var Actions = []Action{ActionCreated, ActionTitleChanged, ActionCompleted, ActionUncompleted, ActionDeleted, ActionRestored}
+
+// actionLabels holds how each action reads in the UI.
+var actionLabels = map[Action]string{
+	ActionCreated:      "Created",
+	ActionTitleChanged: "Renamed",
+	ActionCompleted:    "Completed",
+	ActionUncompleted:  "Reopened",
+	ActionDeleted:      "Deleted",
+	ActionRestored:     "Restored",
+}
+
+// Label returns how the action reads in the UI, e.g. "Renamed".
+func (a Action) Label() string {
+	if label, ok := actionLabels[a]; ok {
+		return label
+	}
+	return string(a)
+}
+
+// ParseAction returns the action with the given name, e.g. "completed".
+// An empty name is the empty action, matching every action in filters.
+func ParseAction(name string) (Action, error) {
+	if name == "" {
+		return "", nil
+	}
+	if _, ok := actionLabels[Action(name)]; !ok {
+		return "", fmt.Errorf("Action must be one of created, title_changed, completed, uncompleted, deleted, restored")
+	}
+	return Action(name), nil
+}
+
+// Event is an entry in the append-only log of changes to todos. Events
+// outlive their todo, so they carry its title at the time of the change.
+type Event struct {
+	ID        int       `json:"id"`
+	TodoID    int       `json:"todo_id"`
+	Title     string    `json:"title"`
+	Action    Action    `json:"action"`
+	From      string    `json:"from,omitempty"` // Value before the change, for changes of a value
+	To        string    `json:"to,omitempty"`   // Value after the change
+	ActorID   int       `json:"actor_id,omitempty"`
+	Actor     string    `json:"actor"` // Email of the user who made the change, empty if the account is gone
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+// List is a named collection of todos. Every todo belongs to exactly one list.
+type List struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	Color     string    `json:"color"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// DefaultListName is the name of the list created for users who have none.
+const DefaultListName = "Inbox"
+
+// Colors are the colors a list or tag can be given, in the order they are offered.
+var Colors = []string{"gray", "red", "orange", "yellow", "green", "blue", "purple", "pink"}
+
+// ValidColor reports whether color is one of Colors.
+func ValidColor(color string) bool {
+	for _, c := range Colors {
+		if c == color {
+			return true
+		}
+	}
+	return false
+}
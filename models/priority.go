@@ -0,0 +1,67 @@
+package models
+
+import "fmt"
+
+// Priority ranks how urgent a todo is. The zero value is PriorityNone, and
+// higher values are more urgent, so sorting by priority descending puts the
+// most urgent todos first.
+type Priority int
+
+const (
+	PriorityNone Priority = iota
+	PriorityLow
+	PriorityMedium
+	PriorityHigh
+	PriorityUrgent
+)
+
+// Priorities lists every priority from least to most urgent.
+var Priorities = []Priority{PriorityNone, PriorityLow, PriorityMedium, PriorityHigh, PriorityUrgent}
+
+// priorityNames holds the name of each priority, indexed by its value.
+var priorityNames = []string{"none", "low", "medium", "high", "urgent"}
+
+// Valid reports whether p is one of Priorities.
+func (p Priority) Valid() bool {
+	return p >= PriorityNone && p <= PriorityUrgent
+}
+
+// String returns the name of the priority, e.g. "high".
+func (p Priority) String() string {
+	if !p.Valid() {
+		return fmt.Sprintf("Priority(%d)", int(p))
+	}
+	return priorityNames[p]
+}
+
+// ParsePriority returns the priority with the given name, e.g. "high".
+// An empty name is PriorityNone.
+func ParsePriority(name string) (Priority, error) {
+	if name == "" {
+		return PriorityNone, nil
+	}
+	for i, n := range priorityNames {
+		if n == name {
+			return Priority(i), nil
+		}
+	}
+	return PriorityNone, fmt.Errorf("Priority must be one of none, low, medium, high, urgent")
+}
+
+// MarshalText encodes the priority by name, so it appears as e.g. "high" in JSON.
+func (p Priority) MarshalText() ([]byte, error) {
+	if !p.Valid() {
+		return nil, fmt.Errorf("invalid priority %d", int(p))
+	}
+	return []byte(p.String()), nil
+}
+
+// UnmarshalText decodes a priority name.
+func (p *Priority) UnmarshalText(text []byte) error {
+	parsed, err := ParsePriority(string(text))
+	if err != nil {
+		return err
+	}
+	*p = parsed
+	return nil
+}
@@ -0,0 +1,29 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestPriorityJSON(t *testing.T) {
+	for _, p := range Priorities {
+		data, err := json.Marshal(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got Priority
+		if err := json.Unmarshal(data, &got); err != nil || got != p {
+			t.Errorf("%s encoded as %s decodes as %s, %v", p, data, got, err)
+		}
+	}
+	if _, err := json.Marshal(Priority(9)); err == nil {
+		t.Error("an invalid priority encoded")
+	}
+	var p Priority
+	if err := json.Unmarshal([]byte(`"High"`), &p); err == nil {
+		t.Error(`"High" decoded as a priority`)
+	}
+	if err := json.Unmarshal([]byte(`""`), &p); err != nil || p != PriorityNone {
+		t.Errorf(`"" decoded as %s, %v, want none`, p, err)
+	}
+}
@@ -0,0 +1,47 @@
+package models
+
+import "strings"
+
+// Markers that delimit the matched parts of the text in a Match. They are
+// control characters so they can't clash with anything a user types.
+const (
+	MatchStart = "\x02"
+	MatchEnd   = "\x03"
+)
+
+// Match holds a todo's title and notes with the parts that matched a search
+// wrapped in MatchStart and MatchEnd.
+type Match struct {
+	Title string
+	Notes string
+}
+
+// MatchSegment is a run of text that either matched a search or didn't.
+type MatchSegment struct {
+	Text string
+	Hit  bool
+}
+
+// MatchSegments splits text marked with MatchStart and MatchEnd into
+// segments, dropping the markers, so it can be rendered safely.
+func MatchSegments(text string) []MatchSegment {
+	var segments []MatchSegment
+	for text != "" {
+		start := strings.Index(text, MatchStart)
+		if start < 0 {
+			segments = append(segments, MatchSegment{Text: text})
+			break
+		}
+		if start > 0 {
+			segments = append(segments, MatchSegment{Text: text[:start]})
+		}
+		text = text[start+len(MatchStart):]
+		end := strings.Index(text, MatchEnd)
+		if end < 0 {
+			end = len(text)
+		}
+		segments = append(segments, MatchSegment{Text: text[:end], Hit: true})
+		text = strings.TrimPrefix(text[end:], MatchEnd)
+	}
+	return segments
+}
@@ -0,0 +1,24 @@
+package models
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestMatchSegments(t *testing.T) {
+	tests := []struct {
+		text string
+		want []MatchSegment
+	}{
+		{"", nil},
+		{"Buy milk", []MatchSegment{{Text: "Buy milk"}}},
+		{"Buy \x02milk\x03", []MatchSegment{{Text: "Buy "}, {Text: "milk", Hit: true}}},
+		{"\x02Milk\x03 and \x02milk\x03 again", []MatchSegment{{Text: "Milk", Hit: true}, {Text: " and "}, {Text: "milk", Hit: true}, {Text: " again"}}},
+		{"Buy \x02milk", []MatchSegment{{Text: "Buy "}, {Text: "milk", Hit: true}}},
+	}
+	for _, tt := range tests {
+		if got := MatchSegments(tt.text); !slices.Equal(got, tt.want) {
+			t.Errorf("MatchSegments(%q) = %+v, want %+v", tt.text, got, tt.want)
+		}
+	}
+}
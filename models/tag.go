@@ -0,0 +1,67 @@
+package models
+
+import (
+	"errors"
+	"strings"
+)
+
+// MaxTagLength is the longest tag name accepted, in bytes.
+const MaxTagLength = 30
+
+// Tag is a label a user can attach to any number of their todos.
+type Tag struct {
+	ID    int    `json:"id"`
+	Name  string `json:"name"`
+	Color string `json:"color"`
+	// Count is the number of todos carrying the tag. It is only filled in
+	// when listing tags for management.
+	Count int `json:"count,omitempty"`
+}
+
+// NormalizeTagName returns the canonical form of a tag name: trimmed, lower
+// case, with runs of whitespace turned into single dashes, so "Home  Office"
+// and "home-office" are the same tag.
+func NormalizeTagName(name string) (string, error) {
+	name = strings.ToLower(strings.Join(strings.Fields(name), "-"))
+	switch {
+	case name == "":
+		return "", errors.New("Tag name cannot be empty")
+	case len(name) > MaxTagLength:
+		return "", errors.New("Tag names must be at most 30 characters")
+	case strings.ContainsAny(name, ",#"):
+		return "", errors.New("Tag names cannot contain commas or #")
+	}
+	return name, nil
+}
+
+// ParseTags splits a comma-separated list of tag names, as typed into the
+// edit form, into normalized, de-duplicated names. A leading # on a name is
+// ignored.
+func ParseTags(list string) ([]string, error) {
+	names := []string{}
+	seen := make(map[string]bool)
+	for _, part := range strings.Split(list, ",") {
+		part = strings.TrimPrefix(strings.TrimSpace(part), "#")
+		if part == "" {
+			continue
+		}
+		name, err := NormalizeTagName(part)
+		if err != nil {
+			return nil, err
+		}
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+// TagNames returns the names of the tags, in order.
+func TagNames(tags []Tag) []string {
+	names := make([]string, len(tags))
+	for i, t := range tags {
+		names[i] = t.Name
+	}
+	return names
+}
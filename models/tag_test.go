@@ -0,0 +1,29 @@
+package models
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseTags(t *testing.T) {
+	tests := []struct {
+		list string
+		want []string
+	}{
+		{"", []string{}},
+		{" , ,", []string{}},
+		{"Home, #work,home", []string{"home", "work"}},
+		{"Home  Office, home-office", []string{"home-office"}},
+	}
+	for _, tt := range tests {
+		if got, err := ParseTags(tt.list); err != nil || !slices.Equal(got, tt.want) {
+			t.Errorf("ParseTags(%q) = %q, %v, want %q", tt.list, got, err, tt.want)
+		}
+	}
+	for _, list := range []string{"a#b", strings.Repeat("x", MaxTagLength+1)} {
+		if got, err := ParseTags(list); err == nil {
+			t.Errorf("ParseTags(%q) = %q, want an error", list, got)
+		}
+	}
+}
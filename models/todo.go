@@ -1,9 +1,39 @@
 package models
 
+import "time"
+
 type Todo struct {
-	ID        int
-	Title     string
-	Completed bool
+	ID        int        `json:"id"`
+	ListID    int        `json:"list_id"`
+	ParentID  int        `json:"parent_id,omitempty"` // Todo this is a subtask of, if any
+	Title     string     `json:"title"`
+	Notes     string     `json:"notes"`
+	Completed bool       `json:"completed"`
+	Priority  Priority   `json:"priority"`
+	Due       *Due       `json:"due"`
+	Tags      []Tag      `json:"tags"`
+	Recur     string     `json:"recur"` // RRULE the todo repeats by, empty if it doesn't
+	Position  string     `json:"position"`
+	Subtasks  Progress   `json:"subtasks"`
+	CreatedAt time.Time  `json:"created_at"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"` // When the todo was moved to the trash, if it was
+	// NextID is the next occurrence that completing a repeating todo just
+	// created. It is only set on the todo returned by that completion.
+	NextID int `json:"next_id,omitempty"`
+	// Match marks where a search hit the todo. It is only set on todos
+	// returned by a search and is not part of the JSON representation.
+	Match *Match `json:"-"`
+}
+
+// Progress counts a todo's subtasks and how many of them are completed.
+type Progress struct {
+	Done  int `json:"done"`
+	Total int `json:"total"`
+}
+
+// Open returns the number of subtasks not completed yet.
+func (p Progress) Open() int {
+	return p.Total - p.Done
 }
 
 func NewTodo(title string) Todo {
@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// User is an account. Every todo belongs to exactly one user.
+// Anonymous users are minted for visitors of the public demo; they have a
+// placeholder email and no password until they are claimed at sign-up.
+type User struct {
+	ID           int       `json:"id"`
+	Email        string    `json:"email"`
+	PasswordHash string    `json:"-"`
+	Anonymous    bool      `json:"anonymous"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// Session is a server-side login session. Only the hash of the session
+// token is stored; the token itself lives in the user's cookie.
+type Session struct {
+	TokenHash string
+	UserID    int
+	ExpiresAt time.Time
+}
@@ -0,0 +1,227 @@
+// Package rank generates fractional, lexicographically ordered position keys.
+// A key can always be generated between any two others, so moving an item in
+// a manually ordered list only rewrites that item's key.
+//
+// A key is an integer part followed by an optional fraction, both written in
+// base-62 digits ordered as their bytes are (0-9, A-Z, a-z). The first
+// character of the integer part encodes its length: 'a' to 'z' for two to 27
+// characters, and 'A' to 'Z', in reverse, for the keys below them. Appending
+// to the end therefore grows keys only logarithmically. Keys compare with
+// plain byte order, so databases must store them with a binary collation.
+package rank
+
+import (
+	"errors"
+	"strings"
+)
+
+// digits are the base-62 digits of a key, in ascending byte order.
+const digits = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// smallestInteger is the lowest possible integer part; no key may equal it,
+// so there is always room to generate a key before any other.
+var smallestInteger = "A" + strings.Repeat("0", 26)
+
+// ErrInvalid is returned for keys that weren't generated by this package.
+var ErrInvalid = errors.New("rank: invalid key")
+
+// ErrOrder is returned by Between when a doesn't sort before b.
+var ErrOrder = errors.New("rank: keys out of order")
+
+// First is the key given to the first item of an empty list.
+const First = "a0"
+
+// Between returns a key that sorts strictly after a and before b. An empty a
+// means the start of the list and an empty b its end, so Between("", "")
+// returns First.
+func Between(a, b string) (string, error) {
+	if a != "" && !Valid(a) || b != "" && !Valid(b) {
+		return "", ErrInvalid
+	}
+	if a != "" && b != "" && a >= b {
+		return "", ErrOrder
+	}
+
+	switch {
+	case a == "" && b == "":
+		return First, nil
+	case a == "":
+		// Before b: the integer part just below b's, or a fraction below it
+		ib := b[:integerLength(b[0])]
+		fb := b[len(ib):]
+		if ib == smallestInteger {
+			return ib + midpoint("", fb), nil
+		}
+		if ib < b {
+			return ib, nil
+		}
+		i, err := decrement(ib)
+		if err != nil {
+			return "", err
+		}
+		if i == smallestInteger {
+			// No key may equal it, so go just above it
+			return i + midpoint("", ""), nil
+		}
+		return i, nil
+	case b == "":
+		// After a: the next integer, or a fraction above a once integers run out
+		ia := a[:integerLength(a[0])]
+		if i, err := increment(ia); err == nil {
+			return i, nil
+		}
+		return ia + midpoint(a[len(ia):], ""), nil
+	}
+
+	ia := a[:integerLength(a[0])]
+	ib := b[:integerLength(b[0])]
+	if ia == ib {
+		return ia + midpoint(a[len(ia):], b[len(ib):]), nil
+	}
+	i, err := increment(ia)
+	if err != nil {
+		return "", err
+	}
+	if i < b {
+		return i, nil
+	}
+	return ia + midpoint(a[len(ia):], ""), nil
+}
+
+// Valid reports whether key is a well-formed key.
+func Valid(key string) bool {
+	if key == "" || key == smallestInteger {
+		return false
+	}
+	n := integerLength(key[0])
+	if n == 0 || n > len(key) {
+		return false
+	}
+	for i := 1; i < len(key); i++ {
+		if strings.IndexByte(digits, key[i]) < 0 {
+			return false
+		}
+	}
+	// A trailing zero would leave no room for keys just below this one
+	return len(key) == n || key[len(key)-1] != digits[0]
+}
+
+// integerLength returns the length of the integer part starting with head,
+// or 0 if head can't start one.
+func integerLength(head byte) int {
+	switch {
+	case head >= 'a' && head <= 'z':
+		return int(head-'a') + 2
+	case head >= 'A' && head <= 'Z':
+		return int('Z'-head) + 2
+	}
+	return 0
+}
+
+// midpoint returns a fraction strictly between the fractions a and b, where
+// an empty b stands for one past the largest fraction. Neither may end in a
+// zero digit, and a must sort before b.
+func midpoint(a, b string) string {
+	if b != "" {
+		// Keep the common prefix, reading a missing digit of a as zero
+		n := 0
+		for n < len(b) && digitAt(a, n) == b[n] {
+			n++
+		}
+		if n > 0 {
+			return b[:n] + midpoint(tail(a, n), b[n:])
+		}
+	}
+
+	digitA := 0
+	if a != "" {
+		digitA = strings.IndexByte(digits, a[0])
+	}
+	digitB := len(digits)
+	if b != "" {
+		digitB = strings.IndexByte(digits, b[0])
+	}
+	if digitB-digitA > 1 {
+		return string(digits[(digitA+digitB+1)/2])
+	}
+	// The first digits are adjacent: b's first digit alone fits if b goes on,
+	// otherwise keep a's first digit and find room after the rest of a
+	if len(b) > 1 {
+		return b[:1]
+	}
+	return string(digits[digitA]) + midpoint(tail(a, 1), "")
+}
+
+// digitAt returns the i-th digit of the fraction s, reading past its end as zero.
+func digitAt(s string, i int) byte {
+	if i < len(s) {
+		return s[i]
+	}
+	return digits[0]
+}
+
+// tail returns s without its first n bytes, or "" if it is shorter.
+func tail(s string, n int) string {
+	if n >= len(s) {
+		return ""
+	}
+	return s[n:]
+}
+
+// increment returns the integer part following x, or ErrInvalid once the
+// largest one is reached.
+func increment(x string) (string, error) {
+	head, digs := x[0], []byte(x[1:])
+	for i := len(digs) - 1; i >= 0; i-- {
+		d := strings.IndexByte(digits, digs[i]) + 1
+		if d < len(digits) {
+			digs[i] = digits[d]
+			return string(head) + string(digs), nil
+		}
+		digs[i] = digits[0]
+	}
+
+	// Every digit carried over: move on to the next length
+	switch head {
+	case 'Z':
+		return "a" + digits[:1], nil
+	case 'z':
+		return "", ErrInvalid
+	}
+	head++
+	if head > 'a' {
+		digs = append(digs, digits[0])
+	} else {
+		digs = digs[:len(digs)-1]
+	}
+	return string(head) + string(digs), nil
+}
+
+// decrement returns the integer part preceding x, or ErrInvalid once the
+// smallest one is reached.
+func decrement(x string) (string, error) {
+	head, digs := x[0], []byte(x[1:])
+	for i := len(digs) - 1; i >= 0; i-- {
+		d := strings.IndexByte(digits, digs[i]) - 1
+		if d >= 0 {
+			digs[i] = digits[d]
+			return string(head) + string(digs), nil
+		}
+		digs[i] = digits[len(digits)-1]
+	}
+
+	// Every digit borrowed: move on to the previous length
+	switch head {
+	case 'a':
+		return "Z" + digits[len(digits)-1:], nil
+	case 'A':
+		return "", ErrInvalid
+	}
+	head--
+	if head < 'Z' {
+		digs = append(digs, digits[len(digits)-1])
+	} else {
+		digs = digs[:len(digs)-1]
+	}
+	return string(head) + string(digs), nil
+}
@@ -0,0 +1,205 @@
+package rank
+
+import (
+	"strings"
+	"testing"
+)
+
+// Keys at the edges of the integer parts.
+var (
+	largest        = "z" + strings.Repeat("z", 26)
+	aboveSmallest  = "A" + strings.Repeat("0", 25) + "1"
+	belowLargest   = "z" + strings.Repeat("z", 25) + "y"
+	smallestLength = "Z" + digits[len(digits)-1:] // The largest two-character key below First
+)
+
+func TestBetween(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want string
+	}{
+		{"empty list", "", "", First},
+		{"after", "a0", "", "a1"},
+		{"after, carrying", "az", "", "b00"},
+		{"after a fraction", "a0V", "", "a1"},
+		{"before", "", "a1", "a0"},
+		{"before, borrowing", "", "a0", smallestLength},
+		{"before a fraction", "", "a1V", "a1"},
+		{"apart", "a0", "a2", "a1"},
+		{"adjacent", "a0", "a1", "a0V"},
+		{"adjacent, on two lengths", smallestLength, "a0", smallestLength + "V"},
+		{"below a fraction", "a0", "a0V", "a0G"},
+		{"above a fraction", "a0V", "a1", "a0l"},
+		{"between fractions", "a0G", "a0V", "a0O"},
+		{"adjacent fractions", "a0G", "a0H", "a0GV"},
+		{"adjacent fractions, b going on", "a0G", "a0H1", "a0H"},
+		{"below a zero fraction", "a0", "a01", "a00V"},
+		{"out of integers at the end", largest, "", largest + "V"},
+		{"just before the end", belowLargest, "", largest},
+		{"out of integers at the start", "", aboveSmallest, smallestInteger + "V"},
+		{"below the smallest integer", "", smallestInteger + "1", smallestInteger + "0V"},
+		{"below the smallest integer, zero first", "", smallestInteger + "01", smallestInteger + "00V"},
+	}
+	for _, tt := range tests {
+		got, err := Between(tt.a, tt.b)
+		if err != nil {
+			t.Errorf("%s: Between(%q, %q): %v", tt.name, tt.a, tt.b, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: Between(%q, %q) = %q, want %q", tt.name, tt.a, tt.b, got, tt.want)
+		}
+		checkBetween(t, tt.a, got, tt.b)
+	}
+}
+
+func TestBetweenErrors(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want error
+	}{
+		{"a1", "a0", ErrOrder},
+		{"a1", "a1", ErrOrder},
+		{"a0", "b", ErrInvalid},
+		{"a00", "", ErrInvalid},
+		{"", smallestInteger, ErrInvalid},
+		{"", "a0-", ErrInvalid},
+		{"0", "", ErrInvalid},
+	}
+	for _, tt := range tests {
+		if _, err := Between(tt.a, tt.b); err != tt.want {
+			t.Errorf("Between(%q, %q) error = %v, want %v", tt.a, tt.b, err, tt.want)
+		}
+	}
+}
+
+func TestValid(t *testing.T) {
+	tests := []struct {
+		key  string
+		want bool
+	}{
+		{First, true},
+		{"a0V", true},
+		{"b00", true},
+		{smallestLength, true},
+		{largest, true},
+		{largest + "zz", true},
+		{smallestInteger + "1", true},
+		{"", false},
+		{"a", false},
+		{"b0", false},
+		{"a0V0", false},
+		{"a0 ", false},
+		{"1", false},
+		{smallestInteger, false},
+	}
+	for _, tt := range tests {
+		if got := Valid(tt.key); got != tt.want {
+			t.Errorf("Valid(%q) = %v, want %v", tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestIncrementDecrement(t *testing.T) {
+	tests := []struct{ x, next string }{
+		{"a0", "a1"},
+		{"a9", "aA"},
+		{"az", "b00"},
+		{"Zz", "a0"},
+		{"Yzz", "Z0"},
+		{"bzz", "c000"},
+		{belowLargest, largest},
+		{smallestInteger, aboveSmallest},
+	}
+	for _, tt := range tests {
+		if got, err := increment(tt.x); err != nil || got != tt.next {
+			t.Errorf("increment(%q) = %q, %v, want %q", tt.x, got, err, tt.next)
+		}
+		if got, err := decrement(tt.next); err != nil || got != tt.x {
+			t.Errorf("decrement(%q) = %q, %v, want %q", tt.next, got, err, tt.x)
+		}
+	}
+	if _, err := increment(largest); err != ErrInvalid {
+		t.Errorf("increment(largest) error = %v, want ErrInvalid", err)
+	}
+	if _, err := decrement(smallestInteger); err != ErrInvalid {
+		t.Errorf("decrement(smallestInteger) error = %v, want ErrInvalid", err)
+	}
+}
+
+// TestBetweenRepeated places many keys at the same spot, as a list does
+// when items are always added at its end, at its start or after its first
+// item, and checks that the keys stay in order and don't grow too long.
+func TestBetweenRepeated(t *testing.T) {
+	tests := []struct {
+		name   string
+		next   func(keys []string) (a, b string)
+		n      int
+		maxLen int
+	}{
+		{"appending", func(keys []string) (string, string) { return keys[len(keys)-1], "" }, 10000, 4},
+		{"prepending", func(keys []string) (string, string) { return "", keys[0] }, 10000, 4},
+		{"after the first", func(keys []string) (string, string) { return keys[0], keys[1] }, 1000, 2 + 1000/5},
+		{"before the last", func(keys []string) (string, string) { return keys[len(keys)-2], keys[len(keys)-1] }, 1000, 2 + 1000/5},
+	}
+	for _, tt := range tests {
+		keys := []string{First, "a1"}
+		for range tt.n {
+			a, b := tt.next(keys)
+			key, err := Between(a, b)
+			if err != nil {
+				t.Fatalf("%s: Between(%q, %q): %v", tt.name, a, b, err)
+			}
+			checkBetween(t, a, key, b)
+			if len(key) > tt.maxLen {
+				t.Fatalf("%s: key %q after %d keys is longer than %d", tt.name, key, len(keys), tt.maxLen)
+			}
+			switch {
+			case a == "":
+				keys = append([]string{key}, keys...)
+			case b == "":
+				keys = append(keys, key)
+			default:
+				i := 0
+				for keys[i] != a {
+					i++
+				}
+				keys = append(keys[:i+1], append([]string{key}, keys[i+1:]...)...)
+			}
+		}
+	}
+}
+
+// FuzzBetween checks that the key Between returns for two valid keys in
+// order is valid and sorts strictly between them.
+func FuzzBetween(f *testing.F) {
+	for _, seed := range [][2]string{
+		{"", ""}, {"a0", ""}, {"", "a0"}, {"a0", "a1"}, {"a0", "a0V"}, {"a0G", "a0H"}, {"a0", "a01"},
+		{largest, ""}, {"", aboveSmallest}, {"", smallestInteger + "1"}, {smallestLength, "a0"},
+	} {
+		f.Add(seed[0], seed[1])
+	}
+	f.Fuzz(func(t *testing.T, a, b string) {
+		if a != "" && !Valid(a) || b != "" && !Valid(b) || a != "" && b != "" && a >= b {
+			return
+		}
+		key, err := Between(a, b)
+		if err != nil {
+			t.Fatalf("Between(%q, %q): %v", a, b, err)
+		}
+		checkBetween(t, a, key, b)
+	})
+}
+
+// checkBetween fails the test unless key is valid and sorts strictly
+// between a and b, either of which may be empty for an end of the list.
+func checkBetween(t *testing.T, a, key, b string) {
+	t.Helper()
+	if !Valid(key) {
+		t.Fatalf("Between(%q, %q) = %q, which is invalid", a, b, key)
+	}
+	if a != "" && key <= a || b != "" && key >= b {
+		t.Fatalf("Between(%q, %q) = %q, which is out of order", a, b, key)
+	}
+}
@@ -0,0 +1,430 @@
+// Package recur parses and evaluates the subset of RFC 5545 recurrence rules
+// (RRULE) todos repeat by. Occurrences are calendar dates: rules never look at
+// times of day, which todos keep separately.
+//
+// Supported parts are FREQ (DAILY, WEEKLY, MONTHLY or YEARLY), INTERVAL,
+// COUNT, UNTIL, BYDAY, BYMONTHDAY and BYMONTH, plus WKST=MO, the default.
+// BYDAY takes ordinals such as 1MO or -1FR only in MONTHLY rules, and in
+// YEARLY rules that name their months with BYMONTH.
+package recur
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Freq is how often a rule repeats.
+type Freq int
+
+// The frequencies a rule can have.
+const (
+	Daily Freq = iota
+	Weekly
+	Monthly
+	Yearly
+)
+
+// freqNames are the RRULE spellings of the frequencies, indexed by Freq.
+var freqNames = []string{"DAILY", "WEEKLY", "MONTHLY", "YEARLY"}
+
+// dayNames are the RRULE spellings of the weekdays, indexed by time.Weekday.
+var dayNames = []string{"SU", "MO", "TU", "WE", "TH", "FR", "SA"}
+
+// ErrInvalid wraps every error Parse returns.
+var ErrInvalid = errors.New("recur: invalid rule")
+
+// maxPeriods bounds how many periods Next scans for an occurrence, so rules
+// that can never match, such as the 30th of every February, end the search.
+const maxPeriods = 10000
+
+// Weekday is a BYDAY entry: a day of the week, and for an ordinal N the Nth
+// such day of the month (counting from the end when negative).
+type Weekday struct {
+	Day time.Weekday
+	N   int
+}
+
+// Rule is a parsed recurrence rule. The zero Interval and Count are read as
+// 1 and unlimited, and a zero Until as no end date.
+type Rule struct {
+	Freq       Freq
+	Interval   int
+	Count      int       // Occurrences left in the series, 0 for unlimited
+	Until      time.Time // Last possible date, at midnight UTC
+	ByDay      []Weekday
+	ByMonthDay []int // 1 to 31, or -31 to -1 counting from the end of the month
+	ByMonth    []time.Month
+}
+
+// Parse parses a rule such as "FREQ=WEEKLY;BYDAY=MO,TH". The "RRULE:" prefix
+// and the case of the rule are ignored.
+func Parse(s string) (Rule, error) {
+	var r Rule
+	s = strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(s)), "RRULE:")
+	if s == "" {
+		return r, fmt.Errorf("%w: empty", ErrInvalid)
+	}
+	seen := map[string]bool{}
+	for _, part := range strings.Split(s, ";") {
+		key, value, ok := strings.Cut(part, "=")
+		if !ok || value == "" {
+			return r, fmt.Errorf("%w: malformed part %q", ErrInvalid, part)
+		}
+		if seen[key] {
+			return r, fmt.Errorf("%w: %s given twice", ErrInvalid, key)
+		}
+		seen[key] = true
+
+		var err error
+		switch key {
+		case "FREQ":
+			i := slices.Index(freqNames, value)
+			if i < 0 {
+				return r, fmt.Errorf("%w: unsupported FREQ %s", ErrInvalid, value)
+			}
+			r.Freq = Freq(i)
+		case "INTERVAL":
+			r.Interval, err = positive(value)
+		case "COUNT":
+			r.Count, err = positive(value)
+		case "UNTIL":
+			// Only the date of a DATE-TIME matters
+			date, _, _ := strings.Cut(value, "T")
+			r.Until, err = time.Parse("20060102", date)
+		case "BYDAY":
+			for _, v := range strings.Split(value, ",") {
+				var d Weekday
+				if d, err = parseWeekday(v); err != nil {
+					break
+				}
+				r.ByDay = append(r.ByDay, d)
+			}
+		case "BYMONTHDAY":
+			for _, v := range strings.Split(value, ",") {
+				var n int
+				if n, err = strconv.Atoi(v); err != nil || n == 0 || n < -31 || n > 31 {
+					err = errors.New("bad BYMONTHDAY " + v)
+					break
+				}
+				r.ByMonthDay = append(r.ByMonthDay, n)
+			}
+		case "BYMONTH":
+			for _, v := range strings.Split(value, ",") {
+				var n int
+				if n, err = strconv.Atoi(v); err != nil || n < 1 || n > 12 {
+					err = errors.New("bad BYMONTH " + v)
+					break
+				}
+				r.ByMonth = append(r.ByMonth, time.Month(n))
+			}
+		case "WKST":
+			if value != "MO" {
+				err = errors.New("only WKST=MO is supported")
+			}
+		default:
+			err = errors.New("unsupported part " + key)
+		}
+		if err != nil {
+			return r, fmt.Errorf("%w: %v", ErrInvalid, err)
+		}
+	}
+
+	if !seen["FREQ"] {
+		return r, fmt.Errorf("%w: FREQ is required", ErrInvalid)
+	}
+	if seen["COUNT"] && seen["UNTIL"] {
+		return r, fmt.Errorf("%w: COUNT and UNTIL are exclusive", ErrInvalid)
+	}
+	for _, d := range r.ByDay {
+		if d.N != 0 && r.Freq != Monthly && (r.Freq != Yearly || len(r.ByMonth) == 0) {
+			return r, fmt.Errorf("%w: BYDAY ordinals need FREQ=MONTHLY, or FREQ=YEARLY with BYMONTH", ErrInvalid)
+		}
+	}
+	if len(r.ByMonthDay) > 0 && r.Freq == Weekly {
+		return r, fmt.Errorf("%w: BYMONTHDAY can't be used with FREQ=WEEKLY", ErrInvalid)
+	}
+	return r, nil
+}
+
+// positive parses a number of at least 1.
+func positive(s string) (int, error) {
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 1 {
+		return 0, errors.New("bad number " + s)
+	}
+	return n, nil
+}
+
+// parseWeekday parses a BYDAY entry such as "MO", "2TU" or "-1FR".
+func parseWeekday(s string) (Weekday, error) {
+	if len(s) < 2 {
+		return Weekday{}, errors.New("bad BYDAY " + s)
+	}
+	day := slices.Index(dayNames, s[len(s)-2:])
+	if day < 0 {
+		return Weekday{}, errors.New("bad BYDAY " + s)
+	}
+	d := Weekday{Day: time.Weekday(day)}
+	if n := s[:len(s)-2]; n != "" {
+		var err error
+		if d.N, err = strconv.Atoi(n); err != nil || d.N == 0 || d.N < -5 || d.N > 5 {
+			return Weekday{}, errors.New("bad BYDAY " + s)
+		}
+	}
+	return d, nil
+}
+
+// String returns the rule in RRULE syntax, without the "RRULE:" prefix and
+// with its parts in a fixed order, so equal rules have equal strings.
+func (r Rule) String() string {
+	parts := []string{"FREQ=" + freqNames[r.Freq]}
+	if r.Interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(r.Interval))
+	}
+	if len(r.ByDay) > 0 {
+		days := make([]string, len(r.ByDay))
+		for i, d := range r.ByDay {
+			days[i] = d.String()
+		}
+		parts = append(parts, "BYDAY="+strings.Join(days, ","))
+	}
+	if len(r.ByMonthDay) > 0 {
+		parts = append(parts, "BYMONTHDAY="+joinInts(r.ByMonthDay))
+	}
+	if len(r.ByMonth) > 0 {
+		months := make([]int, len(r.ByMonth))
+		for i, m := range r.ByMonth {
+			months[i] = int(m)
+		}
+		parts = append(parts, "BYMONTH="+joinInts(months))
+	}
+	if r.Count > 0 {
+		parts = append(parts, "COUNT="+strconv.Itoa(r.Count))
+	}
+	if !r.Until.IsZero() {
+		parts = append(parts, "UNTIL="+r.Until.Format("20060102"))
+	}
+	return strings.Join(parts, ";")
+}
+
+// Text describes the rule in English, such as "Every 2 weeks on Mon, Thu" or
+// "Monthly on the last Fri, 3 times".
+func (r Rule) Text() string {
+	units := []string{"day", "week", "month", "year"}
+	var b strings.Builder
+	if r.Interval > 1 {
+		b.WriteString("Every " + strconv.Itoa(r.Interval) + " " + units[r.Freq] + "s")
+	} else {
+		b.WriteString([]string{"Daily", "Weekly", "Monthly", "Yearly"}[r.Freq])
+	}
+
+	if len(r.ByMonth) > 0 {
+		months := make([]string, len(r.ByMonth))
+		for i, m := range r.ByMonth {
+			months[i] = m.String()[:3]
+		}
+		b.WriteString(" in " + strings.Join(months, ", "))
+	}
+	var on []string
+	for _, n := range r.ByMonthDay {
+		if n == -1 {
+			on = append(on, "the last day")
+		} else if n < 0 {
+			on = append(on, "day "+strconv.Itoa(-n)+" from the end")
+		} else {
+			on = append(on, "day "+strconv.Itoa(n))
+		}
+	}
+	for _, d := range r.ByDay {
+		name := d.Day.String()[:3]
+		switch {
+		case d.N == -1:
+			name = "the last " + name
+		case d.N < 0:
+			name = "the " + ordinal(-d.N) + " last " + name
+		case d.N > 0:
+			name = "the " + ordinal(d.N) + " " + name
+		}
+		on = append(on, name)
+	}
+	if len(on) > 0 {
+		b.WriteString(" on " + strings.Join(on, ", "))
+	}
+
+	switch {
+	case r.Count == 1:
+		b.WriteString(", last occurrence")
+	case r.Count > 1:
+		b.WriteString(", " + strconv.Itoa(r.Count) + " times")
+	case !r.Until.IsZero():
+		b.WriteString(" until " + r.Until.Format("Jan 2, 2006"))
+	}
+	return b.String()
+}
+
+// ordinal returns "1st", "2nd", "3rd" and so on for n from 1 to 5.
+func ordinal(n int) string {
+	switch n {
+	case 1:
+		return "1st"
+	case 2:
+		return "2nd"
+	case 3:
+		return "3rd"
+	}
+	return strconv.Itoa(n) + "th"
+}
+
+// String returns the BYDAY spelling of d.
+func (d Weekday) String() string {
+	if d.N == 0 {
+		return dayNames[d.Day]
+	}
+	return strconv.Itoa(d.N) + dayNames[d.Day]
+}
+
+// joinInts joins numbers with commas.
+func joinInts(ns []int) string {
+	s := make([]string, len(ns))
+	for i, n := range ns {
+		s[i] = strconv.Itoa(n)
+	}
+	return strings.Join(s, ",")
+}
+
+// Next returns the first occurrence strictly after the date after, in the
+// series the rule starts on the date start. Both are read as calendar dates.
+// It reports false once the series ends at its UNTIL date; callers count
+// occurrences against COUNT themselves.
+func (r Rule) Next(start, after time.Time) (time.Time, bool) {
+	start, after = date(start), date(after)
+	interval := max(r.Interval, 1)
+	for k := 0; k < maxPeriods; k++ {
+		// The candidates of the k-th period, in order
+		var days []time.Time
+		switch r.Freq {
+		case Daily:
+			if d := start.AddDate(0, 0, k*interval); r.matchesMonth(d) && r.matchesWeekday(d) && r.matchesMonthDay(d) {
+				days = []time.Time{d}
+			}
+		case Weekly:
+			monday := start.AddDate(0, 0, 7*k*interval-(int(start.Weekday())+6)%7)
+			for i := range 7 {
+				if d := monday.AddDate(0, 0, i); r.matchesMonth(d) && r.inWeek(d, start) {
+					days = append(days, d)
+				}
+			}
+		case Monthly:
+			month := time.Date(start.Year(), start.Month()+time.Month(k*interval), 1, 0, 0, 0, 0, time.UTC)
+			if r.matchesMonth(month) {
+				days = r.monthDays(month, start)
+			}
+		case Yearly:
+			months := r.ByMonth
+			if len(months) == 0 {
+				months = []time.Month{start.Month()}
+			}
+			for m := time.January; m <= time.December; m++ {
+				if slices.Contains(months, m) {
+					days = append(days, r.monthDays(time.Date(start.Year()+k*interval, m, 1, 0, 0, 0, 0, time.UTC), start)...)
+				}
+			}
+		}
+
+		for _, d := range days {
+			if !r.Until.IsZero() && d.After(r.Until) {
+				return time.Time{}, false
+			}
+			if d.After(after) && !d.Before(start) {
+				return d, true
+			}
+		}
+	}
+	return time.Time{}, false
+}
+
+// date truncates t to midnight UTC of its calendar date.
+func date(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// matchesMonth reports whether d lies in one of the BYMONTH months, if any.
+func (r Rule) matchesMonth(d time.Time) bool {
+	return len(r.ByMonth) == 0 || slices.Contains(r.ByMonth, d.Month())
+}
+
+// matchesWeekday reports whether d falls on one of the BYDAY days, if any.
+func (r Rule) matchesWeekday(d time.Time) bool {
+	if len(r.ByDay) == 0 {
+		return true
+	}
+	return slices.ContainsFunc(r.ByDay, func(w Weekday) bool { return w.Day == d.Weekday() })
+}
+
+// matchesMonthDay reports whether d is one of the BYMONTHDAY days, if any.
+func (r Rule) matchesMonthDay(d time.Time) bool {
+	if len(r.ByMonthDay) == 0 {
+		return true
+	}
+	last := daysIn(d)
+	return slices.ContainsFunc(r.ByMonthDay, func(n int) bool {
+		return n == d.Day() || n < 0 && last+n+1 == d.Day()
+	})
+}
+
+// inWeek reports whether d is an occurrence of a weekly rule: one of the
+// BYDAY days, or the start's weekday without them.
+func (r Rule) inWeek(d, start time.Time) bool {
+	if len(r.ByDay) == 0 {
+		return d.Weekday() == start.Weekday()
+	}
+	return r.matchesWeekday(d)
+}
+
+// monthDays returns the occurrences within the month starting on the date
+// first, in order. Without BYDAY or BYMONTHDAY that is the start's day of
+// the month, which months too short for it lack.
+func (r Rule) monthDays(first, start time.Time) []time.Time {
+	var days []time.Time
+	for i := range daysIn(first) {
+		d := first.AddDate(0, 0, i)
+		ok := true
+		if len(r.ByMonthDay) > 0 {
+			ok = r.matchesMonthDay(d)
+		}
+		if len(r.ByDay) > 0 {
+			ok = ok && slices.ContainsFunc(r.ByDay, func(w Weekday) bool { return nthWeekday(d, w) })
+		}
+		if len(r.ByMonthDay) == 0 && len(r.ByDay) == 0 {
+			ok = d.Day() == start.Day()
+		}
+		if ok {
+			days = append(days, d)
+		}
+	}
+	return days
+}
+
+// nthWeekday reports whether d matches w within its month: the right day of
+// the week and, for an ordinal, the right one of them.
+func nthWeekday(d time.Time, w Weekday) bool {
+	if d.Weekday() != w.Day {
+		return false
+	}
+	switch {
+	case w.N > 0:
+		return (d.Day()-1)/7+1 == w.N
+	case w.N < 0:
+		return (daysIn(d)-d.Day())/7+1 == -w.N
+	}
+	return true
+}
+
+// daysIn returns the number of days in the month of d.
+func daysIn(d time.Time) int {
+	return time.Date(d.Year(), d.Month()+1, 0, 0, 0, 0, 0, time.UTC).Day()
+}
@@ -0,0 +1,190 @@
+package recur
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// day returns the calendar date written as 2006-01-02.
+func day(s string) time.Time {
+	d, err := time.Parse(time.DateOnly, s)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		rule string
+		want string // The rule's String
+	}{
+		{"FREQ=DAILY", "FREQ=DAILY"},
+		{"rrule:freq=weekly;byday=th,mo", "FREQ=WEEKLY;BYDAY=TH,MO"},
+		{" RRULE:FREQ=MONTHLY;INTERVAL=1 ", "FREQ=MONTHLY"},
+		{"FREQ=WEEKLY;INTERVAL=2;WKST=MO", "FREQ=WEEKLY;INTERVAL=2"},
+		{"FREQ=YEARLY;COUNT=3;BYMONTH=11;BYDAY=4TH", "FREQ=YEARLY;BYDAY=4TH;BYMONTH=11;COUNT=3"},
+		{"FREQ=MONTHLY;BYDAY=-1FR", "FREQ=MONTHLY;BYDAY=-1FR"},
+		{"FREQ=MONTHLY;BYMONTHDAY=-1,15", "FREQ=MONTHLY;BYMONTHDAY=-1,15"},
+		{"FREQ=DAILY;UNTIL=20261019", "FREQ=DAILY;UNTIL=20261019"},
+		{"FREQ=DAILY;UNTIL=20261019T235959Z", "FREQ=DAILY;UNTIL=20261019"},
+		{"FREQ=DAILY;COUNT=1", "FREQ=DAILY;COUNT=1"},
+	}
+	for _, tt := range tests {
+		r, err := Parse(tt.rule)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.rule, err)
+			continue
+		}
+		if got := r.String(); got != tt.want {
+			t.Errorf("Parse(%q).String() = %q, want %q", tt.rule, got, tt.want)
+		}
+		// The string parses back to the same rule
+		again, err := Parse(r.String())
+		if err != nil || again.String() != r.String() {
+			t.Errorf("Parse(%q) = %q, %v", r.String(), again.String(), err)
+		}
+	}
+}
+
+func TestParseUntil(t *testing.T) {
+	r, err := Parse("FREQ=DAILY;UNTIL=20261019T235959Z")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := day("2026-10-19"); !r.Until.Equal(want) {
+		t.Errorf("Until = %v, want %v", r.Until, want)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, rule := range []string{
+		"",
+		"RRULE:",
+		"FREQ",
+		"FREQ=",
+		"INTERVAL=2",
+		"FREQ=HOURLY",
+		"FREQ=DAILY;FREQ=WEEKLY",
+		"FREQ=DAILY;INTERVAL=0",
+		"FREQ=DAILY;COUNT=-1",
+		"FREQ=DAILY;COUNT=2;UNTIL=20261019",
+		"FREQ=DAILY;UNTIL=2026",
+		"FREQ=WEEKLY;BYDAY=XX",
+		"FREQ=WEEKLY;BYDAY=1MO",
+		"FREQ=YEARLY;BYDAY=1MO",
+		"FREQ=MONTHLY;BYDAY=6MO",
+		"FREQ=MONTHLY;BYDAY=0MO",
+		"FREQ=WEEKLY;BYMONTHDAY=1",
+		"FREQ=MONTHLY;BYMONTHDAY=0",
+		"FREQ=MONTHLY;BYMONTHDAY=32",
+		"FREQ=MONTHLY;BYMONTHDAY=-32",
+		"FREQ=YEARLY;BYMONTH=13",
+		"FREQ=DAILY;WKST=SU",
+		"FREQ=DAILY;BYSETPOS=1",
+	} {
+		if _, err := Parse(rule); !errors.Is(err, ErrInvalid) {
+			t.Errorf("Parse(%q) error = %v, want ErrInvalid", rule, err)
+		}
+	}
+}
+
+func TestNext(t *testing.T) {
+	tests := []struct {
+		rule         string
+		start, after string
+		want         string // Empty when the series has ended
+	}{
+		// DAILY
+		{"FREQ=DAILY", "2026-10-17", "2026-10-17", "2026-10-18"},
+		{"FREQ=DAILY;INTERVAL=3", "2026-10-17", "2026-10-17", "2026-10-20"},
+		{"FREQ=DAILY;INTERVAL=3", "2026-10-17", "2026-10-21", "2026-10-23"},
+		{"FREQ=DAILY", "2026-10-19", "2026-10-01", "2026-10-19"},
+		{"FREQ=DAILY;BYDAY=MO,TH", "2026-10-17", "2026-10-17", "2026-10-19"},
+		// WEEKLY
+		{"FREQ=WEEKLY", "2026-10-17", "2026-10-17", "2026-10-24"},
+		{"FREQ=WEEKLY;BYDAY=MO,TH", "2026-10-19", "2026-10-19", "2026-10-22"},
+		{"FREQ=WEEKLY;BYDAY=MO,TH", "2026-10-19", "2026-10-22", "2026-10-26"},
+		{"FREQ=WEEKLY;BYDAY=MO,TH", "2026-10-17", "2026-10-17", "2026-10-19"},
+		{"FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,TH", "2026-10-19", "2026-10-22", "2026-11-02"},
+		// MONTHLY, with months too short for the day skipped, and BYMONTHDAY=-1 for the end of the month
+		{"FREQ=MONTHLY", "2026-10-17", "2026-10-17", "2026-11-17"},
+		{"FREQ=MONTHLY", "2026-01-31", "2026-01-31", "2026-03-31"},
+		{"FREQ=MONTHLY;BYMONTHDAY=31", "2026-03-31", "2026-03-31", "2026-05-31"},
+		{"FREQ=MONTHLY;BYMONTHDAY=-1", "2026-01-31", "2026-01-31", "2026-02-28"},
+		{"FREQ=MONTHLY;BYMONTHDAY=-1", "2026-01-31", "2026-02-28", "2026-03-31"},
+		{"FREQ=MONTHLY;BYMONTHDAY=-1", "2028-01-31", "2028-01-31", "2028-02-29"},
+		{"FREQ=MONTHLY;BYMONTHDAY=-2", "2026-01-30", "2026-01-30", "2026-02-27"},
+		{"FREQ=MONTHLY;BYMONTHDAY=1,15", "2026-10-01", "2026-10-01", "2026-10-15"},
+		{"FREQ=MONTHLY;BYMONTHDAY=1,15", "2026-10-01", "2026-10-15", "2026-11-01"},
+		{"FREQ=MONTHLY;INTERVAL=3;BYMONTHDAY=1", "2026-10-01", "2026-10-01", "2027-01-01"},
+		{"FREQ=MONTHLY;BYDAY=2TU", "2026-10-01", "2026-10-01", "2026-10-13"},
+		{"FREQ=MONTHLY;BYDAY=-1FR", "2026-10-01", "2026-10-01", "2026-10-30"},
+		{"FREQ=MONTHLY;BYDAY=-1FR", "2026-10-01", "2026-10-30", "2026-11-27"},
+		{"FREQ=MONTHLY;BYDAY=FR;BYMONTHDAY=13", "2026-01-01", "2026-01-01", "2026-02-13"},
+		// YEARLY
+		{"FREQ=YEARLY", "2026-10-17", "2026-10-17", "2027-10-17"},
+		{"FREQ=YEARLY", "2028-02-29", "2028-02-29", "2032-02-29"},
+		{"FREQ=YEARLY;BYMONTH=1,7", "2026-10-17", "2026-10-17", "2027-01-17"},
+		{"FREQ=YEARLY;BYMONTH=11;BYDAY=4TH", "2026-10-17", "2026-10-17", "2026-11-26"},
+		// UNTIL ends the series after its date
+		{"FREQ=DAILY;UNTIL=20261019", "2026-10-17", "2026-10-18", "2026-10-19"},
+		{"FREQ=DAILY;UNTIL=20261019", "2026-10-17", "2026-10-19", ""},
+		{"FREQ=WEEKLY;UNTIL=20261030", "2026-10-17", "2026-10-24", ""},
+		// COUNT is left to the caller
+		{"FREQ=DAILY;COUNT=1", "2026-10-17", "2026-10-17", "2026-10-18"},
+		// Rules that never match end the search
+		{"FREQ=YEARLY;BYMONTH=2;BYMONTHDAY=30", "2026-10-17", "2026-10-17", ""},
+	}
+	for _, tt := range tests {
+		r, err := Parse(tt.rule)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", tt.rule, err)
+		}
+		got, ok := r.Next(day(tt.start), day(tt.after))
+		switch {
+		case tt.want == "" && ok:
+			t.Errorf("%s from %s: Next after %s = %s, want the end", tt.rule, tt.start, tt.after, got.Format(time.DateOnly))
+		case tt.want != "" && (!ok || !got.Equal(day(tt.want))):
+			t.Errorf("%s from %s: Next after %s = %s, %v, want %s", tt.rule, tt.start, tt.after, got.Format(time.DateOnly), ok, tt.want)
+		}
+	}
+}
+
+// TestNextTimeOfDay checks that only the calendar dates of start and after
+// count, whatever their time of day or zone.
+func TestNextTimeOfDay(t *testing.T) {
+	r, err := Parse("FREQ=DAILY")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokyo := time.FixedZone("JST", 9*60*60)
+	start := time.Date(2026, 10, 17, 23, 30, 0, 0, tokyo)
+	got, ok := r.Next(start, start)
+	if !ok || !got.Equal(day("2026-10-18")) {
+		t.Errorf("Next = %v, %v, want 2026-10-18 at midnight UTC", got, ok)
+	}
+}
+
+func TestText(t *testing.T) {
+	tests := []struct{ rule, want string }{
+		{"FREQ=DAILY", "Daily"},
+		{"FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,TH", "Every 2 weeks on Mon, Thu"},
+		{"FREQ=MONTHLY;BYDAY=-1FR;COUNT=3", "Monthly on the last Fri, 3 times"},
+		{"FREQ=MONTHLY;BYDAY=-2MO", "Monthly on the 2nd last Mon"},
+		{"FREQ=MONTHLY;BYMONTHDAY=-1,-3,5", "Monthly on the last day, day 3 from the end, day 5"},
+		{"FREQ=YEARLY;BYMONTH=11;BYDAY=4TH", "Yearly in Nov on the 4th Thu"},
+		{"FREQ=DAILY;COUNT=1", "Daily, last occurrence"},
+		{"FREQ=DAILY;UNTIL=20261019", "Daily until Oct 19, 2026"},
+	}
+	for _, tt := range tests {
+		r, err := Parse(tt.rule)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", tt.rule, err)
+		}
+		if got := r.Text(); got != tt.want {
+			t.Errorf("Parse(%q).Text() = %q, want %q", tt.rule, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package store
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Tottitov/todo/models"
+)
+
+// EventQuery selects entries of the log of changes to a user's todos.
+type EventQuery struct {
+	TodoID  int           // Only events of this todo, if set
+	ActorID int           // Only changes made by this user, if set
+	Action  models.Action // Only events of this kind, if set
+	Since   time.Time     // Only events at or after this time, unless zero
+	Until   time.Time     // Only events before this time, unless zero
+	Limit   int           // Most events to return, or 0 for all of them
+}
+
+// eventColumns selects an event, with the email of its actor, for scanEvent.
+const eventColumns = `e.id, e.todo_id, e.title, e.action, e.from_value, e.to_value,
+	COALESCE(e.actor_id, 0), COALESCE(u.email, ''), e.created_at`
+
+// eventsFrom joins each event to its actor.
+const eventsFrom = " FROM todo_events e LEFT JOIN users u ON u.id = e.actor_id"
+
+// where returns the conditions, following "e.user_id = $1", that narrow the
+// log to q, appending their arguments to args. timeArg turns the bounds of
+// the date range into arguments comparable with created_at.
+func (q EventQuery) where(args []any, timeArg func(time.Time) any) (string, []any) {
+	arg := func(v any) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	var b strings.Builder
+	if q.TodoID != 0 {
+		b.WriteString(" AND e.todo_id = " + arg(q.TodoID))
+	}
+	if q.ActorID != 0 {
+		b.WriteString(" AND e.actor_id = " + arg(q.ActorID))
+	}
+	if q.Action != "" {
+		b.WriteString(" AND e.action = " + arg(string(q.Action)))
+	}
+	if !q.Since.IsZero() {
+		b.WriteString(" AND e.created_at >= " + arg(timeArg(q.Since)))
+	}
+	if !q.Until.IsZero() {
+		b.WriteString(" AND e.created_at < " + arg(timeArg(q.Until)))
+	}
+	b.WriteString(" ORDER BY e.created_at DESC, e.id DESC")
+	if q.Limit > 0 {
+		b.WriteString(" LIMIT " + strconv.Itoa(q.Limit))
+	}
+	return b.String(), args
+}
+
+// matches reports whether e passes q. The in-memory store filters with it in
+// place of the SQL, and must agree with it.
+func (q EventQuery) matches(e models.Event) bool {
+	return (q.TodoID == 0 || e.TodoID == q.TodoID) &&
+		(q.ActorID == 0 || e.ActorID == q.ActorID) &&
+		(q.Action == "" || e.Action == q.Action) &&
+		(q.Since.IsZero() || !e.CreatedAt.Before(q.Since)) &&
+		(q.Until.IsZero() || e.CreatedAt.Before(q.Until))
+}
+
+// scanEvent reads an event selected with eventColumns.
+func scanEvent(row scanner) (models.Event, error) {
+	var e models.Event
+	var action string
+	err := row.Scan(&e.ID, &e.TodoID, &e.Title, &action, &e.From, &e.To, &e.ActorID, &e.Actor, &e.CreatedAt)
+	e.Action = models.Action(action)
+	return e, err
+}
+
+// Statements logging events, in the same transaction as the change they
+// record and before it where the change would hide the todos concerned.
+// Each logs action $3 by user $2, changing a value from $4 to $5, for the
+// todos of user $2 it selects with $1; the casts spare Postgres guessing the
+// types of parameters in a SELECT list. The user acting is always the owner,
+// as todos aren't shared.
+const eventInsert = `INSERT INTO todo_events (user_id, actor_id, todo_id, action, title, from_value, to_value)
+	SELECT user_id, CAST($2 AS INTEGER), id, CAST($3 AS TEXT), title, CAST($4 AS TEXT), CAST($5 AS TEXT) FROM todos `
+
+const (
+	// eventQuery logs an event of todo $1.
+	eventQuery = eventInsert + "WHERE id = $1 AND user_id = $2"
+	// openSubtaskEventsQuery logs an event of each open subtask of todo $1,
+	// the ones completeSubtasksQuery completes.
+	openSubtaskEventsQuery = eventInsert + "WHERE parent_id = $1 AND user_id = $2 AND NOT completed AND deleted_at IS NULL"
+	// subtaskEventsQuery logs an event of each subtask of todo $1.
+	subtaskEventsQuery = eventInsert + "WHERE parent_id = $1 AND user_id = $2 AND deleted_at IS NULL"
+	// deleteEventsQuery logs an event of each todo deleteQuery moves to the trash.
+	deleteEventsQuery = eventInsert + "WHERE (id = $1 OR parent_id = $1) AND user_id = $2 AND deleted_at IS NULL"
+	// restoreEventsQuery logs an event of each todo Restore takes out of the trash.
+	restoreEventsQuery = eventInsert + "WHERE (" + restoreWhere + `)
+		OR (parent_id = $1 AND user_id = $2 AND deleted_at = (SELECT deleted_at FROM todos WHERE id = $1))`
+)
+
+// eventAtQuery logs an event of todo $1 like eventQuery, but made at $6
+// rather than now, for imports that know when a change happened. Events
+// are only ever inserted as dated, never changed afterwards.
+const eventAtQuery = `INSERT INTO todo_events (user_id, actor_id, todo_id, action, title, from_value, to_value, created_at)
+	VALUES ($2, $2, $1, $3, (SELECT title FROM todos WHERE id = $1 AND user_id = $2), $4, $5, $6)`
+
+// actorsQuery selects the users who have changed the todos of user $1.
+const actorsQuery = `SELECT ` + userColumns + ` FROM users
+	WHERE id IN (SELECT actor_id FROM todo_events WHERE user_id = $1) ORDER BY email`
+
+// completionsQuery selects the latest completion of each completed todo of
+// user $1 outside the trash; $2 is the completed action.
+const completionsQuery = `SELECT e.todo_id, MAX(e.created_at) FROM todo_events e
+	JOIN todos t ON t.id = e.todo_id AND t.user_id = e.user_id
+	WHERE e.user_id = $1 AND e.action = $2 AND t.completed AND t.deleted_at IS NULL
+	GROUP BY e.todo_id`
+
+// completionAction returns the action of a todo's completion status
+// becoming done.
+func completionAction(done bool) models.Action {
+	if done {
+		return models.ActionCompleted
+	}
+	return models.ActionUncompleted
+}
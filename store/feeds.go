@@ -0,0 +1,6 @@
+package store
+
+// setFeedQuery gives user $2 the feed token hashed $1, made at $3, in place
+// of the one they had.
+const setFeedQuery = `INSERT INTO feed_tokens (token_hash, user_id, created_at) VALUES ($1, $2, $3)
+	ON CONFLICT (user_id) DO UPDATE SET token_hash = excluded.token_hash, created_at = excluded.created_at`
@@ -0,0 +1,460 @@
+package store
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Tottitov/todo/models"
+)
+
+// MemoryStore is a thread-safe, process-local Store.
+// It is useful for development and tests; its contents are lost on restart.
+type MemoryStore struct {
+	mu          sync.RWMutex
+	todos       map[int]memTodo
+	nextID      int
+	users       map[int]memUser
+	nextUserID  int
+	sessions    map[string]models.Session
+	feeds       map[int]memFeed // By user ID
+	undos       map[string]UndoOffer
+	lists       map[int]memList
+	nextListID  int
+	tags        map[int]memTag
+	nextTagID   int
+	events      []memEvent // Oldest first
+	nextEventID int
+}
+
+// memList is a list together with the ID of the user that owns it.
+type memList struct {
+	models.List
+	userID int
+}
+
+// memTodo is a todo together with the ID of the user that owns it and the
+// IDs of its tags. The embedded Todo never carries Tags; todo resolves them.
+type memTodo struct {
+	models.Todo
+	userID int
+	tagIDs []int
+}
+
+// memUser is a user together with when it was last active.
+type memUser struct {
+	models.User
+	lastSeen time.Time
+}
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		todos:       make(map[int]memTodo),
+		nextID:      1,
+		users:       make(map[int]memUser),
+		nextUserID:  1,
+		sessions:    make(map[string]models.Session),
+		feeds:       make(map[int]memFeed),
+		undos:       make(map[string]UndoOffer),
+		lists:       make(map[int]memList),
+		nextListID:  1,
+		tags:        make(map[int]memTag),
+		nextTagID:   1,
+		nextEventID: 1,
+	}
+}
+
+// List returns the todos in one of the user's lists that pass the query's
+// filter, in its sort order, paging through them like the SQL stores.
+func (s *MemoryStore) List(ctx context.Context, userID int, q TodoQuery) ([]models.Todo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var cursor models.Todo
+	if q.After != 0 {
+		c, ok := s.todos[q.After]
+		if !ok || c.userID != userID {
+			return nil, ErrCursor
+		}
+		cursor = s.todo(c)
+	}
+
+	var todos []models.Todo
+	for _, t := range s.todos {
+		if t.userID != userID {
+			continue
+		}
+		if todo := s.todo(t); q.matches(todo) {
+			if len(q.terms()) > 0 {
+				q.highlight(&todo)
+			}
+			if q.After == 0 || q.less(cursor, todo) {
+				todos = append(todos, todo)
+			}
+		}
+	}
+	sort.Slice(todos, func(i, j int) bool { return q.less(todos[i], todos[j]) })
+	if q.Limit > 0 && len(todos) > q.Limit {
+		todos = todos[:q.Limit]
+	}
+	return todos, nil
+}
+
+// Counts tallies the active and completed todos in one of the user's lists.
+func (s *MemoryStore) Counts(ctx context.Context, userID, listID int) (TodoCounts, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var c TodoCounts
+	for _, t := range s.todos {
+		switch {
+		case t.userID != userID || t.ListID != listID || t.ParentID != 0 || t.DeletedAt != nil:
+		case t.Completed:
+			c.Completed++
+		default:
+			c.Active++
+		}
+	}
+	return c, nil
+}
+
+// Get returns the todo with the given ID.
+func (s *MemoryStore) Get(ctx context.Context, userID, id int) (models.Todo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	t, ok := s.live(userID, id)
+	if !ok {
+		return models.Todo{}, ErrNotFound
+	}
+	return s.todo(t), nil
+}
+
+// Create inserts a new todo into one of the user's lists and assigns it the next ID.
+func (s *MemoryStore) Create(ctx context.Context, userID int, todo models.Todo) (models.Todo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Subtasks go into their parent's list
+	if todo.ParentID != 0 {
+		parent, ok := s.live(userID, todo.ParentID)
+		if !ok {
+			return models.Todo{}, ErrNotFound
+		}
+		if parent.ParentID != 0 {
+			return models.Todo{}, ErrNested
+		}
+		todo.ListID = parent.ListID
+	}
+	if l, ok := s.lists[todo.ListID]; !ok || l.userID != userID {
+		return models.Todo{}, ErrNotFound
+	}
+	t := memTodo{Todo: todo, userID: userID}
+	t.Due = copyDue(todo.Due)
+	t.Tags = nil
+	t.tagIDs = s.tagIDs(userID, models.TagNames(todo.Tags))
+	position, err := s.endPosition(todo.ListID)
+	if err != nil {
+		return models.Todo{}, err
+	}
+	t.Position = position
+	t.CreatedAt = time.Now()
+	t.ID = s.nextID
+	s.nextID++
+	s.todos[t.ID] = t
+	s.log(t, models.ActionCreated, "", "")
+	return s.todo(t), nil
+}
+
+// UpdateTitle changes the title of the todo with the given ID and logs the change.
+func (s *MemoryStore) UpdateTitle(ctx context.Context, userID, id int, title string) (models.Todo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.live(userID, id)
+	if !ok {
+		return models.Todo{}, ErrNotFound
+	}
+	was := t.Title
+	t.Title = title
+	s.todos[id] = t
+	if title != was {
+		s.log(t, models.ActionTitleChanged, was, title)
+	}
+	return s.todo(t), nil
+}
+
+// SetDue sets or clears the due date of the todo with the given ID.
+func (s *MemoryStore) SetDue(ctx context.Context, userID, id int, due *models.Due) (models.Todo, error) {
+	return s.update(userID, id, func(t *models.Todo) { t.Due = copyDue(due) })
+}
+
+// SetNotes replaces the notes of the todo with the given ID.
+func (s *MemoryStore) SetNotes(ctx context.Context, userID, id int, notes string) (models.Todo, error) {
+	return s.update(userID, id, func(t *models.Todo) { t.Notes = notes })
+}
+
+// SetPriority changes the priority of the todo with the given ID.
+func (s *MemoryStore) SetPriority(ctx context.Context, userID, id int, priority models.Priority) (models.Todo, error) {
+	return s.update(userID, id, func(t *models.Todo) { t.Priority = priority })
+}
+
+// SetRecur sets or clears the recurrence rule of the todo with the given ID.
+func (s *MemoryStore) SetRecur(ctx context.Context, userID, id int, rule string) (models.Todo, error) {
+	return s.update(userID, id, func(t *models.Todo) { t.Recur = rule })
+}
+
+// Update applies a patch to the todo with the given ID under the write lock.
+func (s *MemoryStore) Update(ctx context.Context, userID, id int, p TodoPatch) (models.Todo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return patchTodo(memImport{s, userID}, id, p)
+}
+
+// Toggle flips the completion status of the todo with the given ID.
+func (s *MemoryStore) Toggle(ctx context.Context, userID, id int, cascade bool) (models.Todo, error) {
+	return s.complete(userID, id, func(t *models.Todo) { t.Completed = !t.Completed }, cascade)
+}
+
+// SetCompleted sets the completion status of the todo with the given ID.
+func (s *MemoryStore) SetCompleted(ctx context.Context, userID, id int, completed, cascade bool) (models.Todo, error) {
+	return s.complete(userID, id, func(t *models.Todo) { t.Completed = completed }, cascade)
+}
+
+// complete applies fn, which changes the completion status, to the user's
+// todo with the given ID, and logs the change. With cascade, it also
+// completes the open subtasks of a todo that ends up completed. Completing a repeating todo creates its
+// next occurrence.
+func (s *MemoryStore) complete(userID, id int, fn func(*models.Todo), cascade bool) (models.Todo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.live(userID, id)
+	if !ok {
+		return models.Todo{}, ErrNotFound
+	}
+	was := t.Completed
+	fn(&t.Todo)
+	s.todos[id] = t
+	if t.Completed != was {
+		s.log(t, completionAction(t.Completed), "", "")
+	}
+	if cascade && t.Completed {
+		for subID, sub := range s.todos {
+			if sub.ParentID == id && sub.DeletedAt == nil && !sub.Completed {
+				sub.Completed = true
+				s.todos[subID] = sub
+				s.log(sub, models.ActionCompleted, "", "")
+			}
+		}
+	}
+	nextID := 0
+	if t.Completed && !was && t.Recur != "" {
+		var err error
+		if nextID, err = s.repeat(t); err != nil {
+			return models.Todo{}, err
+		}
+		t = s.todos[id]
+	}
+	todo := s.todo(t)
+	todo.NextID = nextID
+	return todo, nil
+}
+
+// Untoggle takes back a toggle under the write lock.
+func (s *MemoryStore) Untoggle(ctx context.Context, userID int, u ToggleUndo) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.live(userID, u.ID)
+	if !ok {
+		return ErrNotFound
+	}
+	if next, ok := s.todos[u.NextID]; ok && u.NextID != 0 && next.userID == userID {
+		for id, o := range s.todos {
+			if id == u.NextID || o.ParentID == u.NextID {
+				if o.DeletedAt == nil {
+					s.log(o, models.ActionDeleted, "", "")
+				}
+				delete(s.todos, id)
+			}
+		}
+	}
+	was := t.Completed
+	t.Completed, t.Recur = u.Completed, u.Recur
+	s.todos[u.ID] = t
+	if t.Completed != was {
+		s.log(t, completionAction(t.Completed), "", "")
+	}
+	for _, id := range u.Reopen {
+		if sub, ok := s.live(userID, id); ok && sub.Completed {
+			sub.Completed = false
+			s.todos[id] = sub
+			s.log(sub, models.ActionUncompleted, "", "")
+		}
+	}
+	return nil
+}
+
+// repeat creates the next occurrence of t, a repeating todo that was just
+// completed, directly after it together with open copies of its subtasks,
+// and clears t's rule so that only the new occurrence carries the series on.
+// It returns the ID of the new occurrence, or 0 if the rule has run out.
+// Callers must hold s.mu.
+func (s *MemoryStore) repeat(t memTodo) (int, error) {
+	next, ok := nextOccurrence(s.todo(t), time.Now())
+	t.Recur = ""
+	s.todos[t.ID] = t
+	if !ok {
+		return 0, nil
+	}
+
+	following := ""
+	for _, o := range s.todos {
+		if o.ListID == t.ListID && o.ParentID == t.ParentID && o.Position > t.Position && (following == "" || o.Position < following) {
+			following = o.Position
+		}
+	}
+	position, err := positionBetween(t.Position, following)
+	if err != nil {
+		return 0, err
+	}
+
+	n := memTodo{Todo: next, userID: t.userID, tagIDs: t.tagIDs}
+	n.Tags = nil
+	n.Position = position
+	n.CreatedAt = time.Now()
+	n.ID = s.nextID
+	s.nextID++
+	s.todos[n.ID] = n
+	s.log(n, models.ActionCreated, "", "")
+
+	// Collect first, so the copies aren't copied again
+	var subtasks []memTodo
+	for _, sub := range s.todos {
+		if sub.ParentID == t.ID && sub.DeletedAt == nil {
+			subtasks = append(subtasks, sub)
+		}
+	}
+	for _, sub := range subtasks {
+		sub.ID = s.nextID
+		s.nextID++
+		sub.ParentID = n.ID
+		sub.Completed = false
+		sub.Due = nil
+		sub.Recur = ""
+		sub.tagIDs = nil
+		sub.CreatedAt = n.CreatedAt
+		s.todos[sub.ID] = sub
+		s.log(sub, models.ActionCreated, "", "")
+	}
+	return n.ID, nil
+}
+
+// update applies fn to the user's todo with the given ID under the write lock.
+func (s *MemoryStore) update(userID, id int, fn func(*models.Todo)) (models.Todo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.live(userID, id)
+	if !ok {
+		return models.Todo{}, ErrNotFound
+	}
+	fn(&t.Todo)
+	s.todos[id] = t
+	return s.todo(t), nil
+}
+
+// Delete moves the todo with the given ID and its subtasks to the trash.
+func (s *MemoryStore) Delete(ctx context.Context, userID, id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.live(userID, id); !ok {
+		return ErrNotFound
+	}
+	now := time.Now()
+	for tid, t := range s.todos {
+		if (tid == id || t.ParentID == id) && t.DeletedAt == nil {
+			t.DeletedAt = &now
+			s.todos[tid] = t
+			s.log(t, models.ActionDeleted, "", "")
+		}
+	}
+	return nil
+}
+
+// Move puts the todo at the end of another of the user's lists.
+func (s *MemoryStore) Move(ctx context.Context, userID, id, listID int) (models.Todo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.live(userID, id)
+	if l, listOK := s.lists[listID]; !ok || !listOK || l.userID != userID {
+		return models.Todo{}, ErrNotFound
+	}
+	position, err := s.endPosition(listID)
+	if err != nil {
+		return models.Todo{}, err
+	}
+	t.ListID = listID
+	t.ParentID = 0
+	t.Position = position
+	s.todos[id] = t
+	for subID, sub := range s.todos {
+		if sub.ParentID == id {
+			sub.ListID = listID
+			s.todos[subID] = sub
+		}
+	}
+	return s.todo(t), nil
+}
+
+// DeleteCompleted moves all completed todos in one of the user's lists, and
+// every subtask of the completed ones, to the trash at the same time.
+func (s *MemoryStore) DeleteCompleted(ctx context.Context, userID, listID int) ([]int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Collect first, so every subtask is still checked against its parent
+	var ids []int
+	for id, t := range s.todos {
+		if t.userID != userID || t.ListID != listID || t.DeletedAt != nil {
+			continue
+		}
+		if t.Completed || t.ParentID != 0 && s.todos[t.ParentID].Completed {
+			ids = append(ids, id)
+		}
+	}
+	sort.Ints(ids)
+	now := time.Now()
+	for _, id := range ids {
+		t := s.todos[id]
+		t.DeletedAt = &now
+		s.todos[id] = t
+		s.log(t, models.ActionDeleted, "", "")
+	}
+	return ids, nil
+}
+
+// Close is a no-op for the in-memory store.
+func (s *MemoryStore) Close() {}
+
+// live returns the user's todo with the given ID unless it is in the trash.
+// Callers must hold s.mu.
+func (s *MemoryStore) live(userID, id int) (memTodo, bool) {
+	t, ok := s.todos[id]
+	return t, ok && t.userID == userID && t.DeletedAt == nil
+}
+
+// copyDue returns a copy of due so the store never shares it with callers.
+func copyDue(due *models.Due) *models.Due {
+	if due == nil {
+		return nil
+	}
+	d := *due
+	return &d
+}
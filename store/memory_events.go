@@ -0,0 +1,99 @@
+package store
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/Tottitov/todo/models"
+)
+
+// memEvent is an event together with the ID of the user whose todo it concerns.
+type memEvent struct {
+	models.Event
+	userID int
+}
+
+// Events returns the events on the user's todos that pass the query.
+func (s *MemoryStore) Events(ctx context.Context, userID int, q EventQuery) ([]models.Event, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	// The log is kept oldest first, so walk it backwards
+	var events []models.Event
+	for i := len(s.events) - 1; i >= 0 && (q.Limit == 0 || len(events) < q.Limit); i-- {
+		e := s.events[i]
+		if e.userID != userID || !q.matches(e.Event) {
+			continue
+		}
+		// Like the SQL join, an actor whose account is gone is unknown
+		if u, ok := s.users[e.ActorID]; ok {
+			e.Actor = u.Email
+		} else {
+			e.ActorID = 0
+		}
+		events = append(events, e.Event)
+	}
+	return events, nil
+}
+
+// Actors returns the users who have changed the user's todos.
+func (s *MemoryStore) Actors(ctx context.Context, userID int) ([]models.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	seen := map[int]bool{}
+	var users []models.User
+	for _, e := range s.events {
+		if u, ok := s.users[e.ActorID]; ok && e.userID == userID && !seen[u.ID] {
+			seen[u.ID] = true
+			users = append(users, u.User)
+		}
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].Email < users[j].Email })
+	return users, nil
+}
+
+// Completions returns when each completed todo of the user was last completed.
+func (s *MemoryStore) Completions(ctx context.Context, userID int) (map[int]time.Time, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	completed := map[int]time.Time{}
+	for _, e := range s.events {
+		t, ok := s.todos[e.TodoID]
+		if e.userID != userID || e.Action != models.ActionCompleted || !ok || !t.Completed || t.DeletedAt != nil {
+			continue
+		}
+		if e.CreatedAt.After(completed[e.TodoID]) {
+			completed[e.TodoID] = e.CreatedAt
+		}
+	}
+	return completed, nil
+}
+
+// log records an event of t, made by its owner. Callers must hold s.mu.
+func (s *MemoryStore) log(t memTodo, action models.Action, from, to string) {
+	s.logAt(t, action, from, to, time.Now())
+}
+
+// logAt records an event of todo t made at the given time, in its place in
+// the log, which is kept in the order of the SQL stores' created_at and ID.
+func (s *MemoryStore) logAt(t memTodo, action models.Action, from, to string, at time.Time) {
+	i := sort.Search(len(s.events), func(i int) bool { return s.events[i].CreatedAt.After(at) })
+	s.events = slices.Insert(s.events, i, memEvent{
+		Event: models.Event{
+			ID:        s.nextEventID,
+			TodoID:    t.ID,
+			Title:     t.Title,
+			Action:    action,
+			From:      from,
+			To:        to,
+			ActorID:   t.userID,
+			CreatedAt: at,
+		},
+		userID: t.userID,
+	})
+	s.nextEventID++
+}
@@ -0,0 +1,55 @@
+package store
+
+import (
+	"context"
+	"time"
+)
+
+// memFeed is the token of a user's calendar feed, by hash, and when it was made.
+type memFeed struct {
+	tokenHash string
+	created   time.Time
+}
+
+// SetFeedToken gives the user a feed token, replacing the one they had.
+func (s *MemoryStore) SetFeedToken(ctx context.Context, userID int, tokenHash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.feeds[userID] = memFeed{tokenHash: tokenHash, created: time.Now()}
+	return nil
+}
+
+// FeedCreated returns when the user's feed token was made.
+func (s *MemoryStore) FeedCreated(ctx context.Context, userID int) (time.Time, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	feed, ok := s.feeds[userID]
+	if !ok {
+		return time.Time{}, ErrNotFound
+	}
+	return feed.created, nil
+}
+
+// FeedUser returns the ID of the user with the given feed token hash.
+func (s *MemoryStore) FeedUser(ctx context.Context, tokenHash string) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for userID, feed := range s.feeds {
+		if feed.tokenHash == tokenHash {
+			return userID, nil
+		}
+	}
+	return 0, ErrNotFound
+}
+
+// DeleteFeedToken turns the user's feed off.
+func (s *MemoryStore) DeleteFeedToken(ctx context.Context, userID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.feeds, userID)
+	return nil
+}
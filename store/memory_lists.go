@@ -0,0 +1,103 @@
+package store
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/Tottitov/todo/models"
+)
+
+// Lists returns the user's lists in the order they were created.
+func (s *MemoryStore) Lists(ctx context.Context, userID int) ([]models.List, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.userLists(userID), nil
+}
+
+// GetList returns one of the user's lists.
+func (s *MemoryStore) GetList(ctx context.Context, userID, id int) (models.List, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	l, ok := s.lists[id]
+	if !ok || l.userID != userID {
+		return models.List{}, ErrNotFound
+	}
+	return l.List, nil
+}
+
+// DefaultList returns the user's first list, creating it if needed.
+func (s *MemoryStore) DefaultList(ctx context.Context, userID int) (models.List, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if lists := s.userLists(userID); len(lists) > 0 {
+		return lists[0], nil
+	}
+	return s.addList(userID, models.DefaultListName, models.Colors[0]), nil
+}
+
+// CreateList adds a list for the user.
+func (s *MemoryStore) CreateList(ctx context.Context, userID int, name, color string) (models.List, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.addList(userID, name, color), nil
+}
+
+// UpdateList renames and recolors one of the user's lists.
+func (s *MemoryStore) UpdateList(ctx context.Context, userID, id int, name, color string) (models.List, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	l, ok := s.lists[id]
+	if !ok || l.userID != userID {
+		return models.List{}, ErrNotFound
+	}
+	l.Name, l.Color = name, color
+	s.lists[id] = l
+	return l.List, nil
+}
+
+// DeleteList removes one of the user's lists together with its todos.
+func (s *MemoryStore) DeleteList(ctx context.Context, userID, id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	l, ok := s.lists[id]
+	if !ok || l.userID != userID {
+		return ErrNotFound
+	}
+	delete(s.lists, id)
+	for todoID, t := range s.todos {
+		if t.ListID == id {
+			delete(s.todos, todoID)
+		}
+	}
+	return nil
+}
+
+// userLists returns the user's lists ordered by ID; the caller must hold the lock.
+func (s *MemoryStore) userLists(userID int) []models.List {
+	var lists []models.List
+	for _, l := range s.lists {
+		if l.userID == userID {
+			lists = append(lists, l.List)
+		}
+	}
+	sort.Slice(lists, func(i, j int) bool { return lists[i].ID < lists[j].ID })
+	return lists
+}
+
+// addList inserts a list; the caller must hold the write lock.
+func (s *MemoryStore) addList(userID int, name, color string) models.List {
+	l := memList{
+		List:   models.List{ID: s.nextListID, Name: name, Color: color, CreatedAt: time.Now()},
+		userID: userID,
+	}
+	s.nextListID++
+	s.lists[l.ID] = l
+	return l.List
+}
@@ -0,0 +1,72 @@
+package store
+
+import (
+	"context"
+
+	"github.com/Tottitov/todo/models"
+)
+
+// Reorder places a todo between two of its neighbours, updating only the
+// moved todo's position.
+func (s *MemoryStore) Reorder(ctx context.Context, userID, id, afterID, beforeID int) (models.Todo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.live(userID, id)
+	if !ok {
+		return models.Todo{}, ErrNotFound
+	}
+
+	// Read the neighbours' positions; they must be siblings of the todo
+	var prev, next string
+	for _, n := range []struct {
+		id  int
+		pos *string
+	}{{afterID, &prev}, {beforeID, &next}} {
+		if n.id == 0 {
+			continue
+		}
+		if n.id == id {
+			return models.Todo{}, ErrOutOfOrder
+		}
+		nt, ok := s.live(userID, n.id)
+		if !ok || nt.ListID != t.ListID || nt.ParentID != t.ParentID {
+			return models.Todo{}, ErrNotFound
+		}
+		*n.pos = nt.Position
+	}
+
+	// Fill in a neighbour that wasn't given from the list itself; with
+	// neither given, the todo goes before the current first one
+	for oid, o := range s.todos {
+		if oid == id || o.ListID != t.ListID || o.ParentID != t.ParentID {
+			continue
+		}
+		switch {
+		case beforeID == 0 && o.Position > prev && (next == "" || o.Position < next):
+			next = o.Position
+		case beforeID != 0 && afterID == 0 && o.Position < next && o.Position > prev:
+			prev = o.Position
+		}
+	}
+	pos, err := positionBetween(prev, next)
+	if err != nil {
+		return models.Todo{}, err
+	}
+
+	t.Position = pos
+	s.todos[id] = t
+	return s.todo(t), nil
+}
+
+// endPosition returns the position following the last todo of a list.
+// Callers must hold s.mu.
+func (s *MemoryStore) endPosition(listID int) (string, error) {
+	last := ""
+	for _, t := range s.todos {
+		if t.ListID == listID && t.Position > last {
+			last = t.Position
+		}
+	}
+	return positionBetween(last, "")
+}
@@ -0,0 +1,160 @@
+package store
+
+import (
+	"context"
+	"slices"
+	"sort"
+
+	"github.com/Tottitov/todo/models"
+)
+
+// memTag is a tag together with the ID of the user that owns it.
+type memTag struct {
+	models.Tag
+	userID int
+}
+
+// SetTags replaces the todo's tags, creating any of the named tags the user doesn't have yet.
+func (s *MemoryStore) SetTags(ctx context.Context, userID, id int, names []string) (models.Todo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.live(userID, id)
+	if !ok {
+		return models.Todo{}, ErrNotFound
+	}
+	t.tagIDs = s.tagIDs(userID, names)
+	s.todos[id] = t
+	return s.todo(t), nil
+}
+
+// Tags returns the user's tags ordered by name, with how many todos carry each.
+func (s *MemoryStore) Tags(ctx context.Context, userID int) ([]models.Tag, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var tags []models.Tag
+	for _, tag := range s.tags {
+		if tag.userID != userID {
+			continue
+		}
+		t := tag.Tag
+		for _, todo := range s.todos {
+			if todo.DeletedAt == nil && slices.Contains(todo.tagIDs, t.ID) {
+				t.Count++
+			}
+		}
+		tags = append(tags, t)
+	}
+	sort.Slice(tags, func(i, j int) bool { return tags[i].Name < tags[j].Name })
+	return tags, nil
+}
+
+// UpdateTag renames and recolors one of the user's tags.
+func (s *MemoryStore) UpdateTag(ctx context.Context, userID, id int, name, color string) (models.Tag, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.tags[id]
+	if !ok || t.userID != userID {
+		return models.Tag{}, ErrNotFound
+	}
+	if other, ok := s.tagByName(userID, name); ok && other.ID != id {
+		return models.Tag{}, ErrTagExists
+	}
+	t.Name, t.Color = name, color
+	s.tags[id] = t
+	return t.Tag, nil
+}
+
+// MergeTag retags every todo carrying fromID with intoID, then deletes fromID.
+func (s *MemoryStore) MergeTag(ctx context.Context, userID, fromID, intoID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	from, fromOK := s.tags[fromID]
+	into, intoOK := s.tags[intoID]
+	if !fromOK || !intoOK || from.userID != userID || into.userID != userID || fromID == intoID {
+		return ErrNotFound
+	}
+	for id, t := range s.todos {
+		if i := slices.Index(t.tagIDs, fromID); i >= 0 {
+			t.tagIDs = slices.Delete(slices.Clone(t.tagIDs), i, i+1)
+			if !slices.Contains(t.tagIDs, intoID) {
+				t.tagIDs = append(t.tagIDs, intoID)
+			}
+			s.todos[id] = t
+		}
+	}
+	delete(s.tags, fromID)
+	return nil
+}
+
+// DeleteTag deletes one of the user's tags and removes it from every todo.
+func (s *MemoryStore) DeleteTag(ctx context.Context, userID, id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if t, ok := s.tags[id]; !ok || t.userID != userID {
+		return ErrNotFound
+	}
+	for todoID, t := range s.todos {
+		if i := slices.Index(t.tagIDs, id); i >= 0 {
+			t.tagIDs = slices.Delete(slices.Clone(t.tagIDs), i, i+1)
+			s.todos[todoID] = t
+		}
+	}
+	delete(s.tags, id)
+	return nil
+}
+
+// todo returns t with its tags resolved and ordered by name, mirroring the
+// tags column of the SQL stores, and its subtasks counted. The caller must
+// hold the lock.
+func (s *MemoryStore) todo(t memTodo) models.Todo {
+	todo := t.Todo
+	todo.Due = copyDue(t.Due)
+	todo.Tags = []models.Tag{}
+	for _, id := range t.tagIDs {
+		todo.Tags = append(todo.Tags, s.tags[id].Tag)
+	}
+	sort.Slice(todo.Tags, func(i, j int) bool { return todo.Tags[i].Name < todo.Tags[j].Name })
+	todo.Subtasks = models.Progress{}
+	for _, sub := range s.todos {
+		if sub.ParentID == t.ID && sameTime(sub.DeletedAt, t.DeletedAt) {
+			todo.Subtasks.Total++
+			if sub.Completed {
+				todo.Subtasks.Done++
+			}
+		}
+	}
+	return todo
+}
+
+// tagIDs returns the IDs of the user's tags with the given names, creating
+// those that don't exist yet. The caller must hold the write lock.
+func (s *MemoryStore) tagIDs(userID int, names []string) []int {
+	var ids []int
+	for _, name := range names {
+		t, ok := s.tagByName(userID, name)
+		if !ok {
+			t = models.Tag{ID: s.nextTagID, Name: name, Color: models.Colors[0]}
+			s.nextTagID++
+			s.tags[t.ID] = memTag{Tag: t, userID: userID}
+		}
+		if !slices.Contains(ids, t.ID) {
+			ids = append(ids, t.ID)
+		}
+	}
+	return ids
+}
+
+// tagByName finds one of the user's tags by name. The caller must hold the lock.
+func (s *MemoryStore) tagByName(userID int, name string) (models.Tag, bool) {
+	for _, t := range s.tags {
+		if t.userID == userID && t.Name == name {
+			return t.Tag, true
+		}
+	}
+	return models.Tag{}, false
+}
@@ -0,0 +1,147 @@
+package store
+
+import (
+	"context"
+	"maps"
+	"sort"
+
+	"github.com/Tottitov/todo/models"
+)
+
+// ExportTodos calls fn with each of the user's todos outside the trash, in
+// the order of exportQuery. The todos are collected under the lock and
+// handed to fn after releasing it, so fn may take its time.
+func (s *MemoryStore) ExportTodos(ctx context.Context, userID int, fn func(models.Todo) error) error {
+	s.mu.RLock()
+	var todos []models.Todo
+	for id := range s.todos {
+		if t, ok := s.live(userID, id); ok {
+			todos = append(todos, s.todo(t))
+		}
+	}
+	// A subtask sorts by its parent's position and ID, after the parent
+	key := func(t models.Todo) (string, int) {
+		if t.ParentID == 0 {
+			return t.Position, t.ID
+		}
+		return s.todos[t.ParentID].Position, t.ParentID
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(todos, func(i, j int) bool {
+		a, b := todos[i], todos[j]
+		if a.ListID != b.ListID {
+			return a.ListID < b.ListID
+		}
+		aPos, aTop := key(a)
+		bPos, bTop := key(b)
+		switch {
+		case aPos != bPos:
+			return aPos < bPos
+		case aTop != bTop:
+			return aTop < bTop
+		case (a.ParentID == 0) != (b.ParentID == 0):
+			return a.ParentID == 0
+		case a.Position != b.Position:
+			return a.Position < b.Position
+		}
+		return a.ID < b.ID
+	})
+	for _, t := range todos {
+		if err := fn(t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Import writes todos to the user's lists under the write lock. Should the
+// import fail, or be a dry run, the store is put back as it was.
+func (s *MemoryStore) Import(ctx context.Context, userID int, todos []ImportTodo, dryRun bool) ([]ImportOutcome, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Entries are replaced rather than changed in place, so shallow copies
+	// are enough to go back to; the log is only ever appended to
+	todoMap, nextID := maps.Clone(s.todos), s.nextID
+	lists, nextListID := maps.Clone(s.lists), s.nextListID
+	tags, nextTagID := maps.Clone(s.tags), s.nextTagID
+	events, nextEventID := len(s.events), s.nextEventID
+
+	outcomes, err := importTodos(memImport{s, userID}, todos)
+	if err != nil || dryRun {
+		s.todos, s.nextID = todoMap, nextID
+		s.lists, s.nextListID = lists, nextListID
+		s.tags, s.nextTagID = tags, nextTagID
+		s.events, s.nextEventID = s.events[:events], nextEventID
+	}
+	return outcomes, err
+}
+
+// memImport is the importTx of the in-memory store, whose lock the import
+// holds.
+type memImport struct {
+	s      *MemoryStore
+	userID int
+}
+
+func (i memImport) listID(name, color string) (int, error) {
+	for _, l := range i.s.userLists(i.userID) {
+		if l.Name == name {
+			return l.ID, nil
+		}
+	}
+	return i.s.addList(i.userID, name, color).ID, nil
+}
+
+func (i memImport) get(id int) (models.Todo, bool, error) {
+	t, ok := i.s.live(i.userID, id)
+	if !ok {
+		return models.Todo{}, false, nil
+	}
+	return i.s.todo(t), true, nil
+}
+
+func (i memImport) insert(todo models.Todo) (int, error) {
+	t := memTodo{Todo: todo, userID: i.userID}
+	t.Due = copyDue(todo.Due)
+	t.Tags = nil
+	t.tagIDs = i.s.tagIDs(i.userID, models.TagNames(todo.Tags))
+	position, err := i.s.endPosition(todo.ListID)
+	if err != nil {
+		return 0, err
+	}
+	t.Position = position
+	t.CreatedAt = importCreatedAt(todo)
+	t.DeletedAt = nil
+	t.ID = i.s.nextID
+	i.s.nextID++
+	i.s.todos[t.ID] = t
+	i.s.log(t, models.ActionCreated, "", "")
+	return t.ID, nil
+}
+
+func (i memImport) update(was, todo models.Todo) error {
+	t := i.s.todos[todo.ID]
+	tagIDs := i.s.tagIDs(i.userID, models.TagNames(todo.Tags))
+	t.Todo = todo
+	t.Due = copyDue(todo.Due)
+	t.Tags = nil
+	t.Subtasks = models.Progress{}
+	t.tagIDs = tagIDs
+	i.s.todos[t.ID] = t
+	if t.ListID != was.ListID {
+		for subID, sub := range i.s.todos {
+			if sub.ParentID == t.ID {
+				sub.ListID = t.ListID
+				i.s.todos[subID] = sub
+			}
+		}
+	}
+	return nil
+}
+
+func (i memImport) log(id int, e importEvent) error {
+	i.s.logAt(i.s.todos[id], e.action, e.from, e.to, e.time())
+	return nil
+}
@@ -0,0 +1,127 @@
+package store
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/Tottitov/todo/models"
+)
+
+// Trash returns the todos in the user's trash, most recently deleted first.
+func (s *MemoryStore) Trash(ctx context.Context, userID int) ([]models.Todo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var todos []models.Todo
+	for _, t := range s.todos {
+		if t.userID == userID && s.inTrash(t) {
+			todos = append(todos, s.todo(t))
+		}
+	}
+	sort.Slice(todos, func(i, j int) bool {
+		if a, b := *todos[i].DeletedAt, *todos[j].DeletedAt; !a.Equal(b) {
+			return a.After(b)
+		}
+		return todos[i].ID > todos[j].ID
+	})
+	return todos, nil
+}
+
+// Restore takes the todo, and the subtasks deleted with it, out of the trash.
+func (s *MemoryStore) Restore(ctx context.Context, userID, id int) (models.Todo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.todos[id]
+	if !ok || t.userID != userID || !s.inTrash(t) {
+		return models.Todo{}, ErrNotFound
+	}
+	for subID, sub := range s.todos {
+		if sub.ParentID == id && sameTime(sub.DeletedAt, t.DeletedAt) {
+			sub.DeletedAt = nil
+			s.todos[subID] = sub
+			s.log(sub, models.ActionRestored, "", "")
+		}
+	}
+	t.DeletedAt = nil
+	s.todos[id] = t
+	s.log(t, models.ActionRestored, "", "")
+	return s.todo(t), nil
+}
+
+// Undelete takes the given todos out of the trash.
+func (s *MemoryStore) Undelete(ctx context.Context, userID int, ids []int) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := 0
+	for _, id := range ids {
+		if t, ok := s.todos[id]; ok && t.userID == userID && t.DeletedAt != nil {
+			t.DeletedAt = nil
+			s.todos[id] = t
+			s.log(t, models.ActionRestored, "", "")
+			n++
+		}
+	}
+	return n, nil
+}
+
+// Purge permanently deletes the todo and its subtasks from the trash.
+func (s *MemoryStore) Purge(ctx context.Context, userID, id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.todos[id]
+	if !ok || t.userID != userID || t.DeletedAt == nil {
+		return ErrNotFound
+	}
+	delete(s.todos, id)
+	for subID, sub := range s.todos {
+		if sub.ParentID == id {
+			delete(s.todos, subID)
+		}
+	}
+	return nil
+}
+
+// EmptyTrash permanently deletes every todo in the user's trash.
+func (s *MemoryStore) EmptyTrash(ctx context.Context, userID int) (int, error) {
+	return s.purge(func(t memTodo) bool { return t.userID == userID })
+}
+
+// PurgeTrash permanently deletes the todos trashed before the given time.
+func (s *MemoryStore) PurgeTrash(ctx context.Context, before time.Time) (int, error) {
+	return s.purge(func(t memTodo) bool { return t.DeletedAt.Before(before) })
+}
+
+// purge permanently deletes the todos in the trash that match, and returns
+// how many there were. A trashed todo's subtasks are all in the trash and
+// deleted no later than it, so none are left behind.
+func (s *MemoryStore) purge(match func(memTodo) bool) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := 0
+	for id, t := range s.todos {
+		if t.DeletedAt != nil && match(t) {
+			delete(s.todos, id)
+			n++
+		}
+	}
+	return n, nil
+}
+
+// inTrash reports whether t is listed in the trash: deleted, and not a
+// subtask of a todo in the trash. Callers must hold s.mu.
+func (s *MemoryStore) inTrash(t memTodo) bool {
+	return t.DeletedAt != nil && (t.ParentID == 0 || s.todos[t.ParentID].DeletedAt == nil)
+}
+
+// sameTime reports whether two optional times are both unset or equal.
+func sameTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
@@ -0,0 +1,46 @@
+package store
+
+import (
+	"context"
+	"time"
+)
+
+// CreateUndo stores a new undo offer.
+func (s *MemoryStore) CreateUndo(ctx context.Context, offer UndoOffer) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	offer.Action.Undelete = append([]int(nil), offer.Action.Undelete...)
+	s.undos[offer.TokenHash] = offer
+	return nil
+}
+
+// TakeUndo removes the user's unexpired undo offer with the given token hash
+// and returns it.
+func (s *MemoryStore) TakeUndo(ctx context.Context, userID int, tokenHash string) (UndoOffer, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	offer, ok := s.undos[tokenHash]
+	if !ok || offer.UserID != userID {
+		return UndoOffer{}, ErrNotFound
+	}
+	delete(s.undos, tokenHash)
+	if !offer.ExpiresAt.After(time.Now()) {
+		return UndoOffer{}, ErrNotFound
+	}
+	return offer, nil
+}
+
+// DeleteExpiredUndos removes undo offers that expired before now.
+func (s *MemoryStore) DeleteExpiredUndos(ctx context.Context, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for hash, offer := range s.undos {
+		if !offer.ExpiresAt.After(now) {
+			delete(s.undos, hash)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,206 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/Tottitov/todo/models"
+)
+
+// CreateUser registers a new user.
+func (s *MemoryStore) CreateUser(ctx context.Context, email, passwordHash string) (models.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.emailTaken(email) {
+		return models.User{}, ErrEmailTaken
+	}
+	return s.addUser(email, passwordHash, false), nil
+}
+
+// GetUser returns the user with the given ID.
+func (s *MemoryStore) GetUser(ctx context.Context, id int) (models.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	u, ok := s.users[id]
+	if !ok {
+		return models.User{}, ErrNotFound
+	}
+	return u.User, nil
+}
+
+// GetUserByEmail returns the user registered with email.
+func (s *MemoryStore) GetUserByEmail(ctx context.Context, email string) (models.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, u := range s.users {
+		if u.Email == email {
+			return u.User, nil
+		}
+	}
+	return models.User{}, ErrNotFound
+}
+
+// CreateAnonymousUser mints an anonymous user.
+func (s *MemoryStore) CreateAnonymousUser(ctx context.Context) (models.User, error) {
+	email, err := anonymousEmail()
+	if err != nil {
+		return models.User{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.addUser(email, "", true), nil
+}
+
+// ClaimAnonymousUser turns an anonymous user into a registered one.
+func (s *MemoryStore) ClaimAnonymousUser(ctx context.Context, id int, email, passwordHash string) (models.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[id]
+	if !ok || !u.Anonymous {
+		return models.User{}, ErrNotFound
+	}
+	if s.emailTaken(email) {
+		return models.User{}, ErrEmailTaken
+	}
+	u.Email, u.PasswordHash, u.Anonymous, u.lastSeen = email, passwordHash, false, time.Now()
+	s.users[id] = u
+	return u.User, nil
+}
+
+// TouchUser records that the user was active at now.
+func (s *MemoryStore) TouchUser(ctx context.Context, id int, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if u, ok := s.users[id]; ok {
+		u.lastSeen = now
+		s.users[id] = u
+	}
+	return nil
+}
+
+// DeleteIdleAnonymousUsers removes anonymous users not seen since before,
+// along with their todos, sessions and feed tokens.
+func (s *MemoryStore) DeleteIdleAnonymousUsers(ctx context.Context, before time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := 0
+	for id, u := range s.users {
+		if u.Anonymous && u.lastSeen.Before(before) {
+			s.deleteUser(id)
+			n++
+		}
+	}
+	return n, nil
+}
+
+// addUser inserts a user; the caller must hold the write lock.
+func (s *MemoryStore) addUser(email, passwordHash string, anonymous bool) models.User {
+	now := time.Now()
+	u := memUser{
+		User: models.User{
+			ID:           s.nextUserID,
+			Email:        email,
+			PasswordHash: passwordHash,
+			Anonymous:    anonymous,
+			CreatedAt:    now,
+		},
+		lastSeen: now,
+	}
+	s.nextUserID++
+	s.users[u.ID] = u
+	return u.User
+}
+
+// deleteUser removes a user and everything that belongs to it, mirroring the
+// ON DELETE CASCADE foreign keys of the SQL stores. The caller must hold the write lock.
+func (s *MemoryStore) deleteUser(id int) {
+	delete(s.users, id)
+	for todoID, t := range s.todos {
+		if t.userID == id {
+			delete(s.todos, todoID)
+		}
+	}
+	for hash, session := range s.sessions {
+		if session.UserID == id {
+			delete(s.sessions, hash)
+		}
+	}
+	delete(s.feeds, id)
+	for tagID, t := range s.tags {
+		if t.userID == id {
+			delete(s.tags, tagID)
+		}
+	}
+	for listID, l := range s.lists {
+		if l.userID == id {
+			delete(s.lists, listID)
+		}
+	}
+	events := s.events[:0]
+	for _, e := range s.events {
+		if e.userID != id {
+			events = append(events, e)
+		}
+	}
+	s.events = events
+}
+
+// emailTaken reports whether any user has the email; the caller must hold the lock.
+func (s *MemoryStore) emailTaken(email string) bool {
+	for _, u := range s.users {
+		if u.Email == email {
+			return true
+		}
+	}
+	return false
+}
+
+// CreateSession stores a new session.
+func (s *MemoryStore) CreateSession(ctx context.Context, session models.Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sessions[session.TokenHash] = session
+	return nil
+}
+
+// GetSession returns the unexpired session with the given token hash.
+func (s *MemoryStore) GetSession(ctx context.Context, tokenHash string) (models.Session, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	session, ok := s.sessions[tokenHash]
+	if !ok || !session.ExpiresAt.After(time.Now()) {
+		return models.Session{}, ErrNotFound
+	}
+	return session, nil
+}
+
+// DeleteSession removes a session.
+func (s *MemoryStore) DeleteSession(ctx context.Context, tokenHash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.sessions, tokenHash)
+	return nil
+}
+
+// DeleteExpiredSessions removes sessions that expired before now.
+func (s *MemoryStore) DeleteExpiredSessions(ctx context.Context, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for hash, session := range s.sessions {
+		if !session.ExpiresAt.After(now) {
+			delete(s.sessions, hash)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,27 @@
+package store
+
+import "github.com/Tottitov/todo/rank"
+
+// Queries for the neighbours of a reordered todo among its siblings, the
+// todos of list $1 with parent $2 (0 for top-level todos).
+const (
+	// neighbourQuery reads the position of sibling $3 of user $4.
+	neighbourQuery = "SELECT position FROM todos WHERE list_id = $1 AND COALESCE(parent_id, 0) = $2 AND id = $3 AND user_id = $4 AND deleted_at IS NULL"
+	// nextPositionQuery and prevPositionQuery fill in a missing neighbour:
+	// the position just after or before $3, not counting the todo being
+	// moved, $4. An empty result means the end of the list.
+	nextPositionQuery = "SELECT COALESCE(min(position), '') FROM todos WHERE list_id = $1 AND COALESCE(parent_id, 0) = $2 AND position > $3 AND id <> $4"
+	prevPositionQuery = "SELECT COALESCE(max(position), '') FROM todos WHERE list_id = $1 AND COALESCE(parent_id, 0) = $2 AND position < $3 AND id <> $4"
+)
+
+// positionBetween returns the rank key for a todo placed between the todos
+// at positions prev and next, either of which is empty at an end of the
+// list. Neighbours that are out of order, or share a position, mean the
+// client reordered a stale copy of the list.
+func positionBetween(prev, next string) (string, error) {
+	pos, err := rank.Between(prev, next)
+	if err != nil {
+		return "", ErrOutOfOrder
+	}
+	return pos, nil
+}
@@ -0,0 +1,71 @@
+package store
+
+import (
+	"time"
+
+	"github.com/Tottitov/todo/models"
+)
+
+// TodoPatch is a change to several fields of a todo at once, for
+// TodoStore.Update. Fields left nil are left as they are.
+type TodoPatch struct {
+	Title    *string
+	Notes    *string
+	Priority *models.Priority
+	SetDue   bool        // Whether to change the due date, to Due
+	Due      *models.Due // The new due date, nil to clear it
+	Tags     *[]string   // Names of the todo's tags, which replace all of them
+	Recur    *string     // The new recurrence rule, empty to stop repeating
+}
+
+// apply makes the changes of the patch to t.
+func (p TodoPatch) apply(t *models.Todo) {
+	if p.Title != nil {
+		t.Title = *p.Title
+	}
+	if p.Notes != nil {
+		t.Notes = *p.Notes
+	}
+	if p.Priority != nil {
+		t.Priority = *p.Priority
+	}
+	if p.SetDue {
+		t.Due = p.Due
+	}
+	if p.Tags != nil {
+		t.Tags = make([]models.Tag, len(*p.Tags))
+		for i, name := range *p.Tags {
+			t.Tags[i] = models.Tag{Name: name}
+		}
+	}
+	if p.Recur != nil {
+		t.Recur = *p.Recur
+	}
+}
+
+// patchTodo applies p to the user's todo with the given ID through tx, the
+// way an import overwrites a todo, and returns the todo as it ends up.
+func patchTodo(tx importTx, id int, p TodoPatch) (models.Todo, error) {
+	was, ok, err := tx.get(id)
+	if err != nil {
+		return models.Todo{}, err
+	}
+	if !ok {
+		return models.Todo{}, ErrNotFound
+	}
+	t := was
+	p.apply(&t)
+	if sameImport(was, t) {
+		return was, nil
+	}
+	if err := tx.update(was, t); err != nil {
+		return models.Todo{}, err
+	}
+	for _, e := range importEvents(was, t, time.Time{}) {
+		if err := tx.log(id, e); err != nil {
+			return models.Todo{}, err
+		}
+	}
+	t, _, err = tx.get(id)
+	return t, err
+}
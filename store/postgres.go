@@ -0,0 +1,469 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Tottitov/todo/migrate"
+	"github.com/Tottitov/todo/models"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// PostgresStore is a Store backed by a PostgreSQL connection pool.
+type PostgresStore struct {
+	pool *pgxpool.Pool
+}
+
+// NewPostgresStore connects to the database at dsn and returns a store using it.
+func NewPostgresStore(ctx context.Context, dsn string) (*PostgresStore, error) {
+	pool, err := pgxpool.New(ctx, dsn)
+	if err != nil {
+		return nil, err
+	}
+	return &PostgresStore{pool: pool}, nil
+}
+
+// Migrator returns a migrator for this database's schema.
+func (s *PostgresStore) Migrator() (*migrate.Migrator, error) {
+	migrations, err := migrate.PostgresMigrations()
+	if err != nil {
+		return nil, err
+	}
+	return migrate.New(migrate.NewPostgresDriver(s.pool), migrations), nil
+}
+
+// pgTodoColumns selects todoFields followed by the todo's tags, as a JSON
+// array ordered by name, for scanTodo.
+const pgTodoColumns = todoFields + `, COALESCE((
+	SELECT json_agg(json_build_object('id', t.id, 'name', t.name, 'color', t.color) ORDER BY t.name)
+	FROM todo_tags tt JOIN tags t ON t.id = tt.tag_id WHERE tt.todo_id = todos.id), '[]')::text`
+
+// List returns the todos in one of the user's lists that pass the query's
+// filter, in the query's sort order. Searches use the full-text index and
+// ts_headline to mark the matches.
+func (s *PostgresStore) List(ctx context.Context, userID int, q TodoQuery) ([]models.Todo, error) {
+	where, args := q.where([]any{userID})
+	searchColumns, searchWhere, rank, args, searching := q.pgSearch(args)
+	page, args := q.page(rank, args)
+	rows, err := s.pool.Query(ctx,
+		"SELECT "+pgTodoColumns+searchColumns+" FROM todos WHERE user_id = $1"+where+searchWhere+page, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	// Scan rows into todo structs, with the highlighted title and notes of search hits
+	var todos []models.Todo
+	for rows.Next() {
+		var (
+			t     models.Todo
+			match models.Match
+			err   error
+		)
+		if searching {
+			t, err = scanTodo(rows, &match.Title, &match.Notes)
+			t.Match = &match
+		} else {
+			t, err = scanTodo(rows)
+		}
+		if err != nil {
+			return nil, err
+		}
+		todos = append(todos, t)
+	}
+	if err := rows.Err(); err != nil || len(todos) > 0 || q.After == 0 {
+		return todos, err
+	}
+	var found bool
+	if err := s.pool.QueryRow(ctx, cursorQuery, q.After, userID).Scan(&found); err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, ErrCursor
+	}
+	return nil, nil
+}
+
+// Counts tallies the active and completed todos in one of the user's lists.
+func (s *PostgresStore) Counts(ctx context.Context, userID, listID int) (TodoCounts, error) {
+	var c TodoCounts
+	err := s.pool.QueryRow(ctx, countsQuery, userID, listID).Scan(&c.Active, &c.Completed)
+	return c, err
+}
+
+// Get returns the todo with the given ID.
+func (s *PostgresStore) Get(ctx context.Context, userID, id int) (models.Todo, error) {
+	t, err := scanTodo(s.pool.QueryRow(ctx,
+		"SELECT "+pgTodoColumns+" FROM todos WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL", id, userID))
+	return t, notFound(err)
+}
+
+// Create inserts a new todo at the end of its list and tags it in one
+// transaction. Locking the list yields ErrNotFound for foreign lists.
+func (s *PostgresStore) Create(ctx context.Context, userID int, todo models.Todo) (models.Todo, error) {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return models.Todo{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	// Subtasks go into their parent's list
+	if todo.ParentID != 0 {
+		var nested bool
+		if err := tx.QueryRow(ctx, parentQuery, todo.ParentID, userID).Scan(&todo.ListID, &nested); err != nil {
+			return models.Todo{}, notFound(err)
+		}
+		if nested {
+			return models.Todo{}, ErrNested
+		}
+	}
+	position, err := pgLockList(ctx, tx, userID, todo.ListID)
+	if err != nil {
+		return models.Todo{}, err
+	}
+
+	id, err := pgInsertTodo(ctx, tx, userID, todo, position)
+	if err != nil {
+		return models.Todo{}, err
+	}
+
+	t, err := scanTodo(tx.QueryRow(ctx, "SELECT "+pgTodoColumns+" FROM todos WHERE id = $1", id))
+	if err != nil {
+		return models.Todo{}, err
+	}
+	return t, tx.Commit(ctx)
+}
+
+// pgInsertTodo inserts a todo at the given position, tags it and logs its
+// creation, returning its ID. The todo's list, and parent if any, must be the user's.
+func pgInsertTodo(ctx context.Context, tx pgx.Tx, userID int, todo models.Todo, position string) (int, error) {
+	var id int
+	dueDate, dueTime, dueTZ, dueAt := dueColumns(todo.Due)
+	err := tx.QueryRow(ctx,
+		`INSERT INTO todos (user_id, list_id, parent_id, title, notes, completed, priority, due_date, due_time, due_tz, due_at, recur, position)
+		VALUES ($1, $2, NULLIF($3, 0), $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+		RETURNING id`,
+		userID, todo.ListID, todo.ParentID, todo.Title, todo.Notes, todo.Completed, int(todo.Priority), dueDate, dueTime, dueTZ, dueAt, todo.Recur, position).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+	if err := pgSetTags(ctx, tx, userID, id, models.TagNames(todo.Tags)); err != nil {
+		return 0, err
+	}
+	return id, pgLog(ctx, tx, eventQuery, id, userID, models.ActionCreated, "", "")
+}
+
+// UpdateTitle changes the title of the todo with the given ID, logging the
+// change in the same transaction.
+func (s *PostgresStore) UpdateTitle(ctx context.Context, userID, id int, title string) (models.Todo, error) {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return models.Todo{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	var was string
+	if err := tx.QueryRow(ctx, "SELECT title FROM todos WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL FOR UPDATE", id, userID).Scan(&was); err != nil {
+		return models.Todo{}, notFound(err)
+	}
+	t, err := scanTodo(tx.QueryRow(ctx,
+		"UPDATE todos SET title = $1 WHERE id = $2 RETURNING "+pgTodoColumns, title, id))
+	if err != nil {
+		return models.Todo{}, err
+	}
+	if title != was {
+		if err := pgLog(ctx, tx, eventQuery, id, userID, models.ActionTitleChanged, was, title); err != nil {
+			return models.Todo{}, err
+		}
+	}
+	return t, tx.Commit(ctx)
+}
+
+// SetDue sets or clears the due date of the todo with the given ID.
+func (s *PostgresStore) SetDue(ctx context.Context, userID, id int, due *models.Due) (models.Todo, error) {
+	dueDate, dueTime, dueTZ, dueAt := dueColumns(due)
+	t, err := scanTodo(s.pool.QueryRow(ctx,
+		`UPDATE todos SET due_date = $1, due_time = $2, due_tz = $3, due_at = $4
+		WHERE id = $5 AND user_id = $6 AND deleted_at IS NULL RETURNING `+pgTodoColumns,
+		dueDate, dueTime, dueTZ, dueAt, id, userID))
+	return t, notFound(err)
+}
+
+// SetNotes replaces the notes of the todo with the given ID.
+func (s *PostgresStore) SetNotes(ctx context.Context, userID, id int, notes string) (models.Todo, error) {
+	t, err := scanTodo(s.pool.QueryRow(ctx,
+		"UPDATE todos SET notes = $1 WHERE id = $2 AND user_id = $3 AND deleted_at IS NULL RETURNING "+pgTodoColumns,
+		notes, id, userID))
+	return t, notFound(err)
+}
+
+// SetPriority changes the priority of the todo with the given ID.
+func (s *PostgresStore) SetPriority(ctx context.Context, userID, id int, priority models.Priority) (models.Todo, error) {
+	t, err := scanTodo(s.pool.QueryRow(ctx,
+		"UPDATE todos SET priority = $1 WHERE id = $2 AND user_id = $3 AND deleted_at IS NULL RETURNING "+pgTodoColumns,
+		int(priority), id, userID))
+	return t, notFound(err)
+}
+
+// SetRecur sets or clears the recurrence rule of the todo with the given ID.
+func (s *PostgresStore) SetRecur(ctx context.Context, userID, id int, rule string) (models.Todo, error) {
+	t, err := scanTodo(s.pool.QueryRow(ctx,
+		"UPDATE todos SET recur = $1 WHERE id = $2 AND user_id = $3 AND deleted_at IS NULL RETURNING "+pgTodoColumns,
+		rule, id, userID))
+	return t, notFound(err)
+}
+
+// Update applies a patch to the todo with the given ID in one transaction,
+// with the row locked so concurrent updates cannot lose one another's.
+func (s *PostgresStore) Update(ctx context.Context, userID, id int, p TodoPatch) (models.Todo, error) {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return models.Todo{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	var one int
+	err = tx.QueryRow(ctx, "SELECT 1 FROM todos WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL FOR UPDATE", id, userID).Scan(&one)
+	if err != nil {
+		return models.Todo{}, notFound(err)
+	}
+	t, err := patchTodo(pgImport{ctx, tx, userID}, id, p)
+	if err != nil {
+		return models.Todo{}, err
+	}
+	return t, tx.Commit(ctx)
+}
+
+// Toggle flips the completion status of the todo with the given ID, with the
+// row locked so concurrent toggles cannot lose an update.
+func (s *PostgresStore) Toggle(ctx context.Context, userID, id int, cascade bool) (models.Todo, error) {
+	return s.complete(ctx, userID, id, nil, cascade)
+}
+
+// SetCompleted sets the completion status of the todo with the given ID.
+func (s *PostgresStore) SetCompleted(ctx context.Context, userID, id int, completed, cascade bool) (models.Todo, error) {
+	return s.complete(ctx, userID, id, &completed, cascade)
+}
+
+// complete sets the completion status of a todo to completed, or flips it
+// if completed is nil, and with cascade completes the open subtasks of a
+// todo that ends up completed, all in one transaction with the events
+// logging it. Completing a repeating todo creates its next occurrence in the
+// same transaction.
+func (s *PostgresStore) complete(ctx context.Context, userID, id int, completed *bool, cascade bool) (models.Todo, error) {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return models.Todo{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	var was, done bool
+	if err := tx.QueryRow(ctx, "SELECT completed FROM todos WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL FOR UPDATE", id, userID).Scan(&was); err != nil {
+		return models.Todo{}, notFound(err)
+	}
+	err = tx.QueryRow(ctx,
+		"UPDATE todos SET completed = COALESCE($1, NOT completed) WHERE id = $2 RETURNING completed",
+		completed, id).Scan(&done)
+	if err != nil {
+		return models.Todo{}, err
+	}
+	if done != was {
+		if err := pgLog(ctx, tx, eventQuery, id, userID, completionAction(done), "", ""); err != nil {
+			return models.Todo{}, err
+		}
+	}
+	if cascade && done {
+		if err := pgLog(ctx, tx, openSubtaskEventsQuery, id, userID, models.ActionCompleted, "", ""); err != nil {
+			return models.Todo{}, err
+		}
+		if _, err := tx.Exec(ctx, completeSubtasksQuery, id, userID); err != nil {
+			return models.Todo{}, err
+		}
+	}
+
+	t, err := scanTodo(tx.QueryRow(ctx, "SELECT "+pgTodoColumns+" FROM todos WHERE id = $1", id))
+	if err != nil {
+		return models.Todo{}, err
+	}
+	if done && !was && t.Recur != "" {
+		if t.NextID, err = pgRepeat(ctx, tx, userID, t); err != nil {
+			return models.Todo{}, err
+		}
+		t.Recur = ""
+	}
+	return t, tx.Commit(ctx)
+}
+
+// Untoggle takes back a toggle in one transaction with the events logging
+// it, with the todo locked like for complete.
+func (s *PostgresStore) Untoggle(ctx context.Context, userID int, u ToggleUndo) error {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var was bool
+	if err := tx.QueryRow(ctx, "SELECT completed FROM todos WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL FOR UPDATE", u.ID, userID).Scan(&was); err != nil {
+		return notFound(err)
+	}
+	if u.NextID != 0 {
+		if err := pgLog(ctx, tx, deleteEventsQuery, u.NextID, userID, models.ActionDeleted, "", ""); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, dropTodoQuery, u.NextID, userID); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec(ctx, untoggleQuery, u.ID, userID, u.Completed, u.Recur); err != nil {
+		return err
+	}
+	if u.Completed != was {
+		if err := pgLog(ctx, tx, eventQuery, u.ID, userID, completionAction(u.Completed), "", ""); err != nil {
+			return err
+		}
+	}
+	for _, id := range u.Reopen {
+		if err := pgLog(ctx, tx, reopenEventsQuery, id, userID, models.ActionUncompleted, "", ""); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, reopenQuery, id, userID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit(ctx)
+}
+
+// pgRepeat creates the next occurrence of t, a repeating todo that was just
+// completed, directly after it, and clears t's rule so that only the new
+// occurrence carries the series on. The list is locked like for Create. It
+// returns the ID of the new occurrence, or 0 if the rule has run out.
+func pgRepeat(ctx context.Context, tx pgx.Tx, userID int, t models.Todo) (int, error) {
+	if _, err := tx.Exec(ctx, "UPDATE todos SET recur = '' WHERE id = $1", t.ID); err != nil {
+		return 0, err
+	}
+	next, ok := nextOccurrence(t, time.Now())
+	if !ok {
+		return 0, nil
+	}
+
+	if _, err := pgLockList(ctx, tx, userID, t.ListID); err != nil {
+		return 0, err
+	}
+	var following string
+	if err := tx.QueryRow(ctx, nextPositionQuery, t.ListID, t.ParentID, t.Position, t.ID).Scan(&following); err != nil {
+		return 0, err
+	}
+	position, err := positionBetween(t.Position, following)
+	if err != nil {
+		return 0, err
+	}
+	nextID, err := pgInsertTodo(ctx, tx, userID, next, position)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec(ctx, copySubtasksQuery, nextID, t.ID, userID); err != nil {
+		return 0, err
+	}
+	return nextID, pgLog(ctx, tx, subtaskEventsQuery, nextID, userID, models.ActionCreated, "", "")
+}
+
+// Delete moves the todo with the given ID and its subtasks to the trash,
+// logging each in the same transaction.
+func (s *PostgresStore) Delete(ctx context.Context, userID, id int) error {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := pgLog(ctx, tx, deleteEventsQuery, id, userID, models.ActionDeleted, "", ""); err != nil {
+		return err
+	}
+	res, err := tx.Exec(ctx, deleteQuery, id, userID, time.Now())
+	if err != nil {
+		return err
+	}
+	if res.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return tx.Commit(ctx)
+}
+
+// Move puts the todo at the end of another of the user's lists.
+func (s *PostgresStore) Move(ctx context.Context, userID, id, listID int) (models.Todo, error) {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return models.Todo{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	position, err := pgLockList(ctx, tx, userID, listID)
+	if err != nil {
+		return models.Todo{}, err
+	}
+	if _, err := tx.Exec(ctx, moveSubtasksQuery, listID, id, userID); err != nil {
+		return models.Todo{}, err
+	}
+	t, err := scanTodo(tx.QueryRow(ctx,
+		`UPDATE todos SET list_id = $1, parent_id = NULL, position = $2 WHERE id = $3 AND user_id = $4 AND deleted_at IS NULL
+		RETURNING `+pgTodoColumns,
+		listID, position, id, userID))
+	if err != nil {
+		return models.Todo{}, notFound(err)
+	}
+	return t, tx.Commit(ctx)
+}
+
+// DeleteCompleted moves all completed todos in one of the user's lists, and
+// every subtask of the completed ones, to the trash at the same time, and
+// logs each.
+func (s *PostgresStore) DeleteCompleted(ctx context.Context, userID, listID int) ([]int, error) {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	now := time.Now()
+	var ids []int
+	for _, query := range []string{deleteCompletedSubtasksQuery, deleteCompletedQuery} {
+		rows, err := tx.Query(ctx, query+" RETURNING id", userID, listID, now)
+		if err != nil {
+			return nil, err
+		}
+		deleted, err := pgx.CollectRows(rows, pgx.RowTo[int])
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, deleted...)
+	}
+	for _, id := range ids {
+		if err := pgLog(ctx, tx, eventQuery, id, userID, models.ActionDeleted, "", ""); err != nil {
+			return nil, err
+		}
+	}
+	return ids, tx.Commit(ctx)
+}
+
+// Close closes the underlying connection pool.
+func (s *PostgresStore) Close() {
+	s.pool.Close()
+}
+
+// notFound translates pgx's no-rows error into ErrNotFound.
+func notFound(err error) error {
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// isUniqueViolation reports whether err is a PostgreSQL unique_violation.
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
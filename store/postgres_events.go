@@ -0,0 +1,74 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/Tottitov/todo/models"
+	"github.com/jackc/pgx/v5"
+)
+
+// Events returns the events on the user's todos that pass the query.
+func (s *PostgresStore) Events(ctx context.Context, userID int, q EventQuery) ([]models.Event, error) {
+	where, args := q.where([]any{userID}, func(t time.Time) any { return t })
+	rows, err := s.pool.Query(ctx, "SELECT "+eventColumns+eventsFrom+" WHERE e.user_id = $1"+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []models.Event
+	for rows.Next() {
+		e, err := scanEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+// Actors returns the users who have changed the user's todos.
+func (s *PostgresStore) Actors(ctx context.Context, userID int) ([]models.User, error) {
+	rows, err := s.pool.Query(ctx, actorsQuery, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []models.User
+	for rows.Next() {
+		u, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
+
+// Completions returns when each completed todo of the user was last completed.
+func (s *PostgresStore) Completions(ctx context.Context, userID int) (map[int]time.Time, error) {
+	rows, err := s.pool.Query(ctx, completionsQuery, userID, string(models.ActionCompleted))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	completed := map[int]time.Time{}
+	for rows.Next() {
+		var id int
+		var at time.Time
+		if err := rows.Scan(&id, &at); err != nil {
+			return nil, err
+		}
+		completed[id] = at
+	}
+	return completed, rows.Err()
+}
+
+// pgLog runs one of the statements logging events within tx.
+func pgLog(ctx context.Context, tx pgx.Tx, query string, id, userID int, action models.Action, from, to string) error {
+	_, err := tx.Exec(ctx, query, id, userID, string(action), from, to)
+	return err
+}
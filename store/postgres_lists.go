@@ -0,0 +1,71 @@
+package store
+
+import (
+	"context"
+
+	"github.com/Tottitov/todo/models"
+)
+
+// Lists returns the user's lists in the order they were created.
+func (s *PostgresStore) Lists(ctx context.Context, userID int) ([]models.List, error) {
+	rows, err := s.pool.Query(ctx,
+		"SELECT "+listColumns+" FROM lists WHERE user_id = $1 ORDER BY id", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var lists []models.List
+	for rows.Next() {
+		l, err := scanList(rows)
+		if err != nil {
+			return nil, err
+		}
+		lists = append(lists, l)
+	}
+	return lists, rows.Err()
+}
+
+// GetList returns one of the user's lists.
+func (s *PostgresStore) GetList(ctx context.Context, userID, id int) (models.List, error) {
+	l, err := scanList(s.pool.QueryRow(ctx,
+		"SELECT "+listColumns+" FROM lists WHERE id = $1 AND user_id = $2", id, userID))
+	return l, notFound(err)
+}
+
+// DefaultList returns the user's first list, creating it if needed.
+func (s *PostgresStore) DefaultList(ctx context.Context, userID int) (models.List, error) {
+	l, err := scanList(s.pool.QueryRow(ctx,
+		"SELECT "+listColumns+" FROM lists WHERE user_id = $1 ORDER BY id LIMIT 1", userID))
+	if err = notFound(err); err != ErrNotFound {
+		return l, err
+	}
+	return s.CreateList(ctx, userID, models.DefaultListName, models.Colors[0])
+}
+
+// CreateList adds a list for the user.
+func (s *PostgresStore) CreateList(ctx context.Context, userID int, name, color string) (models.List, error) {
+	return scanList(s.pool.QueryRow(ctx,
+		"INSERT INTO lists (user_id, name, color) VALUES ($1, $2, $3) RETURNING "+listColumns,
+		userID, name, color))
+}
+
+// UpdateList renames and recolors one of the user's lists.
+func (s *PostgresStore) UpdateList(ctx context.Context, userID, id int, name, color string) (models.List, error) {
+	l, err := scanList(s.pool.QueryRow(ctx,
+		"UPDATE lists SET name = $1, color = $2 WHERE id = $3 AND user_id = $4 RETURNING "+listColumns,
+		name, color, id, userID))
+	return l, notFound(err)
+}
+
+// DeleteList removes one of the user's lists; its todos go with it through ON DELETE CASCADE.
+func (s *PostgresStore) DeleteList(ctx context.Context, userID, id int) error {
+	res, err := s.pool.Exec(ctx, "DELETE FROM lists WHERE id = $1 AND user_id = $2", id, userID)
+	if err != nil {
+		return err
+	}
+	if res.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	// changesChannel is the channel changes are notified on.
+	changesChannel = "todo_changes"
+	// listenPing is how long a listening connection may stay quiet before
+	// it is pinged, to find out whether it was lost.
+	listenPing = time.Minute
+)
+
+// Notify sends c as a notification on changesChannel.
+func (s *PostgresStore) Notify(ctx context.Context, c Change) error {
+	payload, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	_, err = s.pool.Exec(ctx, "SELECT pg_notify($1, $2)", changesChannel, string(payload))
+	return err
+}
+
+// Listen listens on changesChannel over a connection of its own, outside
+// the pool, so it never keeps a pooled connection from queries.
+// Notifications that don't decode are skipped.
+func (s *PostgresStore) Listen(ctx context.Context, listening func(), deliver func(Change)) error {
+	conn, err := pgx.ConnectConfig(ctx, s.pool.Config().ConnConfig.Copy())
+	if err != nil {
+		return err
+	}
+	defer conn.Close(context.Background())
+	if _, err := conn.Exec(ctx, "LISTEN "+changesChannel); err != nil {
+		return err
+	}
+	listening()
+
+	for {
+		// A connection lost without a word would wait forever, so ping it
+		// whenever it has been quiet for a while
+		waitCtx, cancel := context.WithTimeout(ctx, listenPing)
+		n, err := conn.WaitForNotification(waitCtx)
+		cancel()
+		if errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+			if err := conn.Ping(ctx); err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		var c Change
+		if err := json.Unmarshal([]byte(n.Payload), &c); err != nil {
+			continue
+		}
+		deliver(c)
+	}
+}
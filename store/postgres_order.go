@@ -0,0 +1,87 @@
+package store
+
+import (
+	"context"
+
+	"github.com/Tottitov/todo/models"
+	"github.com/jackc/pgx/v5"
+)
+
+// Reorder places a todo between two of its neighbours in one transaction,
+// updating only the moved todo's position.
+func (s *PostgresStore) Reorder(ctx context.Context, userID, id, afterID, beforeID int) (models.Todo, error) {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return models.Todo{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	// Find the todo's list and lock it so concurrent moves can't pick the same position
+	var listID, parentID int
+	err = tx.QueryRow(ctx, "SELECT list_id, COALESCE(parent_id, 0) FROM todos WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL", id, userID).Scan(&listID, &parentID)
+	if err != nil {
+		return models.Todo{}, notFound(err)
+	}
+	if _, err := pgLockList(ctx, tx, userID, listID); err != nil {
+		return models.Todo{}, err
+	}
+
+	// Read the neighbours' positions; they must be siblings of the todo
+	var prev, next string
+	for _, n := range []struct {
+		id  int
+		pos *string
+	}{{afterID, &prev}, {beforeID, &next}} {
+		if n.id == 0 {
+			continue
+		}
+		if n.id == id {
+			return models.Todo{}, ErrOutOfOrder
+		}
+		err := tx.QueryRow(ctx, neighbourQuery, listID, parentID, n.id, userID).Scan(n.pos)
+		if err != nil {
+			return models.Todo{}, notFound(err)
+		}
+	}
+
+	// Fill in a neighbour that wasn't given from the list itself; with
+	// neither given, the todo goes before the current first one
+	switch {
+	case beforeID == 0:
+		err = tx.QueryRow(ctx, nextPositionQuery, listID, parentID, prev, id).Scan(&next)
+	case afterID == 0:
+		err = tx.QueryRow(ctx, prevPositionQuery, listID, parentID, next, id).Scan(&prev)
+	}
+	if err != nil {
+		return models.Todo{}, err
+	}
+	pos, err := positionBetween(prev, next)
+	if err != nil {
+		return models.Todo{}, err
+	}
+
+	t, err := scanTodo(tx.QueryRow(ctx,
+		"UPDATE todos SET position = $1 WHERE id = $2 RETURNING "+pgTodoColumns, pos, id))
+	if err != nil {
+		return models.Todo{}, err
+	}
+	return t, tx.Commit(ctx)
+}
+
+// pgLockList locks one of the user's lists for the rest of tx, serializing
+// the transactions that hand out positions in it, and returns the position
+// following its last todo. It returns ErrNotFound for lists that aren't the
+// user's.
+func pgLockList(ctx context.Context, tx pgx.Tx, userID, listID int) (string, error) {
+	var one int
+	err := tx.QueryRow(ctx, "SELECT 1 FROM lists WHERE id = $1 AND user_id = $2 FOR UPDATE", listID, userID).Scan(&one)
+	if err != nil {
+		return "", notFound(err)
+	}
+	var last string
+	err = tx.QueryRow(ctx, "SELECT COALESCE(max(position), '') FROM todos WHERE list_id = $1", listID).Scan(&last)
+	if err != nil {
+		return "", err
+	}
+	return positionBetween(last, "")
+}
@@ -0,0 +1,131 @@
+package store
+
+import (
+	"context"
+
+	"github.com/Tottitov/todo/models"
+	"github.com/jackc/pgx/v5"
+)
+
+// SetTags replaces the todo's tags in one transaction.
+func (s *PostgresStore) SetTags(ctx context.Context, userID, id int, names []string) (models.Todo, error) {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return models.Todo{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	// Lock the todo, which also checks that it is the user's
+	var one int
+	err = tx.QueryRow(ctx, "SELECT 1 FROM todos WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL FOR UPDATE", id, userID).Scan(&one)
+	if err != nil {
+		return models.Todo{}, notFound(err)
+	}
+	if err := pgSetTags(ctx, tx, userID, id, names); err != nil {
+		return models.Todo{}, err
+	}
+
+	t, err := scanTodo(tx.QueryRow(ctx, "SELECT "+pgTodoColumns+" FROM todos WHERE id = $1", id))
+	if err != nil {
+		return models.Todo{}, err
+	}
+	return t, tx.Commit(ctx)
+}
+
+// pgSetTags replaces the tags of a todo within tx, creating any of the named
+// tags the user doesn't have yet.
+func pgSetTags(ctx context.Context, tx pgx.Tx, userID, todoID int, names []string) error {
+	if _, err := tx.Exec(ctx, "DELETE FROM todo_tags WHERE todo_id = $1", todoID); err != nil {
+		return err
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	_, err := tx.Exec(ctx,
+		`INSERT INTO tags (user_id, name) SELECT $1, unnest($2::text[])
+		ON CONFLICT (user_id, name) DO NOTHING`, userID, names)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(ctx,
+		"INSERT INTO todo_tags (todo_id, tag_id) SELECT $1, id FROM tags WHERE user_id = $2 AND name = ANY($3)",
+		todoID, userID, names)
+	return err
+}
+
+// Tags returns the user's tags ordered by name, with how many todos carry each.
+func (s *PostgresStore) Tags(ctx context.Context, userID int) ([]models.Tag, error) {
+	rows, err := s.pool.Query(ctx,
+		`SELECT id, name, color, (SELECT count(*) FROM todo_tags JOIN todos ON todos.id = todo_tags.todo_id
+			WHERE todo_tags.tag_id = tags.id AND todos.deleted_at IS NULL)
+		FROM tags WHERE user_id = $1 ORDER BY name`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tags []models.Tag
+	for rows.Next() {
+		var t models.Tag
+		if err := rows.Scan(&t.ID, &t.Name, &t.Color, &t.Count); err != nil {
+			return nil, err
+		}
+		tags = append(tags, t)
+	}
+	return tags, rows.Err()
+}
+
+// UpdateTag renames and recolors one of the user's tags.
+func (s *PostgresStore) UpdateTag(ctx context.Context, userID, id int, name, color string) (models.Tag, error) {
+	var t models.Tag
+	err := s.pool.QueryRow(ctx,
+		"UPDATE tags SET name = $1, color = $2 WHERE id = $3 AND user_id = $4 RETURNING id, name, color",
+		name, color, id, userID).Scan(&t.ID, &t.Name, &t.Color)
+	if isUniqueViolation(err) {
+		return models.Tag{}, ErrTagExists
+	}
+	return t, notFound(err)
+}
+
+// MergeTag retags every todo carrying fromID with intoID, then deletes fromID.
+func (s *PostgresStore) MergeTag(ctx context.Context, userID, fromID, intoID int) error {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	// Both tags must be the user's, and distinct
+	var n int
+	err = tx.QueryRow(ctx, "SELECT count(*) FROM tags WHERE user_id = $1 AND id IN ($2, $3)",
+		userID, fromID, intoID).Scan(&n)
+	if err != nil {
+		return err
+	}
+	if n != 2 {
+		return ErrNotFound
+	}
+
+	_, err = tx.Exec(ctx,
+		`INSERT INTO todo_tags (todo_id, tag_id) SELECT todo_id, $2 FROM todo_tags WHERE tag_id = $1
+		ON CONFLICT DO NOTHING`, fromID, intoID)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, "DELETE FROM tags WHERE id = $1", fromID); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// DeleteTag deletes one of the user's tags; its todo_tags rows cascade.
+func (s *PostgresStore) DeleteTag(ctx context.Context, userID, id int) error {
+	tag, err := s.pool.Exec(ctx, "DELETE FROM tags WHERE id = $1 AND user_id = $2", id, userID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
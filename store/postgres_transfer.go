@@ -0,0 +1,110 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/Tottitov/todo/models"
+	"github.com/jackc/pgx/v5"
+)
+
+// ExportTodos calls fn with each of the user's todos outside the trash.
+func (s *PostgresStore) ExportTodos(ctx context.Context, userID int, fn func(models.Todo) error) error {
+	rows, err := s.pool.Query(ctx, fmt.Sprintf(exportQuery, pgTodoColumns), userID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		t, err := scanTodo(rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(t); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// Import writes todos to the user's lists in one transaction, which a dry
+// run rolls back.
+func (s *PostgresStore) Import(ctx context.Context, userID int, todos []ImportTodo, dryRun bool) ([]ImportOutcome, error) {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	outcomes, err := importTodos(pgImport{ctx, tx, userID}, todos)
+	if err != nil || dryRun {
+		return outcomes, err
+	}
+	return outcomes, tx.Commit(ctx)
+}
+
+// pgImport is the importTx of a Postgres transaction.
+type pgImport struct {
+	ctx    context.Context
+	tx     pgx.Tx
+	userID int
+}
+
+func (i pgImport) listID(name, color string) (int, error) {
+	var id int
+	err := i.tx.QueryRow(i.ctx, importListQuery, i.userID, name).Scan(&id)
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return id, err
+	}
+	err = i.tx.QueryRow(i.ctx,
+		"INSERT INTO lists (user_id, name, color) VALUES ($1, $2, $3) RETURNING id", i.userID, name, color).Scan(&id)
+	return id, err
+}
+
+func (i pgImport) get(id int) (models.Todo, bool, error) {
+	t, err := scanTodo(i.tx.QueryRow(i.ctx,
+		"SELECT "+pgTodoColumns+" FROM todos WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL", id, i.userID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.Todo{}, false, nil
+	}
+	return t, err == nil, err
+}
+
+func (i pgImport) insert(t models.Todo) (int, error) {
+	position, err := pgLockList(i.ctx, i.tx, i.userID, t.ListID)
+	if err != nil {
+		return 0, err
+	}
+	id, err := pgInsertTodo(i.ctx, i.tx, i.userID, t, position)
+	if err != nil {
+		return 0, err
+	}
+	_, err = i.tx.Exec(i.ctx, importCreatedQuery, importCreatedAt(t), id)
+	return id, err
+}
+
+func (i pgImport) update(was, t models.Todo) error {
+	dueDate, dueTime, dueTZ, dueAt := dueColumns(t.Due)
+	_, err := i.tx.Exec(i.ctx, importUpdateQuery,
+		t.ListID, t.ParentID, t.Title, t.Notes, t.Completed, int(t.Priority), dueDate, dueTime, dueTZ, dueAt, t.Recur, t.Position,
+		t.ID, i.userID)
+	if err != nil {
+		return err
+	}
+	if err := pgSetTags(i.ctx, i.tx, i.userID, t.ID, models.TagNames(t.Tags)); err != nil {
+		return err
+	}
+	if t.ListID != was.ListID {
+		if _, err := i.tx.Exec(i.ctx, moveSubtasksQuery, t.ListID, t.ID, i.userID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (i pgImport) log(id int, e importEvent) error {
+	_, err := i.tx.Exec(i.ctx, eventAtQuery, id, i.userID, string(e.action), e.from, e.to, e.time())
+	return err
+}
@@ -0,0 +1,119 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/Tottitov/todo/models"
+)
+
+// Trash returns the todos in the user's trash, most recently deleted first.
+func (s *PostgresStore) Trash(ctx context.Context, userID int) ([]models.Todo, error) {
+	rows, err := s.pool.Query(ctx,
+		"SELECT "+pgTodoColumns+" FROM todos WHERE user_id = $1 AND "+inTrash+" ORDER BY deleted_at DESC, id DESC", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var todos []models.Todo
+	for rows.Next() {
+		t, err := scanTodo(rows)
+		if err != nil {
+			return nil, err
+		}
+		todos = append(todos, t)
+	}
+	return todos, rows.Err()
+}
+
+// Restore takes the todo, and the subtasks deleted with it, out of the trash
+// in one transaction, logging each.
+func (s *PostgresStore) Restore(ctx context.Context, userID, id int) (models.Todo, error) {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return models.Todo{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := pgLog(ctx, tx, restoreEventsQuery, id, userID, models.ActionRestored, "", ""); err != nil {
+		return models.Todo{}, err
+	}
+	if _, err := tx.Exec(ctx, restoreSubtasksQuery, id, userID); err != nil {
+		return models.Todo{}, err
+	}
+	t, err := scanTodo(tx.QueryRow(ctx,
+		"UPDATE todos SET deleted_at = NULL WHERE "+restoreWhere+" RETURNING "+pgTodoColumns, id, userID))
+	if err != nil {
+		return models.Todo{}, notFound(err)
+	}
+	return t, tx.Commit(ctx)
+}
+
+// Undelete takes the given todos out of the trash in one transaction,
+// logging each.
+func (s *PostgresStore) Undelete(ctx context.Context, userID int, ids []int) (int, error) {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	n := 0
+	for _, id := range ids {
+		res, err := tx.Exec(ctx, undeleteQuery, id, userID)
+		if err != nil {
+			return 0, err
+		}
+		if res.RowsAffected() == 0 {
+			continue
+		}
+		if err := pgLog(ctx, tx, eventQuery, id, userID, models.ActionRestored, "", ""); err != nil {
+			return 0, err
+		}
+		n++
+	}
+	return n, tx.Commit(ctx)
+}
+
+// Purge permanently deletes the todo from the trash; its subtasks cascade.
+func (s *PostgresStore) Purge(ctx context.Context, userID, id int) error {
+	res, err := s.pool.Exec(ctx, purgeQuery, id, userID)
+	if err != nil {
+		return err
+	}
+	if res.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// EmptyTrash permanently deletes every todo in the user's trash.
+func (s *PostgresStore) EmptyTrash(ctx context.Context, userID int) (int, error) {
+	return s.execAll(ctx, emptyTrashQueries, userID)
+}
+
+// PurgeTrash permanently deletes the todos trashed before the given time.
+func (s *PostgresStore) PurgeTrash(ctx context.Context, before time.Time) (int, error) {
+	return s.execAll(ctx, purgeTrashQueries, before)
+}
+
+// execAll runs the statements in one transaction with the same arguments
+// and returns the total number of rows they affected.
+func (s *PostgresStore) execAll(ctx context.Context, queries []string, args ...any) (int, error) {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	n := 0
+	for _, query := range queries {
+		res, err := tx.Exec(ctx, query, args...)
+		if err != nil {
+			return 0, err
+		}
+		n += int(res.RowsAffected())
+	}
+	return n, tx.Commit(ctx)
+}
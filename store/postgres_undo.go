@@ -0,0 +1,36 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// CreateUndo stores a new undo offer.
+func (s *PostgresStore) CreateUndo(ctx context.Context, offer UndoOffer) error {
+	action, err := json.Marshal(offer.Action)
+	if err != nil {
+		return err
+	}
+	_, err = s.pool.Exec(ctx, createUndoQuery,
+		offer.TokenHash, offer.UserID, offer.ListID, string(action), offer.ExpiresAt.UTC())
+	return err
+}
+
+// TakeUndo removes the user's undo offer with the given token hash and
+// returns it unless it has expired.
+func (s *PostgresStore) TakeUndo(ctx context.Context, userID int, tokenHash string) (UndoOffer, error) {
+	offer := UndoOffer{TokenHash: tokenHash, UserID: userID}
+	var action []byte
+	err := s.pool.QueryRow(ctx, takeUndoQuery, tokenHash, userID).Scan(&offer.ListID, &action, &offer.ExpiresAt)
+	if err != nil {
+		return UndoOffer{}, notFound(err)
+	}
+	return takenUndo(offer, action, time.Now())
+}
+
+// DeleteExpiredUndos removes undo offers that expired before now.
+func (s *PostgresStore) DeleteExpiredUndos(ctx context.Context, now time.Time) error {
+	_, err := s.pool.Exec(ctx, deleteUndosQuery, now.UTC())
+	return err
+}
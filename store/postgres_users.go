@@ -0,0 +1,122 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/Tottitov/todo/models"
+)
+
+// CreateUser registers a new user.
+func (s *PostgresStore) CreateUser(ctx context.Context, email, passwordHash string) (models.User, error) {
+	u, err := scanUser(s.pool.QueryRow(ctx,
+		"INSERT INTO users (email, password_hash, last_seen_at) VALUES ($1, $2, now()) RETURNING "+userColumns,
+		email, passwordHash))
+	if isUniqueViolation(err) {
+		return models.User{}, ErrEmailTaken
+	}
+	return u, err
+}
+
+// GetUser returns the user with the given ID.
+func (s *PostgresStore) GetUser(ctx context.Context, id int) (models.User, error) {
+	u, err := scanUser(s.pool.QueryRow(ctx,
+		"SELECT "+userColumns+" FROM users WHERE id = $1", id))
+	return u, notFound(err)
+}
+
+// GetUserByEmail returns the user registered with email.
+func (s *PostgresStore) GetUserByEmail(ctx context.Context, email string) (models.User, error) {
+	u, err := scanUser(s.pool.QueryRow(ctx,
+		"SELECT "+userColumns+" FROM users WHERE email = $1", email))
+	return u, notFound(err)
+}
+
+// CreateAnonymousUser mints an anonymous user.
+func (s *PostgresStore) CreateAnonymousUser(ctx context.Context) (models.User, error) {
+	email, err := anonymousEmail()
+	if err != nil {
+		return models.User{}, err
+	}
+	return scanUser(s.pool.QueryRow(ctx,
+		"INSERT INTO users (email, password_hash, anonymous, last_seen_at) VALUES ($1, '', true, now()) RETURNING "+userColumns,
+		email))
+}
+
+// ClaimAnonymousUser turns an anonymous user into a registered one.
+func (s *PostgresStore) ClaimAnonymousUser(ctx context.Context, id int, email, passwordHash string) (models.User, error) {
+	u, err := scanUser(s.pool.QueryRow(ctx,
+		`UPDATE users SET email = $1, password_hash = $2, anonymous = false, last_seen_at = now()
+		WHERE id = $3 AND anonymous RETURNING `+userColumns,
+		email, passwordHash, id))
+	if isUniqueViolation(err) {
+		return models.User{}, ErrEmailTaken
+	}
+	return u, notFound(err)
+}
+
+// TouchUser records that the user was active at now.
+func (s *PostgresStore) TouchUser(ctx context.Context, id int, now time.Time) error {
+	_, err := s.pool.Exec(ctx,
+		"UPDATE users SET last_seen_at = $1 WHERE id = $2 AND (last_seen_at IS NULL OR last_seen_at < $3)",
+		now, id, now.Add(-touchInterval))
+	return err
+}
+
+// DeleteIdleAnonymousUsers removes anonymous users not seen since before.
+func (s *PostgresStore) DeleteIdleAnonymousUsers(ctx context.Context, before time.Time) (int, error) {
+	res, err := s.pool.Exec(ctx,
+		"DELETE FROM users WHERE anonymous AND COALESCE(last_seen_at, created_at) < $1", before)
+	if err != nil {
+		return 0, err
+	}
+	return int(res.RowsAffected()), nil
+}
+
+// Orphans counts the todos without an owner.
+func (s *PostgresStore) Orphans(ctx context.Context) (int, error) {
+	var n int
+	err := s.pool.QueryRow(ctx, "SELECT count(*) FROM todos WHERE user_id IS NULL").Scan(&n)
+	return n, err
+}
+
+// ClaimOrphans gives every todo without an owner to the user.
+func (s *PostgresStore) ClaimOrphans(ctx context.Context, userID int) (int, error) {
+	list, err := s.DefaultList(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+	res, err := s.pool.Exec(ctx,
+		"UPDATE todos SET user_id = $1, list_id = $2 WHERE user_id IS NULL", userID, list.ID)
+	return int(res.RowsAffected()), err
+}
+
+// CreateSession stores a new session.
+func (s *PostgresStore) CreateSession(ctx context.Context, session models.Session) error {
+	_, err := s.pool.Exec(ctx,
+		"INSERT INTO sessions (token_hash, user_id, expires_at) VALUES ($1, $2, $3)",
+		session.TokenHash, session.UserID, session.ExpiresAt)
+	return err
+}
+
+// GetSession returns the unexpired session with the given token hash.
+func (s *PostgresStore) GetSession(ctx context.Context, tokenHash string) (models.Session, error) {
+	var session models.Session
+	err := s.pool.QueryRow(ctx,
+		"SELECT token_hash, user_id, expires_at FROM sessions WHERE token_hash = $1 AND expires_at > now()",
+		tokenHash,
+	).Scan(&session.TokenHash, &session.UserID, &session.ExpiresAt)
+	return session, notFound(err)
+}
+
+// DeleteSession removes a session.
+func (s *PostgresStore) DeleteSession(ctx context.Context, tokenHash string) error {
+	_, err := s.pool.Exec(ctx, "DELETE FROM sessions WHERE token_hash = $1", tokenHash)
+	return err
+}
+
+// DeleteExpiredSessions removes sessions that expired before now.
+func (s *PostgresStore) DeleteExpiredSessions(ctx context.Context, now time.Time) error {
+	_, err := s.pool.Exec(ctx, "DELETE FROM sessions WHERE expires_at <= $1", now)
+	return err
+}
@@ -0,0 +1,280 @@
+package store
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Tottitov/todo/models"
+)
+
+// Filters narrowing the todos returned by TodoStore.List.
+const (
+	FilterAll       = ""          // Every todo
+	FilterActive    = "active"    // Incomplete todos
+	FilterCompleted = "completed" // Completed todos
+	FilterToday     = "today"     // Todos due today, complete or not
+	FilterOverdue   = "overdue"   // Incomplete todos whose due date has passed
+	FilterUpcoming  = "upcoming"  // Incomplete todos due after today
+)
+
+// Filters lists every supported filter except FilterAll, in display order.
+var Filters = []string{FilterActive, FilterCompleted, FilterToday, FilterOverdue, FilterUpcoming}
+
+// ValidFilter reports whether filter is FilterAll or one of Filters.
+func ValidFilter(filter string) bool {
+	if filter == FilterAll {
+		return true
+	}
+	for _, f := range Filters {
+		if f == filter {
+			return true
+		}
+	}
+	return false
+}
+
+// Orders in which TodoStore.List can return todos.
+const (
+	SortManual   = ""         // The order the user arranged the todos in
+	SortPriority = "priority" // Most urgent first
+	SortCreated  = "created"  // Newest first
+	SortDue      = "due"      // Soonest due first, todos without a due date last
+	SortTitle    = "title"    // Alphabetically, ignoring case
+)
+
+// Sorts lists every supported order, in display order.
+var Sorts = []string{SortManual, SortPriority, SortCreated, SortDue, SortTitle}
+
+// ValidSort reports whether sort is one of Sorts.
+func ValidSort(sort string) bool {
+	for _, s := range Sorts {
+		if s == sort {
+			return true
+		}
+	}
+	return false
+}
+
+// TodoQuery selects the todos TodoStore.List returns.
+type TodoQuery struct {
+	ListID int    // List to read from
+	Parent int    // Subtasks of this todo instead of the list's top-level todos, if set
+	Filter string // One of the Filter constants
+	Sort   string // One of the Sort constants
+	Tag    string // Only todos carrying the tag with this name, if set
+	Search string // Only todos whose title or notes contain every word, if set
+	After  int    // Only todos after the one with this ID in the sort order, if set
+	Limit  int    // Most todos to return, or 0 for all of them
+	// Now is the reference time for the date filters. Its location decides
+	// which calendar day counts as today. The zero value means time.Now().
+	Now time.Time
+}
+
+// TodoCounts are the number of active and completed top-level todos in a list.
+type TodoCounts struct {
+	Active    int `json:"active"`
+	Completed int `json:"completed"`
+}
+
+// countsQuery tallies the todos of a list for TodoStore.Counts in one pass.
+// Both SQL backends support aggregate FILTER clauses.
+const countsQuery = `SELECT count(*) FILTER (WHERE NOT completed), count(*) FILTER (WHERE completed)
+	FROM todos WHERE user_id = $1 AND list_id = $2 AND parent_id IS NULL AND deleted_at IS NULL`
+
+// now returns q.Now, defaulting to the current time.
+func (q TodoQuery) now() time.Time {
+	if q.Now.IsZero() {
+		return time.Now()
+	}
+	return q.Now
+}
+
+// where renders q as SQL conditions to AND onto a query that already binds
+// args, numbering its own placeholders after them. Both SQL backends accept
+// $n placeholders and compare due_date as a DateLayout string.
+func (q TodoQuery) where(args []any) (string, []any) {
+	arg := func(v any) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	var b strings.Builder
+	b.WriteString(" AND deleted_at IS NULL AND list_id = " + arg(q.ListID))
+	if q.Parent != 0 {
+		b.WriteString(" AND parent_id = " + arg(q.Parent))
+	} else {
+		b.WriteString(" AND parent_id IS NULL")
+	}
+
+	now := q.now()
+	today := now.Format(models.DateLayout)
+	switch q.Filter {
+	case FilterActive:
+		b.WriteString(" AND NOT completed")
+	case FilterCompleted:
+		b.WriteString(" AND completed")
+	case FilterToday:
+		b.WriteString(" AND due_date = " + arg(today))
+	case FilterOverdue:
+		// Timed todos are overdue once their instant passes, all-day ones the day after
+		b.WriteString(" AND NOT completed AND (due_at < " + arg(now.UTC()) +
+			" OR (due_at IS NULL AND due_date < " + arg(today) + "))")
+	case FilterUpcoming:
+		b.WriteString(" AND NOT completed AND due_date > " + arg(today))
+	}
+
+	if q.Tag != "" {
+		b.WriteString(" AND EXISTS (SELECT 1 FROM todo_tags tt JOIN tags t ON t.id = tt.tag_id" +
+			" WHERE tt.todo_id = todos.id AND t.name = " + arg(q.Tag) + ")")
+	}
+	return b.String(), args
+}
+
+// sortKeys returns the SQL expressions q's sort order ranks todos by, most
+// significant first, and whether they descend. Each order runs in a single
+// direction, negating keys where needed, so a row-value comparison can page
+// through it, and ends with the ID so ties come back in a stable order.
+// rank, when set, is a search's ranking expression (lower is better) that
+// takes precedence in the manual order.
+func (q TodoQuery) sortKeys(rank string) (keys []string, desc bool) {
+	switch q.Sort {
+	case SortPriority:
+		return []string{"-priority", "id"}, false
+	case SortCreated:
+		return []string{"created_at", "id"}, true
+	case SortDue:
+		// Todos without a due date sort after every real date
+		return []string{"COALESCE(due_date, '9999-12-31')", "due_time", "id"}, false
+	case SortTitle:
+		return []string{"lower(title)", "id"}, false
+	}
+	if rank != "" {
+		return []string{rank, "position", "id"}, false
+	}
+	return []string{"position", "id"}, false
+}
+
+// cursorQuery tells whether the cursor todo of a page exists, which List
+// asks when a page comes back empty: a purged cursor has no keys to compare,
+// so the keyset condition matches nothing either way.
+const cursorQuery = "SELECT EXISTS (SELECT 1 FROM todos WHERE id = $1 AND user_id = $2)"
+
+// page renders the tail of a todo query that already binds the user ID as
+// $1 and args after it: a keyset condition skipping to the todos after
+// q.After, the ORDER BY clause of sortKeys, and a LIMIT for q.Limit. The
+// cursor todo's keys are looked up in SQL, so no sort values have to be
+// carried between requests.
+func (q TodoQuery) page(rank string, args []any) (string, []any) {
+	keys, desc := q.sortKeys(rank)
+	columns := strings.Join(keys, ", ")
+	cmp, dir := " > ", ""
+	if desc {
+		cmp, dir = " < ", " DESC"
+	}
+
+	var b strings.Builder
+	if q.After != 0 {
+		args = append(args, q.After)
+		b.WriteString(" AND (" + columns + ")" + cmp + "(SELECT " + columns +
+			" FROM todos WHERE id = $" + strconv.Itoa(len(args)) + " AND user_id = $1)")
+	}
+	b.WriteString(" ORDER BY " + strings.Join(keys, dir+", ") + dir)
+	if q.Limit > 0 {
+		b.WriteString(" LIMIT " + strconv.Itoa(q.Limit))
+	}
+	return b.String(), args
+}
+
+// less orders two todos the way sortKeys does, ranking search results like
+// the SQLite store. The in-memory store sorts with it in place of the SQL, and
+// must agree with it.
+func (q TodoQuery) less(a, b models.Todo) bool {
+	if terms := q.terms(); len(terms) > 0 && q.Sort == SortManual {
+		if ra, rb := titleRank(a.Title, terms), titleRank(b.Title, terms); ra != rb {
+			return ra > rb
+		}
+	}
+	switch q.Sort {
+	case SortPriority:
+		if a.Priority != b.Priority {
+			return a.Priority > b.Priority
+		}
+	case SortCreated:
+		if !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.After(b.CreatedAt)
+		}
+		return a.ID > b.ID
+	case SortDue:
+		if (a.Due == nil) != (b.Due == nil) {
+			return b.Due == nil
+		}
+		if a.Due != nil && a.Due.Date != b.Due.Date {
+			return a.Due.Date < b.Due.Date
+		}
+		if a.Due != nil && a.Due.Time != b.Due.Time {
+			return a.Due.Time < b.Due.Time
+		}
+	case SortTitle:
+		if ta, tb := strings.ToLower(a.Title), strings.ToLower(b.Title); ta != tb {
+			return ta < tb
+		}
+	default:
+		if a.Position != b.Position {
+			return a.Position < b.Position
+		}
+	}
+	return a.ID < b.ID
+}
+
+// matches reports whether a todo passes q. The in-memory store uses it in
+// place of the SQL rendered by where, and must agree with it.
+func (q TodoQuery) matches(t models.Todo) bool {
+	if t.DeletedAt != nil || t.ListID != q.ListID || t.ParentID != q.Parent {
+		return false
+	}
+	if q.Tag != "" && !slices.Contains(models.TagNames(t.Tags), q.Tag) {
+		return false
+	}
+	for _, term := range q.terms() {
+		if !strings.Contains(strings.ToLower(t.Title), term) && !strings.Contains(strings.ToLower(t.Notes), term) {
+			return false
+		}
+	}
+
+	now := q.now()
+	today := now.Format(models.DateLayout)
+	switch q.Filter {
+	case FilterActive:
+		return !t.Completed
+	case FilterCompleted:
+		return t.Completed
+	case FilterToday:
+		return t.Due != nil && t.Due.Date == today
+	case FilterOverdue:
+		if t.Completed || t.Due == nil {
+			return false
+		}
+		if at, ok := t.Due.At(); ok {
+			return at.Before(now)
+		}
+		return t.Due.Date < today
+	case FilterUpcoming:
+		return !t.Completed && t.Due != nil && t.Due.Date > today
+	}
+	return true
+}
+
+// dueColumns returns the values stored in the due_date, due_time, due_tz and
+// due_at columns for a due date. due_at holds the instant of timed due dates
+// so the overdue filter can compare it against the current time in SQL.
+func dueColumns(due *models.Due) (date any, clock, tz string, at any) {
+	if due == nil {
+		return nil, "", "", nil
+	}
+	if t, ok := due.At(); ok {
+		at = t.UTC()
+	}
+	return due.Date, due.Time, due.TZ, at
+}
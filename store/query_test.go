@@ -0,0 +1,201 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Tottitov/todo/models"
+)
+
+// queryTodos are todos with ties in every sort order and without due dates,
+// to page through with each of them.
+var queryTodos = []models.Todo{
+	{Title: "Pay rent", Priority: models.PriorityHigh, Due: &models.Due{Date: "2026-10-31"}},
+	{Title: "call Bob", Priority: models.PriorityLow, Tags: []models.Tag{{Name: "home"}}},
+	{Title: "Water plants", Due: &models.Due{Date: "2026-10-17", Time: "09:00", TZ: "UTC"}, Tags: []models.Tag{{Name: "home"}}},
+	{Title: "Call Bob", Priority: models.PriorityHigh, Due: &models.Due{Date: "2026-10-17"}},
+	{Title: "Buy milk", Notes: "Call the shop first", Priority: models.PriorityUrgent},
+	{Title: "File taxes", Priority: models.PriorityHigh, Due: &models.Due{Date: "2026-10-17", Time: "09:00", TZ: "UTC"}},
+	{Title: "Book flights", Due: &models.Due{Date: "2026-10-01"}, Tags: []models.Tag{{Name: "home"}}},
+	{Title: "call bob", Priority: models.PriorityLow},
+	{Title: "Renew passport", Due: &models.Due{Date: "2026-10-17", Time: "18:30", TZ: "UTC"}},
+	{Title: "Clean up", Priority: models.PriorityUrgent},
+}
+
+// queryStore is a store seeded with queryTodos, with the positions of the
+// todos in queryTodos by their ID.
+type queryStore struct {
+	name   string
+	store  Store
+	userID int
+	listID int
+	index  map[int]int
+}
+
+// newQueryStore seeds s with queryTodos, completing every third one and
+// giving the second a subtask.
+func newQueryStore(t *testing.T, name string, s Store) queryStore {
+	t.Helper()
+	ctx := context.Background()
+	user, err := s.CreateUser(ctx, "a@b.c", "hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	list, err := s.DefaultList(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	qs := queryStore{name: name, store: s, userID: user.ID, listID: list.ID, index: map[int]int{}}
+	for i, todo := range queryTodos {
+		todo.ListID = list.ID
+		created, err := s.Create(ctx, user.ID, todo)
+		if err != nil {
+			t.Fatal(err)
+		}
+		qs.index[created.ID] = i
+		if i%3 == 2 {
+			if _, err := s.Toggle(ctx, user.ID, created.ID, false); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if i == 1 {
+			if _, err := s.Create(ctx, user.ID, models.Todo{ParentID: created.ID, Title: "Find his number"}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	return qs
+}
+
+// pages lists the todos q selects a page of limit todos at a time, each
+// after the last of the page before, and returns their positions in
+// queryTodos.
+func (qs queryStore) pages(t *testing.T, q TodoQuery, limit int) []int {
+	t.Helper()
+	q.ListID, q.Limit = qs.listID, limit
+	var got []int
+	for {
+		todos, err := qs.store.List(context.Background(), qs.userID, q)
+		if err != nil {
+			t.Fatalf("%s: %v", qs.name, err)
+		}
+		for _, todo := range todos {
+			got = append(got, qs.index[todo.ID])
+		}
+		if limit == 0 || len(todos) < limit {
+			return got
+		}
+		q.After = todos[len(todos)-1].ID
+	}
+}
+
+// TestListPages pages through every store with every sort order, which
+// have to agree on the order, ties and todos without a due date included,
+// and on which todos the filters select.
+func TestListPages(t *testing.T) {
+	var stores []queryStore
+	for _, s := range testStores(t) {
+		stores = append(stores, newQueryStore(t, s.name, s.store))
+	}
+
+	now := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+	var queries []TodoQuery
+	for _, sort := range Sorts {
+		queries = append(queries,
+			TodoQuery{Sort: sort},
+			TodoQuery{Sort: sort, Filter: FilterActive},
+			TodoQuery{Sort: sort, Filter: FilterOverdue, Now: now},
+			TodoQuery{Sort: sort, Tag: "home"},
+			TodoQuery{Sort: sort, Search: "call"},
+		)
+	}
+	queries = append(queries,
+		TodoQuery{Filter: FilterCompleted},
+		TodoQuery{Filter: FilterToday, Now: now},
+		TodoQuery{Filter: FilterUpcoming, Now: now},
+		TodoQuery{Search: "bob call"},
+	)
+
+	for _, q := range queries {
+		name := fmt.Sprintf("sort %q, filter %q, tag %q, search %q", q.Sort, q.Filter, q.Tag, q.Search)
+		want := stores[0].pages(t, q, 0)
+		if q.Filter == FilterAll && q.Tag == "" && q.Search == "" && len(want) != len(queryTodos) {
+			t.Errorf("%s: listed %v, want every todo", name, want)
+		}
+		for _, qs := range stores {
+			for _, limit := range []int{0, 1, 2, 3, len(queryTodos)} {
+				if got := qs.pages(t, q, limit); !slices.Equal(got, want) {
+					t.Errorf("%s: %s in pages of %d = %v, want %v", name, qs.name, limit, got, want)
+				}
+			}
+		}
+	}
+}
+
+// TestListUnknownCursor checks that paging after a todo in the trash goes
+// on from where it was, and after a purged one fails rather than returning
+// an empty page as if the list had ended.
+func TestListUnknownCursor(t *testing.T) {
+	ctx := context.Background()
+	for _, s := range testStores(t) {
+		qs := newQueryStore(t, s.name, s.store)
+		q := TodoQuery{ListID: qs.listID, Limit: 2}
+		first, err := s.store.List(ctx, qs.userID, q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		q.After = first[1].ID
+		want, err := s.store.List(ctx, qs.userID, q)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := s.store.Delete(ctx, qs.userID, q.After); err != nil {
+			t.Fatal(err)
+		}
+		if got, err := s.store.List(ctx, qs.userID, q); err != nil || len(got) != 2 || got[0].ID != want[0].ID {
+			t.Errorf("%s: page after a todo in the trash = %v, %v, want %v", s.name, got, err, want)
+		}
+		if err := s.store.Purge(ctx, qs.userID, q.After); err != nil {
+			t.Fatal(err)
+		}
+		if got, err := s.store.List(ctx, qs.userID, q); !errors.Is(err, ErrCursor) {
+			t.Errorf("%s: page after a purged todo = %v, %v, want ErrCursor", s.name, got, err)
+		}
+
+		// Another user's todo is no cursor either
+		other, err := s.store.CreateUser(ctx, "other@b.c", "hash")
+		if err != nil {
+			t.Fatal(err)
+		}
+		q.After = first[0].ID
+		if _, err := s.store.List(ctx, other.ID, q); !errors.Is(err, ErrCursor) {
+			t.Errorf("%s: page after another user's todo: %v, want ErrCursor", s.name, err)
+		}
+	}
+}
+
+// TestListOrder checks the orders themselves on the memory store, which
+// TestListPages holds the other stores to.
+func TestListOrder(t *testing.T) {
+	qs := newQueryStore(t, "memory", NewMemoryStore())
+	tests := []struct {
+		sort string
+		want []int
+	}{
+		{SortManual, []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}},
+		{SortPriority, []int{4, 9, 0, 3, 5, 1, 7, 2, 6, 8}},
+		{SortCreated, []int{9, 8, 7, 6, 5, 4, 3, 2, 1, 0}},
+		{SortDue, []int{6, 3, 2, 5, 8, 0, 1, 4, 7, 9}},
+		{SortTitle, []int{6, 4, 1, 3, 7, 9, 5, 0, 8, 2}},
+	}
+	for _, tt := range tests {
+		if got := qs.pages(t, TodoQuery{Sort: tt.sort}, 0); !slices.Equal(got, tt.want) {
+			t.Errorf("sort %q = %v, want %v", tt.sort, got, tt.want)
+		}
+	}
+}
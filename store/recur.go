@@ -0,0 +1,72 @@
+package store
+
+import (
+	"time"
+
+	"github.com/Tottitov/todo/models"
+	"github.com/Tottitov/todo/recur"
+)
+
+// nextOccurrence returns the todo that follows t, a repeating todo being
+// completed at now, and reports false if its rule has run out.
+//
+// The next occurrence is a copy of t, open, with the rule's next date after
+// t's due date as its due date; a todo without one is taken to be due
+// today. Occurrences that have already passed are skipped, so a chore done
+// late is next due today at the earliest rather than on a date long gone.
+// "Today" is the day in the time zone of a timed due date, or in UTC. A
+// rule with a COUNT carries one occurrence less into the copy.
+//
+// Subtasks are not part of the copy; the stores copy them separately.
+func nextOccurrence(t models.Todo, now time.Time) (models.Todo, bool) {
+	rule, err := recur.Parse(t.Recur)
+	if err != nil || rule.Count == 1 {
+		return models.Todo{}, false
+	}
+
+	loc := time.UTC
+	if t.Due != nil && t.Due.TZ != "" {
+		if l, err := time.LoadLocation(t.Due.TZ); err == nil {
+			loc = l
+		}
+	}
+	y, m, d := now.In(loc).Date()
+	today := time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+	start := today
+	if t.Due != nil {
+		if date, err := time.Parse(models.DateLayout, t.Due.Date); err == nil {
+			start = date
+		}
+	}
+	after := start
+	if yesterday := today.AddDate(0, 0, -1); after.Before(yesterday) {
+		after = yesterday
+	}
+	date, ok := rule.Next(start, after)
+	if !ok {
+		return models.Todo{}, false
+	}
+
+	next := t
+	next.ID = 0
+	next.Completed = false
+	next.Subtasks = models.Progress{}
+	next.Match = nil
+	next.Due = &models.Due{Date: date.Format(models.DateLayout)}
+	if t.Due != nil {
+		next.Due.Time, next.Due.TZ = t.Due.Time, t.Due.TZ
+	}
+	if rule.Count > 0 {
+		rule.Count--
+	}
+	next.Recur = rule.String()
+	return next, true
+}
+
+// copySubtasksQuery gives todo $1 open copies of the subtasks of todo $2 of
+// user $3 that aren't in the trash, when a repeating todo is succeeded by its next occurrence. The
+// copies keep their titles, notes, priorities and order. The cast spares
+// Postgres guessing the type of a parameter in a SELECT list.
+const copySubtasksQuery = `INSERT INTO todos (user_id, list_id, parent_id, title, notes, completed, priority, position, created_at)
+	SELECT user_id, list_id, CAST($1 AS INTEGER), title, notes, false, priority, position, CURRENT_TIMESTAMP
+	FROM todos WHERE parent_id = $2 AND user_id = $3 AND deleted_at IS NULL`
@@ -0,0 +1,137 @@
+package store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Tottitov/todo/models"
+)
+
+func TestNextOccurrence(t *testing.T) {
+	noon := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name      string
+		recur     string
+		due       *models.Due
+		now       time.Time
+		wantDue   *models.Due // Nil when the rule has run out
+		wantRecur string
+	}{
+		{
+			name: "weekly", recur: "FREQ=WEEKLY", due: &models.Due{Date: "2026-10-17"}, now: noon,
+			wantDue: &models.Due{Date: "2026-10-24"}, wantRecur: "FREQ=WEEKLY",
+		},
+		{
+			name: "without a due date", recur: "FREQ=DAILY", now: noon,
+			wantDue: &models.Due{Date: "2026-10-18"}, wantRecur: "FREQ=DAILY",
+		},
+		{
+			name: "done late", recur: "FREQ=DAILY", due: &models.Due{Date: "2026-10-01"}, now: noon,
+			wantDue: &models.Due{Date: "2026-10-17"}, wantRecur: "FREQ=DAILY",
+		},
+		{
+			name: "done weeks late", recur: "FREQ=WEEKLY;BYDAY=MO,TH", due: &models.Due{Date: "2026-09-07"}, now: noon,
+			wantDue: &models.Due{Date: "2026-10-19"}, wantRecur: "FREQ=WEEKLY;BYDAY=MO,TH",
+		},
+		{
+			name: "done early", recur: "FREQ=MONTHLY", due: &models.Due{Date: "2026-12-05"}, now: noon,
+			wantDue: &models.Due{Date: "2027-01-05"}, wantRecur: "FREQ=MONTHLY",
+		},
+		{
+			name: "counting down", recur: "FREQ=DAILY;COUNT=3", due: &models.Due{Date: "2026-10-17"}, now: noon,
+			wantDue: &models.Due{Date: "2026-10-18"}, wantRecur: "FREQ=DAILY;COUNT=2",
+		},
+		{
+			name: "last of a count", recur: "FREQ=DAILY;COUNT=1", due: &models.Due{Date: "2026-10-17"}, now: noon,
+		},
+		{
+			name: "before the end", recur: "FREQ=DAILY;UNTIL=20261018", due: &models.Due{Date: "2026-10-17"}, now: noon,
+			wantDue: &models.Due{Date: "2026-10-18"}, wantRecur: "FREQ=DAILY;UNTIL=20261018",
+		},
+		{
+			name: "at the end", recur: "FREQ=DAILY;UNTIL=20261017", due: &models.Due{Date: "2026-10-17"}, now: noon,
+		},
+		{
+			name: "past the end", recur: "FREQ=WEEKLY;UNTIL=20261020", due: &models.Due{Date: "2026-10-01"}, now: noon,
+		},
+		{
+			name: "end of the month", recur: "FREQ=MONTHLY;BYMONTHDAY=-1", due: &models.Due{Date: "2026-10-31"},
+			now:     time.Date(2026, 10, 31, 12, 0, 0, 0, time.UTC),
+			wantDue: &models.Due{Date: "2026-11-30"}, wantRecur: "FREQ=MONTHLY;BYMONTHDAY=-1",
+		},
+		{
+			name: "end of a leap February", recur: "FREQ=MONTHLY;BYMONTHDAY=-1", due: &models.Due{Date: "2028-01-31"},
+			now:     time.Date(2028, 1, 31, 12, 0, 0, 0, time.UTC),
+			wantDue: &models.Due{Date: "2028-02-29"}, wantRecur: "FREQ=MONTHLY;BYMONTHDAY=-1",
+		},
+		{
+			name: "31st, skipping short months", recur: "FREQ=MONTHLY", due: &models.Due{Date: "2026-01-31"},
+			now:     time.Date(2026, 1, 31, 12, 0, 0, 0, time.UTC),
+			wantDue: &models.Due{Date: "2026-03-31"}, wantRecur: "FREQ=MONTHLY",
+		},
+		// Today is the day in the time zone of a timed due date
+		{
+			name: "already tomorrow in Tokyo", recur: "FREQ=DAILY",
+			due:     &models.Due{Date: "2026-10-10", Time: "09:00", TZ: "Asia/Tokyo"},
+			now:     time.Date(2026, 10, 17, 20, 0, 0, 0, time.UTC),
+			wantDue: &models.Due{Date: "2026-10-18", Time: "09:00", TZ: "Asia/Tokyo"}, wantRecur: "FREQ=DAILY",
+		},
+		{
+			name: "still today in UTC", recur: "FREQ=DAILY",
+			due:     &models.Due{Date: "2026-10-10", Time: "09:00", TZ: "UTC"},
+			now:     time.Date(2026, 10, 17, 20, 0, 0, 0, time.UTC),
+			wantDue: &models.Due{Date: "2026-10-17", Time: "09:00", TZ: "UTC"}, wantRecur: "FREQ=DAILY",
+		},
+		{
+			name: "still yesterday in Los Angeles", recur: "FREQ=DAILY",
+			due:     &models.Due{Date: "2026-10-10", Time: "18:00", TZ: "America/Los_Angeles"},
+			now:     time.Date(2026, 10, 18, 3, 0, 0, 0, time.UTC),
+			wantDue: &models.Due{Date: "2026-10-17", Time: "18:00", TZ: "America/Los_Angeles"}, wantRecur: "FREQ=DAILY",
+		},
+		{
+			name: "an invalid rule", recur: "FREQ=HOURLY", due: &models.Due{Date: "2026-10-17"}, now: noon,
+		},
+	}
+	for _, tt := range tests {
+		todo := models.Todo{
+			ID:        7,
+			ListID:    2,
+			Title:     "Water plants",
+			Notes:     "The ferns too",
+			Completed: true,
+			Priority:  models.PriorityHigh,
+			Due:       tt.due,
+			Tags:      []models.Tag{{ID: 1, Name: "home"}},
+			Recur:     tt.recur,
+			Position:  "a0",
+			Subtasks:  models.Progress{Done: 1, Total: 2},
+		}
+		next, ok := nextOccurrence(todo, tt.now)
+		if tt.wantDue == nil {
+			if ok {
+				t.Errorf("%s: next occurrence %+v, want none", tt.name, next.Due)
+			}
+			continue
+		}
+		if !ok {
+			t.Errorf("%s: no next occurrence, want one due %+v", tt.name, *tt.wantDue)
+			continue
+		}
+		if next.Due == nil || *next.Due != *tt.wantDue {
+			t.Errorf("%s: next due %+v, want %+v", tt.name, next.Due, *tt.wantDue)
+		}
+		if next.Recur != tt.wantRecur {
+			t.Errorf("%s: next recur %q, want %q", tt.name, next.Recur, tt.wantRecur)
+		}
+		if next.ID != 0 || next.Completed || next.Subtasks != (models.Progress{}) {
+			t.Errorf("%s: next occurrence %+v, want it new and open, without subtasks", tt.name, next)
+		}
+		if next.Title != todo.Title || next.Notes != todo.Notes || next.Priority != todo.Priority ||
+			next.ListID != todo.ListID || next.Position != todo.Position || len(next.Tags) != 1 {
+			t.Errorf("%s: next occurrence %+v, want a copy of %+v", tt.name, next, todo)
+		}
+		if tt.due != nil && next.Due == tt.due {
+			t.Errorf("%s: the next occurrence shares its due date with the todo", tt.name)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package store
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/Tottitov/todo/models"
+)
+
+// pgHeadlineOptions makes ts_headline mark every match in the whole text
+// with the models.Match markers instead of HTML tags.
+const pgHeadlineOptions = "StartSel=" + models.MatchStart + ", StopSel=" + models.MatchEnd + ", HighlightAll=true"
+
+// terms splits q's search into lower-case words, dropping punctuation so the
+// words are safe to embed in a tsquery or a LIKE pattern.
+func (q TodoQuery) terms() []string {
+	return strings.FieldsFunc(strings.ToLower(q.Search), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// pgSearch renders q's search for Postgres' full-text search over the
+// generated search column: extra columns with the title and notes
+// highlighted by ts_headline, a condition to AND onto the query, and a rank
+// for sortKeys putting the best matches first. Every word is matched as a
+// prefix so results appear while the user is still typing. It returns ok
+// false when q doesn't search.
+func (q TodoQuery) pgSearch(args []any) (columns, where, rank string, _ []any, ok bool) {
+	terms := q.terms()
+	if len(terms) == 0 {
+		return "", "", "", args, false
+	}
+	for i, term := range terms {
+		terms[i] = term + ":*"
+	}
+	args = append(args, strings.Join(terms, " & "), pgHeadlineOptions)
+	query := "to_tsquery('english', $" + strconv.Itoa(len(args)-1) + ")"
+	options := "$" + strconv.Itoa(len(args))
+
+	columns = ", ts_headline('english', title, " + query + ", " + options + ")" +
+		", ts_headline('english', notes, " + query + ", " + options + ")"
+	where = " AND search @@ " + query
+	rank = "-ts_rank(search, " + query + ")"
+	return columns, where, rank, args, true
+}
+
+// sqliteSearch renders q's search for SQLite, which has no full-text index
+// here: every word must appear in the title or notes, and todos with more of
+// the words in their title rank first. Matches are highlighted in Go with
+// highlight. It returns ok false when q doesn't search.
+func (q TodoQuery) sqliteSearch(args []any) (where, rank string, _ []any, ok bool) {
+	terms := q.terms()
+	if len(terms) == 0 {
+		return "", "", args, false
+	}
+	var w, r strings.Builder
+	for _, term := range terms {
+		args = append(args, "%"+term+"%")
+		n := "$" + strconv.Itoa(len(args))
+		w.WriteString(" AND (title LIKE " + n + " OR notes LIKE " + n + ")")
+		r.WriteString(" - (title LIKE " + n + ")")
+	}
+	return w.String(), "0" + r.String(), args, true
+}
+
+// highlight sets t.Match by marking every occurrence of q's search words in
+// its title and notes, for the stores without ts_headline.
+func (q TodoQuery) highlight(t *models.Todo) {
+	terms := q.terms()
+	t.Match = &models.Match{Title: markTerms(t.Title, terms), Notes: markTerms(t.Notes, terms)}
+}
+
+// markTerms wraps every case-insensitive occurrence of the terms in text
+// with the models.Match markers.
+func markTerms(text string, terms []string) string {
+	var b strings.Builder
+	for i := 0; i < len(text); {
+		end := 0
+		for _, term := range terms {
+			if j := i + len(term); j <= len(text) && j > end && strings.EqualFold(text[i:j], term) {
+				end = j
+			}
+		}
+		if end > 0 {
+			b.WriteString(models.MatchStart + text[i:end] + models.MatchEnd)
+			i = end
+			continue
+		}
+		_, size := utf8.DecodeRuneInString(text[i:])
+		b.WriteString(text[i : i+size])
+		i += size
+	}
+	return b.String()
+}
+
+// titleRank counts how many of the terms appear in title, the rank the
+// SQLite and in-memory stores order search results by.
+func titleRank(title string, terms []string) int {
+	title = strings.ToLower(title)
+	n := 0
+	for _, term := range terms {
+		if strings.Contains(title, term) {
+			n++
+		}
+	}
+	return n
+}
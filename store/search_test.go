@@ -0,0 +1,83 @@
+package store
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/Tottitov/todo/models"
+)
+
+func TestMarkTerms(t *testing.T) {
+	q := TodoQuery{Search: "  MILK, buy!"}
+	if got := q.terms(); !slices.Equal(got, []string{"milk", "buy"}) {
+		t.Errorf("terms = %q", got)
+	}
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"Buy milk", "\x02Buy\x03 \x02milk\x03"},
+		{"Buttermilk, café", "Butter\x02milk\x03, café"},
+		{"Call mom", "Call mom"},
+	}
+	for _, tt := range tests {
+		if got := markTerms(tt.text, q.terms()); got != tt.want {
+			t.Errorf("markTerms(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+// TestStoreSearch searches titles and notes on every backend, which have to
+// agree on what matches, rank title matches first and mark the matches.
+func TestStoreSearch(t *testing.T) {
+	ctx := context.Background()
+	for _, ns := range testStores(t) {
+		s := ns.store
+		user, list := testUser(t, s, "a@example.com")
+		for _, todo := range []models.Todo{
+			{Title: "Call mom", Notes: "Ask about the milk"},
+			{Title: "Buy milk"},
+			{Title: "Buy bread"},
+		} {
+			todo.ListID = list.ID
+			if _, err := s.Create(ctx, user.ID, todo); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		tests := []struct {
+			search string
+			want   []string
+		}{
+			{"milk", []string{"Buy milk", "Call mom"}},
+			{"MILK buy", []string{"Buy milk"}},
+			{"milk bread", nil},
+			{"sugar", nil},
+		}
+		for _, tt := range tests {
+			todos, err := s.List(ctx, user.ID, TodoQuery{ListID: list.ID, Search: tt.search})
+			if err != nil {
+				t.Fatalf("%s: %v", ns.name, err)
+			}
+			var got []string
+			for _, todo := range todos {
+				got = append(got, todo.Title)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("%s: search %q = %v, want %v", ns.name, tt.search, got, tt.want)
+			}
+		}
+
+		todos, err := s.List(ctx, user.ID, TodoQuery{ListID: list.ID, Search: "milk"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m := todos[0].Match; m == nil || m.Title != "Buy \x02milk\x03" {
+			t.Errorf("%s: title match %+v", ns.name, m)
+		}
+		if m := todos[1].Match; m == nil || m.Title != "Call mom" || m.Notes != "Ask about the \x02milk\x03" {
+			t.Errorf("%s: notes match %+v", ns.name, m)
+		}
+	}
+}
@@ -0,0 +1,490 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/Tottitov/todo/migrate"
+	"github.com/Tottitov/todo/models"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// SQLiteStore is a Store backed by an embedded SQLite database file.
+// It needs no external services, which makes it suitable for laptops and
+// single-binary, self-hosted deployments.
+//
+// Timestamps are stored as UTC text in DATETIME columns, which the driver
+// parses back into time.Time and which compare correctly as strings.
+type SQLiteStore struct {
+	db *sql.DB
+}
+
+// NewSQLiteStore opens (creating if necessary) the SQLite database at path.
+// The special path ":memory:" gives a private in-memory database.
+func NewSQLiteStore(ctx context.Context, path string) (*SQLiteStore, error) {
+	db, err := sql.Open("sqlite", sqliteDSN(path))
+	if err != nil {
+		return nil, err
+	}
+	if path == ":memory:" {
+		// Every connection to :memory: is a separate database, so pin the pool to one
+		db.SetMaxOpenConns(1)
+	}
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &SQLiteStore{db: db}, nil
+}
+
+// sqliteDSN appends the pragmas every connection needs: foreign keys on, a busy
+// timeout instead of immediate SQLITE_BUSY errors, WAL so readers don't block
+// the writer, immediate transactions so write locks are taken up front, and a
+// sortable time format.
+func sqliteDSN(path string) string {
+	sep := "?"
+	if strings.Contains(path, "?") {
+		sep = "&"
+	}
+	return path + sep + "_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_txlock=immediate&_time_format=sqlite"
+}
+
+// Migrator returns a migrator for this database's schema.
+func (s *SQLiteStore) Migrator() (*migrate.Migrator, error) {
+	migrations, err := migrate.SQLiteMigrations()
+	if err != nil {
+		return nil, err
+	}
+	return migrate.New(migrate.NewSQLiteDriver(s.db), migrations), nil
+}
+
+// sqliteTodoColumns selects todoFields followed by the todo's tags, as a JSON
+// array ordered by name, for scanTodo.
+const sqliteTodoColumns = todoFields + `, (
+	SELECT json_group_array(json_object('id', id, 'name', name, 'color', color))
+	FROM (SELECT t.id, t.name, t.color FROM todo_tags tt JOIN tags t ON t.id = tt.tag_id
+		WHERE tt.todo_id = todos.id ORDER BY t.name))`
+
+// List returns the todos in one of the user's lists that pass the query's
+// filter, in the query's sort order. Searches match words with LIKE.
+func (s *SQLiteStore) List(ctx context.Context, userID int, q TodoQuery) ([]models.Todo, error) {
+	where, args := q.where([]any{userID})
+	searchWhere, rank, args, searching := q.sqliteSearch(args)
+	page, args := q.page(rank, args)
+	rows, err := s.db.QueryContext(ctx,
+		"SELECT "+sqliteTodoColumns+" FROM todos WHERE user_id = $1"+where+searchWhere+page, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	// Scan rows into todo structs, marking the matches of search hits
+	var todos []models.Todo
+	for rows.Next() {
+		t, err := scanTodo(rows)
+		if err != nil {
+			return nil, err
+		}
+		if searching {
+			q.highlight(&t)
+		}
+		todos = append(todos, t)
+	}
+	if err := rows.Err(); err != nil || len(todos) > 0 || q.After == 0 {
+		return todos, err
+	}
+	var found bool
+	if err := s.db.QueryRowContext(ctx, cursorQuery, q.After, userID).Scan(&found); err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, ErrCursor
+	}
+	return nil, nil
+}
+
+// Counts tallies the active and completed todos in one of the user's lists.
+func (s *SQLiteStore) Counts(ctx context.Context, userID, listID int) (TodoCounts, error) {
+	var c TodoCounts
+	err := s.db.QueryRowContext(ctx, countsQuery, userID, listID).Scan(&c.Active, &c.Completed)
+	return c, err
+}
+
+// Get returns the todo with the given ID.
+func (s *SQLiteStore) Get(ctx context.Context, userID, id int) (models.Todo, error) {
+	t, err := scanTodo(s.db.QueryRowContext(ctx,
+		"SELECT "+sqliteTodoColumns+" FROM todos WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL", id, userID))
+	return t, sqlNotFound(err)
+}
+
+// Create inserts a new todo at the end of its list and tags it in one
+// transaction. Looking up the list's end yields ErrNotFound for foreign lists.
+func (s *SQLiteStore) Create(ctx context.Context, userID int, todo models.Todo) (models.Todo, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.Todo{}, err
+	}
+	defer tx.Rollback()
+
+	// Subtasks go into their parent's list
+	if todo.ParentID != 0 {
+		var nested bool
+		if err := tx.QueryRowContext(ctx, parentQuery, todo.ParentID, userID).Scan(&todo.ListID, &nested); err != nil {
+			return models.Todo{}, sqlNotFound(err)
+		}
+		if nested {
+			return models.Todo{}, ErrNested
+		}
+	}
+	position, err := sqliteEndPosition(ctx, tx, userID, todo.ListID)
+	if err != nil {
+		return models.Todo{}, err
+	}
+
+	id, err := sqliteInsertTodo(ctx, tx, userID, todo, position)
+	if err != nil {
+		return models.Todo{}, err
+	}
+
+	t, err := scanTodo(tx.QueryRowContext(ctx, "SELECT "+sqliteTodoColumns+" FROM todos WHERE id = $1", id))
+	if err != nil {
+		return models.Todo{}, err
+	}
+	return t, tx.Commit()
+}
+
+// sqliteInsertTodo inserts a todo at the given position, tags it and logs
+// its creation, returning its ID. The todo's list, and parent if any, must be the user's.
+func sqliteInsertTodo(ctx context.Context, tx *sql.Tx, userID int, todo models.Todo, position string) (int, error) {
+	var id int
+	dueDate, dueTime, dueTZ, dueAt := dueColumns(todo.Due)
+	err := tx.QueryRowContext(ctx,
+		`INSERT INTO todos (user_id, list_id, parent_id, title, notes, completed, priority, due_date, due_time, due_tz, due_at, recur, position, created_at)
+		VALUES ($1, $2, NULLIF($3, 0), $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+		RETURNING id`,
+		userID, todo.ListID, todo.ParentID, todo.Title, todo.Notes, todo.Completed, int(todo.Priority), dueDate, dueTime, dueTZ, dueAt, todo.Recur, position, time.Now().UTC()).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+	if err := sqliteSetTags(ctx, tx, userID, id, models.TagNames(todo.Tags)); err != nil {
+		return 0, err
+	}
+	return id, sqliteLog(ctx, tx, eventQuery, id, userID, models.ActionCreated, "", "")
+}
+
+// UpdateTitle changes the title of the todo with the given ID, logging the
+// change in the same transaction.
+func (s *SQLiteStore) UpdateTitle(ctx context.Context, userID, id int, title string) (models.Todo, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.Todo{}, err
+	}
+	defer tx.Rollback()
+
+	var was string
+	if err := tx.QueryRowContext(ctx, "SELECT title FROM todos WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL", id, userID).Scan(&was); err != nil {
+		return models.Todo{}, sqlNotFound(err)
+	}
+	t, err := scanTodo(tx.QueryRowContext(ctx,
+		"UPDATE todos SET title = $1 WHERE id = $2 RETURNING "+sqliteTodoColumns, title, id))
+	if err != nil {
+		return models.Todo{}, err
+	}
+	if title != was {
+		if err := sqliteLog(ctx, tx, eventQuery, id, userID, models.ActionTitleChanged, was, title); err != nil {
+			return models.Todo{}, err
+		}
+	}
+	return t, tx.Commit()
+}
+
+// SetDue sets or clears the due date of the todo with the given ID.
+func (s *SQLiteStore) SetDue(ctx context.Context, userID, id int, due *models.Due) (models.Todo, error) {
+	dueDate, dueTime, dueTZ, dueAt := dueColumns(due)
+	t, err := scanTodo(s.db.QueryRowContext(ctx,
+		`UPDATE todos SET due_date = $1, due_time = $2, due_tz = $3, due_at = $4
+		WHERE id = $5 AND user_id = $6 AND deleted_at IS NULL RETURNING `+sqliteTodoColumns,
+		dueDate, dueTime, dueTZ, dueAt, id, userID))
+	return t, sqlNotFound(err)
+}
+
+// SetNotes replaces the notes of the todo with the given ID.
+func (s *SQLiteStore) SetNotes(ctx context.Context, userID, id int, notes string) (models.Todo, error) {
+	t, err := scanTodo(s.db.QueryRowContext(ctx,
+		"UPDATE todos SET notes = $1 WHERE id = $2 AND user_id = $3 AND deleted_at IS NULL RETURNING "+sqliteTodoColumns,
+		notes, id, userID))
+	return t, sqlNotFound(err)
+}
+
+// SetPriority changes the priority of the todo with the given ID.
+func (s *SQLiteStore) SetPriority(ctx context.Context, userID, id int, priority models.Priority) (models.Todo, error) {
+	t, err := scanTodo(s.db.QueryRowContext(ctx,
+		"UPDATE todos SET priority = $1 WHERE id = $2 AND user_id = $3 AND deleted_at IS NULL RETURNING "+sqliteTodoColumns,
+		int(priority), id, userID))
+	return t, sqlNotFound(err)
+}
+
+// SetRecur sets or clears the recurrence rule of the todo with the given ID.
+func (s *SQLiteStore) SetRecur(ctx context.Context, userID, id int, rule string) (models.Todo, error) {
+	t, err := scanTodo(s.db.QueryRowContext(ctx,
+		"UPDATE todos SET recur = $1 WHERE id = $2 AND user_id = $3 AND deleted_at IS NULL RETURNING "+sqliteTodoColumns,
+		rule, id, userID))
+	return t, sqlNotFound(err)
+}
+
+// Update applies a patch to the todo with the given ID in one transaction.
+func (s *SQLiteStore) Update(ctx context.Context, userID, id int, p TodoPatch) (models.Todo, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.Todo{}, err
+	}
+	defer tx.Rollback()
+
+	t, err := patchTodo(sqliteImport{ctx, tx, userID}, id, p)
+	if err != nil {
+		return models.Todo{}, err
+	}
+	return t, tx.Commit()
+}
+
+// Toggle flips the completion status of the todo with the given ID.
+func (s *SQLiteStore) Toggle(ctx context.Context, userID, id int, cascade bool) (models.Todo, error) {
+	return s.complete(ctx, userID, id, nil, cascade)
+}
+
+// SetCompleted sets the completion status of the todo with the given ID.
+func (s *SQLiteStore) SetCompleted(ctx context.Context, userID, id int, completed, cascade bool) (models.Todo, error) {
+	return s.complete(ctx, userID, id, &completed, cascade)
+}
+
+// complete sets the completion status of a todo to completed, or flips it
+// if completed is nil, and with cascade completes the open subtasks of a
+// todo that ends up completed, all in one transaction with the events
+// logging it. Completing a repeating todo creates its next occurrence in the
+// same transaction.
+func (s *SQLiteStore) complete(ctx context.Context, userID, id int, completed *bool, cascade bool) (models.Todo, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.Todo{}, err
+	}
+	defer tx.Rollback()
+
+	var was, done bool
+	if err := tx.QueryRowContext(ctx, "SELECT completed FROM todos WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL", id, userID).Scan(&was); err != nil {
+		return models.Todo{}, sqlNotFound(err)
+	}
+	err = tx.QueryRowContext(ctx,
+		"UPDATE todos SET completed = COALESCE($1, NOT completed) WHERE id = $2 RETURNING completed",
+		completed, id).Scan(&done)
+	if err != nil {
+		return models.Todo{}, err
+	}
+	if done != was {
+		if err := sqliteLog(ctx, tx, eventQuery, id, userID, completionAction(done), "", ""); err != nil {
+			return models.Todo{}, err
+		}
+	}
+	if cascade && done {
+		if err := sqliteLog(ctx, tx, openSubtaskEventsQuery, id, userID, models.ActionCompleted, "", ""); err != nil {
+			return models.Todo{}, err
+		}
+		if _, err := tx.ExecContext(ctx, completeSubtasksQuery, id, userID); err != nil {
+			return models.Todo{}, err
+		}
+	}
+
+	t, err := scanTodo(tx.QueryRowContext(ctx, "SELECT "+sqliteTodoColumns+" FROM todos WHERE id = $1", id))
+	if err != nil {
+		return models.Todo{}, err
+	}
+	if done && !was && t.Recur != "" {
+		if t.NextID, err = sqliteRepeat(ctx, tx, userID, t); err != nil {
+			return models.Todo{}, err
+		}
+		t.Recur = ""
+	}
+	return t, tx.Commit()
+}
+
+// Untoggle takes back a toggle in one transaction with the events logging
+// it.
+func (s *SQLiteStore) Untoggle(ctx context.Context, userID int, u ToggleUndo) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var was bool
+	if err := tx.QueryRowContext(ctx, "SELECT completed FROM todos WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL", u.ID, userID).Scan(&was); err != nil {
+		return sqlNotFound(err)
+	}
+	if u.NextID != 0 {
+		if err := sqliteLog(ctx, tx, deleteEventsQuery, u.NextID, userID, models.ActionDeleted, "", ""); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, dropTodoQuery, u.NextID, userID); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, untoggleQuery, u.ID, userID, u.Completed, u.Recur); err != nil {
+		return err
+	}
+	if u.Completed != was {
+		if err := sqliteLog(ctx, tx, eventQuery, u.ID, userID, completionAction(u.Completed), "", ""); err != nil {
+			return err
+		}
+	}
+	for _, id := range u.Reopen {
+		if err := sqliteLog(ctx, tx, reopenEventsQuery, id, userID, models.ActionUncompleted, "", ""); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, reopenQuery, id, userID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// sqliteRepeat creates the next occurrence of t, a repeating todo that was
+// just completed, directly after it, and clears t's rule so that only the
+// new occurrence carries the series on. It returns the ID of the new
+// occurrence, or 0 if the rule has run out.
+func sqliteRepeat(ctx context.Context, tx *sql.Tx, userID int, t models.Todo) (int, error) {
+	if _, err := tx.ExecContext(ctx, "UPDATE todos SET recur = '' WHERE id = $1", t.ID); err != nil {
+		return 0, err
+	}
+	next, ok := nextOccurrence(t, time.Now())
+	if !ok {
+		return 0, nil
+	}
+
+	var following string
+	if err := tx.QueryRowContext(ctx, nextPositionQuery, t.ListID, t.ParentID, t.Position, t.ID).Scan(&following); err != nil {
+		return 0, err
+	}
+	position, err := positionBetween(t.Position, following)
+	if err != nil {
+		return 0, err
+	}
+	nextID, err := sqliteInsertTodo(ctx, tx, userID, next, position)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := tx.ExecContext(ctx, copySubtasksQuery, nextID, t.ID, userID); err != nil {
+		return 0, err
+	}
+	return nextID, sqliteLog(ctx, tx, subtaskEventsQuery, nextID, userID, models.ActionCreated, "", "")
+}
+
+// Delete moves the todo with the given ID and its subtasks to the trash,
+// logging each in the same transaction.
+func (s *SQLiteStore) Delete(ctx context.Context, userID, id int) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := sqliteLog(ctx, tx, deleteEventsQuery, id, userID, models.ActionDeleted, "", ""); err != nil {
+		return err
+	}
+	res, err := tx.ExecContext(ctx, deleteQuery, id, userID, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return tx.Commit()
+}
+
+// Move puts the todo at the end of another of the user's lists.
+func (s *SQLiteStore) Move(ctx context.Context, userID, id, listID int) (models.Todo, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.Todo{}, err
+	}
+	defer tx.Rollback()
+
+	position, err := sqliteEndPosition(ctx, tx, userID, listID)
+	if err != nil {
+		return models.Todo{}, err
+	}
+	if _, err := tx.ExecContext(ctx, moveSubtasksQuery, listID, id, userID); err != nil {
+		return models.Todo{}, err
+	}
+	t, err := scanTodo(tx.QueryRowContext(ctx,
+		`UPDATE todos SET list_id = $1, parent_id = NULL, position = $2 WHERE id = $3 AND user_id = $4 AND deleted_at IS NULL
+		RETURNING `+sqliteTodoColumns,
+		listID, position, id, userID))
+	if err != nil {
+		return models.Todo{}, sqlNotFound(err)
+	}
+	return t, tx.Commit()
+}
+
+// DeleteCompleted moves all completed todos in one of the user's lists, and
+// every subtask of the completed ones, to the trash at the same time, and
+// logs each.
+func (s *SQLiteStore) DeleteCompleted(ctx context.Context, userID, listID int) ([]int, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	var ids []int
+	for _, query := range []string{deleteCompletedSubtasksQuery, deleteCompletedQuery} {
+		rows, err := tx.QueryContext(ctx, query+" RETURNING id", userID, listID, now)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var id int
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			ids = append(ids, id)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+	for _, id := range ids {
+		if err := sqliteLog(ctx, tx, eventQuery, id, userID, models.ActionDeleted, "", ""); err != nil {
+			return nil, err
+		}
+	}
+	return ids, tx.Commit()
+}
+
+// Close closes the underlying database handle.
+func (s *SQLiteStore) Close() {
+	s.db.Close()
+}
+
+// sqlNotFound translates database/sql's no-rows error into ErrNotFound.
+func sqlNotFound(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// isSQLiteUniqueViolation reports whether err is a SQLite UNIQUE constraint failure.
+func isSQLiteUniqueViolation(err error) bool {
+	var sqliteErr *sqlite.Error
+	return errors.As(err, &sqliteErr) && sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE
+}
@@ -0,0 +1,83 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/Tottitov/todo/models"
+)
+
+// Events returns the events on the user's todos that pass the query.
+func (s *SQLiteStore) Events(ctx context.Context, userID int, q EventQuery) ([]models.Event, error) {
+	where, args := q.where([]any{userID}, sqliteTimestamp)
+	rows, err := s.db.QueryContext(ctx, "SELECT "+eventColumns+eventsFrom+" WHERE e.user_id = $1"+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []models.Event
+	for rows.Next() {
+		e, err := scanEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+// Actors returns the users who have changed the user's todos.
+func (s *SQLiteStore) Actors(ctx context.Context, userID int) ([]models.User, error) {
+	rows, err := s.db.QueryContext(ctx, actorsQuery, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []models.User
+	for rows.Next() {
+		u, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
+
+// Completions returns when each completed todo of the user was last completed.
+func (s *SQLiteStore) Completions(ctx context.Context, userID int) (map[int]time.Time, error) {
+	rows, err := s.db.QueryContext(ctx, completionsQuery, userID, string(models.ActionCompleted))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	// The column type is lost to MAX, so the timestamp comes back as text
+	completed := map[int]time.Time{}
+	for rows.Next() {
+		var id int
+		var at string
+		if err := rows.Scan(&id, &at); err != nil {
+			return nil, err
+		}
+		if completed[id], err = time.Parse(time.DateTime, at); err != nil {
+			return nil, err
+		}
+	}
+	return completed, rows.Err()
+}
+
+// sqliteTimestamp formats t like CURRENT_TIMESTAMP, which stamps events, so
+// that the two compare correctly as strings.
+func sqliteTimestamp(t time.Time) any {
+	return t.UTC().Format(time.DateTime)
+}
+
+// sqliteLog runs one of the statements logging events within tx.
+func sqliteLog(ctx context.Context, tx *sql.Tx, query string, id, userID int, action models.Action, from, to string) error {
+	_, err := tx.ExecContext(ctx, query, id, userID, string(action), from, to)
+	return err
+}
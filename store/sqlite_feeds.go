@@ -0,0 +1,34 @@
+package store
+
+import (
+	"context"
+	"time"
+)
+
+// SetFeedToken gives the user a feed token, replacing the one they had.
+func (s *SQLiteStore) SetFeedToken(ctx context.Context, userID int, tokenHash string) error {
+	_, err := s.db.ExecContext(ctx, setFeedQuery, tokenHash, userID, time.Now().UTC())
+	return err
+}
+
+// FeedCreated returns when the user's feed token was made.
+func (s *SQLiteStore) FeedCreated(ctx context.Context, userID int) (time.Time, error) {
+	var created time.Time
+	err := s.db.QueryRowContext(ctx,
+		"SELECT created_at FROM feed_tokens WHERE user_id = $1", userID).Scan(&created)
+	return created, sqlNotFound(err)
+}
+
+// FeedUser returns the ID of the user with the given feed token hash.
+func (s *SQLiteStore) FeedUser(ctx context.Context, tokenHash string) (int, error) {
+	var userID int
+	err := s.db.QueryRowContext(ctx,
+		"SELECT user_id FROM feed_tokens WHERE token_hash = $1", tokenHash).Scan(&userID)
+	return userID, sqlNotFound(err)
+}
+
+// DeleteFeedToken turns the user's feed off.
+func (s *SQLiteStore) DeleteFeedToken(ctx context.Context, userID int) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM feed_tokens WHERE user_id = $1", userID)
+	return err
+}
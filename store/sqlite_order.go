@@ -0,0 +1,81 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/Tottitov/todo/models"
+)
+
+// Reorder places a todo between two of its neighbours in one transaction,
+// updating only the moved todo's position.
+func (s *SQLiteStore) Reorder(ctx context.Context, userID, id, afterID, beforeID int) (models.Todo, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.Todo{}, err
+	}
+	defer tx.Rollback()
+
+	// Find the todo's list; the immediate transaction keeps concurrent moves out
+	var listID, parentID int
+	err = tx.QueryRowContext(ctx, "SELECT list_id, COALESCE(parent_id, 0) FROM todos WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL", id, userID).Scan(&listID, &parentID)
+	if err != nil {
+		return models.Todo{}, sqlNotFound(err)
+	}
+
+	// Read the neighbours' positions; they must be siblings of the todo
+	var prev, next string
+	for _, n := range []struct {
+		id  int
+		pos *string
+	}{{afterID, &prev}, {beforeID, &next}} {
+		if n.id == 0 {
+			continue
+		}
+		if n.id == id {
+			return models.Todo{}, ErrOutOfOrder
+		}
+		err := tx.QueryRowContext(ctx, neighbourQuery, listID, parentID, n.id, userID).Scan(n.pos)
+		if err != nil {
+			return models.Todo{}, sqlNotFound(err)
+		}
+	}
+
+	// Fill in a neighbour that wasn't given from the list itself; with
+	// neither given, the todo goes before the current first one
+	switch {
+	case beforeID == 0:
+		err = tx.QueryRowContext(ctx, nextPositionQuery, listID, parentID, prev, id).Scan(&next)
+	case afterID == 0:
+		err = tx.QueryRowContext(ctx, prevPositionQuery, listID, parentID, next, id).Scan(&prev)
+	}
+	if err != nil {
+		return models.Todo{}, err
+	}
+	pos, err := positionBetween(prev, next)
+	if err != nil {
+		return models.Todo{}, err
+	}
+
+	t, err := scanTodo(tx.QueryRowContext(ctx,
+		"UPDATE todos SET position = $1 WHERE id = $2 RETURNING "+sqliteTodoColumns, pos, id))
+	if err != nil {
+		return models.Todo{}, err
+	}
+	return t, tx.Commit()
+}
+
+// sqliteEndPosition returns the position following the last todo of one of
+// the user's lists within tx, or ErrNotFound for lists that aren't the
+// user's. Transactions are immediate, so nothing else can take the position
+// before tx ends.
+func sqliteEndPosition(ctx context.Context, tx *sql.Tx, userID, listID int) (string, error) {
+	var last string
+	err := tx.QueryRowContext(ctx,
+		`SELECT COALESCE((SELECT max(position) FROM todos WHERE list_id = lists.id), '')
+		FROM lists WHERE id = $1 AND user_id = $2`, listID, userID).Scan(&last)
+	if err != nil {
+		return "", sqlNotFound(err)
+	}
+	return positionBetween(last, "")
+}
@@ -0,0 +1,134 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/Tottitov/todo/models"
+)
+
+// SetTags replaces the todo's tags in one transaction.
+func (s *SQLiteStore) SetTags(ctx context.Context, userID, id int, names []string) (models.Todo, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.Todo{}, err
+	}
+	defer tx.Rollback()
+
+	// Check that the todo is the user's; the immediate transaction already holds the write lock
+	var one int
+	err = tx.QueryRowContext(ctx, "SELECT 1 FROM todos WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL", id, userID).Scan(&one)
+	if err != nil {
+		return models.Todo{}, sqlNotFound(err)
+	}
+	if err := sqliteSetTags(ctx, tx, userID, id, names); err != nil {
+		return models.Todo{}, err
+	}
+
+	t, err := scanTodo(tx.QueryRowContext(ctx, "SELECT "+sqliteTodoColumns+" FROM todos WHERE id = $1", id))
+	if err != nil {
+		return models.Todo{}, err
+	}
+	return t, tx.Commit()
+}
+
+// sqliteSetTags replaces the tags of a todo within tx, creating any of the
+// named tags the user doesn't have yet.
+func sqliteSetTags(ctx context.Context, tx *sql.Tx, userID, todoID int, names []string) error {
+	if _, err := tx.ExecContext(ctx, "DELETE FROM todo_tags WHERE todo_id = $1", todoID); err != nil {
+		return err
+	}
+	for _, name := range names {
+		_, err := tx.ExecContext(ctx,
+			"INSERT INTO tags (user_id, name) VALUES ($1, $2) ON CONFLICT (user_id, name) DO NOTHING",
+			userID, name)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx,
+			"INSERT INTO todo_tags (todo_id, tag_id) SELECT $1, id FROM tags WHERE user_id = $2 AND name = $3",
+			todoID, userID, name)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Tags returns the user's tags ordered by name, with how many todos carry each.
+func (s *SQLiteStore) Tags(ctx context.Context, userID int) ([]models.Tag, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT id, name, color, (SELECT count(*) FROM todo_tags JOIN todos ON todos.id = todo_tags.todo_id
+			WHERE todo_tags.tag_id = tags.id AND todos.deleted_at IS NULL)
+		FROM tags WHERE user_id = $1 ORDER BY name`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tags []models.Tag
+	for rows.Next() {
+		var t models.Tag
+		if err := rows.Scan(&t.ID, &t.Name, &t.Color, &t.Count); err != nil {
+			return nil, err
+		}
+		tags = append(tags, t)
+	}
+	return tags, rows.Err()
+}
+
+// UpdateTag renames and recolors one of the user's tags.
+func (s *SQLiteStore) UpdateTag(ctx context.Context, userID, id int, name, color string) (models.Tag, error) {
+	var t models.Tag
+	err := s.db.QueryRowContext(ctx,
+		"UPDATE tags SET name = $1, color = $2 WHERE id = $3 AND user_id = $4 RETURNING id, name, color",
+		name, color, id, userID).Scan(&t.ID, &t.Name, &t.Color)
+	if isSQLiteUniqueViolation(err) {
+		return models.Tag{}, ErrTagExists
+	}
+	return t, sqlNotFound(err)
+}
+
+// MergeTag retags every todo carrying fromID with intoID, then deletes fromID.
+func (s *SQLiteStore) MergeTag(ctx context.Context, userID, fromID, intoID int) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Both tags must be the user's, and distinct
+	var n int
+	err = tx.QueryRowContext(ctx, "SELECT count(*) FROM tags WHERE user_id = $1 AND id IN ($2, $3)",
+		userID, fromID, intoID).Scan(&n)
+	if err != nil {
+		return err
+	}
+	if n != 2 {
+		return ErrNotFound
+	}
+
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO todo_tags (todo_id, tag_id) SELECT todo_id, $2 FROM todo_tags WHERE tag_id = $1
+		ON CONFLICT DO NOTHING`, fromID, intoID)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM tags WHERE id = $1", fromID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// DeleteTag deletes one of the user's tags; its todo_tags rows cascade.
+func (s *SQLiteStore) DeleteTag(ctx context.Context, userID, id int) error {
+	res, err := s.db.ExecContext(ctx, "DELETE FROM tags WHERE id = $1 AND user_id = $2", id, userID)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err == nil && n == 0 {
+		err = ErrNotFound
+	}
+	return err
+}
@@ -0,0 +1,112 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Tottitov/todo/models"
+)
+
+// ExportTodos calls fn with each of the user's todos outside the trash.
+func (s *SQLiteStore) ExportTodos(ctx context.Context, userID int, fn func(models.Todo) error) error {
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf(exportQuery, sqliteTodoColumns), userID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		t, err := scanTodo(rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(t); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// Import writes todos to the user's lists in one transaction, which a dry
+// run rolls back.
+func (s *SQLiteStore) Import(ctx context.Context, userID int, todos []ImportTodo, dryRun bool) ([]ImportOutcome, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	outcomes, err := importTodos(sqliteImport{ctx, tx, userID}, todos)
+	if err != nil || dryRun {
+		return outcomes, err
+	}
+	return outcomes, tx.Commit()
+}
+
+// sqliteImport is the importTx of a SQLite transaction.
+type sqliteImport struct {
+	ctx    context.Context
+	tx     *sql.Tx
+	userID int
+}
+
+func (i sqliteImport) listID(name, color string) (int, error) {
+	var id int
+	err := i.tx.QueryRowContext(i.ctx, importListQuery, i.userID, name).Scan(&id)
+	if !errors.Is(err, sql.ErrNoRows) {
+		return id, err
+	}
+	err = i.tx.QueryRowContext(i.ctx,
+		"INSERT INTO lists (user_id, name, color, created_at) VALUES ($1, $2, $3, $4) RETURNING id",
+		i.userID, name, color, time.Now().UTC()).Scan(&id)
+	return id, err
+}
+
+func (i sqliteImport) get(id int) (models.Todo, bool, error) {
+	t, err := scanTodo(i.tx.QueryRowContext(i.ctx,
+		"SELECT "+sqliteTodoColumns+" FROM todos WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL", id, i.userID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Todo{}, false, nil
+	}
+	return t, err == nil, err
+}
+
+func (i sqliteImport) insert(t models.Todo) (int, error) {
+	position, err := sqliteEndPosition(i.ctx, i.tx, i.userID, t.ListID)
+	if err != nil {
+		return 0, err
+	}
+	id, err := sqliteInsertTodo(i.ctx, i.tx, i.userID, t, position)
+	if err != nil {
+		return 0, err
+	}
+	_, err = i.tx.ExecContext(i.ctx, importCreatedQuery, importCreatedAt(t), id)
+	return id, err
+}
+
+func (i sqliteImport) update(was, t models.Todo) error {
+	dueDate, dueTime, dueTZ, dueAt := dueColumns(t.Due)
+	_, err := i.tx.ExecContext(i.ctx, importUpdateQuery,
+		t.ListID, t.ParentID, t.Title, t.Notes, t.Completed, int(t.Priority), dueDate, dueTime, dueTZ, dueAt, t.Recur, t.Position,
+		t.ID, i.userID)
+	if err != nil {
+		return err
+	}
+	if err := sqliteSetTags(i.ctx, i.tx, i.userID, t.ID, models.TagNames(t.Tags)); err != nil {
+		return err
+	}
+	if t.ListID != was.ListID {
+		if _, err := i.tx.ExecContext(i.ctx, moveSubtasksQuery, t.ListID, t.ID, i.userID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (i sqliteImport) log(id int, e importEvent) error {
+	_, err := i.tx.ExecContext(i.ctx, eventAtQuery, id, i.userID, string(e.action), e.from, e.to, sqliteTimestamp(e.time()))
+	return err
+}
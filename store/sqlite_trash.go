@@ -0,0 +1,128 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/Tottitov/todo/models"
+)
+
+// Trash returns the todos in the user's trash, most recently deleted first.
+func (s *SQLiteStore) Trash(ctx context.Context, userID int) ([]models.Todo, error) {
+	rows, err := s.db.QueryContext(ctx,
+		"SELECT "+sqliteTodoColumns+" FROM todos WHERE user_id = $1 AND "+inTrash+" ORDER BY deleted_at DESC, id DESC", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var todos []models.Todo
+	for rows.Next() {
+		t, err := scanTodo(rows)
+		if err != nil {
+			return nil, err
+		}
+		todos = append(todos, t)
+	}
+	return todos, rows.Err()
+}
+
+// Restore takes the todo, and the subtasks deleted with it, out of the trash
+// in one transaction, logging each.
+func (s *SQLiteStore) Restore(ctx context.Context, userID, id int) (models.Todo, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.Todo{}, err
+	}
+	defer tx.Rollback()
+
+	if err := sqliteLog(ctx, tx, restoreEventsQuery, id, userID, models.ActionRestored, "", ""); err != nil {
+		return models.Todo{}, err
+	}
+	if _, err := tx.ExecContext(ctx, restoreSubtasksQuery, id, userID); err != nil {
+		return models.Todo{}, err
+	}
+	t, err := scanTodo(tx.QueryRowContext(ctx,
+		"UPDATE todos SET deleted_at = NULL WHERE "+restoreWhere+" RETURNING "+sqliteTodoColumns, id, userID))
+	if err != nil {
+		return models.Todo{}, sqlNotFound(err)
+	}
+	return t, tx.Commit()
+}
+
+// Undelete takes the given todos out of the trash in one transaction,
+// logging each.
+func (s *SQLiteStore) Undelete(ctx context.Context, userID int, ids []int) (int, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	n := 0
+	for _, id := range ids {
+		res, err := tx.ExecContext(ctx, undeleteQuery, id, userID)
+		if err != nil {
+			return 0, err
+		}
+		rows, err := res.RowsAffected()
+		if err != nil {
+			return 0, err
+		}
+		if rows == 0 {
+			continue
+		}
+		if err := sqliteLog(ctx, tx, eventQuery, id, userID, models.ActionRestored, "", ""); err != nil {
+			return 0, err
+		}
+		n++
+	}
+	return n, tx.Commit()
+}
+
+// Purge permanently deletes the todo from the trash; its subtasks cascade.
+func (s *SQLiteStore) Purge(ctx context.Context, userID, id int) error {
+	res, err := s.db.ExecContext(ctx, purgeQuery, id, userID)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err == nil && n == 0 {
+		err = ErrNotFound
+	}
+	return err
+}
+
+// EmptyTrash permanently deletes every todo in the user's trash.
+func (s *SQLiteStore) EmptyTrash(ctx context.Context, userID int) (int, error) {
+	return s.execAll(ctx, emptyTrashQueries, userID)
+}
+
+// PurgeTrash permanently deletes the todos trashed before the given time.
+func (s *SQLiteStore) PurgeTrash(ctx context.Context, before time.Time) (int, error) {
+	return s.execAll(ctx, purgeTrashQueries, before.UTC())
+}
+
+// execAll runs the statements in one transaction with the same arguments
+// and returns the total number of rows they affected.
+func (s *SQLiteStore) execAll(ctx context.Context, queries []string, args ...any) (int, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	n := 0
+	for _, query := range queries {
+		res, err := tx.ExecContext(ctx, query, args...)
+		if err != nil {
+			return 0, err
+		}
+		rows, err := res.RowsAffected()
+		if err != nil {
+			return 0, err
+		}
+		n += int(rows)
+	}
+	return n, tx.Commit()
+}
@@ -0,0 +1,130 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/Tottitov/todo/models"
+)
+
+// CreateUser registers a new user.
+func (s *SQLiteStore) CreateUser(ctx context.Context, email, passwordHash string) (models.User, error) {
+	now := time.Now().UTC()
+	u, err := scanUser(s.db.QueryRowContext(ctx,
+		"INSERT INTO users (email, password_hash, created_at, last_seen_at) VALUES ($1, $2, $3, $3) RETURNING "+userColumns,
+		email, passwordHash, now))
+	if isSQLiteUniqueViolation(err) {
+		return models.User{}, ErrEmailTaken
+	}
+	return u, err
+}
+
+// GetUser returns the user with the given ID.
+func (s *SQLiteStore) GetUser(ctx context.Context, id int) (models.User, error) {
+	u, err := scanUser(s.db.QueryRowContext(ctx,
+		"SELECT "+userColumns+" FROM users WHERE id = $1", id))
+	return u, sqlNotFound(err)
+}
+
+// GetUserByEmail returns the user registered with email.
+func (s *SQLiteStore) GetUserByEmail(ctx context.Context, email string) (models.User, error) {
+	u, err := scanUser(s.db.QueryRowContext(ctx,
+		"SELECT "+userColumns+" FROM users WHERE email = $1", email))
+	return u, sqlNotFound(err)
+}
+
+// CreateAnonymousUser mints an anonymous user.
+func (s *SQLiteStore) CreateAnonymousUser(ctx context.Context) (models.User, error) {
+	email, err := anonymousEmail()
+	if err != nil {
+		return models.User{}, err
+	}
+	now := time.Now().UTC()
+	return scanUser(s.db.QueryRowContext(ctx,
+		"INSERT INTO users (email, password_hash, anonymous, created_at, last_seen_at) VALUES ($1, '', true, $2, $2) RETURNING "+userColumns,
+		email, now))
+}
+
+// ClaimAnonymousUser turns an anonymous user into a registered one.
+func (s *SQLiteStore) ClaimAnonymousUser(ctx context.Context, id int, email, passwordHash string) (models.User, error) {
+	u, err := scanUser(s.db.QueryRowContext(ctx,
+		`UPDATE users SET email = $1, password_hash = $2, anonymous = false, last_seen_at = $3
+		WHERE id = $4 AND anonymous RETURNING `+userColumns,
+		email, passwordHash, time.Now().UTC(), id))
+	if isSQLiteUniqueViolation(err) {
+		return models.User{}, ErrEmailTaken
+	}
+	return u, sqlNotFound(err)
+}
+
+// TouchUser records that the user was active at now.
+func (s *SQLiteStore) TouchUser(ctx context.Context, id int, now time.Time) error {
+	now = now.UTC()
+	_, err := s.db.ExecContext(ctx,
+		"UPDATE users SET last_seen_at = $1 WHERE id = $2 AND (last_seen_at IS NULL OR last_seen_at < $3)",
+		now, id, now.Add(-touchInterval))
+	return err
+}
+
+// DeleteIdleAnonymousUsers removes anonymous users not seen since before.
+func (s *SQLiteStore) DeleteIdleAnonymousUsers(ctx context.Context, before time.Time) (int, error) {
+	res, err := s.db.ExecContext(ctx,
+		"DELETE FROM users WHERE anonymous AND COALESCE(last_seen_at, created_at) < $1", before.UTC())
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+// Orphans counts the todos without an owner.
+func (s *SQLiteStore) Orphans(ctx context.Context) (int, error) {
+	var n int
+	err := s.db.QueryRowContext(ctx, "SELECT count(*) FROM todos WHERE user_id IS NULL").Scan(&n)
+	return n, err
+}
+
+// ClaimOrphans gives every todo without an owner to the user.
+func (s *SQLiteStore) ClaimOrphans(ctx context.Context, userID int) (int, error) {
+	list, err := s.DefaultList(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+	res, err := s.db.ExecContext(ctx,
+		"UPDATE todos SET user_id = $1, list_id = $2 WHERE user_id IS NULL", userID, list.ID)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+// CreateSession stores a new session.
+func (s *SQLiteStore) CreateSession(ctx context.Context, session models.Session) error {
+	_, err := s.db.ExecContext(ctx,
+		"INSERT INTO sessions (token_hash, user_id, expires_at) VALUES ($1, $2, $3)",
+		session.TokenHash, session.UserID, session.ExpiresAt.UTC())
+	return err
+}
+
+// GetSession returns the unexpired session with the given token hash.
+func (s *SQLiteStore) GetSession(ctx context.Context, tokenHash string) (models.Session, error) {
+	var session models.Session
+	err := s.db.QueryRowContext(ctx,
+		"SELECT token_hash, user_id, expires_at FROM sessions WHERE token_hash = $1 AND expires_at > $2",
+		tokenHash, time.Now().UTC(),
+	).Scan(&session.TokenHash, &session.UserID, &session.ExpiresAt)
+	return session, sqlNotFound(err)
+}
+
+// DeleteSession removes a session.
+func (s *SQLiteStore) DeleteSession(ctx context.Context, tokenHash string) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM sessions WHERE token_hash = $1", tokenHash)
+	return err
+}
+
+// DeleteExpiredSessions removes sessions that expired before now.
+func (s *SQLiteStore) DeleteExpiredSessions(ctx context.Context, now time.Time) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM sessions WHERE expires_at <= $1", now.UTC())
+	return err
+}
@@ -0,0 +1,421 @@
+// Package store defines the persistence layer for the todo application.
+// Handlers depend only on the interfaces declared here; concrete backends
+// live alongside them and are selected at startup from a DSN.
+package store
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Tottitov/todo/migrate"
+	"github.com/Tottitov/todo/models"
+)
+
+var (
+	// ErrNotFound is returned when the requested record does not exist
+	// (or is not visible to the requesting user).
+	ErrNotFound = errors.New("store: not found")
+	// ErrEmailTaken is returned by CreateUser when the email is already registered.
+	ErrEmailTaken = errors.New("store: email already registered")
+	// ErrTagExists is returned by UpdateTag when renaming onto an existing tag.
+	ErrTagExists = errors.New("store: tag already exists")
+	// ErrOutOfOrder is returned by Reorder when the neighbours given don't
+	// match the list's current order, typically because the client's copy
+	// of the list is stale.
+	ErrOutOfOrder = errors.New("store: neighbours out of order")
+	// ErrNested is returned by Create when the parent of a new subtask is
+	// itself a subtask; subtasks are only one level deep.
+	ErrNested = errors.New("store: subtasks cannot have subtasks")
+	// ErrCursor is returned by List when the todo to page after no longer
+	// exists, for instance because it was purged from the trash since the
+	// previous page was fetched.
+	ErrCursor = errors.New("store: unknown page cursor")
+)
+
+// TodoStore is the set of operations the handlers need to manage todos.
+// Every operation is scoped to the todos owned by userID. Deleted todos go
+// to the trash, where only the trash operations, Trash through EmptyTrash,
+// see them; to everything else they don't exist. Changes are logged as
+// events for EventStore, see there.
+// Implementations must be safe for concurrent use.
+type TodoStore interface {
+	// List returns the todos in q's list that pass its filter, in its sort order.
+	// When q searches, the todos carry a Match and, in manual order, come
+	// best match first. Paging after a todo that no longer exists fails
+	// with ErrCursor.
+	List(ctx context.Context, userID int, q TodoQuery) ([]models.Todo, error)
+	// Counts tallies the active and completed top-level todos in one of the
+	// user's lists, regardless of any filter.
+	Counts(ctx context.Context, userID, listID int) (TodoCounts, error)
+	// Get returns a single todo or ErrNotFound.
+	Get(ctx context.Context, userID, id int) (models.Todo, error)
+	// Create inserts a new todo into todo.ListID, tagged with the names in
+	// todo.Tags, and returns it with its ID set. It returns ErrNotFound if the
+	// user has no such list. With todo.ParentID set, the todo is instead
+	// added as a subtask to the parent's list; ErrNotFound then means there is
+	// no such parent, and ErrNested that the parent is a subtask itself.
+	Create(ctx context.Context, userID int, todo models.Todo) (models.Todo, error)
+	// UpdateTitle changes the title of a todo and returns the updated todo.
+	UpdateTitle(ctx context.Context, userID, id int, title string) (models.Todo, error)
+	// SetDue sets or, with a nil due, clears the due date of a todo and returns the updated todo.
+	SetDue(ctx context.Context, userID, id int, due *models.Due) (models.Todo, error)
+	// SetNotes replaces the free-form notes of a todo and returns the updated todo.
+	SetNotes(ctx context.Context, userID, id int, notes string) (models.Todo, error)
+	// SetPriority changes the priority of a todo and returns the updated todo.
+	SetPriority(ctx context.Context, userID, id int, priority models.Priority) (models.Todo, error)
+	// SetRecur sets the recurrence rule of a todo, which must be valid for
+	// recur.Parse, or clears it with an empty rule, and returns the updated
+	// todo.
+	SetRecur(ctx context.Context, userID, id int, rule string) (models.Todo, error)
+	// SetTags replaces the tags of a todo with the named ones, creating tags
+	// the user doesn't have yet, and returns the updated todo.
+	SetTags(ctx context.Context, userID, id int, names []string) (models.Todo, error)
+	// Update changes the fields of a todo that p sets, all in one go, and
+	// returns the updated todo. Its rule, if any, must be valid as for
+	// SetRecur.
+	Update(ctx context.Context, userID, id int, p TodoPatch) (models.Todo, error)
+	// Toggle flips the completion status of a todo and returns the updated
+	// todo. With cascade, completing a todo also completes its open subtasks.
+	// Completing a repeating todo also creates its next occurrence, see
+	// nextOccurrence, whose ID the returned todo carries as NextID.
+	Toggle(ctx context.Context, userID, id int, cascade bool) (models.Todo, error)
+	// SetCompleted sets the completion status of a todo and returns the
+	// updated todo. With cascade, completing a todo also completes its open
+	// subtasks. Like Toggle, it creates the next occurrence of a repeating
+	// todo it completes.
+	SetCompleted(ctx context.Context, userID, id int, completed, cascade bool) (models.Todo, error)
+	// Untoggle takes back a toggle of a todo all in one go: it puts back
+	// the todo's completion status and rule without repeating it again,
+	// reopens the subtasks the toggle completed and deletes the next
+	// occurrence it created for good, together with its subtasks. Todos
+	// that are gone since are skipped, but for the toggled one, whose
+	// absence is ErrNotFound.
+	Untoggle(ctx context.Context, userID int, u ToggleUndo) error
+	// Delete moves a todo together with its subtasks to the trash, returning
+	// ErrNotFound if it does not exist.
+	Delete(ctx context.Context, userID, id int) error
+	// DeleteCompleted moves every completed todo in the list to the trash,
+	// along with all subtasks of completed todos whether completed or not,
+	// and returns the IDs of the todos it moved. Open todos keep their open
+	// subtasks.
+	DeleteCompleted(ctx context.Context, userID, listID int) ([]int, error)
+	// Trash returns the todos in the user's trash from every list, most
+	// recently deleted first. Subtasks deleted along with their parent come
+	// with it rather than on their own.
+	Trash(ctx context.Context, userID int) ([]models.Todo, error)
+	// Restore takes a todo out of the trash, together with the subtasks
+	// deleted along with it, and returns it. It returns ErrNotFound if the
+	// todo isn't in the trash, or is a subtask whose parent is.
+	Restore(ctx context.Context, userID, id int) (models.Todo, error)
+	// Undelete takes exactly the given todos out of the trash, in one go,
+	// and returns how many came back. Unlike Restore it brings back no
+	// subtasks that aren't listed, so it reverses DeleteCompleted given the
+	// IDs that returned. Todos that are no longer in the trash are skipped.
+	Undelete(ctx context.Context, userID int, ids []int) (int, error)
+	// Purge permanently deletes a todo in the trash and its subtasks,
+	// returning ErrNotFound if the todo isn't in the trash.
+	Purge(ctx context.Context, userID, id int) error
+	// EmptyTrash permanently deletes every todo in the user's trash and
+	// returns how many were removed.
+	EmptyTrash(ctx context.Context, userID int) (int, error)
+	// PurgeTrash permanently deletes the todos of every user that went to
+	// the trash before the given time, and returns how many were removed.
+	PurgeTrash(ctx context.Context, before time.Time) (int, error)
+	// Move puts a todo at the end of another of the user's lists. It returns
+	// ErrNotFound if either the todo or the list does not exist. Subtasks
+	// follow their parent; a subtask moved on its own becomes a top-level todo.
+	Move(ctx context.Context, userID, id, listID int) (models.Todo, error)
+	// Reorder places a todo in the manual order of its list between the
+	// todos afterID and beforeID. Given only one of them, the todo goes
+	// directly after or before it, so clients showing part of the list need
+	// not know the other neighbour; given neither, it goes first. Subtasks
+	// are ordered among their siblings. Only the moved todo is updated. It
+	// returns ErrNotFound if a neighbour isn't in the todo's list, or isn't a
+	// sibling, and ErrOutOfOrder if afterID doesn't come before beforeID.
+	Reorder(ctx context.Context, userID, id, afterID, beforeID int) (models.Todo, error)
+}
+
+// ListStore manages the named lists todos are grouped into.
+type ListStore interface {
+	// Lists returns the user's lists in the order they were created.
+	Lists(ctx context.Context, userID int) ([]models.List, error)
+	// GetList returns one of the user's lists or ErrNotFound.
+	GetList(ctx context.Context, userID, id int) (models.List, error)
+	// DefaultList returns the user's first list, creating one named
+	// models.DefaultListName if the user has none.
+	DefaultList(ctx context.Context, userID int) (models.List, error)
+	// CreateList adds a list for the user.
+	CreateList(ctx context.Context, userID int, name, color string) (models.List, error)
+	// UpdateList renames and recolors a list.
+	UpdateList(ctx context.Context, userID, id int, name, color string) (models.List, error)
+	// DeleteList removes a list together with all of its todos.
+	DeleteList(ctx context.Context, userID, id int) error
+}
+
+// TagStore manages the tags users label their todos with. Tags are created
+// implicitly by TodoStore.Create and TodoStore.SetTags.
+type TagStore interface {
+	// Tags returns the user's tags ordered by name, each with the number of
+	// todos outside the trash carrying it.
+	Tags(ctx context.Context, userID int) ([]models.Tag, error)
+	// UpdateTag renames and recolors a tag. It returns ErrTagExists if the
+	// user already has another tag with the new name.
+	UpdateTag(ctx context.Context, userID, id int, name, color string) (models.Tag, error)
+	// MergeTag moves every todo tagged fromID over to intoID and deletes fromID.
+	MergeTag(ctx context.Context, userID, fromID, intoID int) error
+	// DeleteTag removes a tag from every todo and deletes it.
+	DeleteTag(ctx context.Context, userID, id int) error
+}
+
+// EventStore reads the append-only log of changes to todos: their creation,
+// renaming, completion, deletion and restoration. TodoStore writes the log,
+// in the same transaction as each change it records.
+type EventStore interface {
+	// Events returns the events on the user's todos that pass q, newest
+	// first. The events of a todo outlive it.
+	Events(ctx context.Context, userID int, q EventQuery) ([]models.Event, error)
+	// Actors returns the users who have changed the user's todos, ordered
+	// by email.
+	Actors(ctx context.Context, userID int) ([]models.User, error)
+	// Completions returns when each completed todo of the user outside the
+	// trash was last completed, by todo ID. Todos whose completion the log
+	// doesn't have are left out.
+	Completions(ctx context.Context, userID int) (map[int]time.Time, error)
+}
+
+// UserStore manages user accounts.
+type UserStore interface {
+	// CreateUser registers a new user, returning ErrEmailTaken if the email is in use.
+	CreateUser(ctx context.Context, email, passwordHash string) (models.User, error)
+	// GetUser returns the user with the given ID or ErrNotFound.
+	GetUser(ctx context.Context, id int) (models.User, error)
+	// GetUserByEmail returns the user registered with email or ErrNotFound.
+	GetUserByEmail(ctx context.Context, email string) (models.User, error)
+	// CreateAnonymousUser mints an anonymous user with a placeholder email.
+	CreateAnonymousUser(ctx context.Context) (models.User, error)
+	// ClaimAnonymousUser turns an anonymous user into a registered one,
+	// keeping its todos. It returns ErrNotFound if id is not anonymous and
+	// ErrEmailTaken if the email is in use.
+	ClaimAnonymousUser(ctx context.Context, id int, email, passwordHash string) (models.User, error)
+	// TouchUser records that the user was active at now. Implementations may
+	// skip the write if the user was seen very recently.
+	TouchUser(ctx context.Context, id int, now time.Time) error
+	// DeleteIdleAnonymousUsers removes anonymous users, and with them their
+	// todos, that have not been seen since before. It returns how many were removed.
+	DeleteIdleAnonymousUsers(ctx context.Context, before time.Time) (int, error)
+}
+
+// SessionStore manages server-side login sessions. Sessions are looked up by
+// the hash of their token so a leaked database does not leak live cookies.
+type SessionStore interface {
+	// CreateSession stores a new session.
+	CreateSession(ctx context.Context, session models.Session) error
+	// GetSession returns the unexpired session with the given token hash or ErrNotFound.
+	GetSession(ctx context.Context, tokenHash string) (models.Session, error)
+	// DeleteSession removes a session. Deleting a missing session is not an error.
+	DeleteSession(ctx context.Context, tokenHash string) error
+	// DeleteExpiredSessions removes sessions that expired before now.
+	DeleteExpiredSessions(ctx context.Context, now time.Time) error
+}
+
+// FeedStore manages the secret tokens of users' calendar feeds, one per
+// user at most. Like sessions, tokens are looked up by their hash.
+type FeedStore interface {
+	// SetFeedToken gives the user a feed token, replacing the one they had.
+	SetFeedToken(ctx context.Context, userID int, tokenHash string) error
+	// FeedCreated returns when the user's feed token was made, or
+	// ErrNotFound if they have none.
+	FeedCreated(ctx context.Context, userID int) (time.Time, error)
+	// FeedUser returns the ID of the user with the given feed token hash or ErrNotFound.
+	FeedUser(ctx context.Context, tokenHash string) (int, error)
+	// DeleteFeedToken turns the user's feed off. Deleting a missing token is not an error.
+	DeleteFeedToken(ctx context.Context, userID int) error
+}
+
+// UndoStore keeps the undo offered after a destructive action until it is
+// taken or expires, so that any server instance can take it. Like sessions,
+// offers are looked up by the hash of their token.
+type UndoStore interface {
+	// CreateUndo stores a new offer.
+	CreateUndo(ctx context.Context, offer UndoOffer) error
+	// TakeUndo removes the user's offer with the given token hash and
+	// returns it, or ErrNotFound if there is none or it has expired. Either
+	// way, an offer can be taken once only.
+	TakeUndo(ctx context.Context, userID int, tokenHash string) (UndoOffer, error)
+	// DeleteExpiredUndos removes offers that expired before now.
+	DeleteExpiredUndos(ctx context.Context, now time.Time) error
+}
+
+// Store is a complete storage backend.
+type Store interface {
+	TodoStore
+	ListStore
+	TagStore
+	EventStore
+	TransferStore
+	UserStore
+	SessionStore
+	FeedStore
+	UndoStore
+	// Close releases any resources held by the store.
+	Close()
+}
+
+// Migratable is implemented by stores whose schema is managed by versioned
+// migrations. The in-memory store has no schema and does not implement it.
+type Migratable interface {
+	Migrator() (*migrate.Migrator, error)
+}
+
+// OrphanClaimer is implemented by stores whose schema predates accounts.
+// Todos created before accounts existed have no owner and aren't listed
+// until an account claims them. The in-memory store never has such todos
+// and does not implement it.
+type OrphanClaimer interface {
+	// Orphans counts the todos without an owner.
+	Orphans(ctx context.Context) (int, error)
+	// ClaimOrphans gives every todo without an owner to the user, in the
+	// user's default list, and returns how many it claimed.
+	ClaimOrphans(ctx context.Context, userID int) (int, error)
+}
+
+// Change is the notice of a change to a user's todos that server instances
+// sharing a database send each other, encoded as compact JSON.
+type Change struct {
+	TodoID int    `json:"todo_id,omitempty"` // Todo changed, if a single one
+	Action string `json:"action,omitempty"`  // What changed it, such as "POST /todos/{id}/toggle"
+	UserID int    `json:"user_id"`           // Owner of the todos
+	Tab    string `json:"tab,omitempty"`     // Browser tab the change was made from
+}
+
+// Notifier is implemented by stores that several server instances can
+// share, to tell every instance of the changes any of them makes. The
+// Postgres store implements it with LISTEN/NOTIFY; the others are local to
+// one instance and do not.
+type Notifier interface {
+	// Notify sends c to every instance listening, this one included.
+	Notify(ctx context.Context, c Change) error
+	// Listen holds a connection of its own listening for changes, calling
+	// listening once it is in place and deliver with each change sent from
+	// then on. It returns when ctx is done or the connection is lost;
+	// changes sent until the caller listens again are missed.
+	Listen(ctx context.Context, listening func(), deliver func(Change)) error
+}
+
+// Open returns the Store described by dsn. Supported schemes are
+// postgres:// (and postgresql://) for PostgreSQL, sqlite:// for an embedded
+// SQLite file (sqlite:///abs/path/todos.db or sqlite://relative/todos.db),
+// and memory:// for a process-local store that is lost on restart. A dsn
+// without a scheme is a PostgreSQL keyword/value string such as
+// "host=localhost dbname=todo", as pgx reads it.
+func Open(ctx context.Context, dsn string) (Store, error) {
+	switch {
+	case dsn == "memory" || strings.HasPrefix(dsn, "memory://"):
+		return NewMemoryStore(), nil
+	case strings.HasPrefix(dsn, "postgres://"), strings.HasPrefix(dsn, "postgresql://"):
+		return NewPostgresStore(ctx, dsn)
+	case strings.HasPrefix(dsn, "sqlite://"):
+		path := strings.TrimPrefix(dsn, "sqlite://")
+		if path == "" {
+			return nil, fmt.Errorf("store: sqlite url %q has no path", dsn)
+		}
+		return NewSQLiteStore(ctx, path)
+	case !strings.Contains(dsn, "://"):
+		return NewPostgresStore(ctx, dsn)
+	default:
+		return nil, fmt.Errorf("store: unsupported database url %q", redact(dsn))
+	}
+}
+
+// touchInterval is how stale last_seen_at must be before TouchUser writes it
+// again, so active users don't cost a write on every request.
+const touchInterval = time.Minute
+
+// anonymousEmail returns a unique placeholder email for an anonymous user.
+// The .invalid TLD is reserved, so it can never belong to a real account.
+func anonymousEmail() (string, error) {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "anon-" + hex.EncodeToString(b) + "@anonymous.invalid", nil
+}
+
+// redact strips everything after the scheme so credentials never end up in logs.
+func redact(dsn string) string {
+	if i := strings.Index(dsn, "://"); i >= 0 {
+		return dsn[:i+3] + "..."
+	}
+	return "..."
+}
+
+// scanner is satisfied by pgx.Row(s) and *sql.Row(s) alike, letting the SQL
+// backends share their scan helpers.
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+// todoFields is the column list every todo query selects, in scanTodo order,
+// apart from the trailing tags column. Each SQL backend appends its own
+// subquery aggregating the todo's tags into a JSON array, since Postgres and
+// SQLite spell JSON aggregation differently. Subtask progress is counted with
+// subqueries both understand, over the subtasks that share the todo's
+// deleted_at: the live ones of a live todo, and those trashed along with a
+// todo in the trash.
+const todoFields = `id, list_id, COALESCE(parent_id, 0), title, notes, completed, priority, due_date, due_time, due_tz, recur, position,
+	(SELECT count(*) FILTER (WHERE sub.completed) FROM todos sub WHERE sub.parent_id = todos.id AND sub.deleted_at IS NOT DISTINCT FROM todos.deleted_at),
+	(SELECT count(*) FROM todos sub WHERE sub.parent_id = todos.id AND sub.deleted_at IS NOT DISTINCT FROM todos.deleted_at),
+	created_at, deleted_at`
+
+// scanTodo scans a row selected with todoFields and a tags column, followed
+// by any extra columns the query selects into extra.
+func scanTodo(row scanner, extra ...any) (models.Todo, error) {
+	var (
+		t        models.Todo
+		priority int
+		dueDate  *time.Time
+		due      models.Due
+		tags     string
+	)
+	dest := []any{&t.ID, &t.ListID, &t.ParentID, &t.Title, &t.Notes, &t.Completed, &priority, &dueDate, &due.Time, &due.TZ,
+		&t.Recur, &t.Position, &t.Subtasks.Done, &t.Subtasks.Total, &t.CreatedAt, &t.DeletedAt, &tags}
+	err := row.Scan(append(dest, extra...)...)
+	if err != nil {
+		return t, err
+	}
+	t.Priority = models.Priority(priority)
+	if err := json.Unmarshal([]byte(tags), &t.Tags); err != nil {
+		return t, err
+	}
+	if dueDate != nil {
+		due.Date = dueDate.Format(models.DateLayout)
+		t.Due = &due
+	}
+	return t, err
+}
+
+// listColumns is the column list every list query selects, in scanList order.
+const listColumns = "id, name, color, created_at"
+
+// scanList scans a row selected with listColumns.
+func scanList(row scanner) (models.List, error) {
+	var l models.List
+	err := row.Scan(&l.ID, &l.Name, &l.Color, &l.CreatedAt)
+	return l, err
+}
+
+// userColumns is the column list every user query selects, in scanUser order.
+const userColumns = "id, email, password_hash, anonymous, created_at"
+
+// scanUser scans a row selected with userColumns.
+func scanUser(row scanner) (models.User, error) {
+	var u models.User
+	err := row.Scan(&u.ID, &u.Email, &u.PasswordHash, &u.Anonymous, &u.CreatedAt)
+	return u, err
+}
@@ -0,0 +1,22 @@
+package store
+
+// parentQuery looks up the list of todo $1 of user $2, a would-be parent,
+// and whether it is a subtask itself.
+const parentQuery = "SELECT list_id, parent_id IS NOT NULL FROM todos WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL"
+
+// Statements DeleteCompleted runs, in this order, in one transaction for
+// list $2 of user $1, moving todos to the trash as of $3. Subtasks go first,
+// while the subquery can still tell their completed parents from the trash.
+const (
+	deleteCompletedSubtasksQuery = `UPDATE todos SET deleted_at = $3
+		WHERE user_id = $1 AND list_id = $2 AND parent_id IS NOT NULL AND deleted_at IS NULL
+		AND (completed OR parent_id IN (SELECT id FROM todos WHERE user_id = $1 AND list_id = $2 AND parent_id IS NULL AND completed AND deleted_at IS NULL))`
+	deleteCompletedQuery = "UPDATE todos SET deleted_at = $3 WHERE user_id = $1 AND list_id = $2 AND parent_id IS NULL AND completed AND deleted_at IS NULL"
+)
+
+// completeSubtasksQuery completes the open subtasks of todo $1 of user $2.
+const completeSubtasksQuery = "UPDATE todos SET completed = true WHERE parent_id = $1 AND user_id = $2 AND NOT completed AND deleted_at IS NULL"
+
+// moveSubtasksQuery moves the subtasks of todo $2 of user $3 into list $1,
+// including those in the trash, so they are restored into the right list.
+const moveSubtasksQuery = "UPDATE todos SET list_id = $1 WHERE parent_id = $2 AND user_id = $3"
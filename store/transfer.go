@@ -0,0 +1,265 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/Tottitov/todo/models"
+	"github.com/Tottitov/todo/rank"
+)
+
+// TransferStore moves a user's todos in and out in bulk.
+type TransferStore interface {
+	// ExportTodos calls fn with each of the user's todos outside the trash:
+	// list by list in the order the lists were created, and within a list
+	// each top-level todo in manual order followed by its subtasks. It
+	// stops at the first error fn returns and returns it.
+	ExportTodos(ctx context.Context, userID int, fn func(models.Todo) error) error
+	// Import writes todos to the user's lists in a single transaction and
+	// returns what it did with each, see importTodos. A dry run does the
+	// same but rolls everything back, to preview an import exactly. An
+	// *ImportError tells which todo an import failed on.
+	Import(ctx context.Context, userID int, todos []ImportTodo, dryRun bool) ([]ImportOutcome, error)
+}
+
+// ImportTodo is a todo to import. Its ID names the user's todo it updates;
+// when the user has no todo by that ID, a new todo is created instead. A
+// ParentID refers to another todo of the same import by its ID, or to a
+// todo the user already has. ListID and Subtasks are ignored.
+type ImportTodo struct {
+	models.Todo
+	List      string // Name of the list the todo belongs to, ignored for subtasks
+	ListColor string // Color of the list, should it have to be created
+	// CompletedAt is when a completed todo was completed, zero if unknown.
+	// The audit log dates the todo's completion by it, and exports then
+	// date the todo by its latest completion.
+	CompletedAt time.Time
+}
+
+// ImportOutcome is what an import did with a todo.
+type ImportOutcome string
+
+const (
+	ImportCreated ImportOutcome = "created"
+	ImportUpdated ImportOutcome = "updated"
+	ImportSkipped ImportOutcome = "skipped" // The todo already was as imported
+)
+
+// ImportError reports the todo an import failed on, by its index among the
+// todos imported.
+type ImportError struct {
+	Index int
+	Err   error // ErrNotFound for an unknown parent, ErrNested for a nested one
+}
+
+func (e *ImportError) Error() string {
+	return fmt.Sprintf("todo %d: %v", e.Index+1, e.Err)
+}
+
+func (e *ImportError) Unwrap() error {
+	return e.Err
+}
+
+// exportQuery selects the columns given by %s of the todos of user $1
+// outside the trash in ExportTodos order.
+const exportQuery = `SELECT %s FROM todos WHERE user_id = $1 AND deleted_at IS NULL
+	ORDER BY list_id, COALESCE((SELECT p.position FROM todos p WHERE p.id = todos.parent_id), position),
+		COALESCE(parent_id, id), parent_id IS NOT NULL, position, id`
+
+// importTx is the part of a store's transaction importTodos works through.
+// Every method acts on the importing user's data only.
+type importTx interface {
+	// listID returns the ID of the user's first list with the given name,
+	// creating the list with color if there is none.
+	listID(name, color string) (int, error)
+	// get returns the user's todo with the given ID, unless it is unknown
+	// or in the trash.
+	get(id int) (models.Todo, bool, error)
+	// insert adds t to the end of its list, keeping its creation time and
+	// logging it, and returns its ID.
+	insert(t models.Todo) (int, error)
+	// update overwrites the todo was with t, moving its subtasks along to
+	// t's list. The changes are logged separately, see log.
+	update(was, t models.Todo) error
+	// log records e in the audit log of the todo with the given ID.
+	log(id int, e importEvent) error
+}
+
+// importTodos imports todos through tx: top-level todos first, then the
+// subtasks, each in the order given. A todo is created unless tx has one
+// by its ID, which is then updated, or skipped if it already is as
+// imported. Imported IDs only ever name todos the user had before, never
+// one the import created. Lists are found by name and created as needed;
+// subtasks go into their parent's list. Created todos go to the end of
+// their list, so they keep the order they are given in, while updated ones
+// take their imported position if it is a valid rank key. Every change is
+// logged, the completion of a todo imported completed dated by its
+// CompletedAt.
+func importTodos(tx importTx, todos []ImportTodo) ([]ImportOutcome, error) {
+	outcomes := make([]ImportOutcome, len(todos))
+	ids := make(map[int]int)      // Imported ID to the ID the todo ended up with
+	created := make(map[int]bool) // IDs of the todos created, which imported IDs don't refer to
+	lists := make(map[string]int)
+
+	for _, subtasks := range []bool{false, true} {
+		for i, in := range todos {
+			if (in.ParentID != 0) != subtasks {
+				continue
+			}
+			t := in.Todo
+			if subtasks {
+				// The parent was imported along, or is one the user has
+				if id, ok := ids[t.ParentID]; ok {
+					t.ParentID = id
+				} else if created[t.ParentID] {
+					return nil, &ImportError{Index: i, Err: ErrNotFound}
+				}
+				parent, ok, err := tx.get(t.ParentID)
+				if err != nil {
+					return nil, err
+				}
+				if !ok {
+					return nil, &ImportError{Index: i, Err: ErrNotFound}
+				}
+				if parent.ParentID != 0 {
+					return nil, &ImportError{Index: i, Err: ErrNested}
+				}
+				t.ListID = parent.ListID
+			} else {
+				id, ok := lists[in.List]
+				if !ok {
+					var err error
+					if id, err = tx.listID(in.List, in.ListColor); err != nil {
+						return nil, err
+					}
+					lists[in.List] = id
+				}
+				t.ListID = id
+			}
+
+			was, exists := models.Todo{}, false
+			if t.ID != 0 && !created[t.ID] {
+				var err error
+				if was, exists, err = tx.get(t.ID); err != nil {
+					return nil, err
+				}
+			}
+			if !exists {
+				id, err := tx.insert(t)
+				if err != nil {
+					return nil, err
+				}
+				// A todo imported completed was created, then completed
+				if t.Completed {
+					if err := tx.log(id, importEvent{action: models.ActionCompleted, at: in.CompletedAt}); err != nil {
+						return nil, err
+					}
+				}
+				if t.ID != 0 {
+					ids[t.ID] = id
+				}
+				created[id] = true
+				outcomes[i] = ImportCreated
+				continue
+			}
+
+			ids[t.ID] = t.ID
+			if t.ParentID != 0 && was.Subtasks.Total > 0 {
+				return nil, &ImportError{Index: i, Err: ErrNested}
+			}
+			if !rank.Valid(t.Position) {
+				t.Position = was.Position
+			}
+			t.CreatedAt = was.CreatedAt
+			if sameImport(was, t) {
+				outcomes[i] = ImportSkipped
+				continue
+			}
+			if err := tx.update(was, t); err != nil {
+				return nil, err
+			}
+			for _, e := range importEvents(was, t, in.CompletedAt) {
+				if err := tx.log(t.ID, e); err != nil {
+					return nil, err
+				}
+			}
+			outcomes[i] = ImportUpdated
+		}
+	}
+	return outcomes, nil
+}
+
+// sameImport reports whether importing t over the todo was would change
+// nothing.
+func sameImport(was, t models.Todo) bool {
+	wasTags, tags := models.TagNames(was.Tags), models.TagNames(t.Tags)
+	slices.Sort(wasTags)
+	slices.Sort(tags)
+	return was.ListID == t.ListID && was.ParentID == t.ParentID && was.Title == t.Title &&
+		was.Notes == t.Notes && was.Completed == t.Completed && was.Priority == t.Priority &&
+		sameDue(was.Due, t.Due) && slices.Equal(wasTags, tags) && was.Recur == t.Recur &&
+		was.Position == t.Position
+}
+
+// sameDue reports whether two due dates, either of which may be nil, are equal.
+func sameDue(a, b *models.Due) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// importCreatedAt returns the creation time to give an imported todo: its
+// own, unless it has none.
+func importCreatedAt(t models.Todo) time.Time {
+	if t.CreatedAt.IsZero() {
+		return time.Now().UTC()
+	}
+	return t.CreatedAt.UTC()
+}
+
+// importEvent is an event the audit log records for a change by import.
+type importEvent struct {
+	action   models.Action
+	from, to string
+	at       time.Time // When the change happened, zero for now
+}
+
+// importEvents returns the events the audit log records for importing t
+// over the todo was, dating a completion by completedAt.
+func importEvents(was, t models.Todo, completedAt time.Time) []importEvent {
+	var events []importEvent
+	if t.Title != was.Title {
+		events = append(events, importEvent{action: models.ActionTitleChanged, from: was.Title, to: t.Title})
+	}
+	if t.Completed != was.Completed {
+		e := importEvent{action: completionAction(t.Completed)}
+		if t.Completed {
+			e.at = completedAt
+		}
+		events = append(events, e)
+	}
+	return events
+}
+
+// time returns when e happened.
+func (e importEvent) time() time.Time {
+	if e.at.IsZero() {
+		return time.Now().UTC()
+	}
+	return e.at.UTC()
+}
+
+// Statements the SQL stores' import transactions share.
+const (
+	// importListQuery selects the ID of the first list of user $1 named $2.
+	importListQuery = "SELECT id FROM lists WHERE user_id = $1 AND name = $2 ORDER BY id LIMIT 1"
+	// importCreatedQuery sets the creation time of todo $2 to $1.
+	importCreatedQuery = "UPDATE todos SET created_at = $1 WHERE id = $2"
+	// importUpdateQuery overwrites todo $13 of user $14 with the imported fields.
+	importUpdateQuery = `UPDATE todos SET list_id = $1, parent_id = NULLIF($2, 0), title = $3, notes = $4, completed = $5,
+		priority = $6, due_date = $7, due_time = $8, due_tz = $9, due_at = $10, recur = $11, position = $12
+		WHERE id = $13 AND user_id = $14`
+)
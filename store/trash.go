@@ -0,0 +1,45 @@
+package store
+
+// inTrash is the condition for a todo to be listed in the trash: deleted,
+// and not a subtask whose parent is in the trash as well. Those come back
+// with their parent, or are purged with it.
+const inTrash = `deleted_at IS NOT NULL
+	AND NOT EXISTS (SELECT 1 FROM todos parent WHERE parent.id = todos.parent_id AND parent.deleted_at IS NOT NULL)`
+
+// deleteQuery moves todo $1 of user $2, and its live subtasks, to the trash
+// as of $3. A todo in the trash has no live subtasks, so no rows affected
+// means there is no such todo.
+const deleteQuery = "UPDATE todos SET deleted_at = $3 WHERE (id = $1 OR parent_id = $1) AND user_id = $2 AND deleted_at IS NULL"
+
+// Statements Restore runs in one transaction for todo $1 of user $2. The
+// subtasks deleted at the same time as the todo come back first, while the
+// todo still carries the time they share; the todo itself follows, if it is
+// in the trash.
+const (
+	restoreSubtasksQuery = `UPDATE todos SET deleted_at = NULL
+		WHERE parent_id = $1 AND user_id = $2 AND deleted_at = (SELECT deleted_at FROM todos WHERE id = $1)`
+	restoreWhere = "id = $1 AND user_id = $2 AND " + inTrash
+)
+
+// undeleteQuery takes todo $1 of user $2 out of the trash, on its own.
+const undeleteQuery = "UPDATE todos SET deleted_at = NULL WHERE id = $1 AND user_id = $2 AND deleted_at IS NOT NULL"
+
+// purgeQuery permanently deletes todo $1 of user $2 from the trash; its
+// subtasks go with it by foreign key cascade.
+const purgeQuery = "DELETE FROM todos WHERE id = $1 AND user_id = $2 AND deleted_at IS NOT NULL"
+
+// Statements emptying the trash, run in this order in one transaction.
+// Subtasks go first, so that the number of removed rows doesn't depend on
+// whether a foreign key cascade got to them first.
+var (
+	// emptyTrashQueries empty the trash of user $1.
+	emptyTrashQueries = []string{
+		"DELETE FROM todos WHERE user_id = $1 AND deleted_at IS NOT NULL AND parent_id IS NOT NULL",
+		"DELETE FROM todos WHERE user_id = $1 AND deleted_at IS NOT NULL",
+	}
+	// purgeTrashQueries remove the todos of every user deleted before $1.
+	purgeTrashQueries = []string{
+		"DELETE FROM todos WHERE deleted_at < $1 AND parent_id IS NOT NULL",
+		"DELETE FROM todos WHERE deleted_at < $1",
+	}
+)
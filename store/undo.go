@@ -0,0 +1,72 @@
+package store
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// ToggleUndo is what TodoStore.Untoggle needs to take back a toggle of a
+// todo: the todo as it was, and what the toggle did besides.
+type ToggleUndo struct {
+	ID        int    `json:"id"`                // The todo toggled
+	Completed bool   `json:"completed"`         // Its completion status before the toggle
+	Recur     string `json:"recur,omitempty"`   // Its recurrence rule before, which completing it cleared
+	NextID    int    `json:"next_id,omitempty"` // The next occurrence completing it created, 0 if none
+	Reopen    []int  `json:"reopen,omitempty"`  // The subtasks completing it completed along
+}
+
+// UndoOffer is an offer to reverse an action of a user, kept by UndoStore
+// under the hash of its token until it is taken or expires.
+type UndoOffer struct {
+	TokenHash string
+	UserID    int
+	ListID    int // List to show once the action is undone
+	Action    UndoAction
+	ExpiresAt time.Time
+}
+
+// UndoAction is how to reverse an action, with exactly one field set. It is
+// stored as JSON.
+type UndoAction struct {
+	Restore  int         `json:"restore,omitempty"`  // Todo to Restore from the trash with its subtasks
+	Undelete []int       `json:"undelete,omitempty"` // Todos to Undelete, and only those
+	Untoggle *ToggleUndo `json:"untoggle,omitempty"` // Toggle to Untoggle
+}
+
+// Statements of the SQL stores' UndoStore.
+const (
+	// createUndoQuery stores the offer with token hash $1 of user $2 in list
+	// $3, whose action is the JSON $4, until $5.
+	createUndoQuery = "INSERT INTO undo_offers (token_hash, user_id, list_id, action, expires_at) VALUES ($1, $2, $3, $4, $5)"
+	// takeUndoQuery deletes the offer with token hash $1 of user $2 and
+	// returns it, expired or not.
+	takeUndoQuery = "DELETE FROM undo_offers WHERE token_hash = $1 AND user_id = $2 RETURNING list_id, action, expires_at"
+	// deleteUndosQuery deletes the offers that expired at $1 or before.
+	deleteUndosQuery = "DELETE FROM undo_offers WHERE expires_at <= $1"
+)
+
+// takenUndo completes the offer the SQL stores took with takeUndoQuery,
+// given its action as JSON. An offer that has expired by now is ErrNotFound
+// like a missing one.
+func takenUndo(offer UndoOffer, action []byte, now time.Time) (UndoOffer, error) {
+	if !offer.ExpiresAt.After(now) {
+		return UndoOffer{}, ErrNotFound
+	}
+	if err := json.Unmarshal(action, &offer.Action); err != nil {
+		return UndoOffer{}, err
+	}
+	return offer, nil
+}
+
+// Statements the SQL stores' Untoggle runs in one transaction, for user $2.
+const (
+	// dropTodoQuery permanently deletes todo $1, in the trash or not; its
+	// subtasks go with it by foreign key cascade.
+	dropTodoQuery = "DELETE FROM todos WHERE id = $1 AND user_id = $2"
+	// untoggleQuery puts completion status $3 and rule $4 back on todo $1.
+	untoggleQuery = "UPDATE todos SET completed = $3, recur = $4 WHERE id = $1 AND user_id = $2"
+	// reopenEventsQuery logs an event of todo $1 if reopenQuery reopens it.
+	reopenEventsQuery = eventInsert + "WHERE id = $1 AND user_id = $2 AND completed AND deleted_at IS NULL"
+	// reopenQuery reopens todo $1, unless it is in the trash.
+	reopenQuery = "UPDATE todos SET completed = FALSE WHERE id = $1 AND user_id = $2 AND completed AND deleted_at IS NULL"
+)
@@ -0,0 +1,332 @@
+// Package todotxt reads and writes tasks in the todo.txt format
+// (https://github.com/todotxt/todo.txt), one task per line:
+//
+//	x 2025-03-08 2025-03-01 Call mom +Family @phone due:2025-03-09
+//	(A) 2025-03-01 File taxes +Admin
+//
+// A task may be marked done with an "x", carry a priority from (A) to (Z)
+// and the dates it was completed and created on. Its description names
+// projects with a +, contexts with an @, and extensions as key:value pairs.
+//
+// Tasks map onto todos: the first project is the todo's list, the other
+// projects and the contexts are its tags, and these extensions carry the
+// rest:
+//
+//	id:12                 the todo's ID
+//	parent:7              the ID of the todo it is a subtask of
+//	due:2025-03-09        its due date,
+//	at:09:30 tz:UTC       and the time and time zone it is due at
+//	rec:+2w               its recurrence, every 2 days (d), weeks (w), months (m) or years (y)
+//	rrule:FREQ=MONTHLY;…  a recurrence rec can't express
+//	pri:A                 the priority of a completed task, which has no (A)
+//
+// Any other key:value pair, such as a URL, is left in the title.
+package todotxt
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Tottitov/todo/models"
+	"github.com/Tottitov/todo/recur"
+)
+
+// Task is a line of a todo.txt file.
+type Task struct {
+	Completed   bool
+	Priority    byte   // 'A' to 'Z', or 0 for none
+	CompletedOn string // Day the task was completed on, in models.DateLayout, if given
+	CreatedOn   string // Day the task was created on, in models.DateLayout, if given
+	Description string // The rest of the line, projects, contexts and extensions included
+}
+
+// datePattern matches the dates of a task.
+var datePattern = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}$`)
+
+// Parse reads a line of a todo.txt file. Every line is a task, if only a
+// description.
+func Parse(line string) Task {
+	var t Task
+	words := strings.Fields(line)
+	if len(words) > 0 && words[0] == "x" {
+		t.Completed = true
+		words = words[1:]
+	}
+	if len(words) > 0 && !t.Completed && len(words[0]) == 3 && words[0][0] == '(' && words[0][2] == ')' &&
+		words[0][1] >= 'A' && words[0][1] <= 'Z' {
+		t.Priority = words[0][1]
+		words = words[1:]
+	}
+	// A completed task's first date is when it was completed, an open one
+	// only has the day it was created on
+	dates := []*string{&t.CreatedOn}
+	if t.Completed {
+		dates = []*string{&t.CompletedOn, &t.CreatedOn}
+	}
+	for _, date := range dates {
+		if len(words) == 0 || !datePattern.MatchString(words[0]) {
+			break
+		}
+		*date = words[0]
+		words = words[1:]
+	}
+	t.Description = strings.Join(words, " ")
+	return t
+}
+
+// String formats the task as a line of a todo.txt file. A creation date
+// can't be written without a completion date on a completed task, so a
+// task completed on an unknown day is written as completed on the day it
+// was created on, which at least keeps that.
+func (t Task) String() string {
+	var words []string
+	if t.Completed {
+		words = append(words, "x")
+	}
+	if t.Priority != 0 && !t.Completed {
+		words = append(words, "("+string(t.Priority)+")")
+	}
+	if t.Completed && t.CompletedOn != "" {
+		words = append(words, t.CompletedOn)
+	} else if t.Completed && t.CreatedOn != "" {
+		words = append(words, t.CreatedOn)
+	}
+	if t.CreatedOn != "" {
+		words = append(words, t.CreatedOn)
+	}
+	if t.Description != "" {
+		words = append(words, t.Description)
+	}
+	return strings.Join(words, " ")
+}
+
+// CompletedAt returns when the task was completed: the start of the day it
+// was completed on, in UTC, or zero if that isn't known.
+func (t Task) CompletedAt() time.Time {
+	if !t.Completed {
+		return time.Time{}
+	}
+	completed, _ := time.Parse(models.DateLayout, t.CompletedOn)
+	return completed
+}
+
+// Projects returns the projects of the task, without their +.
+func (t Task) Projects() []string {
+	return t.tagged('+')
+}
+
+// Contexts returns the contexts of the task, without their @.
+func (t Task) Contexts() []string {
+	return t.tagged('@')
+}
+
+// tagged returns the words of the description starting with mark, without it.
+func (t Task) tagged(mark byte) []string {
+	var names []string
+	for _, word := range strings.Fields(t.Description) {
+		if len(word) > 1 && word[0] == mark {
+			names = append(names, word[1:])
+		}
+	}
+	return names
+}
+
+// Extension returns the value of the task's first key:value extension with
+// the given key.
+func (t Task) Extension(key string) (string, bool) {
+	for _, word := range strings.Fields(t.Description) {
+		if k, v, ok := strings.Cut(word, ":"); ok && k == key && v != "" {
+			return v, true
+		}
+	}
+	return "", false
+}
+
+// extensions lists the keys of the extensions todos map onto.
+var extensions = []string{"id", "parent", "due", "at", "tz", "rec", "rrule", "pri"}
+
+// priorities maps the priorities of todos to task priorities, most urgent
+// first; the letters after D are all low.
+var priorities = map[models.Priority]byte{
+	models.PriorityUrgent: 'A',
+	models.PriorityHigh:   'B',
+	models.PriorityMedium: 'C',
+	models.PriorityLow:    'D',
+}
+
+// Todo returns the todo the task describes, with the name of its list: its
+// first project, or empty if it has none. Its title is the description
+// without the projects, contexts and extensions it maps onto. The values of
+// its fields are not validated, beyond the IDs having to be numbers. A todo
+// has no completion date, see CompletedAt.
+func (t Task) Todo() (models.Todo, string, error) {
+	todo := models.Todo{Completed: t.Completed, Tags: []models.Tag{}}
+	if created, err := time.Parse(models.DateLayout, t.CreatedOn); err == nil {
+		todo.CreatedAt = created
+	}
+	todo.Priority = letterPriority(t.Priority)
+
+	var list string
+	var title []string
+	var err error // The first invalid ID, if any
+	due := models.Due{}
+	for _, word := range strings.Fields(t.Description) {
+		key, value, _ := strings.Cut(word, ":")
+		switch {
+		case len(word) > 1 && word[0] == '+' && list == "":
+			list = word[1:]
+		case len(word) > 1 && (word[0] == '+' || word[0] == '@'):
+			todo.Tags = append(todo.Tags, models.Tag{Name: word[1:]})
+		case value == "" || !isExtension(key):
+			title = append(title, word)
+		case key == "id" || key == "parent":
+			id, e := strconv.Atoi(value)
+			if e != nil && err == nil {
+				err = errors.New("Invalid " + key + ":" + value)
+			}
+			if key == "id" {
+				todo.ID = id
+			} else {
+				todo.ParentID = id
+			}
+		case key == "due":
+			due.Date = value
+		case key == "at":
+			due.Time = value
+		case key == "tz":
+			due.TZ = value
+		case key == "rec":
+			todo.Recur = recRule(value)
+		case key == "rrule":
+			todo.Recur = value
+		case key == "pri" && len(value) == 1:
+			todo.Priority = letterPriority(value[0])
+		}
+	}
+	if due != (models.Due{}) {
+		todo.Due = &due
+	}
+	todo.Title = strings.Join(title, " ")
+	return todo, list, err
+}
+
+// FromTodo returns the task describing a todo of the named list. The day
+// a completed todo was completed on is only known from completedAt; when
+// it is zero, the day the todo was created on stands in for it, as a
+// creation date needs a completion date before it.
+func FromTodo(todo models.Todo, list string, completedAt time.Time) Task {
+	t := Task{Completed: todo.Completed}
+	if !todo.CreatedAt.IsZero() {
+		t.CreatedOn = todo.CreatedAt.UTC().Format(models.DateLayout)
+	}
+	if todo.Completed && !completedAt.IsZero() {
+		t.CompletedOn = completedAt.UTC().Format(models.DateLayout)
+	} else if todo.Completed {
+		t.CompletedOn = t.CreatedOn
+	}
+	letter := priorities[todo.Priority]
+	if !todo.Completed {
+		t.Priority = letter
+	}
+
+	words := strings.Fields(todo.Title)
+	if list != "" {
+		words = append(words, "+"+ProjectName(list))
+	}
+	for _, tag := range todo.Tags {
+		words = append(words, "@"+tag.Name)
+	}
+	if todo.Due != nil {
+		words = append(words, "due:"+todo.Due.Date)
+		if todo.Due.Time != "" {
+			words = append(words, "at:"+todo.Due.Time, "tz:"+todo.Due.TZ)
+		}
+	}
+	if todo.Recur != "" {
+		if rec, ok := ruleRec(todo.Recur); ok {
+			words = append(words, "rec:"+rec)
+		} else {
+			words = append(words, "rrule:"+todo.Recur)
+		}
+	}
+	if todo.Completed && letter != 0 {
+		words = append(words, "pri:"+string(letter))
+	}
+	if todo.ID != 0 {
+		words = append(words, "id:"+strconv.Itoa(todo.ID))
+	}
+	if todo.ParentID != 0 {
+		words = append(words, "parent:"+strconv.Itoa(todo.ParentID))
+	}
+	t.Description = strings.Join(words, " ")
+	return t
+}
+
+// ProjectName returns the project a list's name is written as: the name
+// with its spaces, which a project can't contain, turned into underscores.
+func ProjectName(list string) string {
+	return strings.Join(strings.Fields(list), "_")
+}
+
+// isExtension reports whether key is that of an extension todos map onto.
+func isExtension(key string) bool {
+	for _, k := range extensions {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// letterPriority returns the priority of a todo with the task priority
+// letter, 0 meaning none.
+func letterPriority(letter byte) models.Priority {
+	for p, l := range priorities {
+		if l == letter {
+			return p
+		}
+	}
+	if letter > 'D' && letter <= 'Z' {
+		return models.PriorityLow
+	}
+	return models.PriorityNone
+}
+
+// recUnits are the units of a rec: extension, in the order of recur.Freq.
+const recUnits = "dwmy"
+
+// recRule returns the recurrence rule of a rec: extension such as "+2w".
+// Values it doesn't understand are returned as they are, to be rejected as
+// a rule.
+func recRule(rec string) string {
+	value := strings.TrimPrefix(rec, "+")
+	if value == "" {
+		return rec
+	}
+	freq := strings.IndexByte(recUnits, value[len(value)-1])
+	interval := 1
+	if n := value[:len(value)-1]; n != "" {
+		var err error
+		if interval, err = strconv.Atoi(n); err != nil || interval < 1 {
+			return rec
+		}
+	}
+	if freq < 0 {
+		return rec
+	}
+	return recur.Rule{Freq: recur.Freq(freq), Interval: interval}.String()
+}
+
+// ruleRec returns the rec: extension of a recurrence rule, if the rule is
+// simple enough to have one. The + marks recurrences that follow the due
+// date, as todos' do, rather than the day of completion.
+func ruleRec(rule string) (string, bool) {
+	r, err := recur.Parse(rule)
+	if err != nil || r.Count > 0 || !r.Until.IsZero() || len(r.ByDay) > 0 || len(r.ByMonthDay) > 0 || len(r.ByMonth) > 0 {
+		return "", false
+	}
+	return "+" + strconv.Itoa(max(r.Interval, 1)) + string(recUnits[r.Freq]), true
+}
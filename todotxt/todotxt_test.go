@@ -0,0 +1,204 @@
+package todotxt
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Tottitov/todo/models"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		line string
+		want Task
+	}{
+		{"Call mom", Task{Description: "Call mom"}},
+		{"(A) 2025-03-01 File taxes +Admin", Task{Priority: 'A', CreatedOn: "2025-03-01", Description: "File taxes +Admin"}},
+		{"x 2026-10-01 2026-09-30 Done thing", Task{Completed: true, CompletedOn: "2026-10-01", CreatedOn: "2026-09-30", Description: "Done thing"}},
+		{"x 2026-10-01 Done thing", Task{Completed: true, CompletedOn: "2026-10-01", Description: "Done thing"}},
+		// A completed task has no priority, and an open one no completion date
+		{"x (A) Done thing", Task{Completed: true, Description: "(A) Done thing"}},
+		{"2025-03-01 2025-03-02 Twice dated", Task{CreatedOn: "2025-03-01", Description: "2025-03-02 Twice dated"}},
+		{"(a) Lower case", Task{Description: "(a) Lower case"}},
+		{"xylophone lesson", Task{Description: "xylophone lesson"}},
+		{"  spaced   out  ", Task{Description: "spaced out"}},
+	}
+	for _, tt := range tests {
+		if got := Parse(tt.line); got != tt.want {
+			t.Errorf("Parse(%q) = %+v, want %+v", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestString(t *testing.T) {
+	tests := []struct {
+		task Task
+		want string
+	}{
+		{Task{Description: "Call mom"}, "Call mom"},
+		{Task{Priority: 'A', CreatedOn: "2025-03-01", Description: "File taxes"}, "(A) 2025-03-01 File taxes"},
+		{Task{Completed: true, Priority: 'A', Description: "Done thing"}, "x Done thing"},
+		{Task{Completed: true, CompletedOn: "2026-10-01", CreatedOn: "2026-09-30", Description: "Done thing"},
+			"x 2026-10-01 2026-09-30 Done thing"},
+		{Task{Completed: true, CompletedOn: "2026-10-01", Description: "Done thing"}, "x 2026-10-01 Done thing"},
+		// The creation date needs a completion date before it
+		{Task{Completed: true, CreatedOn: "2026-09-30", Description: "Done thing"}, "x 2026-09-30 2026-09-30 Done thing"},
+		{Task{CompletedOn: "2026-10-01", CreatedOn: "2026-09-30", Description: "Open"}, "2026-09-30 Open"},
+	}
+	for _, tt := range tests {
+		got := tt.task.String()
+		if got != tt.want {
+			t.Errorf("%+v.String() = %q, want %q", tt.task, got, tt.want)
+		}
+		// Whatever is written reads back the same
+		if again := Parse(got).String(); again != got {
+			t.Errorf("Parse(%q).String() = %q", got, again)
+		}
+	}
+}
+
+func TestTaskTodo(t *testing.T) {
+	tests := []struct {
+		line    string
+		want    models.Todo
+		list    string
+		wantErr bool
+	}{
+		{
+			line: "Call mom",
+			want: models.Todo{Title: "Call mom", Tags: []models.Tag{}},
+		},
+		{
+			line: "(B) 2025-03-01 Call mom +Family +Calls @phone due:2025-03-09 at:09:30 tz:Europe/Paris rec:+2w id:12 https://example.com",
+			want: models.Todo{
+				ID:        12,
+				Title:     "Call mom https://example.com",
+				Priority:  models.PriorityHigh,
+				Due:       &models.Due{Date: "2025-03-09", Time: "09:30", TZ: "Europe/Paris"},
+				Tags:      []models.Tag{{Name: "Calls"}, {Name: "phone"}},
+				Recur:     "FREQ=WEEKLY;INTERVAL=2",
+				CreatedAt: time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC),
+			},
+			list: "Family",
+		},
+		{
+			line: "x 2026-10-01 2026-09-30 Done thing pri:E parent:7 rrule:FREQ=MONTHLY;BYMONTHDAY=-1",
+			want: models.Todo{
+				ParentID:  7,
+				Title:     "Done thing",
+				Completed: true,
+				Priority:  models.PriorityLow,
+				Tags:      []models.Tag{},
+				Recur:     "FREQ=MONTHLY;BYMONTHDAY=-1",
+				CreatedAt: time.Date(2026, 9, 30, 0, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			line: "Keys with no value: stay id:",
+			want: models.Todo{Title: "Keys with no value: stay id:", Tags: []models.Tag{}},
+		},
+		{
+			line:    "Bad id:twelve",
+			want:    models.Todo{Title: "Bad", Tags: []models.Tag{}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		got, list, err := Parse(tt.line).Todo()
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Parse(%q).Todo() error = %v, want error %v", tt.line, err, tt.wantErr)
+		}
+		if !reflect.DeepEqual(got, tt.want) || list != tt.list {
+			t.Errorf("Parse(%q).Todo() = %+v, %q, want %+v, %q", tt.line, got, list, tt.want, tt.list)
+		}
+	}
+}
+
+func TestCompletedAt(t *testing.T) {
+	tests := []struct {
+		line string
+		want time.Time
+	}{
+		{"x 2026-10-01 2026-09-30 Done thing", time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)},
+		{"x Done thing", time.Time{}},
+		{"2026-09-30 Open", time.Time{}},
+	}
+	for _, tt := range tests {
+		if got := Parse(tt.line).CompletedAt(); !got.Equal(tt.want) {
+			t.Errorf("Parse(%q).CompletedAt() = %v, want %v", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestFromTodo(t *testing.T) {
+	created := time.Date(2026, 9, 30, 22, 0, 0, 0, time.UTC)
+	completed := time.Date(2026, 10, 1, 8, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name        string
+		todo        models.Todo
+		list        string
+		completedAt time.Time
+		want        string
+	}{
+		{
+			name: "open",
+			todo: models.Todo{ID: 3, Title: "Call mom", Priority: models.PriorityUrgent, CreatedAt: created,
+				Due: &models.Due{Date: "2025-03-09"}, Tags: []models.Tag{{Name: "phone"}}, Recur: "FREQ=DAILY"},
+			list: "Family Stuff",
+			want: "(A) 2026-09-30 Call mom +Family_Stuff @phone due:2025-03-09 rec:+1d id:3",
+		},
+		{
+			name:        "completed",
+			todo:        models.Todo{ID: 15, Title: "Done thing", Completed: true, CreatedAt: created},
+			list:        "Inbox",
+			completedAt: completed,
+			want:        "x 2026-10-01 2026-09-30 Done thing +Inbox id:15",
+		},
+		{
+			name: "completed on an unknown day",
+			todo: models.Todo{ID: 15, Title: "Done thing", Completed: true, CreatedAt: created},
+			list: "Inbox",
+			want: "x 2026-09-30 2026-09-30 Done thing +Inbox id:15",
+		},
+		{
+			name: "completed with a priority and a timed due date",
+			todo: models.Todo{ID: 4, ParentID: 3, Title: "Sub", Completed: true, Priority: models.PriorityHigh,
+				Due: &models.Due{Date: "2025-03-09", Time: "09:30", TZ: "UTC"}, Recur: "FREQ=MONTHLY;BYMONTHDAY=-1"},
+			completedAt: completed,
+			want:        "x 2026-10-01 Sub due:2025-03-09 at:09:30 tz:UTC rrule:FREQ=MONTHLY;BYMONTHDAY=-1 pri:B id:4 parent:3",
+		},
+	}
+	for _, tt := range tests {
+		task := FromTodo(tt.todo, tt.list, tt.completedAt)
+		if got := task.String(); got != tt.want {
+			t.Errorf("%s: FromTodo() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+// TestRoundTrip checks that a todo written as a line reads back as it was,
+// and a line read as a todo is written back as it was.
+func TestRoundTrip(t *testing.T) {
+	lines := []string{
+		"x 2026-10-01 2026-09-30 Done thing +Inbox id:15",
+		"(A) 2026-09-30 Call mom +Family @phone @calls due:2025-03-09 at:09:30 tz:Europe/Paris rec:+2w id:3",
+		"(D) 2026-09-30 Water plants +Home rrule:FREQ=WEEKLY;BYDAY=MO,TH id:4 parent:3",
+		"x 2026-10-01 2026-09-30 Filed +Admin pri:C id:5",
+	}
+	for _, line := range lines {
+		task := Parse(line)
+		todo, list, err := task.Todo()
+		if err != nil {
+			t.Fatalf("Parse(%q).Todo(): %v", line, err)
+		}
+		got := FromTodo(todo, list, task.CompletedAt())
+		if got.String() != line {
+			t.Errorf("round trip of %q = %q", line, got)
+		}
+		again, againList, _ := Parse(got.String()).Todo()
+		if !reflect.DeepEqual(again, todo) || againList != list {
+			t.Errorf("round trip of %q: todo %+v, want %+v", line, again, todo)
+		}
+	}
+}
@@ -0,0 +1,297 @@
+package transfer
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Tottitov/todo/ical"
+	"github.com/Tottitov/todo/models"
+)
+
+// An iCalendar file is a VCALENDAR holding a VTODO per record, which maps
+// the fields of a todo onto these properties:
+//
+//	UID          todo-12@host, the ID of the todo
+//	RELATED-TO   the UID of its parent, if it is a subtask
+//	SUMMARY      its title
+//	DESCRIPTION  its notes
+//	STATUS       COMPLETED, or NEEDS-ACTION if it is open
+//	PRIORITY     1 for urgent, 3 high, 5 medium and 9 low, none if missing
+//	DUE          its due date, all day or at a time, given in UTC with
+//	             the time zone it was set in as the X-TODO-TZ parameter
+//	RRULE        its repeat rule
+//	CATEGORIES   its tags
+//	X-TODO-LIST  the name of its list
+//	CREATED      when it was created
+//
+// A file from another app imports as long as its VTODOs have a SUMMARY;
+// their UIDs are new to the user, so they are created.
+
+// icsProdID identifies the app that made an iCalendar file.
+const icsProdID = "-//Tottitov//Todo//EN"
+
+// icsPriorities maps priorities to the PRIORITY of a VTODO, 1 the highest
+// and 9 the lowest.
+var icsPriorities = map[models.Priority]int{
+	models.PriorityUrgent: 1,
+	models.PriorityHigh:   3,
+	models.PriorityMedium: 5,
+	models.PriorityLow:    9,
+}
+
+// uidPattern matches the UIDs of exported todos, capturing the ID.
+var uidPattern = regexp.MustCompile(`^todo-(\d+)@`)
+
+// uid returns the UID of the todo with the given ID.
+func (w *Writer) uid(id int) string {
+	return "todo-" + strconv.Itoa(id) + "@" + w.Host
+}
+
+// beginICS writes the start of the calendar.
+func (w *Writer) beginICS() error {
+	w.ics.Begin("VCALENDAR")
+	w.ics.Write(ical.Property{Name: "VERSION", Value: "2.0"})
+	w.ics.Write(ical.Property{Name: "PRODID", Value: icsProdID})
+	w.ics.Write(ical.Property{Name: "CALSCALE", Value: "GREGORIAN"})
+	w.ics.Write(ical.Property{Name: "X-WR-CALNAME", Value: "Todos"})
+	return w.ics.Flush()
+}
+
+// writeICS writes the VTODO of a record and, if asked for, the VEVENT of
+// its due date.
+func (w *Writer) writeICS(rec Record) error {
+	prop := func(name, value string) {
+		w.ics.Write(ical.Property{Name: name, Value: value})
+	}
+	stamp := time.Now().UTC().Format(ical.UTCLayout)
+
+	w.ics.Begin("VTODO")
+	prop("UID", w.uid(rec.ID))
+	prop("DTSTAMP", stamp)
+	if !rec.CreatedAt.IsZero() {
+		prop("CREATED", rec.CreatedAt.UTC().Format(ical.UTCLayout))
+	}
+	prop("SUMMARY", ical.EscapeText(rec.Title))
+	if rec.Notes != "" {
+		prop("DESCRIPTION", ical.EscapeText(rec.Notes))
+	}
+	if rec.Completed {
+		prop("STATUS", "COMPLETED")
+		if !rec.CompletedAt.IsZero() {
+			prop("COMPLETED", rec.CompletedAt.UTC().Format(ical.UTCLayout))
+		}
+	} else {
+		prop("STATUS", "NEEDS-ACTION")
+	}
+	priority, _ := models.ParsePriority(rec.Priority)
+	if n, ok := icsPriorities[priority]; ok {
+		prop("PRIORITY", strconv.Itoa(n))
+	}
+	if rec.Due != nil {
+		w.ics.Write(icsDue("DUE", *rec.Due))
+		if rec.Recur != "" {
+			// Clients repeat a todo from its start, so make that the due date
+			w.ics.Write(icsDue("DTSTART", *rec.Due))
+		}
+	}
+	if rec.Recur != "" {
+		prop("RRULE", rec.Recur)
+	}
+	if len(rec.Tags) > 0 {
+		tags := make([]string, len(rec.Tags))
+		for i, name := range rec.Tags {
+			tags[i] = ical.EscapeText(name)
+		}
+		prop("CATEGORIES", strings.Join(tags, ","))
+	}
+	if rec.ParentID != 0 {
+		prop("RELATED-TO", w.uid(rec.ParentID))
+	}
+	if rec.List != "" {
+		prop("X-TODO-LIST", ical.EscapeText(rec.List))
+	}
+	w.ics.End("VTODO")
+
+	// Calendars that only show events show open todos on their due date
+	if w.Events && rec.Due != nil && !rec.Completed {
+		w.ics.Begin("VEVENT")
+		prop("UID", "todo-"+strconv.Itoa(rec.ID)+"-due@"+w.Host)
+		prop("DTSTAMP", stamp)
+		prop("SUMMARY", ical.EscapeText(rec.Title))
+		if rec.Notes != "" {
+			prop("DESCRIPTION", ical.EscapeText(rec.Notes))
+		}
+		w.ics.Write(icsDue("DTSTART", *rec.Due))
+		if rec.Recur != "" {
+			prop("RRULE", rec.Recur)
+		}
+		prop("TRANSP", "TRANSPARENT")
+		w.ics.End("VEVENT")
+	}
+	return w.ics.Flush()
+}
+
+// icsDue returns the property of a due date: a date, or the instant of a
+// timed one in UTC, which needs no VTIMEZONE, with its own time zone kept
+// as a parameter for imports.
+func icsDue(name string, due models.Due) ical.Property {
+	date, _ := time.Parse(models.DateLayout, due.Date)
+	at, ok := due.At()
+	if !ok {
+		return ical.Property{Name: name, Params: map[string]string{"VALUE": "DATE"}, Value: date.Format(ical.DateLayout)}
+	}
+	p := ical.Property{Name: name, Value: at.UTC().Format(ical.UTCLayout)}
+	if due.TZ != "UTC" {
+		p.Params = map[string]string{"X-TODO-TZ": due.TZ}
+	}
+	return p
+}
+
+// closeICS ends the calendar.
+func (w *Writer) closeICS() error {
+	w.ics.End("VCALENDAR")
+	return w.ics.Flush()
+}
+
+// readICS reads the VTODOs of the calendars in an iCalendar file, numbered
+// in the order of the file. Other components are ignored.
+func readICS(r io.Reader) ([]Row, error) {
+	components, err := ical.Parse(r)
+	if err != nil {
+		return nil, fmt.Errorf("The iCalendar file is malformed: %v", err)
+	}
+	var rows []Row
+	calendar := false
+	for _, cal := range components {
+		if cal.Name != "VCALENDAR" {
+			continue
+		}
+		calendar = true
+		for _, c := range cal.Components {
+			if c.Name != "VTODO" {
+				continue
+			}
+			row := Row{Number: len(rows) + 1}
+			row.Record, row.Err = icsRecord(c)
+			rows = append(rows, row)
+		}
+	}
+	if !calendar {
+		return nil, errors.New("The file must hold an iCalendar VCALENDAR")
+	}
+	return rows, nil
+}
+
+// icsRecord reads a record from a VTODO.
+func icsRecord(c ical.Component) (Record, error) {
+	text := func(name string) string {
+		p, _ := c.Get(name)
+		return p.Text()
+	}
+	rec := Record{
+		ID:    uidID(text("UID")),
+		Title: text("SUMMARY"),
+		Notes: text("DESCRIPTION"),
+		List:  text("X-TODO-LIST"),
+		Tags:  []string{},
+	}
+	for _, p := range c.All("RELATED-TO") {
+		if reltype := strings.ToUpper(p.Param("RELTYPE")); reltype == "" || reltype == "PARENT" {
+			rec.ParentID = uidID(p.Text())
+		}
+	}
+
+	// A todo is completed by its STATUS, or by the time of its completion
+	// when it has no STATUS
+	_, completedAt := c.Get("COMPLETED")
+	switch strings.ToUpper(text("STATUS")) {
+	case "COMPLETED":
+		rec.Completed = true
+	case "":
+		rec.Completed = completedAt
+	}
+	if p, ok := c.Get("PRIORITY"); ok {
+		n, err := strconv.Atoi(strings.TrimSpace(p.Value))
+		if err != nil || n < 0 || n > 9 {
+			return rec, errors.New("Invalid PRIORITY, must be 0 to 9")
+		}
+		rec.Priority = icsPriority(n).String()
+	}
+	if p, ok := c.Get("DUE"); ok {
+		due, err := recordDue(p)
+		if err != nil {
+			return rec, fmt.Errorf("Invalid DUE: %v", err)
+		}
+		rec.Due = due
+	}
+	if p, ok := c.Get("RRULE"); ok {
+		rec.Recur = p.Value
+	}
+	for _, p := range c.All("CATEGORIES") {
+		for _, name := range p.TextList() {
+			if name = strings.TrimSpace(name); name != "" {
+				rec.Tags = append(rec.Tags, name)
+			}
+		}
+	}
+	if p, ok := c.Get("CREATED"); ok {
+		if created, _, err := p.Time(); err == nil {
+			rec.CreatedAt = created.UTC()
+		}
+	}
+	return rec, nil
+}
+
+// uidID returns the ID of the todo a UID was exported from, 0 if it wasn't.
+func uidID(uid string) int {
+	m := uidPattern.FindStringSubmatch(uid)
+	if m == nil {
+		return 0
+	}
+	id, _ := strconv.Atoi(m[1])
+	return id
+}
+
+// icsPriority returns the priority a VTODO's PRIORITY stands for, 0 being
+// none and 1 to 9 running from urgent to low.
+func icsPriority(n int) models.Priority {
+	switch {
+	case n == 0:
+		return models.PriorityNone
+	case n == 1:
+		return models.PriorityUrgent
+	case n <= 4:
+		return models.PriorityHigh
+	case n == 5:
+		return models.PriorityMedium
+	}
+	return models.PriorityLow
+}
+
+// recordDue returns the due date of a DUE property: a date, or a time in
+// the time zone of its X-TODO-TZ or TZID parameter, UTC without either.
+func recordDue(p ical.Property) (*models.Due, error) {
+	t, dateOnly, err := p.Time()
+	if err != nil {
+		return nil, err
+	}
+	if dateOnly {
+		return &models.Due{Date: t.Format(models.DateLayout)}, nil
+	}
+	tz := "UTC"
+	if name := p.Param("X-TODO-TZ"); name != "" {
+		loc, err := time.LoadLocation(name)
+		if err != nil {
+			return nil, fmt.Errorf("unknown time zone %s", name)
+		}
+		t, tz = t.In(loc), name
+	} else if name := p.Param("TZID"); name != "" {
+		tz = name
+	}
+	return &models.Due{Date: t.Format(models.DateLayout), Time: t.Format(models.ClockLayout), TZ: tz}, nil
+}
@@ -0,0 +1,212 @@
+package transfer
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Tottitov/todo/models"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// dtstamp matches the time an iCalendar file was written, which differs
+// from run to run.
+var dtstamp = regexp.MustCompile(`(?m)^DTSTAMP:\d{8}T\d{6}Z\r$`)
+
+// icsRecords are records of every kind an iCalendar file carries.
+var icsRecords = []Record{
+	{
+		ID:        1,
+		List:      "Inbox",
+		Title:     "Buy milk, eggs; bread",
+		Notes:     "Two of each\nfrom the market",
+		Priority:  "high",
+		Due:       &models.Due{Date: "2026-10-20"},
+		Tags:      []string{"shop", "food, fresh"},
+		CreatedAt: time.Date(2026, 10, 1, 8, 0, 0, 0, time.UTC),
+	},
+	{
+		ID:       2,
+		List:     "Home",
+		Title:    "Water plants",
+		Priority: "none",
+		Due:      &models.Due{Date: "2026-10-20", Time: "09:30", TZ: "Europe/Paris"},
+		Tags:     []string{},
+		Recur:    "FREQ=WEEKLY;BYDAY=MO,TH",
+	},
+	{
+		ID:          3,
+		List:        "Inbox",
+		ParentID:    1,
+		Title:       "Check the date",
+		Completed:   true,
+		CompletedAt: time.Date(2026, 10, 5, 10, 0, 0, 0, time.UTC),
+		Priority:    "urgent",
+		Tags:        []string{},
+	},
+	{
+		ID:       4,
+		List:     "Work stuff",
+		Title:    "A title long enough that its line has to be folded at 75 octets, with é",
+		Priority: "low",
+		Due:      &models.Due{Date: "2026-10-21", Time: "18:00", TZ: "UTC"},
+		Tags:     []string{},
+		Recur:    "FREQ=MONTHLY;BYDAY=-1FR",
+	},
+}
+
+// writeICS returns records written as an iCalendar file, with events for
+// their due dates if events is set, and the time it was written blanked.
+func writeICS(t *testing.T, records []Record, events bool) []byte {
+	t.Helper()
+	var b bytes.Buffer
+	w := NewWriter(&b, FormatICS)
+	w.Host, w.Events = "todo.example.com", events
+	for _, rec := range records {
+		if err := w.Write(rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return dtstamp.ReplaceAll(b.Bytes(), []byte("DTSTAMP:\r"))
+}
+
+// golden compares got with the golden file testdata/name, or rewrites the
+// file with -update.
+func golden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", name)
+	if *update {
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s differs:\n%s\nwant:\n%s", name, got, want)
+	}
+}
+
+func TestWriteICS(t *testing.T) {
+	golden(t, "export.ics", writeICS(t, icsRecords, false))
+	golden(t, "feed.ics", writeICS(t, icsRecords, true))
+	golden(t, "empty.ics", writeICS(t, nil, false))
+}
+
+func TestReadICS(t *testing.T) {
+	f, err := os.Open(filepath.Join("testdata", "import.ics"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	rows, err := Read(f, FormatICS)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Record{
+		{
+			Title: "Call the bank, then the insurance",
+			Notes: "Ask about:\nthe fees; and the rate",
+			Due:   &models.Due{Date: "2026-10-20", Time: "09:30", TZ: "America/New_York"},
+			Tags:  []string{},
+		},
+		{
+			ID:        7,
+			List:      "Bills, and more",
+			Title:     "Pay rent",
+			Completed: true,
+			Priority:  "high",
+			Due:       &models.Due{Date: "2026-10-31"},
+			Tags:      []string{},
+			Recur:     "FREQ=MONTHLY;BYMONTHDAY=-1",
+			CreatedAt: time.Date(2026, 9, 1, 12, 0, 0, 0, time.UTC),
+		},
+		{
+			ID:       8,
+			ParentID: 7,
+			Title:    "Check the statement",
+			Priority: "low",
+			Due:      &models.Due{Date: "2026-10-22", Time: "15:00", TZ: "UTC"},
+			Tags:     []string{"money", "home", "paper,work"},
+		},
+		{
+			ID:        10,
+			Title:     "Breakfast meeting",
+			Completed: true,
+			Priority:  "none",
+			Due:       &models.Due{Date: "2026-10-20", Time: "09:30", TZ: "Asia/Tokyo"},
+			Tags:      []string{},
+		},
+	}
+	if len(rows) != len(want)+1 {
+		t.Fatalf("read %d rows, want %d", len(rows), len(want)+1)
+	}
+	for i, rec := range want {
+		row := rows[i]
+		if row.Number != i+1 || row.Err != nil {
+			t.Errorf("row %d: number %d, error %v", i+1, row.Number, row.Err)
+		}
+		if !reflect.DeepEqual(row.Record, rec) {
+			t.Errorf("row %d = %+v, want %+v", i+1, row.Record, rec)
+		}
+	}
+	if last := rows[len(want)]; last.Err == nil || last.Record.Title != "Too important" {
+		t.Errorf("row with an invalid PRIORITY: %+v, want an error", last)
+	}
+}
+
+func TestReadICSErrors(t *testing.T) {
+	for _, data := range []string{
+		"",
+		"BEGIN:VTODO\nSUMMARY:No calendar\nEND:VTODO\n",
+		"BEGIN:VCALENDAR\nBEGIN:VTODO\nEND:VCALENDAR\n",
+	} {
+		if _, err := Read(strings.NewReader(data), FormatICS); err == nil {
+			t.Errorf("Read(%q) succeeded", data)
+		}
+	}
+
+	rows, err := Read(strings.NewReader("BEGIN:VCALENDAR\nBEGIN:VTODO\nSUMMARY:x\nDUE;TZID=Nowhere/Special:20261020T093000\nEND:VTODO\nEND:VCALENDAR\n"), FormatICS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 || rows[0].Err == nil {
+		t.Errorf("a DUE in an unknown time zone read as %+v", rows)
+	}
+}
+
+// TestICSRoundTrip reads back a file it wrote, which has to give back the
+// records but for what the format leaves out: list colors, positions and
+// completion times, and the priority of todos without one.
+func TestICSRoundTrip(t *testing.T) {
+	rows, err := Read(bytes.NewReader(writeICS(t, icsRecords, true)), FormatICS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != len(icsRecords) {
+		t.Fatalf("read %d rows, want %d", len(rows), len(icsRecords))
+	}
+	for i, row := range rows {
+		want := icsRecords[i]
+		want.CompletedAt = time.Time{}
+		if want.Priority == "none" {
+			want.Priority = ""
+		}
+		if row.Err != nil || !reflect.DeepEqual(row.Record, want) {
+			t.Errorf("row %d = %+v, %v, want %+v", i+1, row.Record, row.Err, want)
+		}
+	}
+}
@@ -0,0 +1,432 @@
+// Package transfer reads and writes todos in the formats they are exported
+// and imported in: JSON, an array of records, and CSV, a header row followed
+// by a row per record. Both carry every field of a todo, so an export
+// imports back without loss. The todo.txt format, a task per line, carries
+// all but the notes and position of a todo, see package todotxt, and
+// iCalendar, a VTODO per todo, all but the position and the list's color.
+//
+// Records are only parsed here, not validated: a record may name a list
+// that doesn't exist or carry an unknown priority, which the importer
+// reports.
+package transfer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Tottitov/todo/ical"
+	"github.com/Tottitov/todo/models"
+	"github.com/Tottitov/todo/todotxt"
+)
+
+// Formats todos are exported and imported in.
+const (
+	FormatJSON    = "json"
+	FormatCSV     = "csv"
+	FormatTodoTxt = "todotxt"
+	FormatICS     = "ics"
+)
+
+// Formats lists every format, the default first.
+var Formats = []string{FormatJSON, FormatCSV, FormatTodoTxt, FormatICS}
+
+// ValidFormat reports whether format is one of Formats.
+func ValidFormat(format string) bool {
+	return slices.Contains(Formats, format)
+}
+
+// ContentType returns the media type of a format.
+func ContentType(format string) string {
+	switch format {
+	case FormatCSV:
+		return "text/csv; charset=utf-8"
+	case FormatTodoTxt:
+		return "text/plain; charset=utf-8"
+	case FormatICS:
+		return "text/calendar; charset=utf-8"
+	}
+	return "application/json"
+}
+
+// Extension returns the file name extension of a format, without the dot.
+func Extension(format string) string {
+	if format == FormatTodoTxt {
+		return "txt"
+	}
+	return format
+}
+
+// FormatOf returns the format a file name's extension stands for, or empty
+// if it stands for none.
+func FormatOf(name string) string {
+	ext := strings.ToLower(strings.TrimPrefix(path.Ext(name), "."))
+	for _, format := range Formats {
+		if Extension(format) == ext {
+			return format
+		}
+	}
+	return ""
+}
+
+// Record is a todo as exported and imported. Its list is named rather than
+// referred to by ID, so an export can be imported into another account; a
+// subtask's list is its parent's, and its List is ignored on import.
+type Record struct {
+	ID        int         `json:"id"`
+	List      string      `json:"list"`
+	ListColor string      `json:"list_color"`
+	ParentID  int         `json:"parent_id,omitempty"` // ID of the record's parent, if it is a subtask
+	Title     string      `json:"title"`
+	Notes     string      `json:"notes"`
+	Completed bool        `json:"completed"`
+	Priority  string      `json:"priority"` // Name of a models.Priority
+	Due       *models.Due `json:"due"`
+	Tags      []string    `json:"tags"`
+	Recur     string      `json:"recur"`
+	Position  string      `json:"position"`
+	CreatedAt time.Time   `json:"created_at,omitzero"` // Zero if unknown
+
+	// CompletedAt is when a completed todo was completed, zero if unknown.
+	// Only todo.txt, which dates the completion of a task, carries it both
+	// ways; an iCalendar file is only written with it.
+	CompletedAt time.Time `json:"-"`
+}
+
+// NewRecord returns the record of todo t in list.
+func NewRecord(t models.Todo, list models.List) Record {
+	return Record{
+		ID:        t.ID,
+		List:      list.Name,
+		ListColor: list.Color,
+		ParentID:  t.ParentID,
+		Title:     t.Title,
+		Notes:     t.Notes,
+		Completed: t.Completed,
+		Priority:  t.Priority.String(),
+		Due:       t.Due,
+		Tags:      models.TagNames(t.Tags),
+		Recur:     t.Recur,
+		Position:  t.Position,
+		CreatedAt: t.CreatedAt.UTC(),
+	}
+}
+
+// csvHeader names the columns of a CSV file. A due date takes three
+// columns, and tags are joined by commas.
+var csvHeader = []string{"id", "list", "list_color", "parent_id", "title", "notes", "completed", "priority",
+	"due_date", "due_time", "due_tz", "tags", "recur", "position", "created_at"}
+
+// Writer writes records to a file in one of the formats. Records are
+// written as they come, so an export of any size streams through it.
+type Writer struct {
+	// Host is the domain of the UIDs of iCalendar todos, which have to be
+	// unique the world over; localhost unless set
+	Host string
+	// Events has an iCalendar file give every open todo with a due date an
+	// event on it too, for calendars that don't show todos
+	Events bool
+
+	format string
+	w      io.Writer
+	csv    *csv.Writer
+	ics    *ical.Writer
+	n      int // Records written so far
+}
+
+// NewWriter returns a Writer of the given format to w. The CSV header, and
+// the opening of the JSON array, are written along with the first record,
+// or by Close if there is none, like the start of a calendar; a todo.txt
+// file has neither.
+func NewWriter(w io.Writer, format string) *Writer {
+	tw := &Writer{Host: "localhost", format: format, w: w}
+	switch format {
+	case FormatCSV:
+		tw.csv = csv.NewWriter(w)
+	case FormatICS:
+		tw.ics = ical.NewWriter(w)
+	}
+	return tw
+}
+
+// Write writes a record.
+func (w *Writer) Write(rec Record) error {
+	if w.n == 0 {
+		if err := w.begin(); err != nil {
+			return err
+		}
+	}
+	w.n++
+
+	switch w.format {
+	case FormatTodoTxt:
+		task := todotxt.FromTodo(rec.todo(), rec.List, rec.CompletedAt)
+		_, err := fmt.Fprintln(w.w, task)
+		return err
+	case FormatICS:
+		return w.writeICS(rec)
+	case FormatCSV:
+		due := models.Due{}
+		if rec.Due != nil {
+			due = *rec.Due
+		}
+		created := ""
+		if !rec.CreatedAt.IsZero() {
+			created = rec.CreatedAt.Format(time.RFC3339Nano)
+		}
+		return w.csv.Write([]string{
+			itoa(rec.ID), rec.List, rec.ListColor, itoa(rec.ParentID), rec.Title, rec.Notes,
+			strconv.FormatBool(rec.Completed), rec.Priority, due.Date, due.Time, due.TZ,
+			strings.Join(rec.Tags, ","), rec.Recur, rec.Position, created,
+		})
+	}
+
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	sep := ",\n"
+	if w.n == 1 {
+		sep = ""
+	}
+	_, err = fmt.Fprintf(w.w, "%s%s", sep, data)
+	return err
+}
+
+// Close finishes the file, flushing whatever is buffered. It doesn't close
+// the underlying writer.
+func (w *Writer) Close() error {
+	if w.n == 0 {
+		if err := w.begin(); err != nil {
+			return err
+		}
+	}
+	switch w.format {
+	case FormatCSV:
+		w.csv.Flush()
+		return w.csv.Error()
+	case FormatTodoTxt:
+		return nil
+	case FormatICS:
+		return w.closeICS()
+	}
+	_, err := io.WriteString(w.w, "\n]\n")
+	return err
+}
+
+// begin writes what comes before the first record.
+func (w *Writer) begin() error {
+	switch w.format {
+	case FormatCSV:
+		return w.csv.Write(csvHeader)
+	case FormatTodoTxt:
+		return nil
+	case FormatICS:
+		return w.beginICS()
+	}
+	_, err := io.WriteString(w.w, "[\n")
+	return err
+}
+
+// itoa formats an ID, leaving 0 blank.
+func itoa(id int) string {
+	if id == 0 {
+		return ""
+	}
+	return strconv.Itoa(id)
+}
+
+// Row is a record read from a file, numbered from 1 in the order of the
+// file, or the error it couldn't be read with.
+type Row struct {
+	Number int
+	Record Record
+	Err    error
+}
+
+// Read reads every record of a file in the given format. It fails if the
+// file as a whole can't be read; a record that can't be is returned as a
+// row with an error, so the others can still be imported.
+func Read(r io.Reader, format string) ([]Row, error) {
+	switch format {
+	case FormatCSV:
+		return readCSV(r)
+	case FormatTodoTxt:
+		return readTodoTxt(r)
+	case FormatICS:
+		return readICS(r)
+	}
+	return readJSON(r)
+}
+
+// readJSON reads a JSON array of records.
+func readJSON(r io.Reader) ([]Row, error) {
+	var raw []json.RawMessage
+	if err := json.NewDecoder(r).Decode(&raw); err != nil {
+		return nil, errors.New("The file must hold a JSON array of todos")
+	}
+	rows := make([]Row, len(raw))
+	for i, data := range raw {
+		rows[i].Number = i + 1
+		dec := json.NewDecoder(bytes.NewReader(data))
+		if err := dec.Decode(&rows[i].Record); err != nil {
+			rows[i].Err = jsonError(err)
+		}
+	}
+	return rows, nil
+}
+
+// jsonError describes why a record couldn't be decoded.
+func jsonError(err error) error {
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) && typeErr.Field != "" {
+		return fmt.Errorf("Invalid %s", typeErr.Field)
+	}
+	return errors.New("Invalid todo")
+}
+
+// readCSV reads a CSV file whose header row names its columns, in any
+// order. Unknown columns are ignored and missing ones left blank, but a
+// title column is required.
+func readCSV(r io.Reader) ([]Row, error) {
+	cr := csv.NewReader(r)
+	header, err := cr.Read()
+	if err != nil {
+		return nil, errors.New("The file must start with a CSV header row")
+	}
+	columns := make(map[string]int)
+	for i, name := range header {
+		// Spreadsheets may start the file with a byte order mark
+		name = strings.TrimPrefix(name, "\ufeff")
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := columns["title"]; !ok {
+		return nil, errors.New("The CSV header must have a title column")
+	}
+
+	var rows []Row
+	for {
+		fields, err := cr.Read()
+		if err == io.EOF {
+			return rows, nil
+		}
+		row := Row{Number: len(rows) + 1}
+		if err != nil && !errors.Is(err, csv.ErrFieldCount) {
+			return nil, fmt.Errorf("The CSV file is malformed: %v", err)
+		}
+		if err != nil {
+			row.Err = errors.New("Wrong number of columns")
+		} else {
+			row.Record, row.Err = csvRecord(columns, fields)
+		}
+		rows = append(rows, row)
+	}
+}
+
+// csvRecord reads a record from the fields of a CSV row.
+func csvRecord(columns map[string]int, fields []string) (Record, error) {
+	get := func(name string) string {
+		if i, ok := columns[name]; ok {
+			return fields[i]
+		}
+		return ""
+	}
+	rec := Record{
+		List:      get("list"),
+		ListColor: get("list_color"),
+		Title:     get("title"),
+		Notes:     get("notes"),
+		Priority:  get("priority"),
+		Recur:     get("recur"),
+		Position:  get("position"),
+	}
+
+	var err error
+	if rec.ID, err = atoi(get("id")); err != nil {
+		return rec, errors.New("Invalid id")
+	}
+	if rec.ParentID, err = atoi(get("parent_id")); err != nil {
+		return rec, errors.New("Invalid parent_id")
+	}
+	if v := get("completed"); v != "" {
+		if rec.Completed, err = strconv.ParseBool(v); err != nil {
+			return rec, errors.New("Invalid completed, must be true or false")
+		}
+	}
+	if date, clock, tz := get("due_date"), get("due_time"), get("due_tz"); date != "" || clock != "" || tz != "" {
+		rec.Due = &models.Due{Date: date, Time: clock, TZ: tz}
+	}
+	rec.Tags = []string{}
+	for _, name := range strings.Split(get("tags"), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			rec.Tags = append(rec.Tags, name)
+		}
+	}
+	if v := get("created_at"); v != "" {
+		if rec.CreatedAt, err = time.Parse(time.RFC3339Nano, v); err != nil {
+			return rec, errors.New("Invalid created_at, must look like 2006-01-02T15:04:05Z")
+		}
+	}
+	return rec, nil
+}
+
+// readTodoTxt reads a todo.txt file, whose rows are numbered by line.
+// Blank lines are skipped.
+func readTodoTxt(r io.Reader) ([]Row, error) {
+	var rows []Row
+	sc := bufio.NewScanner(r)
+	sc.Buffer(nil, 1<<20)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimPrefix(sc.Text(), "\ufeff")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		row := Row{Number: n}
+		task := todotxt.Parse(line)
+		t, list, err := task.Todo()
+		row.Record, row.Err = NewRecord(t, models.List{Name: list}), err
+		row.Record.CompletedAt = task.CompletedAt()
+		rows = append(rows, row)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, errors.New("The todo.txt file can't be read, its lines may be too long")
+	}
+	return rows, nil
+}
+
+// todo returns the todo a record describes, as far as a todo.txt line needs.
+func (rec Record) todo() models.Todo {
+	priority, _ := models.ParsePriority(rec.Priority)
+	tags := make([]models.Tag, len(rec.Tags))
+	for i, name := range rec.Tags {
+		tags[i] = models.Tag{Name: name}
+	}
+	return models.Todo{
+		ID:        rec.ID,
+		ParentID:  rec.ParentID,
+		Title:     rec.Title,
+		Completed: rec.Completed,
+		Priority:  priority,
+		Due:       rec.Due,
+		Tags:      tags,
+		Recur:     rec.Recur,
+		CreatedAt: rec.CreatedAt,
+	}
+}
+
+// atoi parses an ID, a blank one being 0.
+func atoi(s string) (int, error) {
+	if s = strings.TrimSpace(s); s == "" {
+		return 0, nil
+	}
+	return strconv.Atoi(s)
+}